@@ -0,0 +1,337 @@
+package lake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// Index export format: newline-delimited JSON, one record per line.
+//
+//	{"format":"lake-index","version":1,"exportedAt":<unix>}
+//	{"kind":"catalog","catalog":..,"snap":..,"removeGen":..,"alloc":..}
+//	{"kind":"deltas","catalog":..,"deltas":[{"m":member,"s":score},...]}
+//	...
+//	{"kind":"end","catalogs":N,"deltaCount":M}
+//
+// A catalog record is followed by zero or more deltas records for the same
+// catalog (at most exportChunk members each). The end record carries the
+// totals, so a truncated file is detected rather than half-imported
+// silently. Readers reject any version they do not know.
+const (
+	indexExportFormat  = "lake-index"
+	indexExportVersion = 1
+	exportChunk        = 512
+)
+
+type exportHeader struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	ExportedAt int64  `json:"exportedAt"`
+}
+
+type exportDelta struct {
+	Member string  `json:"m"`
+	Score  float64 `json:"s"`
+}
+
+type exportRecord struct {
+	Kind      string        `json:"kind"`
+	Catalog   string        `json:"catalog,omitempty"`
+	Snap      string        `json:"snap,omitempty"`
+	RemoveGen string        `json:"removeGen,omitempty"`
+	Alloc     string        `json:"alloc,omitempty"`
+	Deltas    []exportDelta `json:"deltas,omitempty"`
+	Catalogs  int           `json:"catalogs,omitempty"`
+	NDeltas   int           `json:"deltaCount,omitempty"`
+}
+
+// IndexFilter selects the catalogs ExportIndex writes (and ImportIndex
+// applies). The zero value selects every catalog.
+type IndexFilter struct {
+	// Catalogs, if set, is the exact set of catalogs.
+	Catalogs []string
+	// Prefix keeps only catalogs whose name starts with it.
+	Prefix string
+}
+
+func (f IndexFilter) validate() error {
+	for _, catalog := range f.Catalogs {
+		if err := utils.ValidateCatalog(catalog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f IndexFilter) match(catalog string) bool {
+	if len(f.Catalogs) > 0 && !slices.Contains(f.Catalogs, catalog) {
+		return false
+	}
+	return strings.HasPrefix(catalog, f.Prefix)
+}
+
+// ImportOptions tunes Client.ImportIndex.
+type ImportOptions struct {
+	// Filter restricts which catalogs of the file are applied; the rest
+	// are still validated.
+	Filter IndexFilter
+	// DryRun validates the whole file without writing anything.
+	DryRun bool
+}
+
+// IndexTransferReport is what one ExportIndex or ImportIndex run covered.
+type IndexTransferReport struct {
+	Catalogs int // catalogs written (export) or applied (import)
+	Deltas   int // delta members among them
+}
+
+// ExportIndex streams the index of every catalog filter selects to w: the
+// raw snap value, removal generation, allocator floor and every delta
+// member with its score — absorbed ones included, so GC bounds survive the
+// round trip. Each catalog is read in one MULTI/EXEC and is therefore
+// self-consistent; the file as a whole is not a point-in-time snapshot of
+// the index, as writes to other catalogs continue during the export.
+//
+// Snapshot history and GC pins are not exported: they are operational
+// state, not needed to read a catalog. Objects are not exported either —
+// the file references them by URI.
+func (c *Client) ExportIndex(ctx context.Context, w io.Writer, filter IndexFilter) (*IndexTransferReport, error) {
+	if err := c.requireRedisIndex("export index"); err != nil {
+		return nil, err
+	}
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	catalogs := filter.Catalogs
+	if len(catalogs) == 0 {
+		var err error
+		if catalogs, err = c.exportCatalogs(ctx, filter.Prefix); err != nil {
+			return nil, err
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(exportHeader{Format: indexExportFormat, Version: indexExportVersion, ExportedAt: c.idx.NowUnix()}); err != nil {
+		return nil, err
+	}
+	rep := &IndexTransferReport{}
+	for _, catalog := range catalogs {
+		if !filter.match(catalog) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+		d, err := c.reader.ExportCatalog(ctx, catalog)
+		if err != nil {
+			return rep, fmt.Errorf("export %s: %w", catalog, err)
+		}
+		deltas := make([]exportDelta, 0, len(d.Deltas))
+		for _, z := range d.Deltas {
+			if m, ok := z.Member.(string); ok && index.IsDeltaMember(m) {
+				deltas = append(deltas, exportDelta{Member: m, Score: z.Score})
+			}
+		}
+		if d.Snap == "" && d.RemoveGen == "0" && d.Alloc == "" && len(deltas) == 0 {
+			continue // named in filter.Catalogs but never written
+		}
+		c.emitEvent(catalog, "ExportIndex", nil)
+		if err := enc.Encode(exportRecord{Kind: "catalog", Catalog: catalog, Snap: d.Snap, RemoveGen: d.RemoveGen, Alloc: d.Alloc}); err != nil {
+			return rep, err
+		}
+		for chunk := range slices.Chunk(deltas, exportChunk) {
+			if err := enc.Encode(exportRecord{Kind: "deltas", Catalog: catalog, Deltas: chunk}); err != nil {
+				return rep, err
+			}
+		}
+		rep.Catalogs++
+		rep.Deltas += len(deltas)
+	}
+	if err := enc.Encode(exportRecord{Kind: "end", Catalogs: rep.Catalogs, NDeltas: rep.Deltas}); err != nil {
+		return rep, err
+	}
+	return rep, nil
+}
+
+// exportCatalogs lists every catalog with index state under prefix —
+// a snap pointer, a removal generation or a delta zset — sorted.
+func (c *Client) exportCatalogs(ctx context.Context, prefix string) ([]string, error) {
+	seen := map[string]struct{}{}
+	add := func(catalog string) bool {
+		if strings.HasPrefix(catalog, prefix) {
+			seen[catalog] = struct{}{}
+		}
+		return true
+	}
+	if err := c.reader.IterateSnapCatalogs(ctx, prefix, add); err != nil {
+		return nil, err
+	}
+	if err := c.reader.IterateDeltaCatalogs(ctx, prefix, add); err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(seen))
+	for catalog := range seen {
+		out = append(out, catalog)
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+// ImportIndex reads a file ExportIndex wrote and merges it into this
+// Client's index, which may use a different prefix or key layout than the
+// exporting one. Every record is validated before its catalog is written:
+// catalog names, the snap value, the allocator pair, and each delta through
+// DecodeDeltaMember, so a member whose score disagrees with its tsSeq is
+// rejected, never indexed.
+//
+// Import is idempotent and never moves a catalog backwards: delta members
+// are added (re-adding a present one is a no-op), the snap pointer moves
+// only forward, and the removal generation and allocator floor are only
+// raised. A catalog whose removal generation is above the file's has had a
+// RemoveDelta since the export, so none of the file's deltas are added to
+// it — a removed delta never comes back. Importing the same file twice
+// changes nothing; an older file over newer state can at most re-add
+// entries GC has since reclaimed, below the snap pointer where reads skip
+// them and the next GC drops them again. A catalog still under its
+// DeleteCatalog tombstone is not recreated: the run stops with
+// ErrCatalogDeleted. Catalogs are applied one by one
+// as the file is read; an invalid or truncated file stops the run with an
+// error naming the record, leaving the catalogs before it applied — run it
+// again once the file is fixed. Use DryRun to validate a file first.
+func (c *Client) ImportIndex(ctx context.Context, r io.Reader, opts ImportOptions) (*IndexTransferReport, error) {
+	if err := c.requireRedisIndex("import index"); err != nil {
+		return nil, err
+	}
+	if err := opts.Filter.validate(); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(r)
+	var hdr exportHeader
+	if err := dec.Decode(&hdr); err != nil {
+		return nil, fmt.Errorf("import index: header: %w", err)
+	}
+	if hdr.Format != indexExportFormat {
+		return nil, fmt.Errorf("import index: not a lake index export (format %q)", hdr.Format)
+	}
+	if hdr.Version != indexExportVersion {
+		return nil, fmt.Errorf("import index: unsupported version %d (want %d)", hdr.Version, indexExportVersion)
+	}
+
+	rep := &IndexTransferReport{}
+	var (
+		cur     string // catalog being buffered; "" before the first
+		dump    *index.CatalogDump
+		seen    = map[string]struct{}{}
+		total   struct{ catalogs, deltas int }
+		seenEnd bool
+	)
+	flush := func() error {
+		if cur == "" || !opts.Filter.match(cur) {
+			return nil
+		}
+		if !opts.DryRun {
+			if err := c.writer.ImportCatalog(ctx, cur, dump); err != nil {
+				return fmt.Errorf("import %s: %w", cur, err)
+			}
+		}
+		c.emitEvent(cur, "ImportIndex", map[string]any{"dryRun": opts.DryRun})
+		rep.Catalogs++
+		rep.Deltas += len(dump.Deltas)
+		return nil
+	}
+
+	for n := 2; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+		var rec exportRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return rep, fmt.Errorf("import index: record %d: %w", n, err)
+		}
+		if seenEnd {
+			return rep, fmt.Errorf("import index: record %d: data after end record", n)
+		}
+		bad := func(format string, args ...any) error {
+			return fmt.Errorf("import index: record %d: %s", n, fmt.Sprintf(format, args...))
+		}
+		switch rec.Kind {
+		case "catalog":
+			if err := flush(); err != nil {
+				return rep, err
+			}
+			if err := utils.ValidateCatalog(rec.Catalog); err != nil {
+				return rep, bad("%v", err)
+			}
+			if _, dup := seen[rec.Catalog]; dup {
+				return rep, bad("catalog %q appears twice", rec.Catalog)
+			}
+			seen[rec.Catalog] = struct{}{}
+			if err := validateImportScalars(rec); err != nil {
+				return rep, bad("%s: %v", rec.Catalog, err)
+			}
+			cur = rec.Catalog
+			dump = &index.CatalogDump{Snap: rec.Snap, RemoveGen: rec.RemoveGen, Alloc: rec.Alloc}
+			total.catalogs++
+		case "deltas":
+			if cur == "" || rec.Catalog != cur {
+				return rep, bad("deltas for %q outside its catalog record", rec.Catalog)
+			}
+			for _, d := range rec.Deltas {
+				if _, err := index.DecodeDeltaMember(d.Member, d.Score); err != nil {
+					return rep, bad("%s: %v", cur, err)
+				}
+				dump.Deltas = append(dump.Deltas, redis.Z{Score: d.Score, Member: d.Member})
+			}
+			total.deltas += len(rec.Deltas)
+		case "end":
+			if rec.Catalogs != total.catalogs || rec.NDeltas != total.deltas {
+				return rep, bad("end record counts %d catalogs / %d deltas, file has %d / %d",
+					rec.Catalogs, rec.NDeltas, total.catalogs, total.deltas)
+			}
+			if err := flush(); err != nil {
+				return rep, err
+			}
+			seenEnd = true
+		default:
+			return rep, bad("unknown kind %q", rec.Kind)
+		}
+	}
+	if !seenEnd {
+		return rep, errors.New("import index: truncated file (no end record); catalogs before the cut were applied")
+	}
+	return rep, nil
+}
+
+// validateImportScalars checks a catalog record's snap value, removal
+// generation and allocator pair.
+func validateImportScalars(rec exportRecord) error {
+	if rec.Snap != "" {
+		if _, _, err := index.DecodeSnapValue(rec.Snap); err != nil {
+			return err
+		}
+	}
+	if rec.RemoveGen == "" {
+		return errors.New("missing removeGen")
+	}
+	if g, err := strconv.ParseInt(rec.RemoveGen, 10, 64); err != nil || g < 0 {
+		return fmt.Errorf("invalid removeGen %q", rec.RemoveGen)
+	}
+	if rec.Alloc != "" {
+		if _, err := index.ParseTimeSeqID(rec.Alloc); err != nil {
+			return fmt.Errorf("invalid allocator %q: %w", rec.Alloc, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package lake
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestExportImportIndex_Redis round-trips a catalog's index into another
+// prefix and key layout: reads match, the removal generation and allocator
+// floor carry over, importing the file again changes nothing, and it never
+// brings back a delta removed since the export.
+func TestExportImportIndex_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	src, dst := testPrefix(t)+"src", testPrefix(t)+"dst"
+	cleanupKeys(t, rdb, src+":*")
+	cleanupKeys(t, rdb, dst+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	ctx := context.Background()
+	write := func(c *Client, catalog, path, body string) {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: catalog, Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+
+	old := New(src, rdb, resolve)
+	write(old, "tenant/users", "/a", `1`)
+	write(old, "tenant/users", "/b", `2`)
+	write(old, "tenant/users", "/c", `3`)
+	write(old, "other", "/x", `true`)
+	list := old.List(ctx, "tenant/users")
+	if ok, err := old.RemoveDelta(ctx, "tenant/users", list.Entries[2].TsSeq.String()); err != nil || !ok {
+		t.Fatalf("RemoveDelta = %v (err=%v)", ok, err)
+	}
+	want, err := ReadString(ctx, old.List(ctx, "tenant/users"))
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+
+	var buf bytes.Buffer
+	rep, err := old.ExportIndex(ctx, &buf, IndexFilter{Prefix: "tenant/"})
+	if err != nil {
+		t.Fatalf("ExportIndex: %v", err)
+	}
+	if rep.Catalogs != 1 || rep.Deltas != 2 {
+		t.Fatalf("export report = %+v, want 1 catalog / 2 deltas", rep)
+	}
+	file := buf.String()
+
+	c := New(dst, rdb, resolve, WithKeyLayout(KeyLayoutCluster))
+	if rep, err := c.ImportIndex(ctx, strings.NewReader(file), ImportOptions{DryRun: true}); err != nil || rep.Catalogs != 1 {
+		t.Fatalf("dry run = %+v (err=%v)", rep, err)
+	}
+	if n, _ := rdb.Exists(ctx, dst+":d:{tenant/users}").Result(); n != 0 {
+		t.Fatal("dry run wrote the delta zset")
+	}
+	for range 2 {
+		if rep, err := c.ImportIndex(ctx, strings.NewReader(file), ImportOptions{}); err != nil || rep.Deltas != 2 {
+			t.Fatalf("ImportIndex = %+v (err=%v)", rep, err)
+		}
+	}
+	if got, err := ReadString(ctx, c.List(ctx, "tenant/users")); err != nil || got != want {
+		t.Fatalf("read after import = %q (err=%v), want %q", got, err, want)
+	}
+	if gen, _ := c.idx.RemoveGen(ctx, "tenant/users"); gen != "1" {
+		t.Fatalf("removal generation = %q, want 1", gen)
+	}
+	if _, err := c.ImportIndex(ctx, strings.NewReader(file), ImportOptions{}); err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	var again bytes.Buffer
+	if _, err := c.ExportIndex(ctx, &again, IndexFilter{}); err != nil {
+		t.Fatalf("ExportIndex (dst): %v", err)
+	}
+	if a, b := file[strings.IndexByte(file, '\n'):], again.String()[strings.IndexByte(again.String(), '\n'):]; a != b {
+		t.Fatalf("re-export differs:\n%s\nvs\n%s", a, b)
+	}
+
+	// The allocator floor carried over: a new write sorts after the
+	// removed delta's tsSeq, never reusing it.
+	write(c, "tenant/users", "/d", `4`)
+	if got := c.List(ctx, "tenant/users").Entries; got[len(got)-1].TsSeq.Score() <= list.Entries[2].TsSeq.Score() {
+		t.Fatalf("new tsSeq %v not after removed %v", got[len(got)-1].TsSeq, list.Entries[2].TsSeq)
+	}
+
+	// A delta removed after the export stays removed when the older file
+	// is imported over it.
+	first := c.List(ctx, "tenant/users").Entries[0]
+	if ok, err := c.RemoveDelta(ctx, "tenant/users", first.TsSeq.String()); err != nil || !ok {
+		t.Fatalf("RemoveDelta = %v (err=%v)", ok, err)
+	}
+	if _, err := c.ImportIndex(ctx, strings.NewReader(file), ImportOptions{}); err != nil {
+		t.Fatalf("import over a newer removal: %v", err)
+	}
+	for _, e := range c.List(ctx, "tenant/users").Entries {
+		if e.TsSeq == first.TsSeq {
+			t.Fatalf("removed delta %v is back after the import", first.TsSeq)
+		}
+	}
+	if got, err := ReadString(ctx, c.List(ctx, "tenant/users")); err != nil || got != `{"b":2,"d":4}` {
+		t.Fatalf("read after import over a removal = %q (err=%v)", got, err)
+	}
+}
+
+// TestImportIndex_Rejects covers the validation: unknown versions, a member
+// whose score disagrees with its tsSeq, and a file cut short.
+func TestImportIndex_Rejects(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+	c := New(prefix, rdb, func(storage.Kind, string, string) (storage.Storage, error) { return nil, nil })
+	ctx := context.Background()
+
+	const hdr = `{"format":"lake-index","version":1,"exportedAt":1}` + "\n"
+	const cat = `{"kind":"catalog","catalog":"users","removeGen":"0","alloc":"1700000000_2"}` + "\n"
+	const deltas = `{"kind":"deltas","catalog":"users","deltas":[{"m":"[1,\"/a\",\"1700000000_1\",\"mem://data/x\"]","s":%s}]}` + "\n"
+	const end = `{"kind":"end","catalogs":1,"deltaCount":1}` + "\n"
+	good := strings.Replace(deltas, "%s", "1700000000.000001", 1)
+	for name, file := range map[string]string{
+		"version":   strings.Replace(hdr, `"version":1`, `"version":9`, 1) + cat + good + end,
+		"score":     hdr + cat + strings.Replace(deltas, "%s", "1700000000.000002", 1) + end,
+		"truncated": hdr + cat + good,
+		"counts":    hdr + cat + good + `{"kind":"end","catalogs":1,"deltaCount":2}` + "\n",
+		"orphan":    hdr + strings.Replace(good, `"users"`, `"other"`, 1) + end,
+	} {
+		if _, err := c.ImportIndex(ctx, strings.NewReader(file), ImportOptions{}); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if n, _ := rdb.Exists(ctx, prefix+":d:users").Result(); n != 0 {
+		t.Fatal("a rejected catalog was written")
+	}
+	if rep, err := c.ImportIndex(ctx, strings.NewReader(hdr+cat+good+end), ImportOptions{}); err != nil || rep.Deltas != 1 {
+		t.Fatalf("valid file = %+v (err=%v)", rep, err)
+	}
+}
@@ -0,0 +1,81 @@
+package lake
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestIterateCatalogs applies CatalogFilter on the memory index and on
+// the Redis index in both key layouts.
+func TestIterateCatalogs(t *testing.T) {
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	clients := map[string]func(t *testing.T) *Client{
+		"memory": func(*testing.T) *Client { return NewWithIndex("edge", NewMemoryIndex(), resolve) },
+	}
+	for name, layout := range map[string]KeyLayout{"redis-global": KeyLayoutGlobal, "redis-cluster": KeyLayoutCluster} {
+		clients[name] = func(t *testing.T) *Client {
+			rdb := redisTestDB(t, 13)
+			prefix := testPrefix(t)
+			cleanupKeys(t, rdb, prefix+":*")
+			return New(prefix, rdb, resolve, WithKeyLayout(layout))
+		}
+	}
+	ctx := context.Background()
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			c := newClient(t)
+			defer c.Close()
+			notify := func(catalog string, n int) {
+				t.Helper()
+				for range n {
+					h, err := c.WriteBegin(ctx, WriteBeginRequest{
+						Catalog: catalog, Path: "/x", MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+					})
+					if err != nil {
+						t.Fatalf("WriteBegin: %v", err)
+					}
+					if err := c.WriteNotify(ctx, h); err != nil {
+						t.Fatalf("WriteNotify: %v", err)
+					}
+				}
+			}
+			notify("tenant42/users", 3)
+			notify("tenant42/orders", 1)
+			notify("tenant7/users", 5)
+			list := c.List(ctx, "tenant42/users")
+			if err := c.idx.AddSnap(ctx, "tenant42/users", list.Entries[2].TsSeq, "mem://snaps/u.snap", ""); err != nil {
+				t.Fatalf("AddSnap: %v", err)
+			}
+
+			names := func(f CatalogFilter) []string {
+				t.Helper()
+				var out []string
+				if err := c.IterateCatalogs(ctx, f, func(ci CatalogInfo) bool { out = append(out, ci.Catalog); return true }); err != nil {
+					t.Fatalf("IterateCatalogs(%+v): %v", f, err)
+				}
+				return out
+			}
+			for _, tc := range []struct {
+				filter CatalogFilter
+				want   []string
+			}{
+				{CatalogFilter{}, []string{"tenant42/orders", "tenant42/users", "tenant7/users"}},
+				{CatalogFilter{Prefix: "tenant42/"}, []string{"tenant42/orders", "tenant42/users"}},
+				{CatalogFilter{Prefix: "tenant42/", HasBacklog: true}, []string{"tenant42/orders"}},
+				{CatalogFilter{MinDeltas: 3}, []string{"tenant42/users", "tenant7/users"}},
+				{CatalogFilter{Prefix: "tenant*"}, nil},
+			} {
+				if got := names(tc.filter); !slices.Equal(got, tc.want) {
+					t.Errorf("IterateCatalogs(%+v) = %v, want %v", tc.filter, got, tc.want)
+				}
+			}
+		})
+	}
+}
@@ -12,9 +12,8 @@ import (
 // the number of entries removed.
 //
 // Scope: Redis only. The delta OBJECTS in storage are untouched — they
-// remain fetchable history, and object deletion belongs to bucket lifecycle
-// rules, not Lake. Compacting changes no read result, only reclaims index
-// memory.
+// remain fetchable history (GC is the opt-in call that deletes them).
+// Compacting changes no read result, only reclaims index memory.
 //
 // Safe to call at any time, from any process:
 //
@@ -34,5 +33,5 @@ func (c *Client) Compact(ctx context.Context, catalog string) (int64, error) {
 	if err := utils.ValidateCatalog(catalog); err != nil {
 		return 0, err
 	}
-	return c.writer.CompactDeltas(ctx, catalog)
+	return c.idx.Compact(ctx, catalog)
 }
@@ -0,0 +1,199 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// ErrCatalogDeleted is returned by WriteNotify (and ImportIndex,
+// RebuildIndex) on a catalog DeleteCatalog removed, while its tombstone is
+// in place — a write begun before the delete cannot resurrect it.
+var ErrCatalogDeleted = index.ErrCatalogDeleted
+
+// defaultTombstone is DeleteOptions.Tombstone's default: longer than any
+// sane WriteBegin → WriteNotify gap.
+const defaultTombstone = time.Hour
+
+// DeleteOptions tunes Client.DeleteCatalog.
+type DeleteOptions struct {
+	// PurgeObjects also deletes the catalog's objects: every delta and
+	// snapshot the index referenced and, with a write manifest, the
+	// catalog's manifest objects. The backends must implement
+	// storage.Deleter. Off, only the index is dropped and the objects are
+	// left for FindOrphans or a lifecycle rule.
+	PurgeObjects bool
+	// Tombstone is how long the deleted catalog refuses writes begun before
+	// the delete. 0 means one hour; it must be at least a second, so a
+	// catalog recreated afterwards allocates past everything deleted.
+	Tombstone time.Duration
+}
+
+// DeleteReport is what one DeleteCatalog removed.
+type DeleteReport struct {
+	Deltas  int // delta index entries, absorbed ones included
+	Snaps   int // distinct snapshots: the pointer and the history
+	Objects int // objects deleted (PurgeObjects)
+}
+
+// DeleteCatalog removes a catalog: its delta index, snap pointer and
+// history, allocator, removal generation and pins go in one atomic step,
+// after which List reports the catalog empty and IterateCatalogs no longer
+// yields it. A tombstone stays for opts.Tombstone: during it, WriteNotify of
+// a handle begun before the delete fails with ErrCatalogDeleted and a
+// snapshot save computed before it is refused, so nothing in flight can
+// recreate the catalog; ImportIndex and RebuildIndex fail with
+// ErrCatalogDeleted too. Once the tombstone expires the name is free again.
+//
+// Derived state follows the RemoveDelta discipline: the sample removal
+// generation is bumped before the delete and every memo entry is swept
+// after it. With a write manifest, a "drop" record is written before
+// DeleteCatalog returns, so RebuildIndex does not resurrect the catalog.
+//
+// With PurgeObjects, objects are deleted AFTER the index: a failure there
+// leaves objects nothing references, for FindOrphans to reclaim, never an
+// index entry without its object. Object errors do not stop the purge; they
+// are joined and returned with the report.
+//
+// DESTRUCTIVE and not undoable — take an ExportIndex first if in doubt.
+func (c *Client) DeleteCatalog(ctx context.Context, catalog string, opts DeleteOptions) (*DeleteReport, error) {
+	c.emitEvent(catalog, "DeleteCatalog", map[string]any{"purgeObjects": opts.PurgeObjects})
+	if err := utils.ValidateCatalog(catalog); err != nil {
+		return nil, err
+	}
+	deleter, ok := c.idx.(index.CatalogDeleter)
+	if !ok {
+		return nil, fmt.Errorf("delete catalog: %w", ErrIndexNotSupported)
+	}
+	ttl := opts.Tombstone
+	if ttl == 0 {
+		ttl = defaultTombstone
+	}
+	if ttl < time.Second {
+		return nil, fmt.Errorf("delete catalog: tombstone %v shorter than a second", ttl)
+	}
+	// Manifest objects are listed before the drop record is written, so the
+	// purge below never deletes the record that voids the rest.
+	var wal []string
+	if opts.PurgeObjects && c.manifest != nil {
+		var err error
+		if wal, err = c.manifestObjects(ctx, catalog); err != nil {
+			return nil, err
+		}
+	}
+	// Same ordering as RemoveDelta: the barrier goes up before anything is
+	// removed.
+	if c.sampleRdb != nil {
+		if err := c.sampleRdb.HIncrBy(ctx, c.keys.MakeSampleRemoveGenKey(), catalog, 1).Err(); err != nil {
+			return nil, fmt.Errorf("install sample barrier: %w", err)
+		}
+	}
+	gone, err := deleter.DeleteCatalog(ctx, catalog, ttl)
+	if err != nil {
+		return nil, err
+	}
+	rep := &DeleteReport{Deltas: len(gone.Deltas)}
+	snaps := map[string]struct{}{}
+	for _, s := range gone.Snaps {
+		snaps[s.URI] = struct{}{}
+	}
+	rep.Snaps = len(snaps)
+
+	var errs []error
+	if c.manifest != nil {
+		if floor := gone.Floor(); floor != (index.TimeSeqID{}) {
+			c.manifest.append(catalog, manifestRecord{Op: "drop", TsSeq: floor.String()})
+			if err := c.manifest.flush(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("catalog deleted, but its manifest drop record was not written (retried on the next flush): %w", err))
+			}
+		}
+	}
+	if c.sampleRdb != nil {
+		if err := c.sweepSamples(ctx, catalog); err != nil {
+			errs = append(errs, fmt.Errorf("catalog deleted, but memo sweep failed: %w", err))
+		}
+	}
+	if opts.PurgeObjects {
+		errs = append(errs, c.purgeObjects(ctx, catalog, gone, wal, rep))
+	}
+	return rep, errors.Join(errs...)
+}
+
+// purgeObjects deletes the objects a deleted catalog referenced, each URI
+// once, plus its listed manifest objects.
+func (c *Client) purgeObjects(ctx context.Context, catalog string, gone *index.DeletedCatalog, wal []string, rep *DeleteReport) error {
+	type object struct {
+		kind storage.Kind
+		uri  string
+	}
+	var objects []object
+	seen := map[string]struct{}{}
+	add := func(kind storage.Kind, uri string) {
+		if _, dup := seen[uri]; !dup {
+			seen[uri] = struct{}{}
+			objects = append(objects, object{kind, uri})
+		}
+	}
+	for _, d := range gone.Deltas {
+		add(storage.Delta, d.URI)
+	}
+	for _, s := range gone.Snaps {
+		add(storage.Snap, s.URI)
+	}
+	for _, uri := range wal {
+		add(storage.Delta, uri)
+	}
+	var errs []error
+	for _, o := range objects {
+		if err := ctx.Err(); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		_, found, err := c.reclaim(ctx, o.kind, catalog, o.uri, false)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if found {
+			rep.Objects++
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// manifestObjects lists the URIs of catalog's manifest objects.
+func (c *Client) manifestObjects(ctx context.Context, catalog string) ([]string, error) {
+	loc := Location{Provider: c.manifest.provider, Bucket: c.manifest.bucket}
+	st, err := c.storageFor(storage.Delta, loc.Provider, loc.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := st.(storage.Lister)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", loc.uriPrefix(), storage.ErrListNotSupported)
+	}
+	var out []string
+	folder := objkey.CatalogFolder(catalog)
+	for cursor := ""; ; {
+		page, next, err := lister.List(ctx, catalog, folder, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("list %s%s: %w", loc.uriPrefix(), folder, err)
+		}
+		for _, obj := range page {
+			name := strings.TrimPrefix(obj.Path, folder)
+			if !strings.Contains(name, "/") && strings.HasSuffix(name, ".wal") {
+				out = append(out, objkey.BuildURI(loc.Provider, loc.Bucket, obj.Path))
+			}
+		}
+		if next == "" {
+			return out, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,140 @@
+package lake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestDeleteCatalog deletes a snapshotted catalog with PurgeObjects on the
+// memory index and on the Redis index in both key layouts: its index and
+// objects are gone, a write begun before the delete cannot land, other
+// catalogs are untouched, and a rebuild from the manifest stays empty.
+func TestDeleteCatalog(t *testing.T) {
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		if bucket == "wal" {
+			return store.Bucket(bucket), nil // listable
+		}
+		return deletableBucket{presignBucket{store.Bucket(bucket)}}, nil
+	}
+	opts := []func(*option){WithSnapTarget("mem", "snaps"), WithWriteManifest("mem", "wal")}
+	clients := map[string]func(t *testing.T) *Client{
+		"memory": func(*testing.T) *Client { return NewWithIndex("edge", NewMemoryIndex(), resolve, opts...) },
+	}
+	for name, layout := range map[string]KeyLayout{"redis-global": KeyLayoutGlobal, "redis-cluster": KeyLayoutCluster} {
+		clients[name] = func(t *testing.T) *Client {
+			rdb := redisTestDB(t, 13)
+			prefix := testPrefix(t)
+			cleanupKeys(t, rdb, prefix+":*")
+			return New(prefix, rdb, resolve, append(opts, WithKeyLayout(layout))...)
+		}
+	}
+	ctx := context.Background()
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			c := newClient(t)
+			defer c.Close()
+			catalog := "del/" + name
+			begin := func(catalog, path string) *WriteHandle {
+				t.Helper()
+				h, err := c.WriteBegin(ctx, WriteBeginRequest{
+					Catalog: catalog, Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+				})
+				if err != nil {
+					t.Fatalf("WriteBegin: %v", err)
+				}
+				if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(`1`)); err != nil {
+					t.Fatalf("upload: %v", err)
+				}
+				return h
+			}
+			write := func(catalog, path string) {
+				t.Helper()
+				if err := c.WriteNotify(ctx, begin(catalog, path)); err != nil {
+					t.Fatalf("WriteNotify: %v", err)
+				}
+			}
+			write(catalog, "/a")
+			write(catalog, "/b")
+			write("keep/"+name, "/a")
+			if _, err := ReadString(ctx, c.List(ctx, catalog)); err != nil {
+				t.Fatalf("ReadString: %v", err)
+			}
+			if !waitFor(func() bool { snap, _ := c.idx.LatestSnap(ctx, catalog); return snap != nil }) {
+				t.Fatal("snapshot was not indexed within timeout")
+			}
+			write(catalog, "/c")
+			stale := begin(catalog, "/d")
+			if err := c.FlushManifest(ctx); err != nil {
+				t.Fatalf("FlushManifest: %v", err)
+			}
+
+			if _, err := c.DeleteCatalog(ctx, catalog, DeleteOptions{Tombstone: 100}); err == nil {
+				t.Fatal("DeleteCatalog accepted a sub-second tombstone")
+			}
+			rep, err := c.DeleteCatalog(ctx, catalog, DeleteOptions{PurgeObjects: true})
+			if err != nil {
+				t.Fatalf("DeleteCatalog: %v", err)
+			}
+			// 3 notified deltas + 1 snapshot + at least one manifest object;
+			// the stale upload is not indexed, so it is not purged.
+			if rep.Deltas != 3 || rep.Snaps != 1 || rep.Objects < 5 {
+				t.Fatalf("report = %+v", rep)
+			}
+			if list := c.List(ctx, catalog); list.Err != nil || len(list.Entries) != 0 || list.LatestSnap != nil {
+				t.Fatalf("List after delete = %+v", list)
+			}
+			if err := c.WriteNotify(ctx, stale); !errors.Is(err, ErrCatalogDeleted) {
+				t.Fatalf("stale WriteNotify err = %v, want ErrCatalogDeleted", err)
+			}
+			folder := objkey.CatalogFolder(catalog)
+			for _, bucket := range []string{"data", "snaps", "wal"} {
+				objs, _, _ := store.Bucket(bucket).(storage.Lister).List(ctx, catalog, folder, "")
+				for _, o := range objs {
+					if o.Path == stale.Key {
+						continue
+					}
+					if body, _ := store.Bucket(bucket).Get(ctx, catalog, o.Path); bucket == "wal" && !strings.Contains(string(body), `"op":"add"`) {
+						continue // the drop record, written after the listing
+					}
+					t.Errorf("%s/%s survived the purge", bucket, o.Path)
+				}
+			}
+			var names []string
+			_ = c.IterateCatalogs(ctx, CatalogFilter{}, func(ci CatalogInfo) bool { names = append(names, ci.Catalog); return true })
+			if len(names) != 1 || names[0] != "keep/"+name {
+				t.Fatalf("catalogs after delete = %v", names)
+			}
+			if c.reader != nil {
+				// Without a purge the add records stay; the drop voids them.
+				var dump bytes.Buffer
+				if _, err := c.ExportIndex(ctx, &dump, IndexFilter{Catalogs: []string{"keep/" + name}}); err != nil {
+					t.Fatalf("ExportIndex: %v", err)
+				}
+				if _, err := c.DeleteCatalog(ctx, "keep/"+name, DeleteOptions{}); err != nil {
+					t.Fatalf("DeleteCatalog: %v", err)
+				}
+				// Nor does an import bring it back under the tombstone.
+				if _, err := c.ImportIndex(ctx, &dump, ImportOptions{}); !errors.Is(err, ErrCatalogDeleted) {
+					t.Fatalf("ImportIndex under the tombstone err = %v, want ErrCatalogDeleted", err)
+				}
+				if list := c.List(ctx, "keep/"+name); len(list.Entries) != 0 || list.LatestSnap != nil {
+					t.Fatalf("List after the refused import = %+v", list)
+				}
+				for _, catalog := range []string{catalog, "keep/" + name} {
+					rb, err := c.RebuildIndex(ctx, catalog)
+					if err != nil || rb.Manifests == 0 || rb.Deltas != 0 || rb.Snap != nil {
+						t.Fatalf("RebuildIndex(%s) after delete = %+v (err=%v), want empty", catalog, rb, err)
+					}
+				}
+			}
+		})
+	}
+}
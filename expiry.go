@@ -0,0 +1,59 @@
+package lake
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/utils"
+)
+
+// SetExpiry gives catalog a sliding time-to-live, for session-like catalogs
+// (carts, drafts) that should disappear after inactivity: the catalog
+// expires ttl after the later of this call and its newest WriteNotify, each
+// of which moves the deadline. 0 removes the policy. Setting it on a
+// catalog without state is allowed — the policy waits for its first write.
+//
+// An expired catalog reads as one never written: List reports it empty,
+// IterateCatalogs skips it and a snapshot save is refused. Its next write
+// starts it afresh, without the policy. On the Redis index the per-catalog
+// keys (delta index, allocator, snapshot history) expire natively at the
+// deadline; the fields sharing a hash with other catalogs stay until a
+// script touching the catalog or SweepExpired drops them.
+//
+// Fails with ErrCatalogDeleted while the catalog's tombstone is in place.
+func (c *Client) SetExpiry(ctx context.Context, catalog string, ttl time.Duration) error {
+	c.emitEvent(catalog, "SetExpiry", map[string]any{"ttl": ttl.String()})
+	if err := utils.ValidateCatalog(catalog); err != nil {
+		return err
+	}
+	expirer, ok := c.idx.(index.CatalogExpirer)
+	if !ok {
+		return fmt.Errorf("set expiry: %w", ErrIndexNotSupported)
+	}
+	return expirer.SetExpiry(ctx, catalog, ttl)
+}
+
+// SweepExpired drops what expiry leaves behind — the expired catalogs'
+// fields in the shared snaps hash and their memo entries — and returns the
+// catalogs it dropped. Run it periodically (like GC) on deployments that
+// use SetExpiry; it is cheap when nothing expired, one snaps-hash scan.
+// A catalog written since its deadline has started afresh and is left
+// alone. The SweepExpired event fires once per dropped catalog.
+func (c *Client) SweepExpired(ctx context.Context) ([]string, error) {
+	expirer, ok := c.idx.(index.CatalogExpirer)
+	if !ok {
+		return nil, fmt.Errorf("sweep expired: %w", ErrIndexNotSupported)
+	}
+	swept, err := expirer.SweepExpired(ctx)
+	for _, catalog := range swept {
+		c.emitEvent(catalog, "SweepExpired", nil)
+	}
+	if len(swept) > 0 && c.sampleRdb != nil {
+		if serr := c.sweepSamples(ctx, swept...); serr != nil && err == nil {
+			err = fmt.Errorf("catalogs expired, but memo sweep failed: %w", serr)
+		}
+	}
+	return swept, err
+}
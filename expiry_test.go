@@ -0,0 +1,123 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestSetExpiry expires an idle catalog on the memory index and on the
+// Redis index in both key layouts: it lists as non-existent, drops out of
+// IterateCatalogs, is reported once by SweepExpired, and its next write
+// starts it afresh.
+func TestSetExpiry(t *testing.T) {
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		if bucket == "blind" {
+			return hashBlindBucket{store.Bucket(bucket)}, nil
+		}
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	// Each client comes with a way to let time pass: the memory index
+	// steps its clock, Redis keeps the server's.
+	clients := map[string]func(t *testing.T) (*Client, func(time.Duration)){
+		"memory": func(*testing.T) (*Client, func(time.Duration)) {
+			idx := index.NewMemory()
+			var now atomic.Int64
+			now.Store(time.Now().UnixNano())
+			idx.SetClock(func() time.Time { return time.Unix(0, now.Load()) })
+			return NewWithIndex("edge", idx, resolve), func(d time.Duration) { now.Add(int64(d)) }
+		},
+	}
+	for name, layout := range map[string]KeyLayout{"redis-global": KeyLayoutGlobal, "redis-cluster": KeyLayoutCluster} {
+		clients[name] = func(t *testing.T) (*Client, func(time.Duration)) {
+			rdb := redisTestDB(t, 13)
+			prefix := testPrefix(t)
+			cleanupKeys(t, rdb, prefix+":*")
+			return New(prefix, rdb, resolve, WithKeyLayout(layout)), time.Sleep
+		}
+	}
+	ctx := context.Background()
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			c, advance := newClient(t)
+			defer c.Close()
+			var mu sync.Mutex
+			var events []string
+			c.Use(func(catalog, event string, _ map[string]any) {
+				mu.Lock()
+				defer mu.Unlock()
+				if event == "SweepExpired" {
+					events = append(events, catalog)
+				}
+			})
+			write := func(catalog string, ttl time.Duration) {
+				t.Helper()
+				h, err := c.WriteBegin(ctx, WriteBeginRequest{
+					Catalog: catalog, Path: "/a", MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data", TTL: ttl,
+				})
+				if err != nil {
+					t.Fatalf("WriteBegin: %v", err)
+				}
+				if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(`1`)); err != nil {
+					t.Fatalf("upload: %v", err)
+				}
+				if err := c.WriteNotify(ctx, h); err != nil {
+					t.Fatalf("WriteNotify: %v", err)
+				}
+			}
+
+			if _, err := c.WriteBegin(ctx, WriteBeginRequest{
+				Catalog: "cart", Path: "/a", MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data", TTL: time.Minute,
+			}); err == nil {
+				t.Fatal("WriteBegin accepted a catalog ttl shorter than the upload ttl")
+			}
+			write("cart", time.Hour)
+			write("keep", 0)
+			// A WriteBegin that fails leaves the catalog's policy alone.
+			if _, err := c.WriteBegin(ctx, WriteBeginRequest{
+				Catalog: "keep", Path: "/a", MergeType: MergeTypeReplace, Provider: "mem", Bucket: "blind",
+				ContentSHA256: strings.Repeat("ab", 32), TTL: time.Second,
+			}, WithUploadTTL(time.Second)); !errors.Is(err, storage.ErrContentSHA256NotSupported) {
+				t.Fatalf("WriteBegin on a hash-blind backend: %v, want ErrContentSHA256NotSupported", err)
+			}
+			advance(1100 * time.Millisecond)
+			if !c.List(ctx, "keep").Exist() {
+				t.Fatal("a failed WriteBegin set the catalog's ttl")
+			}
+			if err := c.SetExpiry(ctx, "cart", 300*time.Millisecond); err != nil {
+				t.Fatalf("SetExpiry: %v", err)
+			}
+			if !c.List(ctx, "cart").Exist() {
+				t.Fatal("catalog gone before its deadline")
+			}
+
+			advance(400 * time.Millisecond)
+			if list := c.List(ctx, "cart"); list.Err != nil || list.Exist() {
+				t.Fatalf("List after expiry = %+v", list)
+			}
+			var names []string
+			_ = c.IterateCatalogs(ctx, CatalogFilter{}, func(ci CatalogInfo) bool { names = append(names, ci.Catalog); return true })
+			if !slices.Equal(names, []string{"keep"}) {
+				t.Fatalf("catalogs after expiry = %v", names)
+			}
+			if swept, err := c.SweepExpired(ctx); err != nil || !slices.Equal(swept, []string{"cart"}) || !slices.Equal(events, swept) {
+				t.Fatalf("SweepExpired = %v (err=%v), events %v", swept, err, events)
+			}
+
+			write("cart", 0)
+			if doc, err := ReadString(ctx, c.List(ctx, "cart")); err != nil || doc != `{"a":1}` {
+				t.Fatalf("restarted catalog = %s (err=%v)", doc, err)
+			}
+		})
+	}
+}
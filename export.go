@@ -17,3 +17,39 @@ type SnapInfo = index.SnapInfo
 
 // TimeSeqID is the (timestamp, seqid) pair Lake stamps onto every write.
 type TimeSeqID = index.TimeSeqID
+
+// TsSeqVersion is a tsSeq allocation scheme (see WithTsSeqVersion).
+type TsSeqVersion = index.TsSeqVersion
+
+const (
+	TsSeqV1 = index.TsSeqV1 // "{timestamp}_{seqid}"; the default
+	TsSeqV2 = index.TsSeqV2 // "v2_{ms}_{seqid}", millisecond precision
+)
+
+// KeyLayout selects how Lake names its Redis keys (see WithKeyLayout).
+type KeyLayout = index.Layout
+
+const (
+	KeyLayoutGlobal  = index.LayoutGlobal  // single-node Redis; the default
+	KeyLayoutCluster = index.LayoutCluster // hash-tagged, Redis Cluster safe
+)
+
+// CatalogInfo is one catalog as IterateCatalogs reports it: its name,
+// snap pointer (nil if none), delta count and backlog past the snapshot.
+type CatalogInfo = index.CatalogStats
+
+// Index is the catalog index a Client runs on (see NewWithIndex). The Redis
+// index behind New is the default; NewMemoryIndex is a pure-Go one.
+type Index = index.Index
+
+// Types an Index implementation returns.
+type (
+	DeltaInfo       = index.DeltaInfo
+	ReadIndexResult = index.ReadIndexResult
+	BatchListResult = index.BatchListResult
+)
+
+// NewMemoryIndex returns an empty in-process Index with the Redis index's
+// semantics: monotonic tsSeq allocation, a forward-only snap pointer and
+// removal generations. Nothing is persisted.
+func NewMemoryIndex() Index { return index.NewMemory() }
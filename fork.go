@@ -0,0 +1,158 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// ErrCatalogExists is returned by Fork when the destination catalog already
+// has state.
+var ErrCatalogExists = index.ErrCatalogExists
+
+// ErrNoSnapTarget is returned by the operations that write a document
+// object of their own — Fork and Promote — on a Client without one.
+var ErrNoSnapTarget = errors.New("lake: no snapshot target configured (WithSnapTarget)")
+
+// Fork starts dst as a copy of src's current document, for a sandbox clone
+// or a draft branch. src is read once (List + merge) and the merged document
+// is written as a fresh snapshot object in dst's folder on the snap target,
+// which becomes dst's snap pointer. No delta body is copied and no object
+// is shared: GC, Migrate or DeleteCatalog on either catalog never touches
+// the other, and later writes to either stay independent. dst's writes
+// sort after the fork point.
+//
+// dst must not exist — no delta, snapshot or removal generation — and this
+// is checked atomically with publishing the pointer: Fork fails with
+// ErrCatalogExists (or ErrCatalogDeleted while dst's tombstone is in place)
+// instead of shadowing state. Writes to src after its List are not part of
+// the fork. Returns dst's snap pointer.
+func (c *Client) Fork(ctx context.Context, src, dst string) (*SnapInfo, error) {
+	c.emitEvent(dst, "Fork", map[string]any{"src": src})
+	if err := utils.ValidateCatalog(src); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateNewCatalog(dst); err != nil {
+		return nil, err
+	}
+	if src == dst {
+		return nil, fmt.Errorf("fork %s onto itself", src)
+	}
+	seeder, ok := c.idx.(index.CatalogSeeder)
+	if !ok {
+		return nil, fmt.Errorf("fork: %w", ErrIndexNotSupported)
+	}
+	if c.snapProvider == "" {
+		return nil, fmt.Errorf("fork: %w", ErrNoSnapTarget)
+	}
+	// Cheap early refusal; SeedSnap re-checks atomically.
+	if cur := c.List(ctx, dst); cur.Err != nil {
+		return nil, cur.Err
+	} else if cur.Exist() {
+		return nil, fmt.Errorf("fork %s: %w", dst, ErrCatalogExists)
+	}
+	stop, data, err := c.readAll(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("fork %s: %w", src, err)
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+	// A unique name per attempt: a fork that loses the race for dst leaves
+	// its own object behind, never bytes another fork's pointer references.
+	path := objkey.SnapPath(dst, stop.String()+"-f"+id)
+	st, err := c.storageFor(storage.Snap, c.snapProvider, c.snapBucket)
+	if err != nil {
+		return nil, fmt.Errorf("resolve snap target: %w", err)
+	}
+	if err := st.Put(ctx, dst, path, data); err != nil {
+		return nil, fmt.Errorf("save fork snapshot: %w", err)
+	}
+	uri := objkey.BuildURI(c.snapProvider, c.snapBucket, path)
+	if err := seeder.SeedSnap(ctx, dst, stop, uri); err != nil {
+		if del, ok := st.(storage.Deleter); ok {
+			_ = del.Delete(ctx, dst, path) // best effort; otherwise an orphan
+		}
+		return nil, err
+	}
+	if c.manifest != nil {
+		c.manifest.append(dst, manifestRecord{Op: "snap", TsSeq: stop.String(), URI: uri})
+	}
+	return &SnapInfo{StopTsSeq: stop, URI: uri}, nil
+}
+
+// Promote publishes draft's merged document into live as ONE root Replace
+// delta — the draft-and-publish step after a Fork. A reader of live sees
+// either the state before or the promoted document, never a mix, and
+// live's history, snapshots and removal generation carry on as for any
+// write. The body is written to live's delta folder on the snap target.
+// draft is left as it is; writes to it after its List are not promoted.
+// Returns the tsSeq of the published delta.
+func (c *Client) Promote(ctx context.Context, draft, live string) (TimeSeqID, error) {
+	c.emitEvent(live, "Promote", map[string]any{"draft": draft})
+	if err := utils.ValidateCatalog(draft); err != nil {
+		return TimeSeqID{}, err
+	}
+	if err := utils.ValidateNewCatalog(live); err != nil {
+		return TimeSeqID{}, err
+	}
+	if draft == live {
+		return TimeSeqID{}, fmt.Errorf("promote %s onto itself", draft)
+	}
+	if c.snapProvider == "" {
+		return TimeSeqID{}, fmt.Errorf("promote: %w", ErrNoSnapTarget)
+	}
+	_, data, err := c.readAll(ctx, draft)
+	if err != nil {
+		return TimeSeqID{}, fmt.Errorf("promote %s: %w", draft, err)
+	}
+
+	id, err := newUUID()
+	if err != nil {
+		return TimeSeqID{}, err
+	}
+	path := objkey.DeltaPath(live, id)
+	st, err := c.storageFor(storage.Delta, c.snapProvider, c.snapBucket)
+	if err != nil {
+		return TimeSeqID{}, err
+	}
+	if err := st.Put(ctx, live, path, data); err != nil {
+		return TimeSeqID{}, fmt.Errorf("upload promoted document: %w", err)
+	}
+	tsSeq, member, err := c.idx.Notify(ctx, live, "/", MergeTypeReplace, objkey.BuildURI(c.snapProvider, c.snapBucket, path))
+	if err != nil {
+		return TimeSeqID{}, err
+	}
+	if c.manifest != nil {
+		c.manifest.append(live, manifestRecord{Op: "add", TsSeq: tsSeq.String(), Member: member})
+	}
+	return tsSeq, nil
+}
+
+// readAll lists and merges catalog, returning the newest position the
+// document covers (last delta, else snap stop). A catalog without state is
+// an error: forking or promoting it would publish an empty document.
+func (c *Client) readAll(ctx context.Context, catalog string) (TimeSeqID, []byte, error) {
+	list := c.List(ctx, catalog)
+	if list.Err != nil {
+		return TimeSeqID{}, nil, list.Err
+	}
+	if !list.Exist() {
+		return TimeSeqID{}, nil, errors.New("catalog has no state")
+	}
+	var stop TimeSeqID
+	if n := len(list.Entries); n > 0 {
+		stop = list.Entries[n-1].TsSeq
+	} else {
+		stop = list.LatestSnap.StopTsSeq
+	}
+	data, err := ReadBytes(ctx, list)
+	return stop, data, err
+}
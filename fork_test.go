@@ -0,0 +1,118 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestForkPromote forks a catalog, diverges both sides, and promotes the
+// draft back, on the memory index and on the Redis index in both key
+// layouts.
+func TestForkPromote(t *testing.T) {
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	clients := map[string]func(t *testing.T) *Client{
+		"memory": func(*testing.T) *Client {
+			return NewWithIndex("edge", NewMemoryIndex(), resolve, WithSnapTarget("mem", "snaps"))
+		},
+	}
+	for name, layout := range map[string]KeyLayout{"redis-global": KeyLayoutGlobal, "redis-cluster": KeyLayoutCluster} {
+		clients[name] = func(t *testing.T) *Client {
+			rdb := redisTestDB(t, 13)
+			prefix := testPrefix(t)
+			cleanupKeys(t, rdb, prefix+":*")
+			return New(prefix, rdb, resolve, WithSnapTarget("mem", "snaps"), WithKeyLayout(layout))
+		}
+	}
+	ctx := context.Background()
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			c := newClient(t)
+			defer c.Close()
+			write := func(catalog, path, body string) {
+				t.Helper()
+				h, err := c.WriteBegin(ctx, WriteBeginRequest{
+					Catalog: catalog, Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+				})
+				if err != nil {
+					t.Fatalf("WriteBegin: %v", err)
+				}
+				if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+					t.Fatalf("upload: %v", err)
+				}
+				if err := c.WriteNotify(ctx, h); err != nil {
+					t.Fatalf("WriteNotify: %v", err)
+				}
+			}
+			read := func(catalog string) string {
+				t.Helper()
+				doc, err := ReadString(ctx, c.List(ctx, catalog))
+				if err != nil {
+					t.Fatalf("read %s: %v", catalog, err)
+				}
+				return doc
+			}
+
+			write("live", "/a", `1`)
+			write("live", "/b", `{"x":2}`)
+			if _, err := c.Fork(ctx, "nope", "draft"); err == nil {
+				t.Fatal("Fork of a catalog without state succeeded")
+			}
+			snap, err := c.Fork(ctx, "live", "draft")
+			if err != nil {
+				t.Fatalf("Fork: %v", err)
+			}
+			if got := c.List(ctx, "draft"); got.LatestSnap == nil || *got.LatestSnap != *snap || len(got.Entries) != 0 {
+				t.Fatalf("draft after Fork = %+v, want only the snap %+v", got, snap)
+			}
+			if got, want := read("draft"), `{"a":1,"b":{"x":2}}`; got != want {
+				t.Fatalf("draft = %s, want %s", got, want)
+			}
+			if _, err := c.Fork(ctx, "live", "draft"); !errors.Is(err, ErrCatalogExists) {
+				t.Fatalf("second Fork err = %v, want ErrCatalogExists", err)
+			}
+
+			write("draft", "/a", `9`)
+			write("live", "/c", `3`)
+			if got, want := read("draft"), `{"a":9,"b":{"x":2}}`; got != want {
+				t.Fatalf("draft after writes = %s, want %s", got, want)
+			}
+			if got, want := read("live"), `{"a":1,"b":{"x":2},"c":3}`; got != want {
+				t.Fatalf("live after writes = %s, want %s", got, want)
+			}
+
+			id, err := c.Promote(ctx, "draft", "live")
+			if err != nil {
+				t.Fatalf("Promote: %v", err)
+			}
+			entries := c.List(ctx, "live").Entries
+			if last := entries[len(entries)-1]; last.TsSeq != id || last.Path != "/" || last.MergeType != MergeTypeReplace {
+				t.Fatalf("promoted delta = %+v, want a root Replace at %v", last, id)
+			}
+			if got, want := read("live"), read("draft"); got != want {
+				t.Fatalf("live after Promote = %s, want %s", got, want)
+			}
+
+			if _, err := c.DeleteCatalog(ctx, "draft", DeleteOptions{}); err != nil {
+				t.Fatalf("DeleteCatalog: %v", err)
+			}
+			if _, err := c.Fork(ctx, "live", "draft"); !errors.Is(err, ErrCatalogDeleted) {
+				t.Fatalf("Fork onto a tombstone err = %v, want ErrCatalogDeleted", err)
+			}
+
+			plain := NewWithIndex("edge", NewMemoryIndex(), resolve)
+			if _, err := plain.Fork(ctx, "live", "x"); !errors.Is(err, ErrNoSnapTarget) {
+				t.Fatalf("Fork without snap target err = %v, want ErrNoSnapTarget", err)
+			}
+			if _, err := plain.Promote(ctx, "live", "x"); !errors.Is(err, ErrNoSnapTarget) {
+				t.Fatalf("Promote without snap target err = %v, want ErrNoSnapTarget", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// GCOptions tunes Client.GC.
+type GCOptions struct {
+	// KeepSnaps is how many of the newest recorded snapshots survive; the
+	// current snap pointer always does. ≤ 0 means 1 (only the current one).
+	KeepSnaps int
+	// MinAge is the grace period protecting in-flight reads: a snapshot
+	// object is deleted only once it has been superseded for at least MinAge,
+	// and a delta object only once a snapshot absorbing it has been published
+	// for at least MinAge. It must exceed your slowest read (List → fetch);
+	// 0 deletes immediately.
+	MinAge time.Duration
+	// DryRun reports what would be reclaimed without deleting anything.
+	DryRun bool
+}
+
+// GCReport is what one GC run reclaimed (or, with DryRun, would reclaim).
+type GCReport struct {
+	SnapObjects  int   // superseded snapshot objects
+	DeltaObjects int   // absorbed delta objects
+	Bytes        int64 // combined size of those objects
+	IndexEntries int64 // delta index entries trimmed (always 0 on DryRun)
+}
+
+// GC deletes a catalog's garbage from object storage: the objects of
+// snapshots the pointer has moved past (beyond the KeepSnaps newest), and
+// the objects of deltas a snapshot has absorbed — whose index entries it
+// then trims, as Compact would. Both kinds are reached through the catalog's
+// snapshot history and delta index, so objects Lake never recorded (an
+// aborted upload, a snapshot save AddSnap refused) are out of its reach.
+//
+// The backend resolved for each object must implement storage.Deleter
+// (DryRun excepted); otherwise GC stops with storage.ErrDeleteNotSupported.
+// A delta object still referenced by a live (unabsorbed) delta is never
+// deleted, nor is a content-addressed one a pending WriteBegin has pinned
+// (its index entry is still trimmed; a later run reclaims the object through
+// the reference that write records — if the write is abandoned, the object
+// stays behind like an aborted upload). While GC deletes a content-addressed
+// object it holds the object's delete mark, and a WriteBegin for the same
+// content waits for it. GC is restartable: objects are deleted BEFORE their
+// records are dropped, so a failed run leaves the records for the next one,
+// and deleting an already-missing object is a no-op. On error the report
+// covers what was reclaimed up to that point.
+//
+// Objects are sized for the report with storage.Stater when the backend has
+// it, otherwise by reading them once. Run GC on your own
+// schedule, like Compact (e.g. driven by IterateSnaps).
+func (c *Client) GC(ctx context.Context, catalog string, opts GCOptions) (*GCReport, error) {
+	c.emitEvent(catalog, "GC", map[string]any{"dryRun": opts.DryRun})
+	if err := c.requireRedisIndex("gc"); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateCatalog(catalog); err != nil {
+		return nil, err
+	}
+	keep := opts.KeepSnaps
+	if keep < 1 {
+		keep = 1
+	}
+
+	cur, err := c.idx.LatestSnap(ctx, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("read snap: %w", err)
+	}
+	history, err := c.reader.SnapHistory(ctx, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("read snap history: %w", err)
+	}
+	// Publication times are Redis-clock stamps; judge age on the same clock.
+	c.ensureClock(ctx)
+	cutoff := c.idx.NowUnix() - int64(opts.MinAge/time.Second)
+
+	rep := &GCReport{}
+	retained := make(map[string]struct{}, keep+1)
+	if cur != nil {
+		retained[cur.URI] = struct{}{}
+	}
+	for i := max(len(history)-keep, 0); i < len(history); i++ {
+		retained[history[i].URI] = struct{}{}
+	}
+	for i := 0; i < len(history)-keep; i++ {
+		rec := history[i]
+		if _, ok := retained[rec.URI]; ok {
+			continue
+		}
+		// history[i+1] is the snapshot that superseded rec.
+		if history[i+1].PublishedAt > cutoff {
+			continue
+		}
+		size, found, err := c.reclaim(ctx, storage.Snap, catalog, rec.URI, opts.DryRun)
+		if err != nil {
+			return rep, fmt.Errorf("gc snapshot %s: %w", rec.StopTsSeq, err)
+		}
+		if found {
+			rep.SnapObjects++
+			rep.Bytes += size
+		}
+		if !opts.DryRun {
+			if err := c.writer.ForgetSnap(ctx, catalog, rec); err != nil {
+				return rep, fmt.Errorf("gc snapshot %s: forget: %w", rec.StopTsSeq, err)
+			}
+		}
+	}
+
+	bound := gcDeltaBound(cur, history, cutoff, opts.MinAge)
+	if bound == nil {
+		return rep, nil
+	}
+	absorbed, live, err := c.reader.DeltasThrough(ctx, catalog, *bound)
+	if err != nil {
+		return rep, fmt.Errorf("read absorbed deltas: %w", err)
+	}
+	done := make(map[string]struct{}, len(absorbed))
+	for _, d := range absorbed {
+		if _, ok := live[d.URI]; ok {
+			continue
+		}
+		if _, ok := done[d.URI]; ok {
+			continue
+		}
+		done[d.URI] = struct{}{}
+		claimed, release, err := c.claimDelta(ctx, catalog, d.URI, opts.DryRun)
+		if err != nil {
+			return rep, fmt.Errorf("gc delta %s: %w", d.TsSeq, err)
+		}
+		if !claimed {
+			continue
+		}
+		size, found, err := c.reclaim(ctx, storage.Delta, catalog, d.URI, opts.DryRun)
+		release()
+		if err != nil {
+			return rep, fmt.Errorf("gc delta %s: %w", d.TsSeq, err)
+		}
+		if found {
+			rep.DeltaObjects++
+			rep.Bytes += size
+		}
+	}
+	if !opts.DryRun {
+		n, err := c.writer.TrimDeltas(ctx, catalog, *bound)
+		if err != nil {
+			return rep, err
+		}
+		rep.IndexEntries = n
+	}
+	return rep, nil
+}
+
+// gcDeltaBound picks the newest snapshot stop whose deltas GC may delete:
+// that of the newest snapshot published at or before cutoff (never past the
+// current pointer). A reader that listed an OLDER pointer may still be about
+// to fetch deltas the newer snapshot absorbed — MinAge is what outlives it.
+// A catalog whose snapshot predates history has no publication time, so its
+// deltas are reclaimable only without a grace period.
+func gcDeltaBound(cur *index.SnapInfo, history []index.SnapRecord, cutoff int64, minAge time.Duration) *index.TimeSeqID {
+	if cur == nil {
+		return nil
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].PublishedAt <= cutoff && history[i].Score() <= cur.Score() {
+			return &history[i].StopTsSeq
+		}
+	}
+	if len(history) == 0 && minAge <= 0 {
+		return &cur.StopTsSeq
+	}
+	return nil
+}
+
+// reclaim sizes and (unless dryRun) deletes one object. found is false when
+// the object is already gone — a retried run, or a lifecycle rule got there
+// first — which is not an error.
+func (c *Client) reclaim(ctx context.Context, kind storage.Kind, catalog, uri string, dryRun bool) (size int64, found bool, err error) {
+	provider, bucket, path, err := objkey.ParseURI(uri)
+	if err != nil {
+		return 0, false, err
+	}
+	st, err := c.storageFor(kind, provider, bucket)
+	if err != nil {
+		return 0, false, err
+	}
+	del, ok := st.(storage.Deleter)
+	if !ok && !dryRun {
+		return 0, false, fmt.Errorf("%s: %w", uri, storage.ErrDeleteNotSupported)
+	}
+	size, err = objectSize(ctx, st, catalog, path)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+	case err != nil:
+		return 0, false, fmt.Errorf("stat %s: %w", uri, err)
+	default:
+		found = true
+	}
+	if dryRun {
+		return size, found, nil
+	}
+	if err := del.Delete(ctx, catalog, path); err != nil {
+		return 0, false, fmt.Errorf("delete %s: %w", uri, err)
+	}
+	return size, found, nil
+}
+
+// objectSize asks a storage.Stater; other backends are sized by reading the
+// object.
+func objectSize(ctx context.Context, st storage.Storage, catalog, path string) (int64, error) {
+	if s, ok := st.(storage.Stater); ok {
+		info, err := s.Stat(ctx, catalog, path)
+		return info.Size, err
+	}
+	data, err := st.Get(ctx, catalog, path)
+	return int64(len(data)), err
+}
+
+// gcMarkTTL bounds a delete mark claimDelta takes: how long a GC that dies
+// between mark and delete blocks WriteBegin from that object.
+const gcMarkTTL = time.Minute
+
+// claimDelta readies a delta object for deletion. A content-addressed one
+// may be pinned by an outstanding WriteBegin — claimed is then false, leave
+// it — or pinned the moment after a check, so unless dryRun claimDelta
+// takes the object's delete mark instead, which PinObject refuses until
+// release. UUID objects are never pinned (one write each), so they cost no
+// Redis call.
+func (c *Client) claimDelta(ctx context.Context, catalog, uri string, dryRun bool) (claimed bool, release func(), err error) {
+	release = func() {}
+	_, _, path, err := objkey.ParseURI(uri)
+	if err != nil || !objkey.IsContentDeltaPath(path) {
+		return true, release, nil
+	}
+	if dryRun {
+		pinned, err := c.reader.ObjectPinned(ctx, catalog, path)
+		return !pinned, release, err
+	}
+	marked, err := c.writer.MarkObjectDeleting(ctx, catalog, path, int64(gcMarkTTL/time.Second))
+	if err != nil || !marked {
+		return false, release, err
+	}
+	// Best-effort: a mark left behind lapses after gcMarkTTL.
+	return true, func() { _ = c.writer.UnmarkObjectDeleting(context.WithoutCancel(ctx), catalog, path) }, nil
+}
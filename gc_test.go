@@ -0,0 +1,149 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// deletableBucket is presignBucket that also forwards storage.Deleter, so GC
+// can reclaim through the test resolver.
+type deletableBucket struct{ presignBucket }
+
+func (b deletableBucket) Delete(ctx context.Context, catalog, path string) error {
+	return b.Storage.(storage.Deleter).Delete(ctx, catalog, path)
+}
+
+func TestGC_ValidatesCatalogBeforeRedis(t *testing.T) {
+	c := newDeadClient(t)
+	if _, err := c.GC(context.Background(), "bad|name", GCOptions{}); err == nil || !strings.Contains(err.Error(), "invalid catalog") {
+		t.Fatalf("expected invalid catalog error, got %v", err)
+	}
+}
+
+// TestGCRoundTrip_Redis: GC reclaims the superseded snapshot and every
+// absorbed delta object, trims their index entries, and changes no read
+// result; DryRun and MinAge reclaim nothing.
+func TestGCRoundTrip_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return deletableBucket{presignBucket{store.Bucket(bucket)}}, nil
+	}
+	c := New(prefix, rdb, resolve, WithSnapTarget("mem", "snaps"))
+	ctx := context.Background()
+
+	var deltaKeys []string
+	writeAndSnap := func(path, body string) *SnapInfo {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+		deltaKeys = append(deltaKeys, h.Key)
+		list := c.List(ctx, "users")
+		if _, err := ReadString(ctx, list); err != nil {
+			t.Fatalf("ReadString: %v", err)
+		}
+		stop := list.NextSnap().StopTsSeq
+		var snap *SnapInfo
+		if !waitFor(func() bool {
+			snap, _ = c.reader.GetLatestSnap(ctx, "users")
+			return snap != nil && snap.StopTsSeq == stop
+		}) {
+			t.Fatal("snapshot was not indexed within timeout")
+		}
+		return snap
+	}
+
+	first := writeAndSnap("/a", `1`)
+	second := writeAndSnap("/b", `2`)
+	doc, err := ReadString(ctx, c.List(ctx, "users"))
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+
+	if rep, err := c.GC(ctx, "users", GCOptions{MinAge: time.Hour}); err != nil || *rep != (GCReport{}) {
+		t.Fatalf("GC within MinAge: rep=%+v err=%v, want nothing reclaimed", rep, err)
+	}
+	rep, err := c.GC(ctx, "users", GCOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("GC dry run: %v", err)
+	}
+	if rep.SnapObjects != 1 || rep.DeltaObjects != 2 || rep.Bytes == 0 || rep.IndexEntries != 0 {
+		t.Fatalf("dry run report = %+v, want 1 snap + 2 deltas, bytes, no trim", rep)
+	}
+	_, _, firstPath, _ := objkey.ParseURI(first.URI)
+	if _, err := store.Bucket("snaps").Get(ctx, "users", firstPath); err != nil {
+		t.Fatalf("dry run deleted the superseded snapshot: %v", err)
+	}
+
+	rep, err = c.GC(ctx, "users", GCOptions{})
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if rep.SnapObjects != 1 || rep.DeltaObjects != 2 || rep.IndexEntries != 2 {
+		t.Fatalf("report = %+v, want 1 snap + 2 deltas + 2 index entries", rep)
+	}
+	if _, err := store.Bucket("snaps").Get(ctx, "users", firstPath); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("superseded snapshot still present (err=%v)", err)
+	}
+	_, _, secondPath, _ := objkey.ParseURI(second.URI)
+	if _, err := store.Bucket("snaps").Get(ctx, "users", secondPath); err != nil {
+		t.Fatalf("current snapshot was reclaimed: %v", err)
+	}
+	for _, k := range deltaKeys {
+		if _, err := store.Bucket("data").Get(ctx, "users", k); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("absorbed delta %s still present (err=%v)", k, err)
+		}
+	}
+
+	got, err := ReadString(ctx, c.List(ctx, "users"))
+	if err != nil || got != doc {
+		t.Fatalf("GC changed the read result: %q (err=%v), want %q", got, err, doc)
+	}
+	if rep, err := c.GC(ctx, "users", GCOptions{}); err != nil || *rep != (GCReport{}) {
+		t.Fatalf("second GC: rep=%+v err=%v, want nothing left", rep, err)
+	}
+}
+
+// TestGC_RequiresDeleter: a backend without storage.Deleter cannot be
+// reclaimed — GC says so instead of silently reporting nothing.
+func TestGC_RequiresDeleter(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	c := New(prefix, rdb, resolve)
+	ctx := context.Background()
+	if err := c.writer.AddSnap(ctx, "users", TimeSeqID{Timestamp: 1700000000, SeqID: 1}, "mem://snaps/a.snap", "0"); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	if err := c.writer.AddSnap(ctx, "users", TimeSeqID{Timestamp: 1700000001, SeqID: 1}, "mem://snaps/b.snap", "0"); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	if _, err := c.GC(ctx, "users", GCOptions{}); !errors.Is(err, storage.ErrDeleteNotSupported) {
+		t.Fatalf("GC without Deleter: err=%v, want ErrDeleteNotSupported", err)
+	}
+}
@@ -0,0 +1,85 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestMemoryIndexClient runs a whole Client on NewMemoryIndex — no Redis:
+// writes, reads, auto-snapshots, RemoveDelta, Compact and an uncached
+// Sampler all work; the Redis-only operations refuse cleanly.
+func TestMemoryIndexClient(t *testing.T) {
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	c := NewWithIndex("edge", NewMemoryIndex(), resolve, WithSnapTarget("mem", "snaps"))
+	defer c.Close()
+	ctx := context.Background()
+
+	write := func(path, body string) {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+	write("/a", `1`)
+	write("/b", `2`)
+	list := c.List(ctx, "users")
+	if got, err := ReadString(ctx, list); err != nil || got != `{"a":1,"b":2}` {
+		t.Fatalf("read = %q (err=%v)", got, err)
+	}
+	if !waitFor(func() bool { snap, _ := c.idx.LatestSnap(ctx, "users"); return snap != nil }) {
+		t.Fatal("snapshot was not indexed within timeout")
+	}
+	if n, err := c.Compact(ctx, "users"); err != nil || n != 2 {
+		t.Fatalf("Compact = %d (err=%v), want 2", n, err)
+	}
+
+	write("/c", `3`)
+	list = c.List(ctx, "users")
+	if list.LatestSnap == nil || len(list.Entries) != 1 {
+		t.Fatalf("list = %+v, want the snapshot and one delta", list)
+	}
+	if ok, err := c.RemoveDelta(ctx, "users", list.Entries[0].TsSeq.String()); err != nil || !ok {
+		t.Fatalf("RemoveDelta = %v (err=%v)", ok, err)
+	}
+	if got, err := ReadString(ctx, c.List(ctx, "users")); err != nil || got != `{"a":1,"b":2}` {
+		t.Fatalf("read after removal = %q (err=%v)", got, err)
+	}
+
+	var runs atomic.Int32
+	s := NewSampler("keys", func(l *ListResult) (int, error) { runs.Add(1); return len(l.Entries), nil })
+	for range 2 {
+		if _, err := s.Sample(ctx, c.List(ctx, "users")); err != nil {
+			t.Fatalf("Sample: %v", err)
+		}
+	}
+	if runs.Load() != 2 {
+		t.Fatalf("loader ran %d times, want 2 (no sample cache)", runs.Load())
+	}
+	if n, err := c.InvalidateSamples(ctx, "keys", "users"); err != nil || n != 0 {
+		t.Fatalf("InvalidateSamples = %d (err=%v)", n, err)
+	}
+
+	if _, err := c.GC(ctx, "users", GCOptions{}); !errors.Is(err, ErrIndexNotSupported) {
+		t.Fatalf("GC err = %v, want ErrIndexNotSupported", err)
+	}
+	if _, err := c.Scrub(ctx, ScrubOptions{}); !errors.Is(err, ErrIndexNotSupported) {
+		t.Fatalf("Scrub err = %v, want ErrIndexNotSupported", err)
+	}
+}
@@ -0,0 +1,202 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CatalogDump is one catalog's complete index state as ExportCatalog reads
+// it: the raw snap value ("" = none), removal generation, allocator floor
+// ("" = none) and every delta member with its score, absorbed or not.
+type CatalogDump struct {
+	Snap      string
+	RemoveGen string
+	Alloc     string
+	Deltas    []redis.Z
+}
+
+// ExportCatalog reads the catalog's index state in one MULTI/EXEC, so the
+// pieces are mutually consistent (a Notify or Compact cannot land between
+// them). All keys share the catalog's slot under LayoutCluster.
+func (r *Reader) ExportCatalog(ctx context.Context, catalog string) (*CatalogDump, error) {
+	var fields snapFieldsCmd
+	var alloc *redis.StringCmd
+	var zs *redis.ZSliceCmd
+	_, err := r.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		fields = r.queueSnapFields(ctx, pipe, catalog, catalog, catalog+":rg")
+		alloc = pipe.Get(ctx, r.MakeSeqAllocKey(catalog))
+		zs = pipe.ZRangeWithScores(ctx, r.MakeDeltaZsetKey(catalog), 0, -1)
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	for _, cmd := range []redis.Cmder{fields.snaps, alloc, zs} {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			return nil, err
+		}
+	}
+	vals := fields.Val()
+	d := &CatalogDump{Alloc: alloc.Val(), Deltas: zs.Val(), RemoveGen: "0"}
+	d.Snap, _ = vals[0].(string)
+	if rg, ok := vals[1].(string); ok {
+		d.RemoveGen = rg
+	}
+	return d, nil
+}
+
+// IterateSnapCatalogs streams the catalog of every snap-hash field whose
+// name starts with catalogPrefix — snap pointers and removal generations
+// alike, so a catalog whose only state is its generation is found too; an
+// expiry policy alone is not state. A catalog may be yielded twice.
+func (r *Reader) IterateSnapCatalogs(ctx context.Context, catalogPrefix string, fn func(catalog string) bool) error {
+	errStop := errors.New("stop")
+	err := iterateSnapFields(ctx, r.rdb, &r.indexIO, catalogPrefix, func(field, _ string) error {
+		if strings.HasSuffix(field, ":x") {
+			return nil
+		}
+		if !fn(strings.TrimSuffix(field, ":rg")) {
+			return errStop
+		}
+		return nil
+	})
+	if err == errStop {
+		return nil
+	}
+	return err
+}
+
+// importScalarsScript merges a dump's scalar state into the catalog, never
+// moving anything backwards, so importing the same dump twice — or an older
+// one over newer state — is a no-op. A tombstoned catalog (see
+// deleteCatalogScript) refuses with a "catalog deleted" error instead:
+//
+//   - the snap pointer is set only if absent, undecodable, or older;
+//   - the removal generation is raised to the dump's, never lowered (an
+//     unparseable stored value is left alone);
+//   - the allocator floor is raised to the dump's (7-day TTL, as Notify).
+//
+// KEYS[1] = snaps hash, KEYS[2] = allocator key, KEYS[3] = legacy snaps
+// hash (see snapsLua), KEYS[4] = tombstone. ARGV[1] catalog, ARGV[2]
+// snap value ("" = none), ARGV[3] its stop score, ARGV[4] removal generation,
+// ARGV[5] allocator pair ("" = none), ARGV[6] its score.
+const importScalarsScript = snapScoreLua + snapsLua + `
+if redis.call("EXISTS", KEYS[4]) == 1 then
+  return redis.error_reply("` + deletedReply + `")
+end
+local snaps = snaps_of(KEYS[1], KEYS[3], ARGV[1])
+if ARGV[2] ~= "" then
+  local cur = redis.call("HGET", snaps, ARGV[1])
+  local score = cur and snap_score(cur)
+  if not score or score < tonumber(ARGV[3]) then
+    redis.call("HSET", snaps, ARGV[1], ARGV[2])
+  end
+end
+local rg = redis.call("HGET", snaps, ARGV[1] .. ":rg")
+if tonumber(ARGV[4]) > 0 and (not rg or (tonumber(rg) and tonumber(rg) < tonumber(ARGV[4]))) then
+  redis.call("HSET", snaps, ARGV[1] .. ":rg", ARGV[4])
+end
+if ARGV[5] ~= "" then
+  local cur = redis.call("GET", KEYS[2])
+  local score = cur and tsseq_score(cur)
+  if not score or score < tonumber(ARGV[6]) then
+    redis.call("SET", KEYS[2], ARGV[5], "EX", 604800)
+  end
+end
+return 1
+`
+
+var luaImportScalars = NewScript(importScalarsScript)
+
+// importDeltasScript adds one batch of a dump's delta members under their
+// scores (re-adding a present member is a no-op) — unless the catalog's
+// removal generation is above the dump's: a RemoveDelta happened after the
+// export, and re-adding its member would bring the removed delta back. The
+// batch is then left out whole; the dump cannot tell which members were
+// removed. An unparseable stored generation is treated as 0, as
+// importScalarsScript leaves it. A tombstoned catalog refuses with a
+// "catalog deleted" error before anything is added, so an import cannot
+// recreate a catalog DeleteCatalog just retired.
+//
+// KEYS[1] = delta zset, KEYS[2] = snaps hash, KEYS[3] = legacy snaps hash
+// (see snapsLua), KEYS[4] = tombstone. ARGV[1] catalog, ARGV[2] the dump's removal generation,
+// then (score, member) pairs. Returns 1 when added, 0 when left out.
+const importDeltasScript = snapsLua + `
+if redis.call("EXISTS", KEYS[4]) == 1 then
+  return redis.error_reply("` + deletedReply + `")
+end
+local snaps = snaps_of(KEYS[2], KEYS[3], ARGV[1])
+local rg = tonumber(redis.call("HGET", snaps, ARGV[1] .. ":rg") or "0") or 0
+if rg > tonumber(ARGV[2]) then
+  return 0
+end
+for i = 3, #ARGV, 2 do
+  redis.call("ZADD", KEYS[1], ARGV[i], ARGV[i + 1])
+end
+return 1
+`
+
+var luaImportDeltas = NewScript(importDeltasScript)
+
+// importBatch bounds the members per importDeltasScript call.
+const importBatch = 512
+
+// ImportCatalog merges d into the catalog: the delta members are added
+// by importDeltasScript, then the scalars are merged by
+// importScalarsScript. Deltas are left out when the catalog has seen a
+// RemoveDelta the dump does not know of (a higher removal generation), so
+// an older dump never resurrects a removed delta. While the catalog's
+// tombstone is in place it fails with ErrCatalogDeleted. The caller
+// validates d first.
+func (w *Writer) ImportCatalog(ctx context.Context, catalog string, d *CatalogDump) error {
+	rg := d.RemoveGen
+	if rg == "" {
+		rg = "0"
+	}
+	keys := []string{w.MakeDeltaZsetKey(catalog), w.MakeSnapsHashKey(catalog), w.legacySnapsKey(catalog), w.MakeTombstoneKey(catalog)}
+	for start := 0; start < len(d.Deltas); start += importBatch {
+		end := min(start+importBatch, len(d.Deltas))
+		args := make([]any, 0, 2+2*(end-start))
+		args = append(args, catalog, rg)
+		for _, z := range d.Deltas[start:end] {
+			args = append(args, z.Score, z.Member)
+		}
+		if err := RunScript(ctx, w.rdb, luaImportDeltas, keys, args...).Err(); err != nil {
+			return importErr("import deltas", err)
+		}
+	}
+	var snapScore, allocScore float64
+	if d.Snap != "" {
+		stop, _, err := DecodeSnapValue(d.Snap)
+		if err != nil {
+			return err
+		}
+		snapScore = stop.Score()
+	}
+	if d.Alloc != "" {
+		id, err := ParseTimeSeqID(d.Alloc)
+		if err != nil {
+			return fmt.Errorf("invalid allocator %q: %w", d.Alloc, err)
+		}
+		allocScore = id.Score()
+	}
+	if err := RunScript(ctx, w.rdb, luaImportScalars,
+		[]string{w.MakeSnapsHashKey(catalog), w.MakeSeqAllocKey(catalog), w.legacySnapsKey(catalog), w.MakeTombstoneKey(catalog)},
+		catalog, d.Snap, snapScore, rg, d.Alloc, allocScore,
+	).Err(); err != nil {
+		return importErr("import eval", err)
+	}
+	return nil
+}
+
+// importErr maps the import scripts' deleted reply to ErrCatalogDeleted.
+func importErr(op string, err error) error {
+	if strings.HasPrefix(err.Error(), deletedReply) {
+		return fmt.Errorf("%s: %w", op, ErrCatalogDeleted)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
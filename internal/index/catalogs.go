@@ -0,0 +1,158 @@
+package index
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CatalogStats is one catalog's cheap index statistics — counts only, no
+// member is read.
+type CatalogStats struct {
+	Catalog string
+	Snap    *SnapInfo // nil if the catalog has no snapshot
+	Deltas  int64     // entries in the delta index, absorbed ones included
+	Backlog int64     // entries past the snap stop: what a read replays
+}
+
+// CatalogIterator is the optional Index capability of enumerating catalogs.
+// IterateCatalogs yields every catalog whose name starts with prefix and
+// that has index state — deltas, a snap pointer or a removal generation —
+// in name order, until fn returns false.
+type CatalogIterator interface {
+	IterateCatalogs(ctx context.Context, prefix string, fn func(CatalogStats) bool) error
+}
+
+var (
+	_ CatalogIterator = (*Reader)(nil)
+	_ CatalogIterator = (*Memory)(nil)
+)
+
+// IterateCatalogs collects the names from the delta keys and the snap
+// fields (both SCANned with the prefix escaped into MATCH), then reads the
+// stats of each page of names in two pipelined round-trips. The name set
+// is held in memory to merge the two sources; stats are not an atomic
+// observation of the catalog.
+func (r *Reader) IterateCatalogs(ctx context.Context, prefix string, fn func(CatalogStats) bool) error {
+	seen := map[string]struct{}{}
+	add := func(catalog string) bool {
+		if strings.HasPrefix(catalog, prefix) {
+			seen[catalog] = struct{}{}
+		}
+		return true
+	}
+	if err := r.IterateDeltaCatalogs(ctx, prefix, add); err != nil {
+		return err
+	}
+	if err := r.IterateSnapCatalogs(ctx, prefix, add); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(seen))
+	for catalog := range seen {
+		names = append(names, catalog)
+	}
+	slices.Sort(names)
+	for page := range slices.Chunk(names, snapScanBatch) {
+		stats, err := r.catalogStats(ctx, page)
+		if err != nil {
+			return err
+		}
+		for _, st := range stats {
+			if !fn(st) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// catalogStats reads the stats of catalogs: snap pointer, expiry and delta
+// count in one pipeline, then the backlog of the snapshotted ones in
+// another. Expired catalogs are left out.
+func (r *Reader) catalogStats(ctx context.Context, catalogs []string) ([]CatalogStats, error) {
+	pipe := r.rdb.Pipeline()
+	snaps := make([]snapFieldsCmd, len(catalogs))
+	cards := make([]*redis.IntCmd, len(catalogs))
+	for i, catalog := range catalogs {
+		snaps[i] = r.queueSnapFields(ctx, pipe, catalog, catalog, catalog+":x")
+		cards[i] = pipe.ZCard(ctx, r.MakeDeltaZsetKey(catalog))
+	}
+	now := pipe.Time(ctx)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	out := make([]CatalogStats, 0, len(catalogs))
+	pipe = r.rdb.Pipeline()
+	backlogs := make([]*redis.IntCmd, len(catalogs))
+	for i, catalog := range catalogs {
+		vals := snaps[i].Val()
+		if expiredAt(vals[1], now.Val()) {
+			continue
+		}
+		out = append(out, CatalogStats{Catalog: catalog, Deltas: cards[i].Val(), Backlog: cards[i].Val()})
+		val, ok := vals[0].(string)
+		if !ok {
+			continue
+		}
+		stop, uri, err := DecodeSnapValue(val)
+		if err != nil {
+			continue
+		}
+		st := &out[len(out)-1]
+		st.Snap = &SnapInfo{StopTsSeq: stop, URI: uri}
+		if st.Deltas > 0 {
+			// The same exclusive bound listScript reads past.
+			after := "(" + strconv.FormatFloat(stop.Score(), 'f', -1, 64)
+			backlogs[len(out)-1] = pipe.ZCount(ctx, r.MakeDeltaZsetKey(catalog), after, "+inf")
+		}
+	}
+	if pipe.Len() > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	for i, cmd := range backlogs {
+		if cmd != nil {
+			out[i].Backlog = cmd.Val()
+		}
+	}
+	return out, nil
+}
+
+// IterateCatalogs yields the catalogs present when it starts; fn runs
+// without the lock held.
+func (m *Memory) IterateCatalogs(ctx context.Context, prefix string, fn func(CatalogStats) bool) error {
+	m.mu.Lock()
+	m.expireDue()
+	stats := make([]CatalogStats, 0, len(m.catalogs))
+	for name, c := range m.catalogs {
+		if !strings.HasPrefix(name, prefix) || (len(c.deltas) == 0 && c.snap == nil && c.removeGen == 0) {
+			continue
+		}
+		st := CatalogStats{Catalog: name, Deltas: int64(len(c.deltas)), Backlog: int64(len(c.deltas))}
+		if c.snap != nil {
+			s := *c.snap
+			st.Snap = &s
+			for _, d := range c.deltas {
+				if d.Score <= s.Score() {
+					st.Backlog--
+				}
+			}
+		}
+		stats = append(stats, st)
+	}
+	m.mu.Unlock()
+	slices.SortFunc(stats, func(a, b CatalogStats) int { return strings.Compare(a.Catalog, b.Catalog) })
+	for _, st := range stats {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(st) {
+			return nil
+		}
+	}
+	return nil
+}
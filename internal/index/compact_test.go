@@ -40,7 +40,7 @@ func TestCompactDeltas(t *testing.T) {
 
 	// A snap pointer the Go reader rejects must never authorize a trim, no
 	// matter how high it scores.
-	if err := rdb.HSet(ctx, w.MakeSnapsHashKey(), catalog, `["9999999999_1",""]`).Err(); err != nil {
+	if err := rdb.HSet(ctx, w.MakeSnapsHashKey(catalog), catalog, `["9999999999_1",""]`).Err(); err != nil {
 		t.Fatalf("HSet corrupt snap: %v", err)
 	}
 	if n, err = w.CompactDeltas(ctx, catalog); err != nil || n != 0 {
@@ -0,0 +1,577 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testIndexConformance is the contract every Index implementation must meet
+// (see Index). newIndex returns a fresh, empty index per subtest.
+func testIndexConformance(t *testing.T, newIndex func(t *testing.T) Index) {
+	ctx := context.Background()
+	notify := func(t *testing.T, x Index, catalog, path string) TimeSeqID {
+		t.Helper()
+		id, _, err := x.Notify(ctx, catalog, path, MergeTypeReplace, "mem://data/"+catalog+path+".dat")
+		if err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+		return id
+	}
+	later := func(a, b TimeSeqID) bool { return a.Score() > b.Score() }
+
+	t.Run("Empty", func(t *testing.T) {
+		x := newIndex(t)
+		snap, rr := x.List(ctx, "users")
+		if snap != nil || rr.Err != nil || len(rr.Deltas) != 0 || rr.RemoveGen != "0" {
+			t.Fatalf("List = %+v, %+v", snap, rr)
+		}
+		if s, err := x.LatestSnap(ctx, "users"); s != nil || err != nil {
+			t.Fatalf("LatestSnap = %+v, %v", s, err)
+		}
+		if g, err := x.RemoveGen(ctx, "users"); g != "0" || err != nil {
+			t.Fatalf("RemoveGen = %q, %v", g, err)
+		}
+		id := TimeSeqID{Timestamp: 1700000000, SeqID: 1}
+		if ok, err := x.HasDelta(ctx, "users", id); ok || err != nil {
+			t.Fatalf("HasDelta = %v, %v", ok, err)
+		}
+		if ok, err := x.RemoveDelta(ctx, "users", id); ok || err != nil {
+			t.Fatalf("RemoveDelta = %v, %v", ok, err)
+		}
+		if n, err := x.Compact(ctx, "users"); n != 0 || err != nil {
+			t.Fatalf("Compact = %d, %v", n, err)
+		}
+	})
+
+	t.Run("NotifyOrder", func(t *testing.T) {
+		x := newIndex(t)
+		ids := []TimeSeqID{notify(t, x, "users", "/a"), notify(t, x, "users", "/b"), notify(t, x, "users", "/c")}
+		if !later(ids[1], ids[0]) || !later(ids[2], ids[1]) {
+			t.Fatalf("tsSeqs not increasing: %v", ids)
+		}
+		if now := x.NowUnix(); ids[0].Timestamp < now-5 || ids[0].Timestamp > now+5 {
+			t.Fatalf("tsSeq %v far from the index clock %d", ids[0], now)
+		}
+		_, rr := x.List(ctx, "users")
+		if rr.Err != nil || len(rr.Deltas) != 3 {
+			t.Fatalf("List = %+v", rr)
+		}
+		for i, d := range rr.Deltas {
+			if d.TsSeq != ids[i] || d.Score != ids[i].Score() || d.Path != []string{"/a", "/b", "/c"}[i] ||
+				d.MergeType != MergeTypeReplace || d.URI != "mem://data/users"+d.Path+".dat" {
+				t.Fatalf("delta %d = %+v", i, d)
+			}
+			if dec, err := DecodeDeltaMember(d.Member, d.Score); err != nil || dec.TsSeq != d.TsSeq {
+				t.Fatalf("member %q does not decode: %v", d.Member, err)
+			}
+		}
+	})
+
+	t.Run("AllocationFloors", func(t *testing.T) {
+		x := newIndex(t)
+		stop := TimeSeqID{Timestamp: x.NowUnix() + 1000, SeqID: 5}
+		if err := x.AddSnap(ctx, "users", stop, "mem://snaps/s.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		id := notify(t, x, "users", "/a")
+		if !later(id, stop) {
+			t.Fatalf("Notify issued %v, not after the snap stop %v", id, stop)
+		}
+		if next := notify(t, x, "users", "/b"); next != (TimeSeqID{Timestamp: id.Timestamp, SeqID: id.SeqID + 1}) {
+			t.Fatalf("Notify after %v issued %v", id, next)
+		}
+		if _, rr := x.List(ctx, "users"); len(rr.Deltas) != 2 {
+			t.Fatalf("List after a future snap = %+v, want both deltas", rr)
+		}
+	})
+
+	t.Run("TsSeqV2", func(t *testing.T) {
+		x := newIndex(t)
+		setVersion := x.(interface{ SetTsSeqVersion(TsSeqVersion) }).SetTsSeqVersion
+		v1 := notify(t, x, "users", "/a")
+		setVersion(TsSeqV2)
+		ids := []TimeSeqID{notify(t, x, "users", "/b"), notify(t, x, "users", "/c")}
+		if ids[0].Version() != TsSeqV2 || !later(ids[0], v1) || !later(ids[1], ids[0]) {
+			t.Fatalf("TsSeqV2 after %v issued %v", v1, ids)
+		}
+		if now := x.NowUnix(); ids[0].Timestamp < now-5 || ids[0].Timestamp > now+5 {
+			t.Fatalf("tsSeq %v far from the index clock %d", ids[0], now)
+		}
+		ms := (x.NowUnix() + 1000) * 1000
+		stop := timeSeqIDMs(ms, MaxSeqIDMs(ms))
+		if err := x.AddSnap(ctx, "users", stop, "mem://snaps/s.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		if id := notify(t, x, "users", "/d"); id != timeSeqIDMs(ms+1, 1) {
+			t.Fatalf("Notify after the full millisecond %v issued %v", stop, id)
+		}
+		setVersion(TsSeqV1) // the catalog holds TsSeqV2 IDs: it keeps them
+		if id := notify(t, x, "users", "/e"); id != timeSeqIDMs(ms+1, 2) {
+			t.Fatalf("TsSeqV1 writer on a TsSeqV2 catalog issued %v", id)
+		}
+		snap, rr := x.List(ctx, "users")
+		if rr.Err != nil || snap == nil || snap.StopTsSeq != stop || len(rr.Deltas) != 2 {
+			t.Fatalf("List = %+v, %+v", snap, rr)
+		}
+		for _, d := range rr.Deltas {
+			if dec, err := DecodeDeltaMember(d.Member, d.Score); err != nil || dec.TsSeq != d.TsSeq {
+				t.Fatalf("member %q does not decode: %v", d.Member, err)
+			}
+		}
+		if n, err := x.Compact(ctx, "users"); n != 3 || err != nil {
+			t.Fatalf("Compact = %d, %v; want the three deltas under the stop", n, err)
+		}
+	})
+
+	t.Run("ConcurrentNotify", func(t *testing.T) {
+		x := newIndex(t)
+		var mu sync.Mutex
+		seen := map[TimeSeqID]bool{}
+		var wg sync.WaitGroup
+		for range 32 {
+			wg.Go(func() {
+				id, _, err := x.Notify(ctx, "users", "/a", MergeTypeReplace, "mem://data/a.dat")
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil || seen[id] {
+					t.Errorf("Notify = %v, %v (duplicate or failed)", id, err)
+				}
+				seen[id] = true
+			})
+		}
+		wg.Wait()
+		if _, rr := x.List(ctx, "users"); len(rr.Deltas) != 32 {
+			t.Fatalf("List = %d deltas, want 32", len(rr.Deltas))
+		}
+	})
+
+	t.Run("SnapPointer", func(t *testing.T) {
+		x := newIndex(t)
+		a := notify(t, x, "users", "/a")
+		b := notify(t, x, "users", "/b")
+		if err := x.AddSnap(ctx, "users", a, "mem://snaps/a.snap", "0"); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		snap, rr := x.List(ctx, "users")
+		if snap == nil || snap.StopTsSeq != a || snap.URI != "mem://snaps/a.snap" || len(rr.Deltas) != 1 || rr.Deltas[0].TsSeq != b {
+			t.Fatalf("List after snap = %+v, %+v", snap, rr)
+		}
+		// The pointer never moves back, nor sideways.
+		for _, stop := range []TimeSeqID{{Timestamp: a.Timestamp - 1, SeqID: 1}, a} {
+			if err := x.AddSnap(ctx, "users", stop, "mem://snaps/old.snap", "0"); err != nil {
+				t.Fatalf("AddSnap: %v", err)
+			}
+		}
+		if s, _ := x.LatestSnap(ctx, "users"); s == nil || s.URI != "mem://snaps/a.snap" {
+			t.Fatalf("pointer moved back: %+v", s)
+		}
+		if err := x.AddSnap(ctx, "users", b, "mem://snaps/b.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		if s, _ := x.LatestSnap(ctx, "users"); s == nil || s.StopTsSeq != b {
+			t.Fatalf("pointer did not advance: %+v", s)
+		}
+	})
+
+	t.Run("RemoveDelta", func(t *testing.T) {
+		x := newIndex(t)
+		a := notify(t, x, "users", "/a")
+		b := notify(t, x, "users", "/b")
+		if ok, err := x.HasDelta(ctx, "users", a); !ok || err != nil {
+			t.Fatalf("HasDelta = %v, %v", ok, err)
+		}
+		_, before := x.List(ctx, "users")
+		if ok, err := x.RemoveDelta(ctx, "users", a); !ok || err != nil {
+			t.Fatalf("RemoveDelta = %v, %v", ok, err)
+		}
+		if ok, _ := x.RemoveDelta(ctx, "users", a); ok {
+			t.Fatal("second RemoveDelta reported a removal")
+		}
+		if g, _ := x.RemoveGen(ctx, "users"); g != "1" {
+			t.Fatalf("RemoveGen = %q, want 1", g)
+		}
+		_, rr := x.List(ctx, "users")
+		if rr.RemoveGen != "1" || len(rr.Deltas) != 1 || rr.Deltas[0].TsSeq != b {
+			t.Fatalf("List after removal = %+v", rr)
+		}
+		// A snapshot computed before the removal is refused.
+		if err := x.AddSnap(ctx, "users", b, "mem://snaps/stale.snap", before.RemoveGen); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		if s, _ := x.LatestSnap(ctx, "users"); s != nil {
+			t.Fatalf("stale-generation snapshot accepted: %+v", s)
+		}
+		if err := x.AddSnap(ctx, "users", b, "mem://snaps/b.snap", rr.RemoveGen); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		if s, _ := x.LatestSnap(ctx, "users"); s == nil || s.StopTsSeq != b {
+			t.Fatalf("current-generation snapshot refused: %+v", s)
+		}
+	})
+
+	t.Run("Compact", func(t *testing.T) {
+		x := newIndex(t)
+		a := notify(t, x, "users", "/a")
+		b := notify(t, x, "users", "/b")
+		c := notify(t, x, "users", "/c")
+		if err := x.AddSnap(ctx, "users", b, "mem://snaps/b.snap", "0"); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		if n, err := x.Compact(ctx, "users"); n != 2 || err != nil {
+			t.Fatalf("Compact = %d, %v, want 2", n, err)
+		}
+		if ok, _ := x.HasDelta(ctx, "users", a); ok {
+			t.Fatal("compacted delta still present")
+		}
+		if _, rr := x.List(ctx, "users"); len(rr.Deltas) != 1 || rr.Deltas[0].TsSeq != c {
+			t.Fatalf("List after compact = %+v", rr)
+		}
+		if n, _ := x.Compact(ctx, "users"); n != 0 {
+			t.Fatalf("second Compact = %d", n)
+		}
+	})
+
+	t.Run("BatchList", func(t *testing.T) {
+		x := newIndex(t)
+		notify(t, x, "a", "/x")
+		b := notify(t, x, "b", "/x")
+		if err := x.AddSnap(ctx, "b", b, "mem://snaps/b.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		out := x.BatchList(ctx, []string{"a", "b", "c"})
+		if len(out) != 3 {
+			t.Fatalf("BatchList = %d results", len(out))
+		}
+		if r := out["a"]; r.Snap != nil || len(r.ReadResult.Deltas) != 1 {
+			t.Fatalf("a = %+v", r)
+		}
+		if r := out["b"]; r.Snap == nil || r.Snap.StopTsSeq != b || len(r.ReadResult.Deltas) != 0 {
+			t.Fatalf("b = %+v", r)
+		}
+		if r := out["c"]; r.Snap != nil || r.ReadResult.Err != nil || len(r.ReadResult.Deltas) != 0 || r.ReadResult.RemoveGen != "0" {
+			t.Fatalf("c = %+v", r)
+		}
+	})
+
+	t.Run("IterateSnaps", func(t *testing.T) {
+		x := newIndex(t)
+		for _, cat := range []string{"a", "b", "c"} {
+			id := notify(t, x, cat, "/x")
+			if err := x.AddSnap(ctx, cat, id, "mem://snaps/"+cat+".snap", ""); err != nil {
+				t.Fatalf("AddSnap: %v", err)
+			}
+		}
+		notify(t, x, "d", "/x") // no snapshot
+		got := map[string]string{}
+		if err := x.IterateSnaps(ctx, func(cat string, s SnapInfo) bool { got[cat] = s.URI; return true }); err != nil {
+			t.Fatalf("IterateSnaps: %v", err)
+		}
+		if len(got) != 3 || got["b"] != "mem://snaps/b.snap" {
+			t.Fatalf("IterateSnaps = %v", got)
+		}
+		n := 0
+		if err := x.IterateSnaps(ctx, func(string, SnapInfo) bool { n++; return false }); err != nil || n != 1 {
+			t.Fatalf("IterateSnaps did not stop: n=%d err=%v", n, err)
+		}
+	})
+
+	t.Run("IterateCatalogs", func(t *testing.T) {
+		x := newIndex(t)
+		it, ok := x.(CatalogIterator)
+		if !ok {
+			t.Skip("optional capability not implemented")
+		}
+		notify(t, x, "tenant42/users", "/a")
+		stop := notify(t, x, "tenant42/users", "/b")
+		notify(t, x, "tenant42/users", "/c")
+		if err := x.AddSnap(ctx, "tenant42/users", stop, "mem://snaps/u.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		notify(t, x, "tenant42/orders", "/a")
+		snapOnly := notify(t, x, "tenant42/[x]", "/a")
+		if err := x.AddSnap(ctx, "tenant42/[x]", snapOnly, "mem://snaps/x.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		if n, err := x.Compact(ctx, "tenant42/[x]"); err != nil || n != 1 {
+			t.Fatalf("Compact = %d (err=%v)", n, err)
+		}
+		notify(t, x, "tenant420", "/a")
+		notify(t, x, "other", "/a")
+
+		var got []CatalogStats
+		if err := it.IterateCatalogs(ctx, "tenant42/", func(st CatalogStats) bool { got = append(got, st); return true }); err != nil {
+			t.Fatalf("IterateCatalogs: %v", err)
+		}
+		if len(got) != 3 || got[0].Catalog != "tenant42/[x]" || got[1].Catalog != "tenant42/orders" || got[2].Catalog != "tenant42/users" {
+			t.Fatalf("IterateCatalogs = %+v, want the three tenant42/ catalogs in order", got)
+		}
+		if x, o, u := got[0], got[1], got[2]; x.Snap == nil || x.Deltas != 0 || o.Snap != nil || o.Backlog != 1 ||
+			u.Snap == nil || u.Snap.StopTsSeq != stop || u.Deltas != 3 || u.Backlog != 1 {
+			t.Fatalf("stats = %+v", got)
+		}
+		n := 0
+		if err := it.IterateCatalogs(ctx, "", func(CatalogStats) bool { n++; return false }); err != nil || n != 1 {
+			t.Fatalf("IterateCatalogs did not stop: n=%d err=%v", n, err)
+		}
+	})
+
+	t.Run("DeleteCatalog", func(t *testing.T) {
+		x := newIndex(t)
+		del, ok := x.(CatalogDeleter)
+		if !ok {
+			t.Skip("optional capability not implemented")
+		}
+		notify(t, x, "users", "/a")
+		stop := notify(t, x, "users", "/b")
+		if err := x.AddSnap(ctx, "users", stop, "mem://snaps/u.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		last := notify(t, x, "users", "/c")
+		notify(t, x, "orders", "/a")
+
+		d, err := del.DeleteCatalog(ctx, "users", time.Minute)
+		if err != nil || len(d.Deltas) != 3 || len(d.Snaps) == 0 || d.Snaps[0].StopTsSeq != stop || d.Floor() != last {
+			t.Fatalf("DeleteCatalog = %+v (err=%v)", d, err)
+		}
+		if snap, rr := x.List(ctx, "users"); snap != nil || rr.Err != nil || len(rr.Deltas) != 0 || rr.RemoveGen != "0" {
+			t.Fatalf("List after delete = %+v, %+v", snap, rr)
+		}
+		if _, _, err := x.Notify(ctx, "users", "/d", MergeTypeReplace, "mem://data/d.dat"); !errors.Is(err, ErrCatalogDeleted) {
+			t.Fatalf("Notify on a tombstone err = %v, want ErrCatalogDeleted", err)
+		}
+		if err := x.AddSnap(ctx, "users", last, "mem://snaps/late.snap", ""); err != nil {
+			t.Fatalf("AddSnap on a tombstone: %v", err)
+		}
+		if snap, _ := x.LatestSnap(ctx, "users"); snap != nil {
+			t.Fatalf("AddSnap landed on a tombstone: %+v", snap)
+		}
+		if _, rr := x.List(ctx, "orders"); len(rr.Deltas) != 1 {
+			t.Fatalf("other catalog lost entries: %+v", rr)
+		}
+	})
+
+	t.Run("SeedSnap", func(t *testing.T) {
+		x := newIndex(t)
+		seed, ok := x.(CatalogSeeder)
+		if !ok {
+			t.Skip("optional capability not implemented")
+		}
+		stop := TimeSeqID{Timestamp: 1700000000, SeqID: 7}
+		if err := seed.SeedSnap(ctx, "draft", stop, "mem://snaps/d.snap"); err != nil {
+			t.Fatalf("SeedSnap: %v", err)
+		}
+		if snap, rr := x.List(ctx, "draft"); snap == nil || snap.StopTsSeq != stop || len(rr.Deltas) != 0 {
+			t.Fatalf("List after seed = %+v, %+v", snap, rr)
+		}
+		if err := seed.SeedSnap(ctx, "draft", stop, "mem://snaps/e.snap"); !errors.Is(err, ErrCatalogExists) {
+			t.Fatalf("second SeedSnap err = %v, want ErrCatalogExists", err)
+		}
+		if id := notify(t, x, "draft", "/a"); !later(id, stop) {
+			t.Fatalf("Notify after seed issued %v, not after %v", id, stop)
+		}
+		notify(t, x, "live", "/a")
+		if err := seed.SeedSnap(ctx, "live", stop, "mem://snaps/l.snap"); !errors.Is(err, ErrCatalogExists) {
+			t.Fatalf("SeedSnap over deltas err = %v, want ErrCatalogExists", err)
+		}
+	})
+
+	t.Run("CatalogDetails", func(t *testing.T) {
+		x := newIndex(t)
+		det, ok := x.(CatalogDetailer)
+		if !ok {
+			t.Skip("optional capability not implemented")
+		}
+		a := notify(t, x, "users", "/a")
+		b := notify(t, x, "users", "/b")
+		c := notify(t, x, "users", "/c")
+		if err := x.AddSnap(ctx, "users", b, "mem://snaps/b.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		if ok, err := x.RemoveDelta(ctx, "users", b); !ok || err != nil {
+			t.Fatalf("RemoveDelta = %v, %v", ok, err)
+		}
+		out, err := det.CatalogDetails(ctx, []string{"users", "none"})
+		if err != nil || len(out) != 2 {
+			t.Fatalf("CatalogDetails = %+v (err=%v)", out, err)
+		}
+		u := out[0]
+		if u.Catalog != "users" || u.Deltas != 2 || u.Backlog != 1 || u.Oldest != a || u.Newest != c ||
+			u.RemoveGen != "1" || u.Snap == nil || u.Snap.StopTsSeq != b || u.DeltaBytes <= 0 {
+			t.Fatalf("users = %+v", u)
+		}
+		if n := out[1]; n.Catalog != "none" || n.Deltas != 0 || n.Snap != nil || n.RemoveGen != "0" || n.DeltaBytes != 0 {
+			t.Fatalf("none = %+v", n)
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		x := newIndex(t)
+		exp, ok := x.(CatalogExpirer)
+		if !ok {
+			t.Skip("optional capability not implemented")
+		}
+		const ttl = 300 * time.Millisecond
+		advance := stepClock(x)
+		if err := exp.SetExpiry(ctx, "cart", -time.Second); err == nil {
+			t.Fatal("SetExpiry accepted a negative ttl")
+		}
+		if err := exp.SetExpiry(ctx, "cart", ttl); err != nil {
+			t.Fatalf("SetExpiry: %v", err)
+		}
+		stop := notify(t, x, "cart", "/a")
+		if err := x.AddSnap(ctx, "cart", stop, "mem://snaps/c.snap", ""); err != nil {
+			t.Fatalf("AddSnap: %v", err)
+		}
+		notify(t, x, "keep", "/a")
+		// Each write slides the deadline: the catalog outlives its first one.
+		for range 2 {
+			advance(ttl / 2)
+			notify(t, x, "cart", "/b")
+		}
+		if snap, rr := x.List(ctx, "cart"); snap == nil || len(rr.Deltas) != 2 {
+			t.Fatalf("List of a live catalog = %+v, %+v", snap, rr)
+		}
+
+		advance(ttl + 50*time.Millisecond)
+		if snap, rr := x.List(ctx, "cart"); snap != nil || rr.Err != nil || len(rr.Deltas) != 0 {
+			t.Fatalf("List after expiry = %+v, %+v", snap, rr)
+		}
+		if snap, _ := x.LatestSnap(ctx, "cart"); snap != nil {
+			t.Fatalf("LatestSnap after expiry = %+v", snap)
+		}
+		if err := x.AddSnap(ctx, "cart", stop, "mem://snaps/late.snap", ""); err != nil {
+			t.Fatalf("AddSnap after expiry: %v", err)
+		}
+		if it, ok := x.(CatalogIterator); ok {
+			var names []string
+			_ = it.IterateCatalogs(ctx, "", func(st CatalogStats) bool { names = append(names, st.Catalog); return true })
+			if !slices.Equal(names, []string{"keep"}) {
+				t.Fatalf("IterateCatalogs after expiry = %v", names)
+			}
+		}
+		if swept, err := exp.SweepExpired(ctx); err != nil || !slices.Equal(swept, []string{"cart"}) {
+			t.Fatalf("SweepExpired = %v (err=%v), want [cart]", swept, err)
+		}
+		if swept, err := exp.SweepExpired(ctx); err != nil || len(swept) != 0 {
+			t.Fatalf("second SweepExpired = %v (err=%v)", swept, err)
+		}
+
+		// The next write starts afresh, without the policy.
+		notify(t, x, "cart", "/c")
+		advance(ttl + 50*time.Millisecond)
+		if snap, rr := x.List(ctx, "cart"); snap != nil || len(rr.Deltas) != 1 {
+			t.Fatalf("List of the restarted catalog = %+v, %+v", snap, rr)
+		}
+		if _, rr := x.List(ctx, "keep"); len(rr.Deltas) != 1 {
+			t.Fatalf("other catalog lost entries: %+v", rr)
+		}
+
+		if del, ok := x.(CatalogDeleter); ok {
+			if _, err := del.DeleteCatalog(ctx, "keep", time.Minute); err != nil {
+				t.Fatalf("DeleteCatalog: %v", err)
+			}
+			if err := exp.SetExpiry(ctx, "keep", ttl); !errors.Is(err, ErrCatalogDeleted) {
+				t.Fatalf("SetExpiry on a tombstone err = %v, want ErrCatalogDeleted", err)
+			}
+		}
+	})
+}
+
+// stepClock returns a func that moves x's clock forward: a Memory index is
+// put on a fake clock, any other index waits in real time.
+func stepClock(x Index) func(time.Duration) {
+	m, ok := x.(*Memory)
+	if !ok {
+		return time.Sleep
+	}
+	var now atomic.Int64
+	now.Store(time.Now().UnixNano())
+	m.SetClock(func() time.Time { return time.Unix(0, now.Load()) })
+	return func(d time.Duration) { now.Add(int64(d)) }
+}
+
+func TestIndexConformance_Memory(t *testing.T) {
+	testIndexConformance(t, func(*testing.T) Index { return NewMemory() })
+}
+
+func TestIndexConformance_Redis(t *testing.T) {
+	testIndexConformance(t, func(t *testing.T) Index {
+		rdb, prefix := indexTestRedis(t)
+		r, w := NewReader(rdb), NewWriter(rdb)
+		r.SetPrefix(prefix)
+		w.SetPrefix(prefix)
+		t.Cleanup(r.Close)
+		return NewRedis(r, w)
+	})
+}
+
+// TestIndexConformance_RedisSharded runs the contract over SetSnapShards,
+// so every script resolves its catalog's shard.
+func TestIndexConformance_RedisSharded(t *testing.T) {
+	testIndexConformance(t, func(t *testing.T) Index {
+		rdb, prefix := indexTestRedis(t)
+		r, w := NewReader(rdb), NewWriter(rdb)
+		for _, io := range []*indexIO{&r.indexIO, &w.indexIO} {
+			io.SetPrefix(prefix)
+			io.SetSnapShards(3)
+		}
+		t.Cleanup(r.Close)
+		return NewRedis(r, w)
+	})
+}
+
+// TestMemoryNotify_ClockStepsBack: a backwards clock step can neither
+// repeat a tsSeq nor order a write before an earlier one.
+func TestMemoryNotify_ClockStepsBack(t *testing.T) {
+	m := NewMemory()
+	now := time.Now().Unix()
+	m.now = func() int64 { return now }
+	ctx := context.Background()
+	first, _, err := m.Notify(ctx, "users", "/a", MergeTypeReplace, "mem://data/a.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now -= 3600
+	second, _, err := m.Notify(ctx, "users", "/b", MergeTypeReplace, "mem://data/b.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != (TimeSeqID{Timestamp: first.Timestamp, SeqID: first.SeqID + 1}) {
+		t.Fatalf("after a clock step back: %v then %v", first, second)
+	}
+	m.now = func() int64 { return first.Timestamp }
+	m.catalogs["users"].issued = TimeSeqID{Timestamp: first.Timestamp, SeqID: 999999}
+	third, _, err := m.Notify(ctx, "users", "/c", MergeTypeReplace, "mem://data/c.dat")
+	if err != nil || third != (TimeSeqID{Timestamp: first.Timestamp + 1, SeqID: 1}) {
+		t.Fatalf("exhausted second: got %v (err=%v), want a spill into the next", third, err)
+	}
+}
+
+// TestMemoryDeleteCatalog_TombstoneExpires: once the tombstone lapses the
+// catalog name is writable again, from an empty state.
+func TestMemoryDeleteCatalog_TombstoneExpires(t *testing.T) {
+	m := NewMemory()
+	advance := stepClock(m)
+	ctx := context.Background()
+	if _, _, err := m.Notify(ctx, "users", "/a", MergeTypeReplace, "mem://data/a.dat"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.DeleteCatalog(ctx, "users", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Notify(ctx, "users", "/b", MergeTypeReplace, "mem://data/b.dat"); !errors.Is(err, ErrCatalogDeleted) {
+		t.Fatalf("Notify under the tombstone: %v, want ErrCatalogDeleted", err)
+	}
+	advance(time.Minute)
+	if _, _, err := m.Notify(ctx, "users", "/b", MergeTypeReplace, "mem://data/b.dat"); err != nil {
+		t.Fatalf("Notify after the tombstone lapsed: %v", err)
+	}
+	if _, rr := m.List(ctx, "users"); len(rr.Deltas) != 1 || len(m.tombstones) != 0 {
+		t.Fatalf("List = %+v, tombstones = %v", rr, m.tombstones)
+	}
+}
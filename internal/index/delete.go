@@ -0,0 +1,157 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrCatalogDeleted is returned by Notify on a catalog whose tombstone
+// (DeleteCatalog) is still in place.
+var ErrCatalogDeleted = errors.New("lake: catalog deleted")
+
+// deletedReply is the error reply notifyScript refuses a tombstoned
+// catalog with; Notify maps it to ErrCatalogDeleted.
+const deletedReply = "catalog deleted"
+
+// DeletedCatalog is the index state DeleteCatalog removed — what a purge
+// of the catalog's objects needs.
+type DeletedCatalog struct {
+	Deltas []DeltaInfo // every delta entry, absorbed ones included
+	Snaps  []SnapInfo  // the snap pointer and the snapshot history
+}
+
+// Floor is the newest tsSeq the deleted state named (zero if none).
+func (d *DeletedCatalog) Floor() TimeSeqID {
+	var floor TimeSeqID
+	for _, x := range d.Deltas {
+		if x.Score > floor.Score() {
+			floor = x.TsSeq
+		}
+	}
+	for _, s := range d.Snaps {
+		if s.Score() > floor.Score() {
+			floor = s.StopTsSeq
+		}
+	}
+	return floor
+}
+
+// CatalogDeleter is the optional Index capability of deleting a catalog:
+// atomically, its whole index state is removed and a tombstone is set
+// for ttl, during which Notify fails with ErrCatalogDeleted and AddSnap
+// refuses silently. It returns what was removed.
+type CatalogDeleter interface {
+	DeleteCatalog(ctx context.Context, catalog string, ttl time.Duration) (*DeletedCatalog, error)
+}
+
+var (
+	_ CatalogDeleter = (*Writer)(nil)
+	_ CatalogDeleter = (*Memory)(nil)
+)
+
+// deleteCatalogScript reads, then drops, every per-catalog key — delta
+// zset, allocator, snapshot history, pins — and the catalog's snap fields
+// (pointer, removal generation, expiry), and sets the tombstone, in one atomic step: no Notify or AddSnap
+// can land between the read and the delete, and none can land after it
+// until the tombstone expires.
+//
+// KEYS[1] = snaps hash, KEYS[2] = delta zset, KEYS[3] = allocator,
+// KEYS[4] = history, KEYS[5] = pins, KEYS[6] = tombstone, KEYS[7] = legacy
+// snaps hash (see snapsLua); ARGV[1] = catalog, ARGV[2] = tombstone TTL in
+// ms. Returns {snapValue|false, flat [member, score, ...] of the deltas,
+// history members}.
+const deleteCatalogScript = snapsLua + `
+local snaps = snaps_of(KEYS[1], KEYS[7], ARGV[1])
+local snap = redis.call("HGET", snaps, ARGV[1])
+local deltas = redis.call("ZRANGE", KEYS[2], 0, -1, "WITHSCORES")
+local history = redis.call("ZRANGE", KEYS[4], 0, -1)
+redis.call("HDEL", snaps, ARGV[1], ARGV[1] .. ":rg", ARGV[1] .. ":x")
+redis.call("DEL", KEYS[2], KEYS[3], KEYS[4], KEYS[5])
+redis.call("SET", KEYS[6], redis.call("TIME")[1], "PX", ARGV[2])
+return {snap or false, deltas, history}
+`
+
+var luaDeleteCatalog = NewScript(deleteCatalogScript)
+
+// DeleteCatalog runs deleteCatalogScript. Entries that do not decode are
+// dropped from the result (they name no object a purge could reach).
+func (w *Writer) DeleteCatalog(ctx context.Context, catalog string, ttl time.Duration) (*DeletedCatalog, error) {
+	if ttl < time.Millisecond {
+		return nil, fmt.Errorf("tombstone ttl %v too short", ttl)
+	}
+	res, err := RunScript(ctx, w.rdb, luaDeleteCatalog,
+		[]string{
+			w.MakeSnapsHashKey(catalog), w.MakeDeltaZsetKey(catalog), w.MakeSeqAllocKey(catalog),
+			w.MakeSnapHistoryKey(catalog), w.MakeObjectPinKey(catalog), w.MakeTombstoneKey(catalog),
+			w.legacySnapsKey(catalog),
+		},
+		catalog, ttl.Milliseconds(),
+	).Result()
+	if err != nil {
+		return nil, fmt.Errorf("delete eval: %w", err)
+	}
+	arr, ok := res.([]any)
+	if !ok || len(arr) != 3 {
+		return nil, fmt.Errorf("unexpected delete result: %v", res)
+	}
+	d := &DeletedCatalog{}
+	if v, ok := arr[0].(string); ok {
+		if stop, uri, err := DecodeSnapValue(v); err == nil {
+			d.Snaps = append(d.Snaps, SnapInfo{StopTsSeq: stop, URI: uri})
+		}
+	}
+	flat, _ := arr[1].([]any)
+	for i := 0; i+1 < len(flat); i += 2 {
+		member, _ := flat[i].(string)
+		score, _ := flat[i+1].(string)
+		f, err := strconv.ParseFloat(score, 64)
+		if err != nil || !IsDeltaMember(member) {
+			continue
+		}
+		if info, err := DecodeDeltaMember(member, f); err == nil {
+			d.Deltas = append(d.Deltas, *info)
+		}
+	}
+	history, _ := arr[2].([]any)
+	for _, h := range history {
+		if s, ok := h.(string); ok {
+			if rec, err := decodeSnapRecord(s); err == nil {
+				d.Snaps = append(d.Snaps, rec.SnapInfo)
+			}
+		}
+	}
+	return d, nil
+}
+
+// DeleteCatalog mirrors deleteCatalogScript.
+func (m *Memory) DeleteCatalog(_ context.Context, catalog string, ttl time.Duration) (*DeletedCatalog, error) {
+	if ttl < time.Millisecond {
+		return nil, fmt.Errorf("tombstone ttl %v too short", ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := &DeletedCatalog{}
+	if c := m.catalogs[catalog]; c != nil {
+		d.Deltas = c.deltas
+		if c.snap != nil {
+			d.Snaps = append(d.Snaps, *c.snap)
+		}
+		delete(m.catalogs, catalog)
+	}
+	m.tombstones[catalog] = m.clock().Add(ttl)
+	return d, nil
+}
+
+// tombstoned reports whether catalog's tombstone is in place. Callers
+// hold m.mu.
+func (m *Memory) tombstoned(catalog string) bool {
+	until, ok := m.tombstones[catalog]
+	if ok && !m.clock().Before(until) {
+		delete(m.tombstones, catalog)
+		return false
+	}
+	return ok
+}
@@ -70,7 +70,7 @@ func DecodeDeltaMember(member string, score float64) (*DeltaInfo, error) {
 		return nil, fmt.Errorf("invalid tsSeq in %q: %w", member, err)
 	}
 	if tsSeq.Score() != score {
-		return nil, fmt.Errorf("score mismatch in %q (member=%.6f, redis=%.6f)", member, tsSeq.Score(), score)
+		return nil, fmt.Errorf("score mismatch in %q (member=%v, redis=%v)", member, tsSeq.Score(), score)
 	}
 	var uri string
 	if err := json.Unmarshal(arr[3], &uri); err != nil || uri == "" {
@@ -87,7 +87,7 @@ func DecodeDeltaMember(member string, score float64) (*DeltaInfo, error) {
 }
 
 // Snap value layout: a JSON array [tsSeq, uri], stored as the field value
-// under "<prefix>:s" keyed by catalog.
+// under the snaps hash (MakeSnapsHashKey) keyed by catalog.
 func EncodeSnapValue(stop TimeSeqID, uri string) (string, error) {
 	b, err := json.Marshal([2]string{stop.String(), uri})
 	if err != nil {
@@ -111,27 +111,68 @@ func DecodeSnapValue(value string) (TimeSeqID, string, error) {
 	return stop, arr[1], nil
 }
 
+// tsSeqLua is the Lua mirror of ParseTimeSeqID and TimeSeqID.Score
+// (timeseqid.go), shared by every script that reads a tsSeq; it MUST
+// accept exactly what they accept. tsseq_parse(s) → a, seq, v2 (a = the
+// timestamp, or the ms of a TsSeqV2 ID) or nil; tsseq_score(s) → score or
+// nil; ms_seq_unit(ms) → 2^k, k = the mantissa bits ms leaves free (see
+// msSeqBits); a TsSeqV2 seqid also stays ≤ 4095 (MaxSeqIDMs). The "0_0"
+// sentinel yields nil: it scores 0 and floors nothing.
+const tsSeqLua = `
+local function ms_seq_unit(ms)
+  local p, n = 1, 0
+  while p <= ms do
+    p, n = p * 2, n + 1
+  end
+  local unit = 1
+  for _ = 1, 53 - n do
+    unit = unit * 2
+  end
+  return unit
+end
+local function tsseq_parse(s)
+  local a, b = string.match(s, "^([1-9]%d*)_([1-9]%d?%d?%d?%d?%d?)$")
+  if a and tonumber(a) <= 8589934591 then
+    return tonumber(a), tonumber(b), false
+  end
+  a, b = string.match(s, "^v2_([1-9]%d*)_([1-9]%d*)$")
+  if a then
+    local ms, seq = tonumber(a), tonumber(b)
+    if ms > 8589934591 and ms <= 8796093022207 and seq < ms_seq_unit(ms) and seq <= 4095 then
+      return ms, seq, true
+    end
+  end
+  return nil
+end
+local function tsseq_score(s)
+  local a, seq, v2 = tsseq_parse(s)
+  if not a then
+    return nil
+  end
+  if v2 then
+    return a + seq / ms_seq_unit(a)
+  end
+  return a + seq / 1000000.0
+end
+`
+
 // snapScoreLua defines snap_score(raw) → score|nil for use inside index Lua
 // scripts (prepend this const to the script body). It is the Lua mirror of
 // DecodeSnapValue + ParseTimeSeqID above and MUST accept exactly what they
-// accept: a 2-string [tsSeq, uri] with non-empty uri; ts with no leading zero
-// within the MaxTimestamp cap; seq 1..999999 with no leading zero. Accepting
-// more would let a script trust a value the Go reader rejects (wedging the
-// catalog); accepting less would make it discard a valid snap. The "0_0"
-// sentinel deliberately yields nil: it scores 0, so no caller's comparison
-// against a real stop can need it.
-const snapScoreLua = `
+// accept: a 2-string [tsSeq, uri] with non-empty uri and a tsSeq
+// tsseq_score accepts (see tsSeqLua). Accepting more would let a script
+// trust a value the Go reader rejects (wedging the catalog); accepting less
+// would make it discard a valid snap. The "0_0" sentinel deliberately
+// yields nil: it scores 0, so no caller's comparison against a real stop
+// can need it.
+const snapScoreLua = tsSeqLua + `
 local function snap_score(raw)
   local ok, arr = pcall(cjson.decode, raw)
   if not (ok and type(arr) == "table" and type(arr[1]) == "string"
         and type(arr[2]) == "string" and arr[2] ~= "") then
     return nil
   end
-  local ts, seq = string.match(arr[1], "^([1-9]%d*)_([1-9]%d?%d?%d?%d?%d?)$")
-  if not ts or tonumber(ts) > 8589934591 then
-    return nil
-  end
-  return tonumber(ts) + tonumber(seq) / 1000000.0
+  return tsseq_score(arr[1])
 end
 `
 
@@ -0,0 +1,243 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CatalogExpirer is the optional Index capability of expiring catalogs.
+// SetExpiry gives a catalog a sliding time-to-live: it expires ttl after
+// the later of the SetExpiry and its newest Notify, each of which moves the
+// deadline; 0 removes the policy. An expired catalog reads as one that was
+// never written — List reports it empty, AddSnap refuses — and its next
+// Notify starts it afresh, without the policy. SweepExpired drops what
+// expiry leaves behind and returns the catalogs it found expired.
+type CatalogExpirer interface {
+	SetExpiry(ctx context.Context, catalog string, ttl time.Duration) error
+	SweepExpired(ctx context.Context) ([]string, error)
+}
+
+var (
+	_ CatalogExpirer = (*Writer)(nil)
+	_ CatalogExpirer = (*Memory)(nil)
+)
+
+// expiryLua is the Lua prelude of every script that honours catalog
+// expiry. The policy is the "<catalog>:x" field next to the snap pointer,
+// "<deadline ms>,<ttl ms>" on the Redis clock. The per-catalog keys — delta
+// zset, allocator, history — carry the same deadline natively (PEXPIREAT),
+// so an idle catalog's bulk goes without a sweep; what shares a hash with
+// other catalogs (the snap, removal generation and policy fields under
+// LayoutGlobal) stays until a script or SweepExpired drops it, and every
+// script that reads it checks the deadline first.
+const expiryLua = `
+local function now_ms()
+  local t = redis.call("TIME")
+  return tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+end
+
+-- expiry_of returns the catalog's deadline and TTL (ms), or nil without a
+-- policy.
+local function expiry_of(snaps, catalog)
+  local d, t = string.match(redis.call("HGET", snaps, catalog .. ":x") or "", "^(%d+),(%d+)$")
+  if d then
+    return tonumber(d), tonumber(t)
+  end
+  return nil
+end
+
+local function is_expired(snaps, catalog)
+  local d = expiry_of(snaps, catalog)
+  return d ~= nil and d <= now_ms()
+end
+
+-- expire_if_due drops an expired catalog's whole index state; keys are its
+-- delta zset, allocator, history and pins.
+local function expire_if_due(snaps, catalog, keys)
+  if not is_expired(snaps, catalog) then
+    return false
+  end
+  redis.call("HDEL", snaps, catalog, catalog .. ":rg", catalog .. ":x")
+  redis.call("DEL", unpack(keys))
+  return true
+end
+
+-- slide_expiry moves the deadline to now + ttl; keys are the delta zset,
+-- allocator and history. The allocator keeps its own 7-day TTL when that
+-- comes sooner.
+local function slide_expiry(snaps, catalog, ttl, keys)
+  local deadline = now_ms() + ttl
+  redis.call("HSET", snaps, catalog .. ":x", string.format("%d,%d", deadline, ttl))
+  redis.call("PEXPIREAT", keys[1], deadline)
+  redis.call("PEXPIREAT", keys[3], deadline)
+  if ttl < 604800000 then
+    redis.call("PEXPIREAT", keys[2], deadline)
+  end
+end
+`
+
+// decodeExpiry parses a "<catalog>:x" value; ok is false on anything else.
+func decodeExpiry(v string) (deadlineMs, ttlMs int64, ok bool) {
+	d, t, found := strings.Cut(v, ",")
+	if !found {
+		return 0, 0, false
+	}
+	dl, err1 := strconv.ParseInt(d, 10, 64)
+	tl, err2 := strconv.ParseInt(t, 10, 64)
+	return dl, tl, err1 == nil && err2 == nil
+}
+
+// expiredAt reports whether the "<catalog>:x" field value x (an HMGET
+// reply; nil = no policy) is past its deadline at now, the Redis clock.
+func expiredAt(x any, now time.Time) bool {
+	v, _ := x.(string)
+	deadline, _, ok := decodeExpiry(v)
+	return ok && deadline <= now.UnixMilli()
+}
+
+// setExpiryScript sets or (ttl 0) clears the policy. A catalog already
+// expired is dropped first, so the policy starts on an empty catalog.
+// Clearing hands the allocator back its 7-day TTL and lets the other keys
+// persist.
+//
+// KEYS[1] = snaps hash, KEYS[2] = delta zset, KEYS[3] = allocator, KEYS[4]
+// = history, KEYS[5] = pins, KEYS[6] = tombstone, KEYS[7] = legacy snaps
+// hash (see snapsLua); ARGV[1] = catalog, ARGV[2] = ttl ms.
+const setExpiryScript = snapsLua + expiryLua + `
+if redis.call("EXISTS", KEYS[6]) == 1 then
+  return redis.error_reply("` + deletedReply + `")
+end
+local snaps = snaps_of(KEYS[1], KEYS[7], ARGV[1])
+expire_if_due(snaps, ARGV[1], {KEYS[2], KEYS[3], KEYS[4], KEYS[5]})
+local ttl = tonumber(ARGV[2])
+if ttl > 0 then
+  slide_expiry(snaps, ARGV[1], ttl, {KEYS[2], KEYS[3], KEYS[4]})
+  return 1
+end
+redis.call("HDEL", snaps, ARGV[1] .. ":x")
+redis.call("PERSIST", KEYS[2])
+redis.call("PERSIST", KEYS[4])
+if redis.call("EXISTS", KEYS[3]) == 1 then
+  redis.call("PEXPIRE", KEYS[3], 604800000)
+end
+return 1
+`
+
+// sweepExpiredScript drops one catalog if it is (still) expired; same KEYS
+// as setExpiryScript, the tombstone unused. Returns 1 if it did.
+const sweepExpiredScript = snapsLua + expiryLua + `
+if expire_if_due(snaps_of(KEYS[1], KEYS[7], ARGV[1]), ARGV[1], {KEYS[2], KEYS[3], KEYS[4], KEYS[5]}) then
+  return 1
+end
+return 0
+`
+
+var (
+	luaSetExpiry    = NewScript(setExpiryScript)
+	luaSweepExpired = NewScript(sweepExpiredScript)
+)
+
+// expiryKeys are the keys setExpiryScript and sweepExpiredScript take.
+func (w *Writer) expiryKeys(catalog string) []string {
+	return []string{
+		w.MakeSnapsHashKey(catalog), w.MakeDeltaZsetKey(catalog), w.MakeSeqAllocKey(catalog),
+		w.MakeSnapHistoryKey(catalog), w.MakeObjectPinKey(catalog), w.MakeTombstoneKey(catalog),
+		w.legacySnapsKey(catalog),
+	}
+}
+
+// SetExpiry runs setExpiryScript.
+func (w *Writer) SetExpiry(ctx context.Context, catalog string, ttl time.Duration) error {
+	if ttl < 0 || (ttl > 0 && ttl < time.Millisecond) {
+		return fmt.Errorf("invalid catalog ttl %v", ttl)
+	}
+	err := RunScript(ctx, w.rdb, luaSetExpiry, w.expiryKeys(catalog), catalog, ttl.Milliseconds()).Err()
+	if err != nil && strings.HasPrefix(err.Error(), deletedReply) {
+		return fmt.Errorf("set expiry %s: %w", catalog, ErrCatalogDeleted)
+	}
+	return err
+}
+
+// SweepExpired finds the policy fields past their deadline (HSCAN of the
+// snap hash, or a SCAN of the snap records) and runs sweepExpiredScript on
+// each, which re-checks the deadline atomically: a catalog written since
+// has moved its deadline and is left alone.
+func (w *Writer) SweepExpired(ctx context.Context) ([]string, error) {
+	now, err := w.rdb.Time(ctx).Result()
+	if err != nil {
+		return nil, err
+	}
+	var due []string
+	err = iterateSnapFields(ctx, w.rdb, &w.indexIO, "", func(field, value string) error {
+		catalog, ok := strings.CutSuffix(field, ":x")
+		if !ok {
+			return nil
+		}
+		if deadline, _, ok := decodeExpiry(value); ok && deadline <= now.UnixMilli() {
+			due = append(due, catalog)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var swept []string
+	for _, catalog := range due {
+		n, err := RunScript(ctx, w.rdb, luaSweepExpired, w.expiryKeys(catalog), catalog).Int()
+		if err != nil {
+			return swept, fmt.Errorf("sweep %s: %w", catalog, err)
+		}
+		if n == 1 {
+			swept = append(swept, catalog)
+		}
+	}
+	return swept, nil
+}
+
+// SetExpiry mirrors setExpiryScript.
+func (m *Memory) SetExpiry(_ context.Context, catalog string, ttl time.Duration) error {
+	if ttl < 0 || (ttl > 0 && ttl < time.Millisecond) {
+		return fmt.Errorf("invalid catalog ttl %v", ttl)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tombstoned(catalog) {
+		return fmt.Errorf("set expiry %s: %w", catalog, ErrCatalogDeleted)
+	}
+	c := m.catalog(catalog, true)
+	c.ttl = ttl
+	c.deadline = m.clock().Add(ttl)
+	return nil
+}
+
+// SweepExpired returns the catalogs found expired since the last sweep,
+// by it or lazily by any other call, and not written since.
+func (m *Memory) SweepExpired(context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expireDue()
+	swept := slices.Sorted(maps.Keys(m.expired))
+	clear(m.expired)
+	return swept, nil
+}
+
+// isExpired reports whether c's deadline has passed at now.
+func (c *memCatalog) isExpired(now time.Time) bool {
+	return c.ttl > 0 && !now.Before(c.deadline)
+}
+
+// expireDue drops every expired catalog. Callers hold m.mu.
+func (m *Memory) expireDue() {
+	now := m.clock()
+	for name, c := range m.catalogs {
+		if c.isExpired(now) {
+			delete(m.catalogs, name)
+			m.expired[name] = struct{}{}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrCatalogExists is returned by SeedSnap on a catalog that already has
+// index state.
+var ErrCatalogExists = errors.New("lake: catalog exists")
+
+// existsReply is the error reply seedSnapScript refuses a catalog with
+// state with; SeedSnap maps it to ErrCatalogExists.
+const existsReply = "catalog exists"
+
+// CatalogSeeder is the optional Index capability of starting a catalog
+// from a snapshot: SeedSnap publishes stop/uri as the snap pointer of a
+// catalog with no index state — no delta, snap pointer or removal
+// generation — atomically, failing with ErrCatalogExists otherwise (and
+// with ErrCatalogDeleted while the catalog's tombstone is in place). Later
+// Notifies allocate past stop, as they do past any snap stop.
+type CatalogSeeder interface {
+	SeedSnap(ctx context.Context, catalog string, stop TimeSeqID, uri string) error
+}
+
+var (
+	_ CatalogSeeder = (*Writer)(nil)
+	_ CatalogSeeder = (*Memory)(nil)
+)
+
+// seedSnapScript checks the catalog is empty — an expired one is dropped
+// first — and, if so, writes the snap field and its history entry exactly
+// as addSnapScript would.
+//
+// KEYS[1] = snaps hash, KEYS[2] = delta zset, KEYS[3] = history, KEYS[4] =
+// tombstone, KEYS[5] = allocator, KEYS[6] = pins, KEYS[7] = legacy snaps
+// hash (see snapsLua); ARGV[1] = catalog, ARGV[2] = snap value, ARGV[3] =
+// stop score.
+const seedSnapScript = snapsLua + expiryLua + `
+if redis.call("EXISTS", KEYS[4]) == 1 then
+  return redis.error_reply("` + deletedReply + `")
+end
+local snaps = snaps_of(KEYS[1], KEYS[7], ARGV[1])
+expire_if_due(snaps, ARGV[1], {KEYS[2], KEYS[5], KEYS[3], KEYS[6]})
+if redis.call("EXISTS", KEYS[2]) == 1 or redis.call("HEXISTS", snaps, ARGV[1]) == 1
+  or redis.call("HEXISTS", snaps, ARGV[1] .. ":rg") == 1 then
+  return redis.error_reply("` + existsReply + `")
+end
+redis.call("HSET", snaps, ARGV[1], ARGV[2])
+local snap = cjson.decode(ARGV[2])
+local now = tonumber(redis.call("TIME")[1])
+redis.call("ZADD", KEYS[3], ARGV[3], cjson.encode({snap[1], snap[2], now}))
+local deadline = expiry_of(snaps, ARGV[1])
+if deadline then
+  redis.call("PEXPIREAT", KEYS[3], deadline)
+end
+return 1
+`
+
+var luaSeedSnap = NewScript(seedSnapScript)
+
+// SeedSnap runs seedSnapScript.
+func (w *Writer) SeedSnap(ctx context.Context, catalog string, stop TimeSeqID, uri string) error {
+	val, err := EncodeSnapValue(stop, uri)
+	if err != nil {
+		return err
+	}
+	err = RunScript(ctx, w.rdb, luaSeedSnap,
+		[]string{
+			w.MakeSnapsHashKey(catalog), w.MakeDeltaZsetKey(catalog), w.MakeSnapHistoryKey(catalog),
+			w.MakeTombstoneKey(catalog), w.MakeSeqAllocKey(catalog), w.MakeObjectPinKey(catalog),
+			w.legacySnapsKey(catalog),
+		},
+		catalog, val, stop.Score(),
+	).Err()
+	switch {
+	case err == nil:
+		return nil
+	case strings.HasPrefix(err.Error(), existsReply):
+		return fmt.Errorf("seed %s: %w", catalog, ErrCatalogExists)
+	case strings.HasPrefix(err.Error(), deletedReply):
+		return fmt.Errorf("seed %s: %w", catalog, ErrCatalogDeleted)
+	}
+	return err
+}
+
+// SeedSnap mirrors seedSnapScript, history aside.
+func (m *Memory) SeedSnap(_ context.Context, catalog string, stop TimeSeqID, uri string) error {
+	if _, err := EncodeSnapValue(stop, uri); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tombstoned(catalog) {
+		return fmt.Errorf("seed %s: %w", catalog, ErrCatalogDeleted)
+	}
+	if c := m.catalog(catalog, false); c != nil && (len(c.deltas) > 0 || c.snap != nil || c.removeGen > 0) {
+		return fmt.Errorf("seed %s: %w", catalog, ErrCatalogExists)
+	}
+	m.catalog(catalog, true).snap = &SnapInfo{StopTsSeq: stop, URI: uri}
+	return nil
+}
@@ -0,0 +1,170 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SnapRecord is one entry of a catalog's snapshot history: a snapshot that
+// was published as the catalog's pointer at PublishedAt (Redis clock, unix
+// seconds). Member is the raw zset member, the handle ForgetSnap removes.
+type SnapRecord struct {
+	SnapInfo
+	PublishedAt int64
+	Member      string
+}
+
+// SnapHistory returns the catalog's recorded snapshots, oldest first (score
+// order is publication order — AddSnap is monotonic). Members that fail to
+// decode are skipped: history is GC bookkeeping, never read-path state.
+func (r *Reader) SnapHistory(ctx context.Context, catalog string) ([]SnapRecord, error) {
+	members, err := r.rdb.ZRange(ctx, r.MakeSnapHistoryKey(catalog), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]SnapRecord, 0, len(members))
+	for _, m := range members {
+		rec, derr := decodeSnapRecord(m)
+		if derr != nil {
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// decodeSnapRecord parses a history member [tsSeq, uri, publishedAt].
+func decodeSnapRecord(member string) (SnapRecord, error) {
+	var arr []json.RawMessage
+	if err := json.Unmarshal([]byte(member), &arr); err != nil || len(arr) != 3 {
+		return SnapRecord{}, fmt.Errorf("invalid snap history member %q", member)
+	}
+	var tsSeq, uri string
+	var at int64
+	if json.Unmarshal(arr[0], &tsSeq) != nil || json.Unmarshal(arr[1], &uri) != nil ||
+		json.Unmarshal(arr[2], &at) != nil || uri == "" {
+		return SnapRecord{}, fmt.Errorf("invalid snap history member %q", member)
+	}
+	stop, err := ParseTimeSeqID(tsSeq)
+	if err != nil {
+		return SnapRecord{}, fmt.Errorf("invalid snap history member %q: %w", member, err)
+	}
+	return SnapRecord{SnapInfo: SnapInfo{StopTsSeq: stop, URI: uri}, PublishedAt: at, Member: member}, nil
+}
+
+// ForgetSnap drops one history entry — called by GC once the snapshot's
+// object is gone, never before (a crash in between must leave the record
+// for the next run to retry).
+func (w *Writer) ForgetSnap(ctx context.Context, catalog string, rec SnapRecord) error {
+	return w.rdb.ZRem(ctx, w.MakeSnapHistoryKey(catalog), rec.Member).Err()
+}
+
+// DeltasThrough returns the catalog's deltas with score ≤ bound's score
+// (inclusive — the range a snapshot stopping at bound absorbed), plus the
+// URIs still referenced by deltas past it. GC must not delete an object a
+// live delta also points at (a duplicate WriteNotify records the same URI
+// twice). Undecodable members are skipped here; TrimDeltas still removes
+// them from the index.
+func (r *Reader) DeltasThrough(ctx context.Context, catalog string, bound TimeSeqID) ([]DeltaInfo, map[string]struct{}, error) {
+	key := r.MakeDeltaZsetKey(catalog)
+	max := strconv.FormatFloat(bound.Score(), 'f', -1, 64)
+	pipe := r.rdb.Pipeline()
+	absorbedCmd := pipe.ZRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{Min: "-inf", Max: max})
+	liveCmd := pipe.ZRangeByScore(ctx, key, &redis.ZRangeBy{Min: "(" + max, Max: "+inf"})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, err
+	}
+	var absorbed []DeltaInfo
+	for _, z := range absorbedCmd.Val() {
+		member, _ := z.Member.(string)
+		d, err := DecodeDeltaMember(member, z.Score)
+		if err != nil {
+			continue
+		}
+		absorbed = append(absorbed, *d)
+	}
+	live := make(map[string]struct{})
+	for _, m := range liveCmd.Val() {
+		if uri, ok := memberURI(m); ok {
+			live[uri] = struct{}{}
+		}
+	}
+	return absorbed, live, nil
+}
+
+// DeltaURIs returns the URI of every entry in the catalog's delta zset. It
+// is deliberately lenient — a member DecodeDeltaMember would reject still
+// counts as long as its URI is readable — because callers use it to decide
+// what NOT to delete.
+func (r *Reader) DeltaURIs(ctx context.Context, catalog string) (map[string]struct{}, error) {
+	members, err := r.rdb.ZRange(ctx, r.MakeDeltaZsetKey(catalog), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]struct{}, len(members))
+	for _, m := range members {
+		if uri, ok := memberURI(m); ok {
+			out[uri] = struct{}{}
+		}
+	}
+	return out, nil
+}
+
+// memberURI extracts the URI (4th element) of a delta member without
+// validating the rest.
+func memberURI(member string) (string, bool) {
+	var arr []json.RawMessage
+	if json.Unmarshal([]byte(member), &arr) != nil || len(arr) != 4 {
+		return "", false
+	}
+	var uri string
+	if json.Unmarshal(arr[3], &uri) != nil {
+		return "", false
+	}
+	return uri, true
+}
+
+// trimDeltasScript is compactDeltasScript with a caller-chosen upper bound:
+// it removes entries with score ≤ min(ARGV[2], current snap stop). The snap
+// clamp keeps the call as safe as Compact even if the caller's bound is
+// wrong — a delta the read path can still fetch is never trimmed. KEYS[3]
+// is the legacy snaps hash (see snapsLua).
+const trimDeltasScript = snapScoreLua + snapsLua + `
+local cur = redis.call("HGET", snaps_of(KEYS[1], KEYS[3], ARGV[1]), ARGV[1])
+if not cur then
+  return 0
+end
+local score = snap_score(cur)
+if not score then
+  return 0
+end
+local bound = tonumber(ARGV[2])
+if bound < score then
+  score = bound
+end
+return redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", string.format("%.17g", score))
+`
+
+var luaTrimDeltas = NewScript(trimDeltasScript)
+
+// TrimDeltas removes the catalog's delta index entries up to bound
+// (inclusive), never past the current snap stop. GC calls it only after the
+// objects of those deltas are deleted. Returns the number of entries removed.
+func (w *Writer) TrimDeltas(ctx context.Context, catalog string, bound TimeSeqID) (int64, error) {
+	res, err := RunScript(ctx, w.rdb, luaTrimDeltas,
+		[]string{w.MakeSnapsHashKey(catalog), w.MakeDeltaZsetKey(catalog), w.legacySnapsKey(catalog)},
+		catalog, bound.Score(),
+	).Result()
+	if err != nil {
+		return 0, fmt.Errorf("trim deltas eval: %w", err)
+	}
+	n, ok := res.(int64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected trim result: %v", res)
+	}
+	return n, nil
+}
@@ -0,0 +1,161 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TestSnapHistoryRecordsPublishedSnaps pins the history contract GC relies
+// on: every snapshot AddSnap publishes is recorded oldest-first with its
+// publication time; refused saves are not.
+func TestSnapHistoryRecordsPublishedSnaps(t *testing.T) {
+	rdb, prefix := indexTestRedis(t)
+	w := NewWriter(rdb)
+	r := NewReader(rdb)
+	w.SetPrefix(prefix)
+	r.SetPrefix(prefix)
+	ctx := context.Background()
+
+	s1 := TimeSeqID{Timestamp: 1700000100, SeqID: 1}
+	s2 := TimeSeqID{Timestamp: 1700000200, SeqID: 1}
+	if err := w.AddSnap(ctx, "users", s2, "oss://b/2.snap", ""); err != nil {
+		t.Fatalf("AddSnap s2: %v", err)
+	}
+	// Older stop: refused by the monotonic guard, so never recorded.
+	if err := w.AddSnap(ctx, "users", s1, "oss://b/1.snap", ""); err != nil {
+		t.Fatalf("AddSnap s1: %v", err)
+	}
+	s3 := TimeSeqID{Timestamp: 1700000300, SeqID: 1}
+	if err := w.AddSnap(ctx, "users", s3, "oss://b/3.snap", ""); err != nil {
+		t.Fatalf("AddSnap s3: %v", err)
+	}
+
+	hist, err := r.SnapHistory(ctx, "users")
+	if err != nil {
+		t.Fatalf("SnapHistory: %v", err)
+	}
+	if len(hist) != 2 || hist[0].StopTsSeq != s2 || hist[1].StopTsSeq != s3 {
+		t.Fatalf("history = %+v, want [s2, s3]", hist)
+	}
+	if hist[0].URI != "oss://b/2.snap" || hist[0].PublishedAt == 0 {
+		t.Fatalf("history[0] = %+v, want uri + publication time", hist[0])
+	}
+
+	if err := w.ForgetSnap(ctx, "users", hist[0]); err != nil {
+		t.Fatalf("ForgetSnap: %v", err)
+	}
+	if hist, _ = r.SnapHistory(ctx, "users"); len(hist) != 1 || hist[0].StopTsSeq != s3 {
+		t.Fatalf("history after forget = %+v, want [s3]", hist)
+	}
+}
+
+// TestTrimDeltasClampsToSnapStop: TrimDeltas honours the caller's bound but
+// never trims past the current snap stop, and trims nothing without a snap.
+func TestTrimDeltasClampsToSnapStop(t *testing.T) {
+	rdb, prefix := indexTestRedis(t)
+	w := NewWriter(rdb)
+	r := NewReader(rdb)
+	w.SetPrefix(prefix)
+	r.SetPrefix(prefix)
+	ctx := context.Background()
+
+	var ids []TimeSeqID
+	for i := 0; i < 4; i++ {
+		ts, _, err := w.Notify(ctx, "users", "/", MergeTypeReplace, "oss://b/x.dat")
+		if err != nil {
+			t.Fatalf("Notify #%d: %v", i, err)
+		}
+		ids = append(ids, ts)
+	}
+	if n, err := w.TrimDeltas(ctx, "users", ids[3]); err != nil || n != 0 {
+		t.Fatalf("no-snap trim: removed=%d err=%v, want 0/nil", n, err)
+	}
+	if err := w.AddSnap(ctx, "users", ids[2], "oss://b/s.snap", ""); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+
+	absorbed, live, err := r.DeltasThrough(ctx, "users", ids[1])
+	if err != nil {
+		t.Fatalf("DeltasThrough: %v", err)
+	}
+	if len(absorbed) != 2 {
+		t.Fatalf("absorbed = %d entries, want 2", len(absorbed))
+	}
+	if _, ok := live["oss://b/x.dat"]; !ok {
+		t.Fatal("URI shared with a live delta must be reported live")
+	}
+
+	if n, err := w.TrimDeltas(ctx, "users", ids[1]); err != nil || n != 2 {
+		t.Fatalf("bounded trim: removed=%d err=%v, want 2", n, err)
+	}
+	// A bound past the snap stop is clamped: the delta after the stop stays.
+	if n, err := w.TrimDeltas(ctx, "users", ids[3]); err != nil || n != 1 {
+		t.Fatalf("clamped trim: removed=%d err=%v, want 1", n, err)
+	}
+	if card := rdb.ZCard(ctx, w.MakeDeltaZsetKey("users")).Val(); card != 1 {
+		t.Fatalf("zset after trims: %d entries, want 1", card)
+	}
+}
+
+// TestObjectPin: a pin holds until it lapses, a shorter re-pin never cuts a
+// longer one short, the pin set carries a key TTL, and a pin and GC's
+// delete mark never coexist.
+func TestObjectPin(t *testing.T) {
+	rdb, prefix := indexTestRedis(t)
+	w := NewWriter(rdb)
+	r := NewReader(rdb)
+	w.SetPrefix(prefix)
+	r.SetPrefix(prefix)
+	ctx := context.Background()
+	r.EnsureClock(ctx)
+
+	if ok, err := r.ObjectPinned(ctx, "users", "a/sha256-x.dat"); err != nil || ok {
+		t.Fatalf("unpinned object: pinned=%v err=%v", ok, err)
+	}
+	if err := w.PinObject(ctx, "users", "a/sha256-x.dat", 600); err != nil {
+		t.Fatalf("PinObject: %v", err)
+	}
+	if err := w.PinObject(ctx, "users", "a/sha256-x.dat", 1); err != nil {
+		t.Fatalf("PinObject (shorter): %v", err)
+	}
+	if ok, err := r.ObjectPinned(ctx, "users", "a/sha256-x.dat"); err != nil || !ok {
+		t.Fatalf("pinned object: pinned=%v err=%v", ok, err)
+	}
+	key := w.MakeObjectPinKey("users")
+	if ttl := rdb.TTL(ctx, key).Val(); ttl <= 0 {
+		t.Fatalf("pin set TTL = %v, want > 0", ttl)
+	}
+	// A pin and GC's delete mark exclude each other.
+	if ok, err := w.MarkObjectDeleting(ctx, "users", "a/sha256-x.dat", 60); err != nil || ok {
+		t.Fatalf("mark over a pin = %v, %v; want refused", ok, err)
+	}
+	if ok, err := w.MarkObjectDeleting(ctx, "users", "a/sha256-y.dat", 60); err != nil || !ok {
+		t.Fatalf("mark = %v, %v", ok, err)
+	}
+	if err := w.PinObject(ctx, "users", "a/sha256-y.dat", 600); !errors.Is(err, ErrObjectDeleting) {
+		t.Fatalf("pin over a mark: %v, want ErrObjectDeleting", err)
+	}
+	if ok, err := r.ObjectPinned(ctx, "users", "a/sha256-y.dat"); err != nil || ok {
+		t.Fatalf("marked object reported pinned=%v (err=%v)", ok, err)
+	}
+	if err := w.UnmarkObjectDeleting(ctx, "users", "a/sha256-y.dat"); err != nil {
+		t.Fatalf("UnmarkObjectDeleting: %v", err)
+	}
+	if err := w.PinObject(ctx, "users", "a/sha256-y.dat", 600); err != nil {
+		t.Fatalf("pin after unmark: %v", err)
+	}
+	if err := w.UnmarkObjectDeleting(ctx, "users", "a/sha256-y.dat"); err != nil {
+		t.Fatalf("UnmarkObjectDeleting: %v", err)
+	}
+	if ok, err := r.ObjectPinned(ctx, "users", "a/sha256-y.dat"); err != nil || !ok {
+		t.Fatalf("unmark dropped a pin: pinned=%v err=%v", ok, err)
+	}
+	// A lapsed pin no longer protects.
+	rdb.ZAdd(ctx, key, redis.Z{Score: float64(r.NowUnix() - 10), Member: "a/old.dat"})
+	if ok, _ := r.ObjectPinned(ctx, "users", "a/old.dat"); ok {
+		t.Fatal("lapsed pin still reported")
+	}
+}
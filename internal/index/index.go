@@ -0,0 +1,66 @@
+package index
+
+import "context"
+
+// Index is the catalog index behind a Client: per catalog, an ordered log of
+// delta entries, a monotonic snapshot pointer, and a removal generation.
+// Redis (Reader + Writer, Lua-scripted) is the default implementation;
+// Memory is a pure-Go one with the same semantics. Every implementation
+// must pass the conformance suite (conformance_test.go) — the contract,
+// method by method:
+//
+//   - List returns the snap pointer and every delta strictly after its
+//     stop, in tsSeq order, together with the removal generation, as ONE
+//     consistent observation. A failure is reported in ReadIndexResult.Err.
+//   - BatchList is List for many catalogs; only per-catalog consistency is
+//     promised.
+//   - Notify allocates the catalog's next tsSeq — strictly after the last
+//     one issued, the snap stop and the newest delta, however the clock
+//     moves — and appends the delta. It returns the tsSeq and the stored
+//     member.
+//   - AddSnap moves the pointer only forward, and only while removeGen
+//     ("" = "0") still equals the catalog's generation; refusals are silent.
+//   - LatestSnap returns the pointer, nil if none.
+//   - Compact drops the deltas at or before the snap stop; returns how many.
+//   - HasDelta / RemoveDelta find a delta by tsSeq; a removal also bumps the
+//     removal generation, atomically.
+//   - RemoveGen returns the generation, "0" before the first removal.
+//   - IterateSnaps streams every (catalog, snap) until fn returns false.
+//   - NowUnix is the clock tsSeqs and handle expiries are judged on.
+type Index interface {
+	List(ctx context.Context, catalog string) (*SnapInfo, *ReadIndexResult)
+	BatchList(ctx context.Context, catalogs []string) map[string]*BatchListResult
+	Notify(ctx context.Context, catalog, fieldPath string, mergeType MergeType, uri string) (TimeSeqID, string, error)
+	AddSnap(ctx context.Context, catalog string, stopTsSeq TimeSeqID, uri, removeGen string) error
+	LatestSnap(ctx context.Context, catalog string) (*SnapInfo, error)
+	Compact(ctx context.Context, catalog string) (int64, error)
+	HasDelta(ctx context.Context, catalog string, tsSeq TimeSeqID) (bool, error)
+	RemoveDelta(ctx context.Context, catalog string, tsSeq TimeSeqID) (bool, error)
+	RemoveGen(ctx context.Context, catalog string) (string, error)
+	IterateSnaps(ctx context.Context, fn func(catalog string, snap SnapInfo) bool) error
+	NowUnix() int64
+}
+
+// Redis is the default Index: the Redis index a Reader and Writer of the
+// same prefix and layout maintain.
+type Redis struct {
+	*Reader
+	*Writer
+}
+
+var _ Index = (*Redis)(nil)
+
+// NewRedis pairs r and w into an Index.
+func NewRedis(r *Reader, w *Writer) *Redis { return &Redis{Reader: r, Writer: w} }
+
+func (x *Redis) List(ctx context.Context, catalog string) (*SnapInfo, *ReadIndexResult) {
+	return x.Reader.ListCatalog(ctx, catalog)
+}
+
+func (x *Redis) LatestSnap(ctx context.Context, catalog string) (*SnapInfo, error) {
+	return x.Reader.GetLatestSnap(ctx, catalog)
+}
+
+func (x *Redis) Compact(ctx context.Context, catalog string) (int64, error) {
+	return x.Writer.CompactDeltas(ctx, catalog)
+}
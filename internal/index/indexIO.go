@@ -1,27 +1,96 @@
 package index
 
 import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+
 	"github.com/hkloudou/lake/v3/internal/encode"
 )
 
-// indexIO holds the deployment-level Redis key prefix and renders the
-// canonical Redis keys used by Reader / Writer. All keys live under
+// Layout selects how Lake's Redis keys are named.
+type Layout uint8
+
+const (
+	// LayoutGlobal is the original layout: untagged per-catalog keys and
+	// one deployment-wide snap hash "<prefix>:s". Single-node Redis only —
+	// the scripts touch that hash together with per-catalog keys.
+	LayoutGlobal Layout = iota
+	// LayoutCluster hash-tags every per-catalog key with "{<catalog>}" and
+	// replaces the global snap hash by a per-catalog snap record
+	// "<prefix>:s:{<catalog>}", so each script's keys share one Redis
+	// Cluster slot. Sample keys share one deployment-wide tag "{m}".
+	LayoutCluster
+)
+
+func (l Layout) String() string {
+	switch l {
+	case LayoutGlobal:
+		return "global"
+	case LayoutCluster:
+		return "cluster"
+	default:
+		return "layout(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// indexIO holds the deployment-level Redis key prefix and layout and renders
+// the canonical Redis keys used by Reader / Writer. All keys live under
 // "<prefix>:..." so different deployments sharing one Redis stay
-// isolated by Name. The fixed keys are rendered once in SetPrefix — they
-// sit on every hot path (List, BatchList per catalog, every sample probe),
-// so they must not be re-formatted per call.
+// isolated by Name. The fixed keys are rendered once in SetPrefix /
+// SetLayout — they sit on every hot path (List, BatchList per catalog,
+// every sample probe), so they must not be re-formatted per call.
 type indexIO struct {
-	prefix   string
-	snapsKey string // "<prefix>:s"
-	mrgKey   string // "<prefix>:mrg"
+	prefix     string
+	layout     Layout
+	snapShards int      // SetSnapShards; 0 = the single snap hash
+	snapsKey   string   // "<prefix>:s" (LayoutGlobal)
+	shardKeys  []string // "<prefix>:s:<n>" for n < snapShards
+	mrgKey     string   // "<prefix>:mrg" / "<prefix>:{m}rg"
+	memoHead   string   // "<prefix>:m:" / "<prefix>:{m}:"
 }
 
 func (w *indexIO) SetPrefix(p string) {
 	w.prefix = p
+	w.render()
+}
+
+// SetLayout switches the key layout; every process sharing the prefix must
+// use the same one.
+func (w *indexIO) SetLayout(l Layout) {
+	w.layout = l
+	w.render()
+}
+
+// SetSnapShards splits LayoutGlobal's snap hash into n hashes
+// "<prefix>:s:<shard>", the shard chosen by a hash of the catalog name; 0
+// keeps the single "<prefix>:s". LayoutCluster ignores it (its snap records
+// are per catalog already). Every process sharing the prefix must use the
+// same count; fields still in "<prefix>:s" stay readable and writable
+// until MigrateSnapShards moves them (see snapsLua).
+func (w *indexIO) SetSnapShards(n int) {
+	w.snapShards = max(n, 0)
+	w.render()
+}
+
+func (w *indexIO) render() {
+	p := w.prefix
 	w.snapsKey = p + ":s"
-	w.mrgKey = p + ":mrg"
+	w.shardKeys = make([]string, w.snapShards)
+	for i := range w.shardKeys {
+		w.shardKeys[i] = p + ":s:" + strconv.Itoa(i)
+	}
+	if w.layout == LayoutCluster {
+		w.mrgKey = p + ":{m}rg"
+		w.memoHead = p + ":{m}:"
+	} else {
+		w.mrgKey = p + ":mrg"
+		w.memoHead = p + ":m:"
+	}
 }
+
 func (w *indexIO) Prefix() string { return w.prefix }
+func (w *indexIO) Layout() Layout { return w.layout }
 
 func (w *indexIO) requirePrefix() {
 	if w.prefix == "" {
@@ -29,25 +98,111 @@ func (w *indexIO) requirePrefix() {
 	}
 }
 
+// catalogKey renders "<prefix>:<kind>:<catalog>", hash-tagged as
+// "<prefix>:<kind>:{<catalog>}" under LayoutCluster.
+func (w *indexIO) catalogKey(kind, catalog string) string {
+	w.requirePrefix()
+	if w.layout == LayoutCluster {
+		return w.prefix + ":" + kind + ":{" + encode.EncodeRedisCatalogName(catalog) + "}"
+	}
+	return w.prefix + ":" + kind + ":" + encode.EncodeRedisCatalogName(catalog)
+}
+
+// catalogKeyPattern is the SCAN MATCH pattern for every catalogKey of kind.
+func (w *indexIO) catalogKeyPattern(kind string) string {
+	return w.catalogPrefixPattern(kind, "")
+}
+
+// catalogPrefixPattern narrows catalogKeyPattern to the catalogs whose
+// name starts with catalogPrefix (escaped: it matches only itself).
+func (w *indexIO) catalogPrefixPattern(kind, catalogPrefix string) string {
+	w.requirePrefix()
+	name := encode.EncodeRedisCatalogName(catalogPrefix)
+	if w.layout == LayoutCluster {
+		return GlobEscape(w.prefix+":"+kind+":{"+name) + "*"
+	}
+	return GlobEscape(w.prefix+":"+kind+":"+name) + "*"
+}
+
+// catalogOfKey inverts catalogKey; ok is false for a key of another kind.
+func (w *indexIO) catalogOfKey(kind, key string) (string, bool) {
+	head := w.prefix + ":" + kind + ":"
+	if !strings.HasPrefix(key, head) {
+		return "", false
+	}
+	name := key[len(head):]
+	if w.layout == LayoutCluster {
+		if len(name) < 2 || name[0] != '{' || name[len(name)-1] != '}' {
+			return "", false
+		}
+		name = name[1 : len(name)-1]
+	} else if strings.HasPrefix(name, "{") {
+		return "", false // a LayoutCluster key; "{" is never in a catalog name
+	}
+	return name, name != ""
+}
+
 // MakeDeltaZsetKey: per-catalog delta ZSet "<prefix>:d:<catalog>".
 func (w *indexIO) MakeDeltaZsetKey(catalog string) string {
-	w.requirePrefix()
-	return w.prefix + ":d:" + encode.EncodeRedisCatalogName(catalog)
+	return w.catalogKey("d", catalog)
 }
 
-// MakeSnapsHashKey: deployment-wide snap Hash "<prefix>:s", with catalog
-// as field. One HMGet/HGETALL surfaces every snap at once.
-func (w *indexIO) MakeSnapsHashKey() string {
+// MakeSnapsHashKey: the Hash holding catalog's snap pointer (field
+// catalog) and removal generation (field "<catalog>:rg"). Under
+// LayoutGlobal it is the deployment-wide "<prefix>:s" — one HSCAN surfaces
+// every snap — or, with SetSnapShards, the catalog's shard
+// "<prefix>:s:<shard>"; under LayoutCluster a per-catalog record
+// "<prefix>:s:{<catalog>}" in the catalog's slot. The field names are the
+// same in all, so no script depends on the layout.
+func (w *indexIO) MakeSnapsHashKey(catalog string) string {
+	if w.layout == LayoutCluster {
+		return w.catalogKey("s", catalog)
+	}
 	w.requirePrefix()
+	if w.snapShards > 0 {
+		return w.shardKeys[snapShardOf(catalog, w.snapShards)]
+	}
 	return w.snapsKey
 }
 
+// legacySnapsKey is the hash catalog's snap fields lived in before
+// SetSnapShards: "<prefix>:s" when sharded, MakeSnapsHashKey otherwise.
+// Every script touching the snap fields takes it as its last key.
+func (w *indexIO) legacySnapsKey(catalog string) string {
+	if w.layout == LayoutGlobal && w.snapShards > 0 {
+		w.requirePrefix()
+		return w.snapsKey
+	}
+	return w.MakeSnapsHashKey(catalog)
+}
+
+// snapHashKeys lists every LayoutGlobal snap hash: "<prefix>:s", then the
+// shards. Fields only move from the first to the others, so a scan in this
+// order sees a catalog moved during it twice at worst, never not at all.
+func (w *indexIO) snapHashKeys() []string {
+	w.requirePrefix()
+	return append([]string{w.snapsKey}, w.shardKeys...)
+}
+
+// snapShardOf is catalog's shard among n: FNV-1a of the name, mod n.
+func snapShardOf(catalog string, n int) int {
+	h := fnv.New32a()
+	h.Write([]byte(catalog))
+	return int(h.Sum32() % uint32(n))
+}
+
 // MakeSampleIndicatorKey: per-indicator sample Hash
 // "<prefix>:m:<indicator>", with catalog as field. "m" reads as "memo" —
 // a sample is the memoised output of a derived computation.
 func (w *indexIO) MakeSampleIndicatorKey(indicator string) string {
 	w.requirePrefix()
-	return w.prefix + ":m:" + encode.EncodeRedisCatalogName(indicator)
+	return w.memoHead + encode.EncodeRedisCatalogName(indicator)
+}
+
+// SampleKeyPattern is the SCAN MATCH pattern for every sample Hash.
+func (w *indexIO) SampleKeyPattern() string {
+	w.requirePrefix()
+	return GlobEscape(w.memoHead) + "*"
 }
 
 // MakeSampleRemoveGenKey: deployment-wide catalog-level sample removal
@@ -66,6 +221,54 @@ func (w *indexIO) MakeSampleRemoveGenKey() string {
 // MakeSeqAllocKey: per-catalog tsSeq allocator "<prefix>:seq:<catalog>",
 // holding the last issued "ts_seq" pair (see notifyLua, writer_atomic.go).
 func (w *indexIO) MakeSeqAllocKey(catalog string) string {
-	w.requirePrefix()
-	return w.prefix + ":seq:" + encode.EncodeRedisCatalogName(catalog)
+	return w.catalogKey("seq", catalog)
+}
+
+// MakeObjectPinKey: per-catalog pin ZSet "<prefix>:pin:<catalog>", member
+// an object path, score the unix second (Redis clock) the pin lapses. GC
+// leaves pinned objects alone (see PinObject).
+func (w *indexIO) MakeObjectPinKey(catalog string) string {
+	return w.catalogKey("pin", catalog)
+}
+
+// MakeSnapHistoryKey: per-catalog snapshot history ZSet "<prefix>:h:<catalog>",
+// one member per published snapshot (see addSnapScript). It is the record GC
+// walks to find superseded snapshot objects — object storage alone cannot say
+// which ".snap" objects a pointer once referenced.
+func (w *indexIO) MakeSnapHistoryKey(catalog string) string {
+	return w.catalogKey("h", catalog)
+}
+
+// MakeTombstoneKey: per-catalog tombstone "<prefix>:t:<catalog>", set for
+// a while by DeleteCatalog (value: the Redis clock at deletion). Notify and
+// AddSnap refuse a tombstoned catalog.
+func (w *indexIO) MakeTombstoneKey(catalog string) string {
+	return w.catalogKey("t", catalog)
+}
+
+// GlobEscape backslash-escapes Redis MATCH metacharacters so s matches only
+// itself as a literal pattern segment.
+func GlobEscape(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// Keys renders a deployment's keys without a connection — for the Redis
+// state kept outside an Index (the sample cache).
+type Keys struct{ indexIO }
+
+// NewKeys returns the key renderer for prefix under layout l.
+func NewKeys(prefix string, l Layout) *Keys {
+	k := &Keys{}
+	k.SetPrefix(prefix)
+	k.SetLayout(l)
+	return k
 }
@@ -0,0 +1,181 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LayoutReport is what one CopyLayout run copied.
+type LayoutReport struct {
+	Keys       int // per-catalog keys (delta, allocator, history, pin, tombstone) copied
+	SnapFields int // snap pointer and removal-generation fields copied
+}
+
+// layoutKinds are the per-catalog key kinds whose name is all that changes
+// between layouts; the snap fields ("s") are handled separately.
+var layoutKinds = []string{"d", "seq", "h", "pin", "t"}
+
+// CopyLayout copies a deployment's index state from its keys under layout
+// from on src to the keys of layout to on dst: every delta zset, tsSeq
+// allocator, snapshot history, pin set and tombstone (value and TTL), and
+// every snap pointer and removal generation — from "<prefix>:s" and any
+// shards of it (SetSnapShards) alike; a LayoutGlobal destination gets them
+// all in "<prefix>:s", for MigrateSnapShards to move. Sample (memo) hashes are a
+// cache and are not copied.
+//
+// Destination keys are overwritten, so a re-run after a failure converges;
+// source keys are left in place. The copy is not atomic with respect to
+// writers — run it with every writer of the prefix stopped.
+func CopyLayout(ctx context.Context, prefix string, src, dst redis.UniversalClient, from, to Layout) (*LayoutReport, error) {
+	var fk, tk indexIO
+	fk.SetPrefix(prefix)
+	fk.SetLayout(from)
+	tk.SetPrefix(prefix)
+	tk.SetLayout(to)
+	if from == LayoutGlobal {
+		n, err := discoverSnapShards(ctx, src, prefix)
+		if err != nil {
+			return nil, err
+		}
+		fk.SetSnapShards(n)
+	}
+	rep := &LayoutReport{}
+	for _, kind := range layoutKinds {
+		err := ScanKeys(ctx, src, fk.catalogKeyPattern(kind), snapScanBatch, func(keys []string) (bool, error) {
+			for _, key := range keys {
+				catalog, ok := fk.catalogOfKey(kind, key)
+				if !ok {
+					continue
+				}
+				copied, err := copyKey(ctx, src, dst, key, tk.catalogKey(kind, catalog))
+				if err != nil {
+					return false, fmt.Errorf("copy %s: %w", key, err)
+				}
+				if copied {
+					rep.Keys++
+				}
+			}
+			return true, nil
+		})
+		if err != nil {
+			return rep, err
+		}
+	}
+	err := iterateSnapFields(ctx, src, &fk, "", func(field, value string) error {
+		catalog, _, _ := strings.Cut(field, ":") // snap, ":rg" and ":x" fields
+		if err := dst.HSet(ctx, tk.MakeSnapsHashKey(catalog), field, value).Err(); err != nil {
+			return fmt.Errorf("copy snap field %s: %w", field, err)
+		}
+		rep.SnapFields++
+		return nil
+	})
+	return rep, err
+}
+
+// iterateSnapFields streams every field of the snap hashes (LayoutGlobal;
+// see snapHashKeys) or of every per-catalog snap record (LayoutCluster)
+// under io's layout.
+func iterateSnapFields(ctx context.Context, rdb redis.UniversalClient, io *indexIO, catalogPrefix string, fn func(field, value string) error) error {
+	if io.Layout() != LayoutCluster {
+		match := ""
+		if catalogPrefix != "" {
+			match = GlobEscape(catalogPrefix) + "*"
+		}
+		for _, key := range io.snapHashKeys() {
+			if err := scanHash(ctx, rdb, key, match, fn); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ScanKeys(ctx, rdb, io.catalogPrefixPattern("s", catalogPrefix), snapScanBatch, func(keys []string) (bool, error) {
+		for _, key := range keys {
+			if _, ok := io.catalogOfKey("s", key); !ok {
+				continue
+			}
+			fields, err := rdb.HGetAll(ctx, key).Result()
+			if err != nil {
+				return false, err
+			}
+			for field, value := range fields {
+				if err := fn(field, value); err != nil {
+					return false, err
+				}
+			}
+		}
+		return true, nil
+	})
+}
+
+// scanHash streams every field of key matching match ("" = all) via HSCAN.
+func scanHash(ctx context.Context, rdb redis.UniversalClient, key, match string, fn func(field, value string) error) error {
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pairs, next, err := rdb.HScan(ctx, key, cursor, match, snapScanBatch).Result()
+		if err != nil {
+			return err
+		}
+		for i := 0; i+1 < len(pairs); i += 2 {
+			if err := fn(pairs[i], pairs[i+1]); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// copyKey replaces to on dst with a copy of from on src — a string or a
+// zset, the only types among the per-catalog keys — carrying over its TTL.
+// copied is false if from vanished in the meantime.
+func copyKey(ctx context.Context, src, dst redis.UniversalClient, from, to string) (copied bool, err error) {
+	typ, err := src.Type(ctx, from).Result()
+	if err != nil {
+		return false, err
+	}
+	ttl, err := src.PTTL(ctx, from).Result()
+	if err != nil {
+		return false, err
+	}
+	var write func(pipe redis.Pipeliner)
+	switch typ {
+	case "none":
+		return false, nil
+	case "string":
+		val, err := src.Get(ctx, from).Result()
+		if err == redis.Nil {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		write = func(pipe redis.Pipeliner) { pipe.Set(ctx, to, val, 0) }
+	case "zset":
+		zs, err := src.ZRangeWithScores(ctx, from, 0, -1).Result()
+		if err != nil {
+			return false, err
+		}
+		if len(zs) == 0 {
+			return false, nil
+		}
+		write = func(pipe redis.Pipeliner) { pipe.ZAdd(ctx, to, zs...) }
+	default:
+		return false, fmt.Errorf("unexpected key type %q", typ)
+	}
+	_, err = dst.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, to)
+		write(pipe)
+		if ttl > 0 {
+			pipe.PExpire(ctx, to, ttl)
+		}
+		return nil
+	})
+	return err == nil, err
+}
@@ -0,0 +1,142 @@
+package index
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestLayoutKeys pins both key layouts: LayoutGlobal keeps the original
+// names, LayoutCluster tags every per-catalog key (snap record included)
+// with the same "{<catalog>}" so a script's keys share one slot.
+func TestLayoutKeys(t *testing.T) {
+	var io indexIO
+	io.SetPrefix("app")
+	if got := io.MakeDeltaZsetKey("a/b"); got != "app:d:a/b" {
+		t.Fatalf("global delta key = %q", got)
+	}
+	if got := io.MakeSnapsHashKey("a/b"); got != "app:s" {
+		t.Fatalf("global snaps key = %q", got)
+	}
+	if got := io.MakeSampleRemoveGenKey(); got != "app:mrg" {
+		t.Fatalf("global mrg key = %q", got)
+	}
+
+	io.SetLayout(LayoutCluster)
+	for _, key := range []string{
+		io.MakeDeltaZsetKey("a/b"), io.MakeSnapsHashKey("a/b"), io.MakeSeqAllocKey("a/b"),
+		io.MakeSnapHistoryKey("a/b"), io.MakeObjectPinKey("a/b"),
+	} {
+		if !strings.HasSuffix(key, ":{a/b}") {
+			t.Fatalf("cluster key %q is not tagged {a/b}", key)
+		}
+	}
+	if a, b := io.MakeSampleIndicatorKey("x"), io.MakeSampleRemoveGenKey(); !strings.Contains(a, "{m}") || !strings.Contains(b, "{m}") {
+		t.Fatalf("sample keys %q / %q do not share the {m} tag", a, b)
+	}
+	if cat, ok := io.catalogOfKey("d", io.MakeDeltaZsetKey("a/b")); !ok || cat != "a/b" {
+		t.Fatalf("catalogOfKey = %q, %v", cat, ok)
+	}
+
+	io.SetLayout(LayoutGlobal)
+	if _, ok := io.catalogOfKey("d", "app:d:{a/b}"); ok {
+		t.Fatal("global layout must not claim a cluster-layout key")
+	}
+}
+
+// TestClusterLayout_Redis runs the write/read paths under LayoutCluster and
+// checks IterateSnaps / IterateDeltaCatalogs find the per-catalog records.
+func TestClusterLayout_Redis(t *testing.T) {
+	rdb, prefix := indexTestRedis(t)
+	w, r := NewWriter(rdb), NewReader(rdb)
+	for _, io := range []*indexIO{&w.indexIO, &r.indexIO} {
+		io.SetPrefix(prefix)
+		io.SetLayout(LayoutCluster)
+	}
+	ctx := context.Background()
+
+	if _, _, err := w.Notify(ctx, "users", "/a", MergeTypeReplace, "mem://data/a.dat"); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	stop := TimeSeqID{Timestamp: 1700000100, SeqID: 1}
+	if err := w.AddSnap(ctx, "orders", stop, "mem://snaps/o.snap", ""); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	if n, err := rdb.Exists(ctx, prefix+":s").Result(); err != nil || n != 0 {
+		t.Fatalf("global snaps hash written under LayoutCluster (n=%d err=%v)", n, err)
+	}
+	if got, err := r.GetLatestSnap(ctx, "orders"); err != nil || got == nil || got.StopTsSeq != stop {
+		t.Fatalf("GetLatestSnap = %+v, %v", got, err)
+	}
+
+	snaps := map[string]SnapInfo{}
+	if err := r.IterateSnaps(ctx, func(c string, s SnapInfo) bool { snaps[c] = s; return true }); err != nil {
+		t.Fatalf("IterateSnaps: %v", err)
+	}
+	if len(snaps) != 1 || snaps["orders"].URI != "mem://snaps/o.snap" {
+		t.Fatalf("IterateSnaps = %v", snaps)
+	}
+	var deltas []string
+	if err := r.IterateDeltaCatalogs(ctx, "", func(c string) bool { deltas = append(deltas, c); return true }); err != nil {
+		t.Fatalf("IterateDeltaCatalogs: %v", err)
+	}
+	if len(deltas) != 1 || deltas[0] != "users" {
+		t.Fatalf("IterateDeltaCatalogs = %v", deltas)
+	}
+}
+
+// TestCopyLayout_Redis: a global-layout index copied to LayoutCluster reads
+// back the same, TTLs included; a re-run converges on the same state.
+func TestCopyLayout_Redis(t *testing.T) {
+	rdb, prefix := indexTestRedis(t)
+	w, r := NewWriter(rdb), NewReader(rdb)
+	w.SetPrefix(prefix)
+	r.SetPrefix(prefix)
+	ctx := context.Background()
+
+	for _, p := range []string{"/a", "/b"} {
+		if _, _, err := w.Notify(ctx, "users", p, MergeTypeReplace, "mem://data"+p+".dat"); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+	}
+	stop := TimeSeqID{Timestamp: 1700000100, SeqID: 1}
+	if err := w.AddSnap(ctx, "users", stop, "mem://snaps/u.snap", ""); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	if err := rdb.HSet(ctx, w.MakeSnapsHashKey("users"), "users:rg", "3").Err(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := r.AllDeltas(ctx, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		rep, err := CopyLayout(ctx, prefix, rdb, rdb, LayoutGlobal, LayoutCluster)
+		if err != nil {
+			t.Fatalf("CopyLayout: %v", err)
+		}
+		// delta zset, allocator, history; pointer and removal generation.
+		if rep.Keys != 3 || rep.SnapFields != 2 {
+			t.Fatalf("report = %+v, want 3 keys and 2 snap fields", rep)
+		}
+	}
+
+	cr := NewReader(rdb)
+	cr.SetPrefix(prefix)
+	cr.SetLayout(LayoutCluster)
+	got, err := cr.AllDeltas(ctx, "users")
+	if err != nil || len(got) != len(want) || got[1].URI != want[1].URI || got[1].TsSeq != want[1].TsSeq {
+		t.Fatalf("AllDeltas after copy = %+v (err=%v), want %+v", got, err, want)
+	}
+	if snap, err := cr.GetLatestSnap(ctx, "users"); err != nil || snap == nil || snap.StopTsSeq != stop {
+		t.Fatalf("GetLatestSnap after copy = %+v, %v", snap, err)
+	}
+	if rg, err := rdb.HGet(ctx, cr.MakeSnapsHashKey("users"), "users:rg").Result(); err != nil || rg != "3" {
+		t.Fatalf("removal gen after copy = %q, %v", rg, err)
+	}
+	if ttl, err := rdb.TTL(ctx, cr.MakeSeqAllocKey("users")).Result(); err != nil || ttl <= 0 || ttl > 7*24*time.Hour {
+		t.Fatalf("allocator TTL after copy = %v, %v", ttl, err)
+	}
+}
@@ -0,0 +1,319 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory is a pure-Go Index held in process memory: the Redis index's
+// semantics — monotonic tsSeq allocation, forward-only snap pointer,
+// removal generations — without a server. Nothing is persisted; it suits
+// tests and single-process deployments. One mutex serializes every
+// operation, which is what the Lua scripts' atomicity gives the Redis index.
+type Memory struct {
+	mu         sync.Mutex
+	catalogs   map[string]*memCatalog
+	tombstones map[string]time.Time // DeleteCatalog; value = expiry
+	expired    map[string]struct{}  // dropped by expiry, not yet swept (the ":x" field)
+	now        func() int64         // unix seconds; swapped by tests
+	nowMs      func() int64         // unix milliseconds, for TsSeqV2 and deadlines
+	version    TsSeqVersion         // SetTsSeqVersion; 0 = TsSeqV1
+}
+
+// memCatalog is one catalog's state; deltas is kept in score order.
+type memCatalog struct {
+	deltas    []DeltaInfo
+	snap      *SnapInfo
+	removeGen int64
+	issued    TimeSeqID     // last tsSeq Notify issued
+	ttl       time.Duration // sliding expiry (SetExpiry); 0 = none
+	deadline  time.Time
+}
+
+var _ Index = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory Index on the local clock.
+func NewMemory() *Memory {
+	return &Memory{
+		catalogs:   make(map[string]*memCatalog),
+		tombstones: make(map[string]time.Time),
+		expired:    make(map[string]struct{}),
+		now:        func() int64 { return time.Now().Unix() },
+		nowMs:      func() int64 { return time.Now().UnixMilli() },
+	}
+}
+
+// catalog returns the state of name, creating it when create is set; nil
+// otherwise. An expired catalog is dropped first, and left for
+// SweepExpired unless it is recreated at once (as expire_if_due leaves no
+// policy field behind). Callers hold m.mu.
+func (m *Memory) catalog(name string, create bool) *memCatalog {
+	c := m.catalogs[name]
+	if c != nil && c.isExpired(m.clock()) {
+		delete(m.catalogs, name)
+		m.expired[name] = struct{}{}
+		c = nil
+	}
+	if create {
+		delete(m.expired, name)
+	}
+	if c == nil && create {
+		c = &memCatalog{}
+		m.catalogs[name] = c
+	}
+	return c
+}
+
+// list is List under m.mu: copies, so callers may keep (and fill Body on)
+// what they get.
+func (m *Memory) list(catalog string) (*SnapInfo, *ReadIndexResult) {
+	rr := &ReadIndexResult{Catalog: catalog, RemoveGen: "0", Deltas: []DeltaInfo{}}
+	c := m.catalog(catalog, false)
+	if c == nil {
+		return nil, rr
+	}
+	rr.RemoveGen = strconv.FormatInt(c.removeGen, 10)
+	var snap *SnapInfo
+	after := 0
+	if c.snap != nil {
+		s := *c.snap
+		snap = &s
+		after = sort.Search(len(c.deltas), func(i int) bool { return c.deltas[i].Score > s.Score() })
+	}
+	rr.Deltas = slices.Clone(c.deltas[after:])
+	return snap, rr
+}
+
+func (m *Memory) List(_ context.Context, catalog string) (*SnapInfo, *ReadIndexResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.list(catalog)
+}
+
+func (m *Memory) BatchList(_ context.Context, catalogs []string) map[string]*BatchListResult {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make(map[string]*BatchListResult, len(catalogs))
+	for _, catalog := range catalogs {
+		snap, rr := m.list(catalog)
+		out[catalog] = &BatchListResult{Snap: snap, ReadResult: rr}
+	}
+	return out
+}
+
+// Notify mirrors notifyScript (writer_atomic.go): the new tsSeq sorts
+// strictly after the clock, the last issued pair, the snap stop and the
+// newest delta; a full second (millisecond, under TsSeqV2) spills into the
+// next. A tombstoned catalog refuses with ErrCatalogDeleted.
+func (m *Memory) Notify(_ context.Context, catalog, fieldPath string, mergeType MergeType, uri string) (TimeSeqID, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tombstoned(catalog) {
+		return TimeSeqID{}, "", fmt.Errorf("notify %s: %w", catalog, ErrCatalogDeleted)
+	}
+	c := m.catalog(catalog, true)
+	var floor TimeSeqID
+	bump := func(t TimeSeqID) {
+		if t.Score() > floor.Score() {
+			floor = t
+		}
+	}
+	bump(c.issued)
+	if c.snap != nil {
+		bump(c.snap.StopTsSeq)
+	}
+	if n := len(c.deltas); n > 0 {
+		bump(c.deltas[n-1].TsSeq)
+	}
+	var id TimeSeqID
+	if m.version == TsSeqV2 || floor.Version() == TsSeqV2 {
+		ms, seq := m.nowMs(), int64(0)
+		if fms := floor.Ms(); fms > ms {
+			ms, seq = fms, floor.MsSeqID()
+		} else if fms == ms {
+			seq = floor.MsSeqID()
+		}
+		seq++
+		if seq > MaxSeqIDMs(ms) {
+			ms, seq = ms+1, 1
+		}
+		if ms > MaxTimestampMs {
+			return TimeSeqID{}, "", fmt.Errorf("ms %d beyond score-safe cap (clock misconfigured?)", ms)
+		}
+		id = timeSeqIDMs(ms, seq)
+	} else {
+		if now := (TimeSeqID{Timestamp: m.now()}); now.Score() > floor.Score() {
+			floor = now
+		}
+		id = TimeSeqID{Timestamp: floor.Timestamp, SeqID: floor.SeqID + 1}
+		if id.SeqID > 999999 {
+			id = TimeSeqID{Timestamp: id.Timestamp + 1, SeqID: 1}
+		}
+		if id.Timestamp > MaxTimestamp {
+			return TimeSeqID{}, "", fmt.Errorf("timestamp %d beyond score-safe cap (clock misconfigured?)", id.Timestamp)
+		}
+	}
+	member, err := json.Marshal([]any{int(mergeType), fieldPath, id.String(), uri})
+	if err != nil {
+		return TimeSeqID{}, "", err
+	}
+	c.issued = id
+	c.deltas = append(c.deltas, DeltaInfo{
+		Member: string(member), Score: id.Score(), TsSeq: id,
+		MergeType: mergeType, Path: fieldPath, URI: uri,
+	})
+	if c.ttl > 0 {
+		c.deadline = m.clock().Add(c.ttl)
+	}
+	return id, string(member), nil
+}
+
+// AddSnap mirrors addSnapScript (writer_snap.go), history aside.
+func (m *Memory) AddSnap(_ context.Context, catalog string, stopTsSeq TimeSeqID, uri, removeGen string) error {
+	if _, err := EncodeSnapValue(stopTsSeq, uri); err != nil {
+		return err
+	}
+	if removeGen == "" {
+		removeGen = "0"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tombstoned(catalog) {
+		return nil
+	}
+	if c := m.catalog(catalog, false); c == nil {
+		if _, unswept := m.expired[catalog]; unswept {
+			return nil
+		}
+	}
+	c := m.catalog(catalog, true)
+	if c.snap != nil && c.snap.Score() >= stopTsSeq.Score() {
+		return nil
+	}
+	if strconv.FormatInt(c.removeGen, 10) != removeGen {
+		return nil
+	}
+	c.snap = &SnapInfo{StopTsSeq: stopTsSeq, URI: uri}
+	return nil
+}
+
+func (m *Memory) LatestSnap(_ context.Context, catalog string) (*SnapInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.catalog(catalog, false); c != nil && c.snap != nil {
+		s := *c.snap
+		return &s, nil
+	}
+	return nil, nil
+}
+
+func (m *Memory) Compact(_ context.Context, catalog string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.catalog(catalog, false)
+	if c == nil || c.snap == nil {
+		return 0, nil
+	}
+	stop := c.snap.Score()
+	n := sort.Search(len(c.deltas), func(i int) bool { return c.deltas[i].Score > stop })
+	c.deltas = slices.Delete(c.deltas, 0, n)
+	return int64(n), nil
+}
+
+// find returns the index of catalog's delta at tsSeq, or -1.
+func (c *memCatalog) find(tsSeq TimeSeqID) int {
+	for i := range c.deltas {
+		if c.deltas[i].TsSeq == tsSeq {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *Memory) HasDelta(_ context.Context, catalog string, tsSeq TimeSeqID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.catalog(catalog, false)
+	return c != nil && c.find(tsSeq) >= 0, nil
+}
+
+func (m *Memory) RemoveDelta(_ context.Context, catalog string, tsSeq TimeSeqID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := m.catalog(catalog, false)
+	if c == nil {
+		return false, nil
+	}
+	i := c.find(tsSeq)
+	if i < 0 {
+		return false, nil
+	}
+	c.removeGen++
+	c.deltas = slices.Delete(c.deltas, i, i+1)
+	return true, nil
+}
+
+func (m *Memory) RemoveGen(_ context.Context, catalog string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c := m.catalog(catalog, false); c != nil {
+		return strconv.FormatInt(c.removeGen, 10), nil
+	}
+	return "0", nil
+}
+
+// IterateSnaps yields the pointers present when it starts, in catalog
+// order; fn runs without the lock held, so it may call back into m.
+func (m *Memory) IterateSnaps(ctx context.Context, fn func(catalog string, snap SnapInfo) bool) error {
+	type entry struct {
+		catalog string
+		snap    SnapInfo
+	}
+	m.mu.Lock()
+	m.expireDue()
+	entries := make([]entry, 0, len(m.catalogs))
+	for name, c := range m.catalogs {
+		if c.snap != nil {
+			entries = append(entries, entry{name, *c.snap})
+		}
+	}
+	m.mu.Unlock()
+	slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.catalog, b.catalog) })
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(e.catalog, e.snap) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (m *Memory) NowUnix() int64 { return m.now() }
+
+// SetClock replaces the local clock behind tsSeq allocation, expiry
+// deadlines and tombstones, so tests can step time instead of sleeping.
+func (m *Memory) SetClock(now func() time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.now = func() int64 { return now().Unix() }
+	m.nowMs = func() int64 { return now().UnixMilli() }
+}
+
+// clock is the current time on m's clock. Callers hold m.mu.
+func (m *Memory) clock() time.Time { return time.UnixMilli(m.nowMs()) }
+
+// SetTsSeqVersion mirrors Writer.SetTsSeqVersion.
+func (m *Memory) SetTsSeqVersion(v TsSeqVersion) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.version = v
+}
@@ -0,0 +1,190 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// rewriteURIsScript moves index references from one storage location to
+// another in a single atomic step: the snap pointer (compare-and-set on its
+// raw value), then the given delta and history members, each replaced by
+// the member RewriteURIs built for it under the old one's score. The
+// replacements are assembled in Go (see rewriteMemberURI), so every byte
+// but the URI's is the stored member's own — the script never re-encodes.
+// Members that vanished since the caller listed them (a concurrent
+// Compact, GC or RemoveDelta) are skipped, which makes a retried batch a
+// no-op.
+//
+// KEYS[1] delta zset, KEYS[2] snaps hash, KEYS[3] history zset, KEYS[4]
+// legacy snaps hash (see snapsLua).
+// ARGV[1] catalog, ARGV[2] expected snap value ("" = leave the pointer
+// alone), ARGV[3] replacement snap value, ARGV[4] number of delta pairs n,
+// then n (old, new) delta member pairs, the rest (old, new) history pairs.
+//
+// Returns {1 if the pointer moved, history entries rewritten, then the
+// 1-based pair number of each delta rewritten}.
+const rewriteURIsScript = snapsLua + `
+local function rewrite(key, old, new)
+  local score = redis.call("ZSCORE", key, old)
+  if not score then
+    return 0
+  end
+  redis.call("ZREM", key, old)
+  redis.call("ZADD", key, score, new)
+  return 1
+end
+local out = {0, 0}
+local hash = snaps_of(KEYS[2], KEYS[4], ARGV[1])
+if ARGV[2] ~= "" and redis.call("HGET", hash, ARGV[1]) == ARGV[2] then
+  redis.call("HSET", hash, ARGV[1], ARGV[3])
+  out[1] = 1
+end
+local last = 4 + 2 * tonumber(ARGV[4])
+for i = 5, last, 2 do
+  if rewrite(KEYS[1], ARGV[i], ARGV[i + 1]) == 1 then
+    out[#out + 1] = (i - 3) / 2
+  end
+end
+for i = last + 1, #ARGV, 2 do
+  out[2] = out[2] + rewrite(KEYS[3], ARGV[i], ARGV[i + 1])
+end
+return out
+`
+
+var luaRewriteURIs = NewScript(rewriteURIsScript)
+
+// URIRewrite is one batch for RewriteURIs: the raw delta and history
+// members to move, and optionally the snap pointer (Snap non-nil) to move to
+// SnapURI.
+type URIRewrite struct {
+	From, To       string // URI prefixes, "provider://bucket/"
+	DeltaMembers   []string
+	HistoryMembers []string
+	Snap           *SnapInfo
+	SnapURI        string
+}
+
+// URIRewriteResult is what one RewriteURIs call actually changed.
+type URIRewriteResult struct {
+	Deltas  []MemberRewrite // delta entries repointed
+	History int64           // history entries repointed
+	Pointer bool            // the snap pointer was repointed
+}
+
+// MemberRewrite is one delta entry RewriteURIs replaced.
+type MemberRewrite struct {
+	Old, New string
+}
+
+// RewriteURIs atomically repoints a batch of the catalog's index entries
+// from the From prefix to To (see rewriteURIsScript). Members whose URI
+// does not start with From are left alone. The pointer is only moved if it
+// still equals *Snap — a snapshot published since the caller read it wins.
+func (w *Writer) RewriteURIs(ctx context.Context, catalog string, rw URIRewrite) (*URIRewriteResult, error) {
+	var oldSnap, newSnap string
+	if rw.Snap != nil {
+		var err error
+		if oldSnap, err = EncodeSnapValue(rw.Snap.StopTsSeq, rw.Snap.URI); err != nil {
+			return nil, err
+		}
+		if newSnap, err = EncodeSnapValue(rw.Snap.StopTsSeq, rw.SnapURI); err != nil {
+			return nil, err
+		}
+	}
+	pairs := func(members []string, pos int) []any {
+		var out []any
+		for _, m := range members {
+			if r, ok := rewriteMemberURI(m, pos, rw.From, rw.To); ok {
+				out = append(out, m, r)
+			}
+		}
+		return out
+	}
+	deltaPairs := pairs(rw.DeltaMembers, 3)     // [mergeType, path, tsSeq, uri]
+	historyPairs := pairs(rw.HistoryMembers, 1) // [tsSeq, uri, publishedAt]
+	args := make([]any, 0, 4+len(deltaPairs)+len(historyPairs))
+	args = append(args, catalog, oldSnap, newSnap, len(deltaPairs)/2)
+	args = append(args, deltaPairs...)
+	args = append(args, historyPairs...)
+	res, err := RunScript(ctx, w.rdb, luaRewriteURIs,
+		[]string{w.MakeDeltaZsetKey(catalog), w.MakeSnapsHashKey(catalog), w.MakeSnapHistoryKey(catalog), w.legacySnapsKey(catalog)},
+		args...,
+	).Result()
+	if err != nil {
+		return nil, fmt.Errorf("rewrite uris eval: %w", err)
+	}
+	arr, ok := res.([]any)
+	if !ok || len(arr) < 2 {
+		return nil, fmt.Errorf("unexpected rewrite result: %v", res)
+	}
+	pointer, ok1 := arr[0].(int64)
+	history, ok2 := arr[1].(int64)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("unexpected rewrite result: %v", res)
+	}
+	out := &URIRewriteResult{History: history, Pointer: pointer == 1}
+	for _, v := range arr[2:] {
+		n, ok := v.(int64)
+		if !ok || n < 1 || int(2*n) > len(deltaPairs) {
+			return nil, fmt.Errorf("unexpected rewrite result: %v", res)
+		}
+		out.Deltas = append(out.Deltas, MemberRewrite{Old: deltaPairs[2*n-2].(string), New: deltaPairs[2*n-1].(string)})
+	}
+	return out, nil
+}
+
+// rewriteMemberURI returns member — a JSON array holding a URI at pos —
+// with the URI's from prefix replaced by to. Only that element is
+// re-encoded, in the member's own escaping of "/" (Lua's cjson writes
+// "\/"); every other byte is kept. ok is false when member does not
+// decode or its URI is not under from.
+func rewriteMemberURI(member string, pos int, from, to string) (string, bool) {
+	var elems []json.RawMessage
+	if err := json.Unmarshal([]byte(member), &elems); err != nil || pos >= len(elems) {
+		return "", false
+	}
+	var uri string
+	if err := json.Unmarshal(elems[pos], &uri); err != nil || !strings.HasPrefix(uri, from) {
+		return "", false
+	}
+	enc, err := json.Marshal(to + uri[len(from):])
+	if err != nil {
+		return "", false
+	}
+	if bytes.Contains(elems[pos], []byte(`\/`)) {
+		enc = bytes.ReplaceAll(enc, []byte("/"), []byte(`\/`))
+	}
+	elems[pos] = enc
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, e := range elems {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(e)
+	}
+	b.WriteByte(']')
+	return b.String(), true
+}
+
+// AllDeltas returns every decodable entry of the catalog's delta zset in
+// score order, absorbed or not. Undecodable members are skipped.
+func (r *Reader) AllDeltas(ctx context.Context, catalog string) ([]DeltaInfo, error) {
+	zs, err := r.rdb.ZRangeWithScores(ctx, r.MakeDeltaZsetKey(catalog), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]DeltaInfo, 0, len(zs))
+	for _, z := range zs {
+		member, _ := z.Member.(string)
+		d, derr := DecodeDeltaMember(member, z.Score)
+		if derr != nil {
+			continue
+		}
+		out = append(out, *d)
+	}
+	return out, nil
+}
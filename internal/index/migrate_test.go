@@ -0,0 +1,29 @@
+package index
+
+import "testing"
+
+// TestRewriteMemberURI: only the URI element changes, other bytes are kept
+// verbatim and the member's own "/" escaping carries over.
+func TestRewriteMemberURI(t *testing.T) {
+	from, to := "oss://old/", "s3://new/"
+	tests := []struct {
+		member string
+		pos    int
+		want   string
+		ok     bool
+	}{
+		{mkMember(1, "/a/b", "1700000000_1", "oss://old/c/1.dat"), 3, `[1,"/a/b","1700000000_1","s3://new/c/1.dat"]`, true},
+		// Lua's cjson escapes "/" — path and tsSeq keep theirs byte for byte.
+		{`[1,"\/a\/b","1700000000_1","oss:\/\/old\/c\/1.dat"]`, 3, `[1,"\/a\/b","1700000000_1","s3:\/\/new\/c\/1.dat"]`, true},
+		{`["1700000000_1","oss:\/\/old\/s.snap",1700000001]`, 1, `["1700000000_1","s3:\/\/new\/s.snap",1700000001]`, true},
+		{mkMember(1, "/a", "1700000000_1", "oss://other/c/1.dat"), 3, "", false},
+		{`[1,"/a"]`, 3, "", false},
+		{"not json", 3, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := rewriteMemberURI(tt.member, tt.pos, from, to)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("rewriteMemberURI(%s) = %s, %v; want %s, %v", tt.member, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package index
 
 import (
 	"context"
+	"strconv"
 	"testing"
 
 	"github.com/redis/go-redis/v9"
@@ -70,3 +71,39 @@ func TestNotifyMemberConsistency_Redis(t *testing.T) {
 		t.Fatalf("Notify returned member %q but it is not the one stored in the zset", member1)
 	}
 }
+
+// TestTsSeqLuaMirror_Redis: tsSeqLua accepts exactly what ParseTimeSeqID
+// accepts ("0_0" aside, which floors nothing), and tsseq_score is
+// bit-identical to TimeSeqID.Score — the snap and allocator floors every
+// script computes depend on it.
+func TestTsSeqLuaMirror_Redis(t *testing.T) {
+	rdb, _ := indexTestRedis(t)
+	ctx := context.Background()
+	script := tsSeqLua + `
+local score = tsseq_score(ARGV[1])
+return score and string.format("%.17g", score) or false
+`
+	for _, s := range []string{
+		"1700000000_1", "1700000000_999999", "8589934591_999999", "8589934592_1",
+		"1700000000_01", "1700000000_1000000", "1.7e9_1",
+		"v2_1700000000123_1", "v2_1700000000123_4095", "v2_1700000000123_4096",
+		"v2_8589934592_1", "v2_8589934592_4095", "v2_8589934592_4096", "v2_8589934591_1", "v2_8796093022207_1023", "v2_8796093022208_1",
+		"v2_01700000000123_1", "v2_1700000000123_0",
+	} {
+		res, err := rdb.Eval(ctx, script, nil, s).Result()
+		if err != nil && err != redis.Nil {
+			t.Fatalf("eval %q: %v", s, err)
+		}
+		id, perr := ParseTimeSeqID(s)
+		if (perr == nil) != (res != nil) {
+			t.Fatalf("%q: Go err=%v, Lua score=%v", s, perr, res)
+		}
+		if perr != nil {
+			continue
+		}
+		score, err := strconv.ParseFloat(res.(string), 64)
+		if err != nil || score != id.Score() {
+			t.Fatalf("%q: Lua score %v, Go %v", s, res, id.Score())
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ErrObjectDeleting is returned by PinObject while GC holds the object's
+// delete mark (MarkObjectDeleting): it is about to be deleted, so it can be
+// neither referenced nor uploaded over until the mark is gone.
+var ErrObjectDeleting = errors.New("lake: object is being deleted")
+
+// deletingReply is the error reply pinObjectScript refuses a marked object
+// with; PinObject maps it to ErrObjectDeleting.
+const deletingReply = "object being deleted"
+
+// The pin set holds one member per object path. A positive score is a pin
+// held until that Unix second; a negative one is GC's delete mark, held
+// until -score. One member per path makes the two exclusive: each script
+// sets its own only while the other's is absent or lapsed, so GC never
+// deletes an object a WriteBegin has pinned, and no WriteBegin pins one GC
+// is deleting. Both prune lapsed members: a score in (-now, now).
+
+// pinObjectScript extends (never shortens) the pin on ARGV[1] to ARGV[2]
+// seconds from now unless it carries a live delete mark, prunes lapsed
+// members, and keeps the key alive at least as long as the pin just set —
+// an idle catalog's pin set expires on its own.
+const pinObjectScript = `
+local now = tonumber(redis.call("TIME")[1])
+local ttl = tonumber(ARGV[2])
+local cur = redis.call("ZSCORE", KEYS[1], ARGV[1])
+cur = cur and tonumber(cur)
+if cur and cur <= -now then
+  return redis.error_reply("` + deletingReply + `")
+end
+if not cur or cur < now + ttl then
+  redis.call("ZADD", KEYS[1], now + ttl, ARGV[1])
+end
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "(" .. -now, "(" .. now)
+if redis.call("TTL", KEYS[1]) < ttl then
+  redis.call("EXPIRE", KEYS[1], ttl)
+end
+return 1
+`
+
+// markObjectScript sets the delete mark on ARGV[1] for ARGV[2] seconds
+// unless it holds a live pin; returns 1 when marked, 0 when pinned.
+const markObjectScript = `
+local now = tonumber(redis.call("TIME")[1])
+local ttl = tonumber(ARGV[2])
+local cur = redis.call("ZSCORE", KEYS[1], ARGV[1])
+cur = cur and tonumber(cur)
+if cur and cur >= now then
+  return 0
+end
+redis.call("ZADD", KEYS[1], -(now + ttl), ARGV[1])
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "(" .. -now, "(" .. now)
+if redis.call("TTL", KEYS[1]) < ttl then
+  redis.call("EXPIRE", KEYS[1], ttl)
+end
+return 1
+`
+
+// unmarkObjectScript drops the delete mark on ARGV[1] — never a pin that
+// replaced a lapsed mark.
+const unmarkObjectScript = `
+local cur = redis.call("ZSCORE", KEYS[1], ARGV[1])
+cur = cur and tonumber(cur)
+if cur and cur < 0 then
+  redis.call("ZREM", KEYS[1], ARGV[1])
+end
+return 1
+`
+
+var (
+	luaPinObject    = NewScript(pinObjectScript)
+	luaMarkObject   = NewScript(markObjectScript)
+	luaUnmarkObject = NewScript(unmarkObjectScript)
+)
+
+// PinObject protects the object at path from GC for ttlSeconds. A
+// content-addressed WriteBegin pins the object it hands out, whether it
+// already exists or is about to be uploaded: an absorbed delta's object may
+// be about to gain a new reference that its WriteNotify has not recorded.
+// Fails with ErrObjectDeleting while GC holds the object's delete mark.
+func (w *Writer) PinObject(ctx context.Context, catalog, path string, ttlSeconds int64) error {
+	err := RunScript(ctx, w.rdb, luaPinObject, []string{w.MakeObjectPinKey(catalog)}, path, max(ttlSeconds, 1)).Err()
+	if err != nil && strings.HasPrefix(err.Error(), deletingReply) {
+		return fmt.Errorf("pin %s: %w", path, ErrObjectDeleting)
+	}
+	if err != nil {
+		return fmt.Errorf("pin object eval: %w", err)
+	}
+	return nil
+}
+
+// MarkObjectDeleting takes the delete mark on the object at path for
+// ttlSeconds — the bound on a GC that dies before UnmarkObjectDeleting.
+// Reports false, taking nothing, when the object is pinned.
+func (w *Writer) MarkObjectDeleting(ctx context.Context, catalog, path string, ttlSeconds int64) (bool, error) {
+	n, err := RunScript(ctx, w.rdb, luaMarkObject, []string{w.MakeObjectPinKey(catalog)}, path, max(ttlSeconds, 1)).Int()
+	if err != nil {
+		return false, fmt.Errorf("mark object eval: %w", err)
+	}
+	return n == 1, nil
+}
+
+// UnmarkObjectDeleting releases the delete mark MarkObjectDeleting took.
+func (w *Writer) UnmarkObjectDeleting(ctx context.Context, catalog, path string) error {
+	if err := RunScript(ctx, w.rdb, luaUnmarkObject, []string{w.MakeObjectPinKey(catalog)}, path).Err(); err != nil {
+		return fmt.Errorf("unmark object eval: %w", err)
+	}
+	return nil
+}
+
+// ObjectPinned reports whether path holds an unexpired pin, judged on the
+// Redis-synced clock.
+func (r *Reader) ObjectPinned(ctx context.Context, catalog, path string) (bool, error) {
+	until, err := r.rdb.ZScore(ctx, r.MakeObjectPinKey(catalog), path).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return int64(until) >= r.NowUnix(), nil
+}
@@ -3,6 +3,7 @@ package index
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"sync"
@@ -17,7 +18,7 @@ import (
 // ticker runs until Close; a Reader that is never closed is reclaimed
 // by the OS at process exit (the intended single-Client-per-process use).
 type Reader struct {
-	rdb       *redis.Client
+	rdb       redis.UniversalClient
 	clock     atomic.Pointer[clockSync]
 	done      chan struct{}
 	closeOnce sync.Once
@@ -34,7 +35,7 @@ type clockSync struct {
 	at        time.Time // monotonic anchor
 }
 
-func NewReader(rdb *redis.Client) *Reader {
+func NewReader(rdb redis.UniversalClient) *Reader {
 	r := &Reader{rdb: rdb, done: make(chan struct{})}
 	go r.timeUpdater()
 	return r
@@ -96,18 +97,23 @@ type BatchListResult struct {
 // then surfaces the decode error (parseListReply). The removal generation
 // ("<catalog>:rg" field of the snaps hash, absent = "0") is read in the same
 // atomic step so AddSnap can later tell whether a RemoveDelta interleaved.
-// KEYS[1] = snaps hash, KEYS[2] = delta zset; ARGV[1] = catalog. Returns
-// {snapValue|false, removeGen, flat [member, score, ...]} — scores pass
-// through as Redis reply strings, never via Lua numbers (tostring would
-// mangle the float).
-const listScript = snapScoreLua + `
-local snap = redis.call("HGET", KEYS[1], ARGV[1])
-local rg = redis.call("HGET", KEYS[1], ARGV[1] .. ":rg") or "0"
+// An expired catalog (see expiryLua) lists as one never written.
+// KEYS[1] = snaps hash, KEYS[2] = delta zset, KEYS[3] = legacy snaps hash
+// (see snapsLua); ARGV[1] = catalog. Returns {snapValue|false, removeGen,
+// flat [member, score, ...]} — scores pass through as Redis reply strings,
+// never via Lua numbers (tostring would mangle the float).
+const listScript = snapScoreLua + snapsLua + expiryLua + `
+local snaps = snaps_of(KEYS[1], KEYS[3], ARGV[1])
+if is_expired(snaps, ARGV[1]) then
+  return {false, "0", {}}
+end
+local snap = redis.call("HGET", snaps, ARGV[1])
+local rg = redis.call("HGET", snaps, ARGV[1] .. ":rg") or "0"
 local min = "-inf"
 if snap then
   local score = snap_score(snap)
   if score then
-    min = "(" .. string.format("%.6f", score)
+    min = "(" .. string.format("%.17g", score)
   end
 end
 return {snap or false, rg, redis.call("ZRANGEBYSCORE", KEYS[2], min, "+inf", "WITHSCORES")}
@@ -121,7 +127,7 @@ var luaList = NewScript(listScript)
 // the single read primitive behind Client.List / Client.BatchList.
 func (r *Reader) ListCatalog(ctx context.Context, catalog string) (*SnapInfo, *ReadIndexResult) {
 	res, err := RunScript(ctx, r.rdb, luaList,
-		[]string{r.MakeSnapsHashKey(), r.MakeDeltaZsetKey(catalog)},
+		[]string{r.MakeSnapsHashKey(catalog), r.MakeDeltaZsetKey(catalog), r.legacySnapsKey(catalog)},
 		catalog,
 	).Result()
 	if err != nil {
@@ -220,24 +226,31 @@ func (r *Reader) HasDelta(ctx context.Context, catalog string, tsSeq TimeSeqID)
 // generation captured with their ListResult: a loader computing from a list
 // taken BEFORE a removal must not cache its result after it.
 func (r *Reader) RemoveGen(ctx context.Context, catalog string) (string, error) {
-	gen, err := r.rdb.HGet(ctx, r.MakeSnapsHashKey(), catalog+":rg").Result()
-	if err == redis.Nil {
-		return "0", nil
-	}
-	if err != nil {
+	pipe := r.rdb.Pipeline()
+	fields := r.queueSnapFields(ctx, pipe, catalog, catalog+":rg")
+	if _, err := pipe.Exec(ctx); err != nil {
 		return "", err
 	}
-	return gen, nil
+	if gen, ok := fields.Val()[0].(string); ok {
+		return gen, nil
+	}
+	return "0", nil
 }
 
+// GetLatestSnap reads the snap pointer, nil for a catalog without one or
+// past its expiry deadline.
 func (r *Reader) GetLatestSnap(ctx context.Context, catalog string) (*SnapInfo, error) {
-	val, err := r.rdb.HGet(ctx, r.MakeSnapsHashKey(), catalog).Result()
-	if err == redis.Nil {
-		return nil, nil
-	}
-	if err != nil {
+	pipe := r.rdb.Pipeline()
+	fields := r.queueSnapFields(ctx, pipe, catalog, catalog, catalog+":x")
+	now := pipe.Time(ctx)
+	if _, err := pipe.Exec(ctx); err != nil {
 		return nil, err
 	}
+	vals := fields.Val()
+	val, ok := vals[0].(string)
+	if !ok || expiredAt(vals[1], now.Val()) {
+		return nil, nil
+	}
 	stop, uri, err := DecodeSnapValue(val)
 	if err != nil {
 		return nil, err
@@ -256,37 +269,85 @@ const snapScanBatch = 500
 // fields, so this scales to multi-million-catalog deployments without
 // stalling concurrent reads/writes. Iteration stops when fn returns false
 // or the hash is exhausted; ctx cancellation is honoured between pages.
+// Under LayoutCluster the per-catalog snap records are found by SCAN
+// instead (on every master) and read one pipelined page at a time.
 //
 // Each (catalog, snap) is yielded at most once for snap values that
 // existed throughout the scan; a catalog that is added or removed *during*
 // the scan may be observed once, twice, or not at all (HSCAN's standard
-// concurrent-modification semantics). Values that fail to decode are
-// skipped silently.
+// concurrent-modification semantics), and one MigrateSnapShards moves
+// during it may be observed twice. With SetSnapShards each shard is scanned
+// in turn, "<prefix>:s" first. Values that fail to decode are skipped
+// silently.
 func (r *Reader) IterateSnaps(ctx context.Context, fn func(catalog string, snap SnapInfo) bool) error {
-	key := r.MakeSnapsHashKey()
-	var cursor uint64
-	for {
-		if err := ctx.Err(); err != nil {
-			return err
+	if r.Layout() == LayoutCluster {
+		return r.iterateSnapRecords(ctx, fn)
+	}
+	errStop := errors.New("stop")
+	for _, key := range r.snapHashKeys() {
+		err := scanHash(ctx, r.rdb, key, "", func(field, value string) error {
+			stop, uri, derr := DecodeSnapValue(value)
+			if derr != nil {
+				return nil
+			}
+			if !fn(field, SnapInfo{StopTsSeq: stop, URI: uri}) {
+				return errStop
+			}
+			return nil
+		})
+		if err == errStop {
+			return nil
 		}
-		pairs, next, err := r.rdb.HScan(ctx, key, cursor, "", snapScanBatch).Result()
 		if err != nil {
 			return err
 		}
-		for i := 0; i+1 < len(pairs); i += 2 {
-			stop, uri, derr := DecodeSnapValue(pairs[i+1])
-			if derr != nil {
-				continue
+	}
+	return nil
+}
+
+// iterateSnapRecords is IterateSnaps over LayoutCluster's per-catalog snap
+// records.
+func (r *Reader) iterateSnapRecords(ctx context.Context, fn func(catalog string, snap SnapInfo) bool) error {
+	return ScanKeys(ctx, r.rdb, r.catalogKeyPattern("s"), snapScanBatch, func(keys []string) (bool, error) {
+		catalogs := make([]string, 0, len(keys))
+		pipe := r.rdb.Pipeline()
+		var cmds []*redis.StringCmd
+		for _, key := range keys {
+			if catalog, ok := r.catalogOfKey("s", key); ok {
+				catalogs = append(catalogs, catalog)
+				cmds = append(cmds, pipe.HGet(ctx, key, catalog))
 			}
-			if !fn(pairs[i], SnapInfo{StopTsSeq: stop, URI: uri}) {
-				return nil
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return false, err
+		}
+		for i, cmd := range cmds {
+			stop, uri, derr := DecodeSnapValue(cmd.Val())
+			if cmd.Err() != nil || derr != nil {
+				continue // a record holding only a removal generation
+			}
+			if !fn(catalogs[i], SnapInfo{StopTsSeq: stop, URI: uri}) {
+				return false, nil
 			}
 		}
-		if next == 0 {
-			return nil
+		return true, nil
+	})
+}
+
+// IterateDeltaCatalogs streams the name of every catalog whose name starts
+// with catalogPrefix ("" = all) and that has a delta zset, via SCAN over the
+// delta keys — together with IterateSnaps it reaches every catalog with
+// index state. Same paging and concurrent-modification semantics as
+// IterateSnaps.
+func (r *Reader) IterateDeltaCatalogs(ctx context.Context, catalogPrefix string, fn func(catalog string) bool) error {
+	return ScanKeys(ctx, r.rdb, r.catalogPrefixPattern("d", catalogPrefix), snapScanBatch, func(keys []string) (bool, error) {
+		for _, key := range keys {
+			if catalog, ok := r.catalogOfKey("d", key); ok && !fn(catalog) {
+				return false, nil
+			}
 		}
-		cursor = next
-	}
+		return true, nil
+	})
 }
 
 // BatchList runs one pipelined listScript per catalog — a single round-trip
@@ -346,7 +407,7 @@ func (r *Reader) evalListPipelined(ctx context.Context, catalogs []string, fullB
 	pipe := r.rdb.Pipeline()
 	cmds := make(map[string]*redis.Cmd, len(catalogs))
 	for _, c := range catalogs {
-		keys := []string{r.MakeSnapsHashKey(), r.MakeDeltaZsetKey(c)}
+		keys := []string{r.MakeSnapsHashKey(c), r.MakeDeltaZsetKey(c), r.legacySnapsKey(c)}
 		if fullBody {
 			cmds[c] = pipe.Eval(ctx, luaList.src, keys, c)
 		} else {
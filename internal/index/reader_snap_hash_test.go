@@ -71,7 +71,7 @@ func TestSnapHashRoundTrip(t *testing.T) {
 		t.Fatalf("AddSnap: %v", err)
 	}
 
-	val, err := rdb.HGet(ctx, r.MakeSnapsHashKey(), "users").Result()
+	val, err := rdb.HGet(ctx, r.MakeSnapsHashKey("users"), "users").Result()
 	if err != nil {
 		t.Fatalf("HGet: %v", err)
 	}
@@ -126,7 +126,7 @@ func TestSnapHashOverwrite(t *testing.T) {
 		t.Fatalf("after overwrite: got %+v, want stop=%v", got, stop2)
 	}
 
-	cnt, err := rdb.HLen(ctx, r.MakeSnapsHashKey()).Result()
+	cnt, err := rdb.HLen(ctx, r.MakeSnapsHashKey("users")).Result()
 	if err != nil {
 		t.Fatalf("HLen: %v", err)
 	}
@@ -190,7 +190,7 @@ func TestSnapHashMonotonic(t *testing.T) {
 		`["9999999999_011","oss://x"]`,     // leading-zero seq
 		`["9999999999_1000000","oss://x"]`, // seq past 999999
 	} {
-		if err := rdb.HSet(ctx, r.MakeSnapsHashKey(), "users", corrupt).Err(); err != nil {
+		if err := rdb.HSet(ctx, r.MakeSnapsHashKey("users"), "users", corrupt).Err(); err != nil {
 			t.Fatalf("HSet corrupt %q: %v", corrupt, err)
 		}
 		if err := w.AddSnap(ctx, "users", older, "oss://b/"+older.String()+".snap", ""); err != nil {
@@ -0,0 +1,53 @@
+package index
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ScanKeys streams the keys matching pattern to fn one SCAN page at a time
+// (up to count keys each). On a Redis Cluster client every master is
+// scanned in turn — a plain SCAN only walks the node it happens to land on.
+// Iteration stops when fn returns false or an error; ctx is checked between
+// pages. SCAN's usual guarantees apply: a key present throughout is
+// yielded at least once, possibly twice.
+func ScanKeys(ctx context.Context, rdb redis.UniversalClient, pattern string, count int64,
+	fn func(keys []string) (bool, error)) error {
+	nodes := []redis.UniversalClient{rdb}
+	if cc, ok := rdb.(*redis.ClusterClient); ok {
+		nodes = nodes[:0]
+		var mu sync.Mutex
+		if err := cc.ForEachMaster(ctx, func(_ context.Context, node *redis.Client) error {
+			mu.Lock()
+			nodes = append(nodes, node)
+			mu.Unlock()
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+	for _, node := range nodes {
+		var cursor uint64
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			keys, next, err := node.Scan(ctx, cursor, pattern, count).Result()
+			if err != nil {
+				return err
+			}
+			if len(keys) > 0 {
+				if more, err := fn(keys); err != nil || !more {
+					return err
+				}
+			}
+			if next == 0 {
+				break
+			}
+			cursor = next
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package index
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// snapsLua is the Lua prelude of every script that touches a catalog's
+// snap fields. Such a script takes the catalog's current snap hash
+// (MakeSnapsHashKey) and, as its LAST key, the hash the fields lived in
+// before SetSnapShards (legacySnapsKey; the same key when unsharded).
+// snaps_of picks the one holding the catalog: a catalog keeps all its
+// fields — pointer, ":rg", ":x" — in one hash, the legacy one until
+// moveSnapFieldsScript moves them over in one atomic step, so a deployment
+// switches to shards without downtime and without a script ever seeing half
+// a catalog. A new catalog starts in its shard. Once "<prefix>:s" is empty
+// the check is one EXISTS.
+const snapsLua = `
+local function snaps_of(snaps, legacy, catalog)
+  if snaps == legacy or redis.call("EXISTS", legacy) == 0 then
+    return snaps
+  end
+  if redis.call("HEXISTS", legacy, catalog) == 1 or redis.call("HEXISTS", legacy, catalog .. ":rg") == 1
+    or redis.call("HEXISTS", legacy, catalog .. ":x") == 1 then
+    return legacy
+  end
+  return snaps
+end
+`
+
+// snapFieldsCmd is a queued read of a catalog's snap fields; see
+// queueSnapFields.
+type snapFieldsCmd struct{ legacy, snaps *redis.SliceCmd }
+
+// queueSnapFields queues HMGET of catalog's snap fields on pipe. While a
+// shard migration may be moving the catalog, the legacy hash is read first:
+// fields move only from it to the shard, so a catalog moved between the two
+// reads is found in the second.
+func (w *indexIO) queueSnapFields(ctx context.Context, pipe redis.Pipeliner, catalog string, fields ...string) snapFieldsCmd {
+	var cmd snapFieldsCmd
+	if legacy := w.legacySnapsKey(catalog); legacy != w.MakeSnapsHashKey(catalog) {
+		cmd.legacy = pipe.HMGet(ctx, legacy, fields...)
+	}
+	cmd.snaps = pipe.HMGet(ctx, w.MakeSnapsHashKey(catalog), fields...)
+	return cmd
+}
+
+// Val returns one value per field (nil = absent), the shard's winning.
+func (c snapFieldsCmd) Val() []any {
+	vals := c.snaps.Val()
+	if c.legacy == nil || len(vals) == 0 {
+		return vals
+	}
+	if slices.ContainsFunc(vals, func(v any) bool { return v != nil }) {
+		return vals
+	}
+	return c.legacy.Val()
+}
+
+// moveSnapFieldsScript moves one catalog's snap fields from the legacy hash
+// to its shard, a field the shard already holds winning. KEYS[1] = shard,
+// KEYS[2] = legacy hash; ARGV[1] = catalog. Returns 1 if anything moved.
+const moveSnapFieldsScript = `
+local moved = 0
+for _, field in ipairs({ARGV[1], ARGV[1] .. ":rg", ARGV[1] .. ":x"}) do
+  local v = redis.call("HGET", KEYS[2], field)
+  if v then
+    redis.call("HSETNX", KEYS[1], field, v)
+    redis.call("HDEL", KEYS[2], field)
+    moved = 1
+  end
+end
+return moved
+`
+
+var luaMoveSnapFields = NewScript(moveSnapFieldsScript)
+
+// discoverSnapShards returns the shard count of a LayoutGlobal deployment
+// from its keys: one past the highest "<prefix>:s:<n>", 0 if none.
+func discoverSnapShards(ctx context.Context, rdb redis.UniversalClient, prefix string) (int, error) {
+	head := prefix + ":s:"
+	n := 0
+	err := ScanKeys(ctx, rdb, GlobEscape(head)+"*", snapScanBatch, func(keys []string) (bool, error) {
+		for _, key := range keys {
+			if i, err := strconv.Atoi(strings.TrimPrefix(key, head)); err == nil && i >= 0 {
+				n = max(n, i+1)
+			}
+		}
+		return true, nil
+	})
+	return n, err
+}
+
+// MigrateSnapShards moves every catalog's snap fields out of "<prefix>:s"
+// into its shard (SetSnapShards), one catalog per atomic step, while
+// readers and writers keep running: each step is a moveSnapFieldsScript,
+// and every script finds a catalog in whichever hash holds it. Re-running
+// is safe; once it returns nil "<prefix>:s" is gone. Returns the number of
+// catalogs moved.
+func (w *Writer) MigrateSnapShards(ctx context.Context) (int, error) {
+	if w.Layout() != LayoutGlobal || w.snapShards == 0 {
+		return 0, fmt.Errorf("migrate snap shards: no shards configured (layout %v, %d shards)", w.Layout(), w.snapShards)
+	}
+	legacy := w.legacySnapsKey("")
+	moved := 0
+	var cursor uint64
+	for {
+		if err := ctx.Err(); err != nil {
+			return moved, err
+		}
+		pairs, next, err := w.rdb.HScan(ctx, legacy, cursor, "", snapScanBatch).Result()
+		if err != nil {
+			return moved, err
+		}
+		seen := map[string]struct{}{}
+		for i := 0; i < len(pairs); i += 2 {
+			catalog, _, _ := strings.Cut(pairs[i], ":")
+			if _, dup := seen[catalog]; dup {
+				continue
+			}
+			seen[catalog] = struct{}{}
+			n, err := RunScript(ctx, w.rdb, luaMoveSnapFields, []string{w.MakeSnapsHashKey(catalog), legacy}, catalog).Int()
+			if err != nil {
+				return moved, fmt.Errorf("move %s: %w", catalog, err)
+			}
+			moved += n
+		}
+		if next == 0 {
+			return moved, nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,118 @@
+package index
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSnapShardKeys pins the sharded snap hash names: a stable shard per
+// catalog, "<prefix>:s" as the legacy hash, and no effect under
+// LayoutCluster.
+func TestSnapShardKeys(t *testing.T) {
+	var io indexIO
+	io.SetPrefix("app")
+	io.SetSnapShards(4)
+	key := io.MakeSnapsHashKey("a/b")
+	if !strings.HasPrefix(key, "app:s:") || key != io.MakeSnapsHashKey("a/b") {
+		t.Fatalf("sharded snaps key = %q", key)
+	}
+	if got := io.legacySnapsKey("a/b"); got != "app:s" {
+		t.Fatalf("legacy snaps key = %q", got)
+	}
+	if got := io.snapHashKeys(); len(got) != 5 || got[0] != "app:s" || got[4] != "app:s:3" {
+		t.Fatalf("snapHashKeys = %v", got)
+	}
+
+	io.SetLayout(LayoutCluster)
+	if got := io.MakeSnapsHashKey("a/b"); got != "app:s:{a/b}" || io.legacySnapsKey("a/b") != got {
+		t.Fatalf("cluster snaps key = %q, legacy %q", got, io.legacySnapsKey("a/b"))
+	}
+}
+
+// TestMigrateSnapShards_Redis: catalogs written before sharding stay
+// readable and writable in "<prefix>:s", new ones start in their shard,
+// and MigrateSnapShards empties "<prefix>:s" with reads unchanged;
+// CopyLayout copies a sharded source.
+func TestMigrateSnapShards_Redis(t *testing.T) {
+	rdb, prefix := indexTestRedis(t)
+	ctx := context.Background()
+	old := NewWriter(rdb)
+	old.SetPrefix(prefix)
+	stop := TimeSeqID{Timestamp: 1700000100, SeqID: 1}
+	if err := old.AddSnap(ctx, "b", stop, "mem://snaps/b1.snap", ""); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	if _, _, err := old.Notify(ctx, "c", "/a", MergeTypeReplace, "mem://data/c.dat"); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if err := old.SetExpiry(ctx, "c", time.Hour); err != nil {
+		t.Fatalf("SetExpiry: %v", err)
+	}
+	if _, err := old.MigrateSnapShards(ctx); err == nil {
+		t.Fatal("MigrateSnapShards ran without shards")
+	}
+
+	w, r := NewWriter(rdb), NewReader(rdb)
+	for _, io := range []*indexIO{&w.indexIO, &r.indexIO} {
+		io.SetPrefix(prefix)
+		io.SetSnapShards(4)
+	}
+	stop2 := TimeSeqID{Timestamp: 1700000200, SeqID: 1}
+	if err := w.AddSnap(ctx, "b", stop2, "mem://snaps/b2.snap", ""); err != nil {
+		t.Fatalf("AddSnap over legacy: %v", err)
+	}
+	if ok, err := rdb.HExists(ctx, prefix+":s", "b").Result(); err != nil || !ok {
+		t.Fatalf("legacy catalog left <prefix>:s (ok=%v err=%v)", ok, err)
+	}
+	if err := w.AddSnap(ctx, "d", stop, "mem://snaps/d.snap", ""); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	if ok, err := rdb.HExists(ctx, w.MakeSnapsHashKey("d"), "d").Result(); err != nil || !ok {
+		t.Fatalf("new catalog not in its shard (ok=%v err=%v)", ok, err)
+	}
+
+	check := func(when string) {
+		t.Helper()
+		if snap, err := r.GetLatestSnap(ctx, "b"); err != nil || snap == nil || snap.StopTsSeq != stop2 {
+			t.Fatalf("%s: GetLatestSnap(b) = %+v, %v", when, snap, err)
+		}
+		if _, res := r.ListCatalog(ctx, "c"); res.Err != nil || len(res.Deltas) != 1 {
+			t.Fatalf("%s: ListCatalog(c) = %+v", when, res)
+		}
+		snaps := map[string]string{}
+		if err := r.IterateSnaps(ctx, func(c string, s SnapInfo) bool { snaps[c] = s.URI; return true }); err != nil {
+			t.Fatalf("%s: IterateSnaps: %v", when, err)
+		}
+		if len(snaps) != 2 || snaps["b"] != "mem://snaps/b2.snap" || snaps["d"] != "mem://snaps/d.snap" {
+			t.Fatalf("%s: IterateSnaps = %v", when, snaps)
+		}
+	}
+	check("before migration")
+
+	if n, err := w.MigrateSnapShards(ctx); err != nil || n != 2 {
+		t.Fatalf("MigrateSnapShards = %d, %v; want b and c moved", n, err)
+	}
+	if n, err := rdb.Exists(ctx, prefix+":s").Result(); err != nil || n != 0 {
+		t.Fatalf("<prefix>:s left after migration (n=%d err=%v)", n, err)
+	}
+	if ok, err := rdb.HExists(ctx, w.MakeSnapsHashKey("c"), "c:x").Result(); err != nil || !ok {
+		t.Fatalf("expiry of c not moved (ok=%v err=%v)", ok, err)
+	}
+	check("after migration")
+	if n, err := w.MigrateSnapShards(ctx); err != nil || n != 0 {
+		t.Fatalf("re-run MigrateSnapShards = %d, %v", n, err)
+	}
+
+	rep, err := CopyLayout(ctx, prefix, rdb, rdb, LayoutGlobal, LayoutCluster)
+	if err != nil || rep.SnapFields != 3 {
+		t.Fatalf("CopyLayout = %+v, %v; want b, c:x and d", rep, err)
+	}
+	cr := NewReader(rdb)
+	cr.SetPrefix(prefix)
+	cr.SetLayout(LayoutCluster)
+	if snap, err := cr.GetLatestSnap(ctx, "b"); err != nil || snap == nil || snap.StopTsSeq != stop2 {
+		t.Fatalf("GetLatestSnap after copy = %+v, %v", snap, err)
+	}
+}
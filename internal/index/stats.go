@@ -0,0 +1,166 @@
+package index
+
+import (
+	"context"
+	"slices"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// CatalogDetail is one catalog's full index statistics: CatalogStats plus
+// the delta range, removal generation and the delta index's footprint. A
+// catalog without state (or expired) reports zeros and RemoveGen "0".
+type CatalogDetail struct {
+	CatalogStats
+	Oldest     TimeSeqID // first delta in the index; zero without deltas
+	Newest     TimeSeqID // last delta in the index; zero without deltas
+	RemoveGen  string
+	DeltaBytes int64 // approximate memory of the delta index; 0 if unknown
+}
+
+// CatalogDetailer is the optional Index capability of detailed per-catalog
+// statistics. CatalogDetails returns one CatalogDetail per catalog, in the
+// order given.
+type CatalogDetailer interface {
+	CatalogDetails(ctx context.Context, catalogs []string) ([]CatalogDetail, error)
+}
+
+var (
+	_ CatalogDetailer = (*Reader)(nil)
+	_ CatalogDetailer = (*Memory)(nil)
+)
+
+// CatalogDetails reads each page of catalogs in two pipelined round-trips:
+// snap fields, delta count and end members, then the backlog and MEMORY
+// USAGE of the delta zset (sampled, so approximate on big zsets; left 0
+// where the server refuses the command).
+func (r *Reader) CatalogDetails(ctx context.Context, catalogs []string) ([]CatalogDetail, error) {
+	out := make([]CatalogDetail, 0, len(catalogs))
+	for page := range slices.Chunk(catalogs, snapScanBatch) {
+		details, err := r.catalogDetails(ctx, page)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, details...)
+	}
+	return out, nil
+}
+
+func (r *Reader) catalogDetails(ctx context.Context, catalogs []string) ([]CatalogDetail, error) {
+	pipe := r.rdb.Pipeline()
+	fields := make([]snapFieldsCmd, len(catalogs))
+	cards := make([]*redis.IntCmd, len(catalogs))
+	first := make([]*redis.ZSliceCmd, len(catalogs))
+	last := make([]*redis.ZSliceCmd, len(catalogs))
+	for i, catalog := range catalogs {
+		key := r.MakeDeltaZsetKey(catalog)
+		fields[i] = r.queueSnapFields(ctx, pipe, catalog, catalog, catalog+":rg", catalog+":x")
+		cards[i] = pipe.ZCard(ctx, key)
+		first[i] = pipe.ZRangeWithScores(ctx, key, 0, 0)
+		last[i] = pipe.ZRangeWithScores(ctx, key, -1, -1)
+	}
+	now := pipe.Time(ctx)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	out := make([]CatalogDetail, len(catalogs))
+	pipe = r.rdb.Pipeline()
+	backlogs := make([]*redis.IntCmd, len(catalogs))
+	sizes := make([]*redis.IntCmd, len(catalogs))
+	for i, catalog := range catalogs {
+		d := &out[i]
+		d.Catalog, d.RemoveGen = catalog, "0"
+		vals := fields[i].Val()
+		if expiredAt(vals[2], now.Val()) {
+			continue
+		}
+		if gen, ok := vals[1].(string); ok {
+			d.RemoveGen = gen
+		}
+		d.Deltas, d.Backlog = cards[i].Val(), cards[i].Val()
+		if d.Deltas > 0 {
+			d.Oldest = tsSeqOfZ(first[i].Val())
+			d.Newest = tsSeqOfZ(last[i].Val())
+			sizes[i] = pipe.MemoryUsage(ctx, r.MakeDeltaZsetKey(catalog))
+		}
+		val, ok := vals[0].(string)
+		if !ok {
+			continue
+		}
+		stop, uri, err := DecodeSnapValue(val)
+		if err != nil {
+			continue
+		}
+		d.Snap = &SnapInfo{StopTsSeq: stop, URI: uri}
+		if d.Deltas > 0 {
+			// The same exclusive bound listScript reads past.
+			after := "(" + strconv.FormatFloat(stop.Score(), 'f', -1, 64)
+			backlogs[i] = pipe.ZCount(ctx, r.MakeDeltaZsetKey(catalog), after, "+inf")
+		}
+	}
+	if pipe.Len() > 0 {
+		_, _ = pipe.Exec(ctx) // errors checked per command: MEMORY USAGE may be refused
+	}
+	for i := range out {
+		if cmd := backlogs[i]; cmd != nil {
+			if err := cmd.Err(); err != nil {
+				return nil, err
+			}
+			out[i].Backlog = cmd.Val()
+		}
+		if cmd := sizes[i]; cmd != nil && cmd.Err() == nil {
+			out[i].DeltaBytes = cmd.Val()
+		}
+	}
+	return out, nil
+}
+
+// tsSeqOfZ decodes the tsSeq of a one-member ZRANGE reply; zero if empty
+// or undecodable.
+func tsSeqOfZ(zs []redis.Z) TimeSeqID {
+	if len(zs) == 0 {
+		return TimeSeqID{}
+	}
+	member, _ := zs[0].Member.(string)
+	d, err := DecodeDeltaMember(member, zs[0].Score)
+	if err != nil {
+		return TimeSeqID{}
+	}
+	return d.TsSeq
+}
+
+// CatalogDetails mirrors Reader.CatalogDetails; DeltaBytes is the sum of
+// the members' lengths, a lower bound of what Redis would hold.
+func (m *Memory) CatalogDetails(_ context.Context, catalogs []string) ([]CatalogDetail, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]CatalogDetail, len(catalogs))
+	for i, catalog := range catalogs {
+		d := &out[i]
+		d.Catalog, d.RemoveGen = catalog, "0"
+		c := m.catalog(catalog, false)
+		if c == nil {
+			continue
+		}
+		d.RemoveGen = strconv.FormatInt(c.removeGen, 10)
+		d.Deltas, d.Backlog = int64(len(c.deltas)), int64(len(c.deltas))
+		if n := len(c.deltas); n > 0 {
+			d.Oldest, d.Newest = c.deltas[0].TsSeq, c.deltas[n-1].TsSeq
+		}
+		for _, delta := range c.deltas {
+			d.DeltaBytes += int64(len(delta.Member))
+		}
+		if c.snap != nil {
+			s := *c.snap
+			d.Snap = &s
+			for _, delta := range c.deltas {
+				if delta.Score <= s.Score() {
+					d.Backlog--
+				}
+			}
+		}
+	}
+	return out, nil
+}
@@ -2,32 +2,95 @@ package index
 
 import (
 	"fmt"
+	"math"
+	"math/bits"
 	"strconv"
 	"strings"
 )
 
-// TimeSeqID is a (Unix-second timestamp, intra-second seqid) pair. The
-// pair is encoded as a Redis ZSet score
-// (timestamp + seqid/1e6, 6-decimal precision).
+// TimeSeqID is a (Unix-second timestamp, intra-second seqid) pair, encoded
+// as a Redis ZSet score that is unique per ID (see Score). A TsSeqV2 ID
+// keeps the shape: Timestamp is still its second, and SeqID packs the
+// millisecond within it and the intra-millisecond seqid (see timeSeqIDMs).
 type TimeSeqID struct {
 	Timestamp int64 // Unix seconds
-	SeqID     int64 // 1..999999 within that second; 0 only inside the sentinel "0_0"
+	SeqID     int64 // 1..999999 within that second (TsSeqV2: see timeSeqIDMs); 0 only inside the sentinel "0_0"
+}
+
+// TsSeqVersion is a tsSeq allocation scheme.
+type TsSeqVersion int
+
+const (
+	// TsSeqV1 allocates "{timestamp}_{seqid}": 999,999 IDs per second,
+	// score timestamp + seqid/1e6. The default.
+	TsSeqV1 TsSeqVersion = 1
+	// TsSeqV2 allocates "v2_{ms}_{seqid}": MaxSeqIDMs(ms) IDs per
+	// millisecond — 4,095 until 2039, never fewer than 1,023 — with score
+	// ms + seqid/2^k, k the mantissa bits ms leaves free. A catalog holding
+	// a TsSeqV2 ID keeps allocating TsSeqV2, whatever the writer's setting:
+	// every TsSeqV2 score sorts above every TsSeqV1 one.
+	TsSeqV2 TsSeqVersion = 2
+)
+
+// msSeqFlag marks a TsSeqV2 SeqID: 1<<22 | (ms%1000)<<12 | seqid. It is
+// above every TsSeqV1 seqid, and the millisecond (< 1000 < 1<<10) and the
+// seqid (≤ 4095) each keep their own bits.
+const msSeqFlag = 1 << 22
+
+// timeSeqIDMs builds the TsSeqV2 ID (ms, seq).
+func timeSeqIDMs(ms, seq int64) TimeSeqID {
+	return TimeSeqID{Timestamp: ms / 1000, SeqID: msSeqFlag | ms%1000<<12 | seq}
+}
+
+// Version reports the scheme t was allocated under.
+func (t TimeSeqID) Version() TsSeqVersion {
+	if t.SeqID&msSeqFlag != 0 {
+		return TsSeqV2
+	}
+	return TsSeqV1
+}
+
+// Ms returns the Unix millisecond of a TsSeqV2 ID (0 for TsSeqV1).
+func (t TimeSeqID) Ms() int64 {
+	if t.Version() != TsSeqV2 {
+		return 0
+	}
+	return t.Timestamp*1000 + t.SeqID>>12&(1<<10-1)
+}
+
+// MsSeqID returns the intra-millisecond seqid of a TsSeqV2 ID (SeqID for
+// TsSeqV1).
+func (t TimeSeqID) MsSeqID() int64 {
+	if t.Version() != TsSeqV2 {
+		return t.SeqID
+	}
+	return t.SeqID & (1<<12 - 1)
 }
 
 // Score returns the float used as Redis ZADD score.
-// Example: ts=1700000000, seqid=123 → 1700000000.000123.
+// Example: ts=1700000000, seqid=123 → 1700000000.000123; TsSeqV2
+// ms=1700000000123, seqid=3 → 1700000000123 + 3/4096.
 //
 // This is the single Go mirror of the score the notify Lua computes
-// server-side (writer_atomic.go: ts + seqid/1e6). The zset is ordered by the
-// Lua-computed score and the read path recomputes it here, so the two MUST
-// stay bit-identical — DecodeDeltaMember rejects any mismatch, and
-// TestNotifyMemberConsistency_Redis pins the agreement against a live Redis.
+// server-side (writer_atomic.go: ts + seqid/1e6, or ms + seqid/2^k). The
+// zset is ordered by the Lua-computed score and the read path recomputes it
+// here, so the two MUST stay bit-identical — DecodeDeltaMember rejects any
+// mismatch, and TestNotifyMemberConsistency_Redis pins the agreement
+// against a live Redis. A TsSeqV2 score is exact by construction: ms takes
+// bits.Len64(ms) of the 53 mantissa bits and seqid/2^k the other k.
 func (t TimeSeqID) Score() float64 {
+	if ms := t.Ms(); ms != 0 {
+		return float64(ms) + math.Ldexp(float64(t.MsSeqID()), -msSeqBits(ms))
+	}
 	return float64(t.Timestamp) + float64(t.SeqID)/1000000.0
 }
 
-// String renders as "{timestamp}_{seqid}", the on-disk filename form.
+// String renders as "{timestamp}_{seqid}" ("v2_{ms}_{seqid}" for a TsSeqV2
+// ID), the on-disk filename form.
 func (t TimeSeqID) String() string {
+	if ms := t.Ms(); ms != 0 {
+		return fmt.Sprintf("v2_%d_%d", ms, t.MsSeqID())
+	}
 	return fmt.Sprintf("%d_%d", t.Timestamp, t.SeqID)
 }
 
@@ -41,15 +104,40 @@ func (t TimeSeqID) String() string {
 // notify allocator (writer_atomic.go).
 const MaxTimestamp = 1<<33 - 1 // 8589934591
 
-// ParseTimeSeqID parses "{timestamp}_{seqid}".
+// MaxTimestampMs is the largest TsSeqV2 millisecond, 2^43-1 (~year 2248):
+// up to it ms leaves at least 10 mantissa bits for the seqid. The smallest
+// is MaxTimestamp+1, so TsSeqV2 scores never meet TsSeqV1 ones. Both
+// bounds are mirrored in tsSeqLua.
+const MaxTimestampMs = 1<<43 - 1 // 8796093022207
+
+// msSeqBits is how many mantissa bits a TsSeqV2 score has free for the
+// seqid at ms.
+func msSeqBits(ms int64) int {
+	return 53 - bits.Len64(uint64(ms))
+}
+
+// MaxSeqIDMs is the TsSeqV2 seqid budget of millisecond ms: 2^k-1 with k
+// its free mantissa bits, at most 4,095 (the SeqID packing) — 4,095 for
+// today's clock.
+func MaxSeqIDMs(ms int64) int64 {
+	return 1<<min(msSeqBits(ms), 12) - 1
+}
+
+// ParseTimeSeqID parses "{timestamp}_{seqid}" or, for a TsSeqV2 ID,
+// "v2_{ms}_{seqid}".
 //
 // Rules: timestamp ∈ [0, MaxTimestamp]; seqid ∈ [1, 999999]; no leading
 // zeros (except the literal sentinel "0_0", which represents "no prior
-// snap"); no negatives, no scientific notation.
+// snap"); no negatives, no scientific notation. TsSeqV2: ms ∈
+// (MaxTimestamp, MaxTimestampMs], seqid ∈ [1, MaxSeqIDMs(ms)], no leading
+// zeros either.
 func ParseTimeSeqID(s string) (TimeSeqID, error) {
 	if s == "0_0" {
 		return TimeSeqID{}, nil
 	}
+	if rest, ok := strings.CutPrefix(s, "v2_"); ok {
+		return parseTimeSeqIDMs(s, rest)
+	}
 	tsPart, seqPart, ok := strings.Cut(s, "_")
 	if !ok {
 		return TimeSeqID{}, fmt.Errorf("invalid TimeSeqID %q (want timestamp_seqid)", s)
@@ -71,6 +159,29 @@ func ParseTimeSeqID(s string) (TimeSeqID, error) {
 	return TimeSeqID{Timestamp: ts, SeqID: seq}, nil
 }
 
+// parseTimeSeqIDMs parses the "{ms}_{seqid}" rest of the TsSeqV2 ID s.
+func parseTimeSeqIDMs(s, rest string) (TimeSeqID, error) {
+	msPart, seqPart, ok := strings.Cut(rest, "_")
+	if !ok {
+		return TimeSeqID{}, fmt.Errorf("invalid TimeSeqID %q (want v2_ms_seqid)", s)
+	}
+	ms, err := parseTsSeqPart(msPart, "ms")
+	if err != nil {
+		return TimeSeqID{}, err
+	}
+	if ms <= MaxTimestamp || ms > MaxTimestampMs {
+		return TimeSeqID{}, fmt.Errorf("invalid ms: %d (must be in (%d, %d])", ms, int64(MaxTimestamp), int64(MaxTimestampMs))
+	}
+	seq, err := parseTsSeqPart(seqPart, "seqid")
+	if err != nil {
+		return TimeSeqID{}, err
+	}
+	if seq < 1 || seq > MaxSeqIDMs(ms) {
+		return TimeSeqID{}, fmt.Errorf("invalid seqid: %d (must be 1..%d at ms %d)", seq, MaxSeqIDMs(ms), ms)
+	}
+	return timeSeqIDMs(ms, seq), nil
+}
+
 func parseTsSeqPart(s, label string) (int64, error) {
 	if s == "" || strings.HasPrefix(s, "-") || strings.HasPrefix(s, "0") || strings.ContainsAny(s, "eE") {
 		return 0, fmt.Errorf("invalid %s: %q (no leading zero / negative / scientific)", label, s)
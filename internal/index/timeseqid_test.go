@@ -212,3 +212,72 @@ func TestTimeSeqIDParsing(t *testing.T) {
 		}
 	})
 }
+
+// TestTimeSeqIDV2 pins the TsSeqV2 form: "v2_{ms}_{seqid}" round-trips,
+// its scores are exact and distinct up to the seqid budget, and every one
+// sorts above every TsSeqV1 score.
+func TestTimeSeqIDV2(t *testing.T) {
+	const ms = 1700000000123
+	if got := MaxSeqIDMs(ms); got != 4095 {
+		t.Fatalf("MaxSeqIDMs(%d) = %d, want 4095", int64(ms), got)
+	}
+	if got := MaxSeqIDMs(MaxTimestampMs); got != 1023 {
+		t.Fatalf("MaxSeqIDMs(MaxTimestampMs) = %d, want 1023", got)
+	}
+	if got := MaxSeqIDMs(MaxTimestamp + 1); got != 4095 {
+		t.Fatalf("MaxSeqIDMs(MaxTimestamp+1) = %d, want 4095 (the packing cap)", got)
+	}
+
+	// The struct keeps its two fields: a TsSeqV2 ID packs into SeqID.
+	id := timeSeqIDMs(ms, 7)
+	if id != (TimeSeqID{1700000000, 1<<22 | 123<<12 | 7}) || id.Ms() != ms || id.MsSeqID() != 7 {
+		t.Fatalf("timeSeqIDMs(%d, 7) = %+v", int64(ms), id)
+	}
+	if v1 := (TimeSeqID{1700000000, 999999}); v1.Version() != TsSeqV1 || v1.Ms() != 0 || v1.MsSeqID() != 999999 {
+		t.Fatalf("TsSeqV1 ID reads as %v, ms %d", v1.Version(), v1.Ms())
+	}
+
+	for _, s := range []string{"v2_1700000000123_1", "v2_1700000000123_4095", "v2_8589934592_1", "v2_8796093022207_1023"} {
+		id, err := ParseTimeSeqID(s)
+		if err != nil {
+			t.Fatalf("ParseTimeSeqID(%q): %v", s, err)
+		}
+		if id.Version() != TsSeqV2 || id.String() != s || id.Timestamp != id.Ms()/1000 {
+			t.Fatalf("ParseTimeSeqID(%q) = %+v (%s)", s, id, id)
+		}
+	}
+	for _, s := range []string{
+		"v2_1700000000123_0",    // seqid starts at 1
+		"v2_1700000000123_4096", // past the budget of this ms
+		"v2_8589934592_4096",    // past the SeqID packing
+		"v2_1700000000123_01",   // leading zero
+		"v2_01700000000123_1",   // leading zero
+		"v2_8589934591_1",       // ms must be above MaxTimestamp
+		"v2_8796093022208_1",    // past MaxTimestampMs
+		"v2_1700000000123",      // missing seqid
+		"v2__1",                 // missing ms
+		"v2_1.7e12_1",           // scientific notation
+		"V2_1700000000123_1",    // case matters
+	} {
+		if id, err := ParseTimeSeqID(s); err == nil {
+			t.Errorf("ParseTimeSeqID(%q) = %+v, want an error", s, id)
+		}
+	}
+
+	prev := TimeSeqID{Timestamp: MaxTimestamp, SeqID: 999999}.Score()
+	for _, id := range []TimeSeqID{
+		timeSeqIDMs(MaxTimestamp+1, 1),
+		timeSeqIDMs(ms, 1), timeSeqIDMs(ms, 2), timeSeqIDMs(ms, 4095),
+		timeSeqIDMs(ms+1, 1),
+		timeSeqIDMs(MaxTimestampMs, 1022), timeSeqIDMs(MaxTimestampMs, 1023),
+	} {
+		score := id.Score()
+		if score <= prev {
+			t.Fatalf("%s scores %v, not above the previous %v", id, score, prev)
+		}
+		if int64(score) != id.Ms() || score-float64(id.Ms()) != float64(id.MsSeqID())/float64(int64(1)<<msSeqBits(id.Ms())) {
+			t.Fatalf("%s score %v is not exact", id, score)
+		}
+		prev = score
+	}
+}
@@ -3,6 +3,7 @@ package index
 import (
 	"context"
 	"fmt"
+	"strings"
 )
 
 // notifyScript atomically allocates a TimeSeqID and adds the committed delta
@@ -27,38 +28,45 @@ import (
 //
 // Within one second the seq budget is 999,999; when exhausted (or pinned by
 // a backwards clock) allocation spills into the next second instead of
-// failing — order is preserved and the wall clock catches up.
+// failing — order is preserved and the wall clock catches up. Under
+// TsSeqV2 (ARGV[5] = "2", or a catalog already holding a TsSeqV2 ID) the
+// unit is the millisecond and the budget MaxSeqIDMs(ms).
 //
 // The member is the JSON array [mergeType, fieldPath, tsSeq, uri], assembled
 // here via cjson — this script is the single authoritative encoder. The uri
 // (provider://bucket/path) fully locates the body, so reads need no
 // key-derivation knowledge.
 //
-// KEYS[1] = delta zset, KEYS[2] = snaps hash, KEYS[3] = allocator key;
-// ARGV[1] = fieldPath, ARGV[2] = mergeType, ARGV[3] = uri, ARGV[4] = catalog.
-const notifyScript = `
-local zsetKey, snapsKey, allocKey = KEYS[1], KEYS[2], KEYS[3]
+// A tombstoned catalog (see deleteCatalogScript) refuses the write with a
+// "catalog deleted" error, so a write begun before DeleteCatalog cannot
+// resurrect the catalog. An expired catalog (see expiryLua) is dropped
+// before the write, which starts it afresh; a live expiry policy has its
+// deadline slid past the write.
+//
+// KEYS[1] = delta zset, KEYS[2] = snaps hash, KEYS[3] = allocator key,
+// KEYS[4] = tombstone, KEYS[5] = history, KEYS[6] = pins, KEYS[7] = legacy
+// snaps hash (see snapsLua); ARGV[1] = fieldPath, ARGV[2] = mergeType,
+// ARGV[3] = uri, ARGV[4] = catalog, ARGV[5] = TsSeqVersion. Returns {ts or
+// ms, seq, member, version}.
+const notifyScript = tsSeqLua + snapsLua + expiryLua + `
+local zsetKey, allocKey = KEYS[1], KEYS[3]
 local fieldPath, mergeType, uri, catalog = ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+local snapsKey = snaps_of(KEYS[2], KEYS[7], catalog)
 
--- (ts, seq) floor: the pair the new allocation must sort strictly after.
-local ts = tonumber(redis.call("TIME")[1])
-local seq = 0
-
-local function bump(bts, bseq)
-  if bts and (bts > ts or (bts == ts and bseq > seq)) then
-    ts, seq = bts, bseq
-  end
+if redis.call("EXISTS", KEYS[4]) == 1 then
+  return redis.error_reply("` + deletedReply + `")
 end
+expire_if_due(snapsKey, catalog, {zsetKey, allocKey, KEYS[5], KEYS[6]})
 
--- Mirror of ParseTimeSeqID (timeseqid.go): "ts_seq", no leading zeros,
--- ts within the score-safe cap, seq 1..999999. Returns nil on anything else
--- (including the "0_0" sentinel, which floors nothing).
-local function parse_tsseq(s)
-  local a, b = string.match(s, "^([1-9]%d*)_([1-9]%d?%d?%d?%d?%d?)$")
-  if a and tonumber(a) <= 8589934591 then
-    return tonumber(a), tonumber(b)
+-- The floor: the newest ID the new allocation must sort strictly after.
+local floor, fa, fseq, fv2
+
+local function bump(s)
+  local score = tsseq_score(s)
+  if score and (not floor or score > floor) then
+    floor = score
+    fa, fseq, fv2 = tsseq_parse(s)
   end
-  return nil
 end
 
 -- ALL three floors run on every call — the allocator is never trusted alone.
@@ -70,43 +78,70 @@ end
 -- noise next to the round-trip.)
 local last = redis.call("GET", allocKey)
 if last then
-  bump(parse_tsseq(last))
+  bump(last)
 end
 local snap = redis.call("HGET", snapsKey, catalog)
 if snap then
   local ok, arr = pcall(cjson.decode, snap)
   if ok and type(arr) == "table" and type(arr[1]) == "string" then
-    bump(parse_tsseq(arr[1]))
+    bump(arr[1])
   end
 end
 local top = redis.call("ZREVRANGE", zsetKey, 0, 0)
 if top[1] then
   local ok, arr = pcall(cjson.decode, top[1])
   if ok and type(arr) == "table" and type(arr[3]) == "string" then
-    bump(parse_tsseq(arr[3]))
+    bump(arr[3])
   end
 end
 
-seq = seq + 1
-if seq > 999999 then
-  ts, seq = ts + 1, 1
+-- (ts, seq) of the clock — ts in ms under TsSeqV2, which a catalog holding
+-- a TsSeqV2 ID keeps; every TsSeqV2 score is above any TsSeqV1 floor.
+local v2 = ARGV[5] == "2" or fv2
+local now = redis.call("TIME")
+local ts, seq = tonumber(now[1]), 0
+if v2 then
+  ts = ts * 1000 + math.floor(tonumber(now[2]) / 1000)
 end
-if ts > 8589934591 then
-  -- Past MaxTimestamp the reader rejects the member (and the score cannot
-  -- carry the seqid); minting it would wedge every read of the catalog.
-  -- Reachable only via an absurdly future server clock.
-  return redis.error_reply("timestamp " .. ts .. " beyond score-safe cap (server clock misconfigured?)")
+if floor and fv2 == v2 and (fa > ts or (fa == ts and fseq > seq)) then
+  ts, seq = fa, fseq
+end
+
+seq = seq + 1
+local tsSeq, score
+if v2 then
+  if seq >= ms_seq_unit(ts) or seq > 4095 then
+    ts, seq = ts + 1, 1
+  end
+  if ts > 8796093022207 then
+    return redis.error_reply("ms " .. ts .. " beyond score-safe cap (server clock misconfigured?)")
+  end
+  tsSeq = "v2_" .. string.format("%d", ts) .. "_" .. seq
+  score = ts + seq / ms_seq_unit(ts)
+else
+  if seq > 999999 then
+    ts, seq = ts + 1, 1
+  end
+  if ts > 8589934591 then
+    -- Past MaxTimestamp the reader rejects the member (and the score cannot
+    -- carry the seqid); minting it would wedge every read of the catalog.
+    -- Reachable only via an absurdly future server clock.
+    return redis.error_reply("timestamp " .. ts .. " beyond score-safe cap (server clock misconfigured?)")
+  end
+  tsSeq = ts .. "_" .. seq
+  -- score MUST stay bit-identical to TimeSeqID.Score() in timeseqid.go: the
+  -- read path recomputes it and DecodeDeltaMember rejects a mismatch.
+  score = ts + (seq / 1000000.0)
 end
-local tsSeq = ts .. "_" .. seq
 redis.call("SET", allocKey, tsSeq, "EX", 604800)
 
 local member = cjson.encode({tonumber(mergeType), fieldPath, tsSeq, uri})
--- score MUST stay bit-identical to TimeSeqID.Score() in timeseqid.go: the read
--- path recomputes it and DecodeDeltaMember rejects a mismatch.
-local score = ts + (seq / 1000000.0)
-
 redis.call("ZADD", zsetKey, score, member)
-return {ts, seq, member}
+local _, ttl = expiry_of(snapsKey, catalog)
+if ttl then
+  slide_expiry(snapsKey, catalog, ttl, {zsetKey, allocKey, KEYS[5]})
+end
+return {ts, seq, member, v2 and 2 or 1}
 `
 
 // luaNotify dispatches notifyScript by SHA (EVALSHA with EVAL fallback on a
@@ -122,21 +157,40 @@ func (w *Writer) Notify(ctx context.Context, catalog, fieldPath string, mergeTyp
 		return TimeSeqID{}, "", fmt.Errorf("writer prefix not set; call SetPrefix")
 	}
 	res, err := RunScript(ctx, w.rdb, luaNotify,
-		[]string{w.MakeDeltaZsetKey(catalog), w.MakeSnapsHashKey(), w.MakeSeqAllocKey(catalog)},
-		fieldPath, int(mergeType), uri, catalog,
+		[]string{
+			w.MakeDeltaZsetKey(catalog), w.MakeSnapsHashKey(catalog), w.MakeSeqAllocKey(catalog),
+			w.MakeTombstoneKey(catalog), w.MakeSnapHistoryKey(catalog), w.MakeObjectPinKey(catalog),
+			w.legacySnapsKey(catalog),
+		},
+		fieldPath, int(mergeType), uri, catalog, int(w.tsSeqVersion),
 	).Result()
+	if err != nil && strings.HasPrefix(err.Error(), deletedReply) {
+		return TimeSeqID{}, "", fmt.Errorf("notify %s: %w", catalog, ErrCatalogDeleted)
+	}
 	if err != nil {
 		return TimeSeqID{}, "", fmt.Errorf("notify eval: %w", err)
 	}
 	arr, ok := res.([]any)
-	if !ok || len(arr) != 3 {
+	if !ok || len(arr) != 4 {
 		return TimeSeqID{}, "", fmt.Errorf("unexpected notify result: %v", res)
 	}
 	ts, ok1 := arr[0].(int64)
 	seq, ok2 := arr[1].(int64)
 	member, ok3 := arr[2].(string)
-	if !ok1 || !ok2 || !ok3 {
-		return TimeSeqID{}, "", fmt.Errorf("unexpected notify types: %T,%T,%T", arr[0], arr[1], arr[2])
+	version, ok4 := arr[3].(int64)
+	if !ok1 || !ok2 || !ok3 || !ok4 {
+		return TimeSeqID{}, "", fmt.Errorf("unexpected notify types: %T,%T,%T,%T", arr[0], arr[1], arr[2], arr[3])
+	}
+	if TsSeqVersion(version) == TsSeqV2 {
+		return timeSeqIDMs(ts, seq), member, nil
 	}
 	return TimeSeqID{Timestamp: ts, SeqID: seq}, member, nil
 }
+
+// SetTsSeqVersion selects the ID scheme Notify allocates (default TsSeqV1).
+// A catalog that already holds a TsSeqV2 ID keeps allocating TsSeqV2
+// whatever the setting, so processes sharing a prefix may switch one at a
+// time.
+func (w *Writer) SetTsSeqVersion(v TsSeqVersion) {
+	w.tsSeqVersion = v
+}
@@ -25,13 +25,14 @@ import (
 // cannot fail (plain ZREM never errors) needs no compensation.
 //
 // Returns 1 if removed, 0 if no entry at that tsSeq. KEYS[1] = delta zset,
-// KEYS[2] = snaps hash; ARGV[1] = score, ARGV[2] = tsSeq, ARGV[3] = catalog.
-const removeDeltaScript = `
+// KEYS[2] = snaps hash, KEYS[3] = legacy snaps hash (see snapsLua); ARGV[1]
+// = score, ARGV[2] = tsSeq, ARGV[3] = catalog.
+const removeDeltaScript = snapsLua + `
 local members = redis.call("ZRANGEBYSCORE", KEYS[1], ARGV[1], ARGV[1])
 for _, m in ipairs(members) do
   local ok, arr = pcall(cjson.decode, m)
   if ok and type(arr) == "table" and arr[3] == ARGV[2] then
-    redis.call("HINCRBY", KEYS[2], ARGV[3] .. ":rg", 1)
+    redis.call("HINCRBY", snaps_of(KEYS[2], KEYS[3], ARGV[3]), ARGV[3] .. ":rg", 1)
     redis.call("ZREM", KEYS[1], m)
     return 1
   end
@@ -48,7 +49,7 @@ var luaRemoveDelta = NewScript(removeDeltaScript)
 // Returns whether an entry was removed.
 func (w *Writer) RemoveDelta(ctx context.Context, catalog string, tsSeq TimeSeqID) (bool, error) {
 	res, err := RunScript(ctx, w.rdb, luaRemoveDelta,
-		[]string{w.MakeDeltaZsetKey(catalog), w.MakeSnapsHashKey()},
+		[]string{w.MakeDeltaZsetKey(catalog), w.MakeSnapsHashKey(catalog), w.legacySnapsKey(catalog)},
 		tsSeq.Score(), tsSeq.String(), catalog,
 	).Result()
 	if err != nil {
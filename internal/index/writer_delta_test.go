@@ -62,7 +62,7 @@ func TestRemoveDelta(t *testing.T) {
 	// non-integer ":rg"), the removal must fail with the delta INTACT — the
 	// reverse order would leave it gone under an unmoved generation, and an
 	// in-flight old-generation snapshot could resurrect it.
-	if err := rdb.HSet(ctx, w.MakeSnapsHashKey(), catalog+":rg", "corrupt").Err(); err != nil {
+	if err := rdb.HSet(ctx, w.MakeSnapsHashKey(catalog), catalog+":rg", "corrupt").Err(); err != nil {
 		t.Fatalf("HSet corrupt rg: %v", err)
 	}
 	if _, err := w.RemoveDelta(ctx, catalog, stops[0]); err == nil {
@@ -72,7 +72,7 @@ func TestRemoveDelta(t *testing.T) {
 		t.Fatalf("delta removed despite failed generation bump: %d entries, want 2", card)
 	}
 	// Healing the field lets the removal proceed.
-	if err := rdb.HSet(ctx, w.MakeSnapsHashKey(), catalog+":rg", "1").Err(); err != nil {
+	if err := rdb.HSet(ctx, w.MakeSnapsHashKey(catalog), catalog+":rg", "1").Err(); err != nil {
 		t.Fatalf("heal rg: %v", err)
 	}
 	if removed, err := w.RemoveDelta(ctx, catalog, stops[0]); err != nil || !removed {
@@ -9,12 +9,13 @@ import (
 
 // Writer writes Redis index entries (delta zset, snap hash, seqid).
 type Writer struct {
-	rdb *redis.Client
+	rdb redis.UniversalClient
 	indexIO
+	tsSeqVersion TsSeqVersion // SetTsSeqVersion; 0 = TsSeqV1
 }
 
 // NewWriter returns a Writer; SetPrefix must be called before use.
-func NewWriter(rdb *redis.Client) *Writer {
+func NewWriter(rdb redis.UniversalClient) *Writer {
 	return &Writer{rdb: rdb}
 }
 
@@ -35,22 +36,56 @@ func NewWriter(rdb *redis.Client) *Writer {
 // generation (captured atomically by listScript) no longer matches is
 // dropped. The next read starts from post-removal state and snapshots fine.
 //
-// Returns 1 when the entry was written, 0 when it was dropped/kept.
-const addSnapScript = snapScoreLua + `
-local cur = redis.call("HGET", KEYS[1], ARGV[1])
+// History: a published snapshot is also recorded in the catalog's history
+// zset ("<prefix>:h:<catalog>", score = stop score, member = [tsSeq, uri,
+// publishedAt] with publishedAt the Redis clock) — GC's only way to find the
+// objects of snapshots the pointer has since moved past. The pointer is
+// monotonic, so score order is publication order. The history keeps the
+// newest snapHistoryCap entries; older ones fall off untracked, exactly as
+// every superseded snapshot was before history existed.
+//
+// Tombstone and expiry: a save landing while the catalog is being deleted
+// (see deleteCatalogScript) or after it expired (see expiryLua) is dropped
+// too; under a live expiry policy the history expires with the catalog.
+//
+// KEYS[1] = snaps hash, KEYS[2] = history, KEYS[3] = tombstone, KEYS[4] =
+// legacy snaps hash (see snapsLua); ARGV[1] = catalog, ARGV[2] = snap
+// value, ARGV[3] = stop score, ARGV[4] = removal generation, ARGV[5] =
+// history cap. Returns 1 when the entry was written, 0 when it was
+// dropped/kept.
+const addSnapScript = snapScoreLua + snapsLua + expiryLua + `
+local snaps = snaps_of(KEYS[1], KEYS[4], ARGV[1])
+if redis.call("EXISTS", KEYS[3]) == 1 or is_expired(snaps, ARGV[1]) then
+  return 0
+end
+local cur = redis.call("HGET", snaps, ARGV[1])
 if cur then
   local score = snap_score(cur)
   if score and score >= tonumber(ARGV[3]) then
     return 0
   end
 end
-if (redis.call("HGET", KEYS[1], ARGV[1] .. ":rg") or "0") ~= ARGV[4] then
+if (redis.call("HGET", snaps, ARGV[1] .. ":rg") or "0") ~= ARGV[4] then
   return 0
 end
-redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+redis.call("HSET", snaps, ARGV[1], ARGV[2])
+local snap = cjson.decode(ARGV[2])
+local now = tonumber(redis.call("TIME")[1])
+redis.call("ZADD", KEYS[2], ARGV[3], cjson.encode({snap[1], snap[2], now}))
+redis.call("ZREMRANGEBYRANK", KEYS[2], 0, -(tonumber(ARGV[5]) + 1))
+local deadline = expiry_of(snaps, ARGV[1])
+if deadline then
+  redis.call("PEXPIREAT", KEYS[2], deadline)
+end
 return 1
 `
 
+// snapHistoryCap bounds the per-catalog snapshot history. A hot catalog
+// saves a snapshot on nearly every read after a write, so an uncapped
+// history would grow without bound for deployments that never run GC; 128
+// entries is far more than any sane KeepSnaps while costing a few KB.
+const snapHistoryCap = 128
+
 // luaAddSnap / luaCompactDeltas dispatch their scripts by SHA (EVALSHA with
 // EVAL fallback), so the shared snapScoreLua prelude is not re-sent per call.
 var (
@@ -60,9 +95,10 @@ var (
 
 // AddSnap upserts the catalog's snap entry in "<prefix>:s" as [tsSeq, uri],
 // but only monotonically, and only when removeGen still matches the
-// catalog's removal generation (see addSnapScript). Refusals are silent
-// no-ops; the freshly written snap object is left orphan in storage, like
-// any superseded snap — V3 contract.
+// catalog's removal generation (see addSnapScript), recording it in the
+// catalog's snapshot history. Refusals are silent no-ops; the freshly
+// written snap object is left orphan in storage and is never recorded, so
+// GC cannot reach it either.
 func (w *Writer) AddSnap(ctx context.Context, catalog string, stopTsSeq TimeSeqID, uri, removeGen string) error {
 	val, err := EncodeSnapValue(stopTsSeq, uri)
 	if err != nil {
@@ -72,8 +108,8 @@ func (w *Writer) AddSnap(ctx context.Context, catalog string, stopTsSeq TimeSeqI
 		removeGen = "0"
 	}
 	return RunScript(ctx, w.rdb, luaAddSnap,
-		[]string{w.MakeSnapsHashKey()},
-		catalog, val, stopTsSeq.Score(), removeGen,
+		[]string{w.MakeSnapsHashKey(catalog), w.MakeSnapHistoryKey(catalog), w.MakeTombstoneKey(catalog), w.legacySnapsKey(catalog)},
+		catalog, val, stopTsSeq.Score(), removeGen, snapHistoryCap,
 	).Err()
 }
 
@@ -82,9 +118,10 @@ func (w *Writer) AddSnap(ctx context.Context, catalog string, stopTsSeq TimeSeqI
 // path fetches deltas strictly AFTER the stop (listScript, reader.go), so an
 // absorbed delta can never be read again. Missing or undecodable snap → 0
 // (never trim on a pointer the Go reader would reject). Returns the number
-// of entries removed.
-const compactDeltasScript = snapScoreLua + `
-local cur = redis.call("HGET", KEYS[1], ARGV[1])
+// of entries removed. KEYS[1] = snaps hash, KEYS[2] = delta zset, KEYS[3]
+// = legacy snaps hash (see snapsLua); ARGV[1] = catalog.
+const compactDeltasScript = snapScoreLua + snapsLua + `
+local cur = redis.call("HGET", snaps_of(KEYS[1], KEYS[3], ARGV[1]), ARGV[1])
 if not cur then
   return 0
 end
@@ -92,7 +129,7 @@ local score = snap_score(cur)
 if not score then
   return 0
 end
-return redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", string.format("%.6f", score))
+return redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", string.format("%.17g", score))
 `
 
 // CompactDeltas trims the catalog's delta zset up to (and including) the
@@ -100,7 +137,7 @@ return redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", string.format("%.6f", sco
 // entries are removed — delta objects in storage are untouched.
 func (w *Writer) CompactDeltas(ctx context.Context, catalog string) (int64, error) {
 	res, err := RunScript(ctx, w.rdb, luaCompactDeltas,
-		[]string{w.MakeSnapsHashKey(), w.MakeDeltaZsetKey(catalog)},
+		[]string{w.MakeSnapsHashKey(catalog), w.MakeDeltaZsetKey(catalog), w.legacySnapsKey(catalog)},
 		catalog,
 	).Result()
 	if err != nil {
@@ -16,11 +16,40 @@ func DeltaPath(catalog, uuid string) string {
 	return prefix(catalog) + "/" + uuid + ".dat"
 }
 
+// ContentDeltaPath: "{md5(catalog)[0:4]}/{enc(catalog)}/sha256-{hex}.dat" —
+// the content-addressed form of DeltaPath, so identical bodies written to one
+// catalog share one object. The "sha256-" marker keeps it disjoint from the
+// UUID form (32 hex chars, no "-").
+func ContentDeltaPath(catalog, sha256Hex string) string {
+	return prefix(catalog) + "/sha256-" + sha256Hex + ".dat"
+}
+
+// IsContentDeltaPath reports whether path is in the ContentDeltaPath form.
+func IsContentDeltaPath(path string) bool {
+	name := path[strings.LastIndexByte(path, '/')+1:]
+	return strings.HasPrefix(name, "sha256-") && strings.HasSuffix(name, ".dat")
+}
+
 // SnapPath: "{md5(catalog)[0:4]}/{enc(catalog)}/{stopTsSeq}.snap".
 func SnapPath(catalog, stopTsSeq string) string {
 	return prefix(catalog) + "/" + stopTsSeq + ".snap"
 }
 
+// ManifestPath: "{md5(catalog)[0:4]}/{enc(catalog)}/{name}.wal" — one batch
+// of the catalog's write-ahead manifest (see lake.WithWriteManifest).
+func ManifestPath(catalog, name string) string {
+	return prefix(catalog) + "/" + name + ".wal"
+}
+
+// CatalogFolder: "{md5(catalog)[0:4]}/{enc(catalog)}/" — the folder every
+// DeltaPath, ContentDeltaPath, SnapPath and ManifestPath of catalog lives
+// in directly. It may also hold other catalogs' nested folders (an md5[0:4]
+// collision with a "/"-extended name), so a listing must keep only direct
+// children.
+func CatalogFolder(catalog string) string {
+	return prefix(catalog) + "/"
+}
+
 // prefix shards by md5[0:4] (65,536 hot-spot-free buckets-within-a-bucket)
 // then keeps a human-readable per-catalog folder for lifecycle / billing.
 func prefix(catalog string) string {
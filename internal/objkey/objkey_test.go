@@ -20,6 +20,12 @@ func TestDeltaAndSnapPathShape(t *testing.T) {
 	if got, want := SnapPath("users", "1700000000_42"), "9bc6/(users/1700000000_42.snap"; got != want {
 		t.Fatalf("SnapPath = %q, want %q", got, want)
 	}
+	if got, want := ManifestPath("users", "wal-1"), "9bc6/(users/wal-1.wal"; got != want {
+		t.Fatalf("ManifestPath = %q, want %q", got, want)
+	}
+	if got, want := CatalogFolder("users"), "9bc6/(users/"; got != want || !strings.HasPrefix(DeltaPath("users", uuid), got) {
+		t.Fatalf("CatalogFolder = %q, want %q (and a prefix of DeltaPath)", got, want)
+	}
 }
 
 func TestCatalogEncodingForms(t *testing.T) {
@@ -75,3 +81,17 @@ func TestParseURIRejectsMalformed(t *testing.T) {
 		}
 	}
 }
+
+func TestContentDeltaPathShape(t *testing.T) {
+	const sum = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+	got := ContentDeltaPath("users", sum)
+	if want := "9bc6/(users/sha256-" + sum + ".dat"; got != want {
+		t.Fatalf("ContentDeltaPath = %q, want %q", got, want)
+	}
+	if !IsContentDeltaPath(got) {
+		t.Fatal("IsContentDeltaPath rejects its own form")
+	}
+	if IsContentDeltaPath(DeltaPath("users", "0123456789abcdef0123456789abcdef")) {
+		t.Fatal("IsContentDeltaPath accepts the UUID form")
+	}
+}
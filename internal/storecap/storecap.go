@@ -0,0 +1,164 @@
+// Package storecap lets a storage decorator expose exactly the optional
+// capabilities (Presigner, Stater, Lister, Deleter) of the Storage it wraps.
+// Lake detects capabilities by type assertion, so a decorator must neither
+// hide one the backend has (WriteBegin would report presign unsupported) nor
+// fabricate one it lacks (GC would call a Delete that cannot work). With four
+// independent capabilities that is sixteen concrete types; they live here
+// once instead of in every decorator.
+package storecap
+
+import "github.com/hkloudou/lake/v3/storage"
+
+// Set holds the capability implementations a wrapped Storage should expose;
+// a nil field means "not supported".
+type Set struct {
+	Presigner storage.Presigner
+	Stater    storage.Stater
+	Lister    storage.Lister
+	Deleter   storage.Deleter
+}
+
+// Of returns the capabilities s implements.
+func Of(s storage.Storage) Set {
+	var c Set
+	c.Presigner, _ = s.(storage.Presigner)
+	c.Stater, _ = s.(storage.Stater)
+	c.Lister, _ = s.(storage.Lister)
+	c.Deleter, _ = s.(storage.Deleter)
+	return c
+}
+
+// Each combination embeds the decorator's Storage (Get/Put only — embedding
+// an interface promotes just its own methods) plus the supported subset.
+type (
+	p struct {
+		storage.Storage
+		storage.Presigner
+	}
+	s struct {
+		storage.Storage
+		storage.Stater
+	}
+	l struct {
+		storage.Storage
+		storage.Lister
+	}
+	d struct {
+		storage.Storage
+		storage.Deleter
+	}
+	ps struct {
+		storage.Storage
+		storage.Presigner
+		storage.Stater
+	}
+	pl struct {
+		storage.Storage
+		storage.Presigner
+		storage.Lister
+	}
+	pd struct {
+		storage.Storage
+		storage.Presigner
+		storage.Deleter
+	}
+	sl struct {
+		storage.Storage
+		storage.Stater
+		storage.Lister
+	}
+	sd struct {
+		storage.Storage
+		storage.Stater
+		storage.Deleter
+	}
+	ld struct {
+		storage.Storage
+		storage.Lister
+		storage.Deleter
+	}
+	psl struct {
+		storage.Storage
+		storage.Presigner
+		storage.Stater
+		storage.Lister
+	}
+	psd struct {
+		storage.Storage
+		storage.Presigner
+		storage.Stater
+		storage.Deleter
+	}
+	pld struct {
+		storage.Storage
+		storage.Presigner
+		storage.Lister
+		storage.Deleter
+	}
+	sld struct {
+		storage.Storage
+		storage.Stater
+		storage.Lister
+		storage.Deleter
+	}
+	psld struct {
+		storage.Storage
+		storage.Presigner
+		storage.Stater
+		storage.Lister
+		storage.Deleter
+	}
+	none struct{ storage.Storage }
+)
+
+// Wrap returns a Storage whose Get/Put are base's and which implements
+// exactly the non-nil capabilities of c — none of base's own beyond those.
+func Wrap(base storage.Storage, c Set) storage.Storage {
+	var mask int
+	if c.Presigner != nil {
+		mask |= 1
+	}
+	if c.Stater != nil {
+		mask |= 2
+	}
+	if c.Lister != nil {
+		mask |= 4
+	}
+	if c.Deleter != nil {
+		mask |= 8
+	}
+	switch mask {
+	case 1:
+		return p{base, c.Presigner}
+	case 2:
+		return s{base, c.Stater}
+	case 3:
+		return ps{base, c.Presigner, c.Stater}
+	case 4:
+		return l{base, c.Lister}
+	case 5:
+		return pl{base, c.Presigner, c.Lister}
+	case 6:
+		return sl{base, c.Stater, c.Lister}
+	case 7:
+		return psl{base, c.Presigner, c.Stater, c.Lister}
+	case 8:
+		return d{base, c.Deleter}
+	case 9:
+		return pd{base, c.Presigner, c.Deleter}
+	case 10:
+		return sd{base, c.Stater, c.Deleter}
+	case 11:
+		return psd{base, c.Presigner, c.Stater, c.Deleter}
+	case 12:
+		return ld{base, c.Lister, c.Deleter}
+	case 13:
+		return pld{base, c.Presigner, c.Lister, c.Deleter}
+	case 14:
+		return sld{base, c.Stater, c.Lister, c.Deleter}
+	case 15:
+		return psld{base, c.Presigner, c.Stater, c.Lister, c.Deleter}
+	default:
+		return none{base}
+	}
+}
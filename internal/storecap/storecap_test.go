@@ -0,0 +1,49 @@
+package storecap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+type full struct{}
+
+func (full) Get(context.Context, string, string) ([]byte, error) { return nil, nil }
+func (full) Put(context.Context, string, string, []byte) error   { return nil }
+func (full) Delete(context.Context, string, string) error        { return nil }
+func (full) Stat(context.Context, string, string) (storage.ObjectInfo, error) {
+	return storage.ObjectInfo{}, nil
+}
+func (full) List(context.Context, string, string, string) ([]storage.ObjectInfo, string, error) {
+	return nil, "", nil
+}
+func (full) PresignPut(context.Context, string, string, storage.PresignOptions) (storage.PresignedUpload, error) {
+	return storage.PresignedUpload{}, nil
+}
+
+// TestWrapExposesExactlyTheSet walks all sixteen combinations: the wrapper
+// implements a capability iff the Set has it.
+func TestWrapExposesExactlyTheSet(t *testing.T) {
+	all := Of(full{})
+	for mask := 0; mask < 16; mask++ {
+		var c Set
+		if mask&1 != 0 {
+			c.Presigner = all.Presigner
+		}
+		if mask&2 != 0 {
+			c.Stater = all.Stater
+		}
+		if mask&4 != 0 {
+			c.Lister = all.Lister
+		}
+		if mask&8 != 0 {
+			c.Deleter = all.Deleter
+		}
+		got := Of(Wrap(full{}, c))
+		if (got.Presigner != nil) != (c.Presigner != nil) || (got.Stater != nil) != (c.Stater != nil) ||
+			(got.Lister != nil) != (c.Lister != nil) || (got.Deleter != nil) != (c.Deleter != nil) {
+			t.Fatalf("mask %04b: wrapper exposes %+v", mask, got)
+		}
+	}
+}
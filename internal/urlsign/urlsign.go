@@ -0,0 +1,185 @@
+// Package urlsign gives the local backends (storage/file, storage/mem) the
+// presigned-upload flow object stores have: PresignPut mints an HMAC-signed
+// PUT URL under a configurable base URL, and Handler serves those URLs,
+// verifying signature, expiry and signed headers before writing the body
+// through the backend's own Put. Production clients need no special case —
+// they PUT to whatever URL and headers WriteBegin handed them.
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// Query parameters of a signed URL.
+const (
+	paramCatalog = "X-Lake-Catalog"
+	paramExpires = "X-Lake-Expires"
+	paramHeaders = "X-Lake-SignedHeaders"
+	paramSig     = "X-Lake-Signature"
+)
+
+// metaPrefix carries PresignOptions.UserMetadata. Local backends store no
+// metadata; the headers are signed and required anyway, so a client that
+// would forget them against OSS / S3 fails here too.
+const metaPrefix = "x-lake-meta-"
+
+// sha256Header carries PresignOptions.ContentSHA256; Handler rejects a body
+// that does not hash to it.
+const sha256Header = "x-lake-content-sha256"
+
+// DefaultMaxBody caps an upload Handler accepts when the backend sets no
+// cap of its own: the body is held in memory to be hashed and Put.
+const DefaultMaxBody = 64 << 20
+
+// Signer mints and verifies signed upload URLs for one base URL.
+type Signer struct {
+	base   *url.URL
+	secret []byte
+	now    func() time.Time
+}
+
+// New validates baseURL (absolute http/https, no query) and secret.
+func New(baseURL string, secret []byte) (*Signer, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("presign secret must not be empty")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("presign base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+		return nil, fmt.Errorf("presign base URL %q must be http(s)://host[/path]", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+	return &Signer{base: u, secret: append([]byte(nil), secret...), now: time.Now}, nil
+}
+
+// PresignPut signs a PUT of bucket/path. Content-Type (if set), metadata and
+// the content hash (if set) become signed headers the uploader must send
+// verbatim.
+func (s *Signer) PresignPut(catalog, bucket, path string, opts storage.PresignOptions) storage.PresignedUpload {
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	headers := map[string]string{}
+	signed := map[string]string{} // lower-case name -> value
+	if opts.ContentType != "" {
+		headers["Content-Type"] = opts.ContentType
+		signed["content-type"] = opts.ContentType
+	}
+	for k, v := range opts.UserMetadata {
+		headers[metaPrefix+strings.ToLower(k)] = v
+		signed[metaPrefix+strings.ToLower(k)] = v
+	}
+	if opts.ContentSHA256 != "" {
+		headers[sha256Header] = opts.ContentSHA256
+		signed[sha256Header] = opts.ContentSHA256
+	}
+	names := make([]string, 0, len(signed))
+	for k := range signed {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	// Round up: a sub-second TTL must not sign an already-expired URL.
+	exp := s.now().Add(ttl + time.Second - 1).Unix()
+
+	u := *s.base
+	u.Path += "/" + bucket + "/" + path
+	q := url.Values{}
+	q.Set(paramCatalog, catalog)
+	q.Set(paramExpires, strconv.FormatInt(exp, 10))
+	q.Set(paramHeaders, strings.Join(names, ";"))
+	q.Set(paramSig, s.sign(bucket, path, catalog, exp, names, func(n string) string { return signed[n] }))
+	u.RawQuery = q.Encode()
+	return storage.PresignedUpload{URL: u.String(), Method: http.MethodPut, Headers: headers}
+}
+
+// sign MACs everything a signed URL pins.
+func (s *Signer) sign(bucket, path, catalog string, exp int64, names []string, header func(string) string) string {
+	m := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(m, "PUT\n%s\n%s\n%s\n%d\n", bucket, path, catalog, exp)
+	for _, n := range names {
+		fmt.Fprintf(m, "%s:%s\n", n, header(n))
+	}
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// Handler serves signed uploads: mount it at the base URL's path. bucket
+// maps a bucket name to the backend Storage the body is written to; a body
+// over maxBody bytes (≤ 0: DefaultMaxBody) is refused with 413 before it is
+// buffered.
+func (s *Signer) Handler(bucket func(name string) storage.Storage, maxBody int64) http.Handler {
+	if maxBody <= 0 {
+		maxBody = DefaultMaxBody
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			w.Header().Set("Allow", http.MethodPut)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rest, ok := strings.CutPrefix(r.URL.Path, s.base.Path+"/")
+		name, path, ok2 := strings.Cut(rest, "/")
+		if !ok || !ok2 || name == "" || path == "" {
+			http.Error(w, "not a signed upload path", http.StatusNotFound)
+			return
+		}
+		q := r.URL.Query()
+		exp, err := strconv.ParseInt(q.Get(paramExpires), 10, 64)
+		if err != nil {
+			http.Error(w, "missing expiry", http.StatusForbidden)
+			return
+		}
+		var names []string
+		if h := q.Get(paramHeaders); h != "" {
+			names = strings.Split(h, ";")
+		}
+		catalog := q.Get(paramCatalog)
+		want := s.sign(name, path, catalog, exp, names, r.Header.Get)
+		if !hmac.Equal([]byte(want), []byte(q.Get(paramSig))) {
+			http.Error(w, "signature mismatch", http.StatusForbidden)
+			return
+		}
+		if s.now().Unix() > exp {
+			http.Error(w, "signed URL expired", http.StatusForbidden)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+		if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("body exceeds %d bytes", maxBody), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, "read body: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if slices.Contains(names, sha256Header) {
+			sum := sha256.Sum256(body)
+			if hex.EncodeToString(sum[:]) != r.Header.Get(sha256Header) {
+				http.Error(w, "body does not match its signed SHA-256", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := bucket(name).Put(r.Context(), catalog, path, body); err != nil {
+			http.Error(w, "store: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
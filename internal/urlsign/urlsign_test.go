@@ -0,0 +1,118 @@
+package urlsign
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// mapStore records Puts; urlsign cannot import the backends that use it.
+type mapStore map[string]string
+
+func (m mapStore) Get(context.Context, string, string) ([]byte, error) {
+	return nil, storage.ErrNotFound
+}
+func (m mapStore) Put(_ context.Context, catalog, path string, data []byte) error {
+	m[catalog+":"+path] = string(data)
+	return nil
+}
+
+func TestNew_ValidatesConfig(t *testing.T) {
+	for _, base := range []string{"", "localhost:8080", "ftp://host/x", "http://host/x?y=1"} {
+		if _, err := New(base, []byte("k")); err == nil {
+			t.Errorf("New(%q) should fail", base)
+		}
+	}
+	if _, err := New("http://host/up", nil); err == nil {
+		t.Error("empty secret should fail")
+	}
+}
+
+// TestHandler_Verifies: the handler writes only what the signature covers,
+// before expiry, on the signed path, under this secret.
+func TestHandler_Verifies(t *testing.T) {
+	store := mapStore{}
+	s, err := New("http://placeholder/up/", []byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler(func(string) storage.Storage { return store }, 0))
+	defer srv.Close()
+	// Re-point the signer at the test server, keeping the path.
+	s.base.Host = strings.TrimPrefix(srv.URL, "http://")
+
+	put := func(url string, hdr map[string]string) int {
+		req, _ := http.NewRequest(http.MethodPut, url, strings.NewReader("x"))
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	up := s.PresignPut("users", "data", "a/1.dat", storage.PresignOptions{TTL: time.Minute, ContentType: "text/plain"})
+	cases := []struct {
+		name string
+		url  string
+		hdr  map[string]string
+		want int
+	}{
+		{"other path", strings.Replace(up.URL, "a/1.dat", "a/2.dat", 1), up.Headers, http.StatusForbidden},
+		{"other catalog", strings.Replace(up.URL, "X-Lake-Catalog=users", "X-Lake-Catalog=admin", 1), up.Headers, http.StatusForbidden},
+		{"content-type", up.URL, map[string]string{"Content-Type": "text/html"}, http.StatusForbidden},
+		{"ok", up.URL, up.Headers, http.StatusOK},
+	}
+	for _, c := range cases {
+		if got := put(c.url, c.hdr); got != c.want {
+			t.Errorf("%s: status %d, want %d", c.name, got, c.want)
+		}
+	}
+	if len(store) != 1 || store["users:a/1.dat"] != "x" {
+		t.Errorf("stored = %v, want only the accepted upload", store)
+	}
+
+	s.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	old := s.PresignPut("users", "data", "a/3.dat", storage.PresignOptions{TTL: time.Minute})
+	s.now = time.Now
+	if got := put(old.URL, old.Headers); got != http.StatusForbidden {
+		t.Errorf("expired: status %d, want 403", got)
+	}
+}
+
+// TestHandler_MaxBody: a body past the cap is refused with 413 and never
+// stored; one at the cap goes through.
+func TestHandler_MaxBody(t *testing.T) {
+	store := mapStore{}
+	s, err := New("http://placeholder/up", []byte("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(s.Handler(func(string) storage.Storage { return store }, 4))
+	defer srv.Close()
+	s.base.Host = strings.TrimPrefix(srv.URL, "http://")
+
+	for body, want := range map[string]int{"abcd": http.StatusOK, "abcde": http.StatusRequestEntityTooLarge} {
+		up := s.PresignPut("users", "data", "a/"+body+".dat", storage.PresignOptions{TTL: time.Minute})
+		req, _ := http.NewRequest(http.MethodPut, up.URL, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("%d-byte body: status %d, want %d", len(body), resp.StatusCode, want)
+		}
+	}
+	if len(store) != 1 || store["users:a/abcd.dat"] != "abcd" {
+		t.Errorf("stored = %v, want only the body within the cap", store)
+	}
+}
@@ -1,6 +1,8 @@
 package lake
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"sync"
@@ -27,14 +29,17 @@ import (
 // fire-and-forget. Read-path caching, if any, lives in the Storage the
 // Resolver returns (see storage/cached).
 type Client struct {
-	rdb       *redis.Client // authoritative: snap hash, delta zset, seqid
-	sampleRdb *redis.Client // sample (memo) hash; defaults to rdb
-	writer    *index.Writer
-	reader    *index.Reader
+	rdb       redis.UniversalClient // authoritative: snap hash, delta zset, seqid; nil under NewWithIndex
+	sampleRdb redis.UniversalClient // sample (memo) hash; defaults to rdb; nil = no sample cache
+	idx       index.Index           // every list / notify / snap operation goes through it
+	keys      *index.Keys           // sample-cache keys
+	writer    *index.Writer         // the Redis index behind idx, for the Redis-only
+	reader    *index.Reader         // operations (GC, Migrate, …); nil under NewWithIndex
 
 	resolve      storage.Resolver
 	snapProvider string // WithSnapTarget; "" disables auto-snapshotting
 	snapBucket   string
+	manifest     *manifestLog // WithWriteManifest; nil disables the manifest
 
 	storMu     sync.RWMutex // guards stores
 	stores     map[string]storage.Storage
@@ -52,11 +57,17 @@ type Client struct {
 }
 
 type option struct {
-	sampleRdb     *redis.Client
+	sampleRdb     redis.UniversalClient
 	ownsSampleRdb bool
 	snapProvider  string
 	snapBucket    string
 	handleSecret  []byte
+	layout        index.Layout
+	snapShards    int
+	tsSeqVersion  index.TsSeqVersion
+
+	manifestProvider string
+	manifestBucket   string
 }
 
 // New creates a Lake client.
@@ -67,12 +78,12 @@ type option struct {
 //     a bucket-scoped storage.Storage. Lake memoises the result per pair.
 //
 // Panics on a nil/empty required argument (programmer error, per package policy).
-func New(prefix string, rdb *redis.Client, resolve storage.Resolver, opts ...func(*option)) *Client {
+func New(prefix string, rdb redis.UniversalClient, resolve storage.Resolver, opts ...func(*option)) *Client {
 	if prefix == "" {
 		panic("lake: New requires a non-empty prefix")
 	}
 	if rdb == nil {
-		panic("lake: New requires an index *redis.Client")
+		panic("lake: New requires an index redis.UniversalClient")
 	}
 	if resolve == nil {
 		panic("lake: New requires a storage.Resolver")
@@ -84,12 +95,59 @@ func New(prefix string, rdb *redis.Client, resolve storage.Resolver, opts ...fun
 	if o.sampleRdb == nil {
 		o.sampleRdb = rdb
 	}
+	reader, writer := index.NewReader(rdb), index.NewWriter(rdb)
+	writer.SetPrefix(prefix)
+	reader.SetPrefix(prefix)
+	writer.SetLayout(o.layout)
+	reader.SetLayout(o.layout)
+	writer.SetSnapShards(o.snapShards)
+	reader.SetSnapShards(o.snapShards)
+	writer.SetTsSeqVersion(o.tsSeqVersion)
+	c := newClient(prefix, index.NewRedis(reader, writer), resolve, o)
+	c.rdb, c.reader, c.writer = rdb, reader, writer
+	return c
+}
+
+// NewWithIndex creates a Lake client over any Index — for example
+// NewMemoryIndex() in unit tests or a single-process deployment that has no
+// Redis. prefix still namespaces the sample-cache keys. Without
+// WithSampleCacheRedis / WithSampleCacheURL there is no sample cache:
+// every Sample runs its loader (concurrent identical calls still share one
+// run). The Redis-only maintenance operations — GC, Migrate, Scrub and
+// FindOrphans — return ErrIndexNotSupported.
+//
+// Panics on an empty prefix, a nil idx or a nil resolve, or on
+// WithTsSeqVersion over an idx without SetTsSeqVersion (programmer error).
+func NewWithIndex(prefix string, idx Index, resolve storage.Resolver, opts ...func(*option)) *Client {
+	if prefix == "" {
+		panic("lake: NewWithIndex requires a non-empty prefix")
+	}
+	if idx == nil {
+		panic("lake: NewWithIndex requires an Index")
+	}
+	if resolve == nil {
+		panic("lake: NewWithIndex requires a storage.Resolver")
+	}
+	o := &option{}
+	for _, fn := range opts {
+		fn(o)
+	}
+	if o.tsSeqVersion != 0 {
+		v, ok := idx.(interface{ SetTsSeqVersion(index.TsSeqVersion) })
+		if !ok {
+			panic(fmt.Errorf("lake: WithTsSeqVersion: %T cannot select a TsSeqVersion", idx))
+		}
+		v.SetTsSeqVersion(o.tsSeqVersion)
+	}
+	return newClient(prefix, idx, resolve, o)
+}
+
+func newClient(prefix string, idx index.Index, resolve storage.Resolver, o *option) *Client {
 	c := &Client{
-		rdb:           rdb,
 		sampleRdb:     o.sampleRdb,
 		ownsSampleRdb: o.ownsSampleRdb,
-		writer:        index.NewWriter(rdb),
-		reader:        index.NewReader(rdb),
+		idx:           idx,
+		keys:          index.NewKeys(prefix, o.layout),
 		resolve:       resolve,
 		snapProvider:  o.snapProvider,
 		snapBucket:    o.snapBucket,
@@ -98,13 +156,35 @@ func New(prefix string, rdb *redis.Client, resolve storage.Resolver, opts ...fun
 		storFlight:    xsync.NewSingleFlight[storage.Storage](),
 		sampleFlight:  xsync.NewSingleFlight[string](),
 	}
-	c.writer.SetPrefix(prefix)
-	c.reader.SetPrefix(prefix)
+	if o.manifestProvider != "" {
+		c.manifest = newManifestLog(c, o.manifestProvider, o.manifestBucket)
+	}
 	return c
 }
 
+// ErrIndexNotSupported is returned by the operations that need the Redis
+// index (see NewWithIndex) on a Client built over another Index.
+var ErrIndexNotSupported = errors.New("lake: operation requires the Redis index")
+
+// requireRedisIndex fails op with ErrIndexNotSupported unless the Client
+// runs on the Redis index.
+func (c *Client) requireRedisIndex(op string) error {
+	if c.reader == nil {
+		return fmt.Errorf("%s: %w", op, ErrIndexNotSupported)
+	}
+	return nil
+}
+
+// ensureClock performs the index's first clock sync if it has one to
+// perform (see index.Reader.EnsureClock).
+func (c *Client) ensureClock(ctx context.Context) {
+	if e, ok := c.idx.(interface{ EnsureClock(context.Context) }); ok {
+		e.EnsureClock(ctx)
+	}
+}
+
 // Close releases the Client's background resources: it stops the Redis-clock
-// ticker and closes the sample-cache Redis client iff Lake itself created it
+// ticker, flushes the write manifest (WithWriteManifest), and closes the sample-cache Redis client iff Lake itself created it
 // (WithSampleCacheURL). The rdb and any client passed via WithSampleCacheRedis
 // belong to the caller and are left open. A closed Client keeps serving
 // (the clock falls back to its last synced value, then the local clock), but
@@ -112,7 +192,12 @@ func New(prefix string, rdb *redis.Client, resolve storage.Resolver, opts ...fun
 func (c *Client) Close() error {
 	var err error
 	c.closeOnce.Do(func() {
-		c.reader.Close()
+		if c.reader != nil {
+			c.reader.Close()
+		}
+		if c.manifest != nil {
+			c.manifest.close()
+		}
 		if c.ownsSampleRdb && c.sampleRdb != nil {
 			err = c.sampleRdb.Close()
 		}
@@ -146,10 +231,56 @@ func WithSnapTarget(provider, bucket string) func(*option) {
 	return func(o *option) { o.snapProvider, o.snapBucket = provider, bucket }
 }
 
+// WithKeyLayout selects the Redis key layout (default KeyLayoutGlobal).
+// KeyLayoutCluster hash-tags every per-catalog key with "{<catalog>}" and
+// keeps each catalog's snap pointer in its own record instead of the
+// deployment-wide "<prefix>:s" hash, so every Lua script's keys share one
+// slot — required for a *redis.ClusterClient. Every process sharing the
+// prefix must use the same layout; move an existing deployment across with
+// MigrateKeyLayout. Panics on an unknown layout (programmer error at
+// construction time).
+func WithKeyLayout(l KeyLayout) func(*option) {
+	if l != KeyLayoutGlobal && l != KeyLayoutCluster {
+		panic(fmt.Errorf("lake: WithKeyLayout: unknown layout %v", l))
+	}
+	return func(o *option) { o.layout = l }
+}
+
+// WithSnapShards splits KeyLayoutGlobal's deployment-wide snap hash
+// "<prefix>:s" into n hashes "<prefix>:s:<shard>", a catalog's shard chosen
+// by a hash of its name, so no single key grows with the catalog count
+// (KeyLayoutCluster already keeps one record per catalog and ignores it).
+// Every process sharing the prefix must use the same n. Catalogs still in
+// "<prefix>:s" keep working — reads and scripts look there first — until
+// MigrateSnapShards moves them, online. Panics on a negative n (programmer
+// error at construction time).
+func WithSnapShards(n int) func(*option) {
+	if n < 0 {
+		panic(fmt.Errorf("lake: WithSnapShards: negative shard count %d", n))
+	}
+	return func(o *option) { o.snapShards = n }
+}
+
+// WithTsSeqVersion selects the tsSeq scheme new writes are stamped with.
+// TsSeqV1 (the default) allocates "{timestamp}_{seqid}", 999,999 per
+// second per catalog; TsSeqV2 allocates "v2_{ms}_{seqid}", up to 4,095 per
+// millisecond. Old IDs stay valid under either, and a TsSeqV2 ID always
+// sorts after every TsSeqV1 one, so a deployment can switch one process at
+// a time — a catalog that has received a TsSeqV2 ID keeps getting them even
+// from TsSeqV1 writers. Every reader must understand TsSeqV2 before the
+// first writer switches. Panics on an unknown version (programmer error at
+// construction time).
+func WithTsSeqVersion(v TsSeqVersion) func(*option) {
+	if v != TsSeqV1 && v != TsSeqV2 {
+		panic(fmt.Errorf("lake: WithTsSeqVersion: unknown version %d", v))
+	}
+	return func(o *option) { o.tsSeqVersion = v }
+}
+
 // WithSampleCacheRedis routes the Sampler memo hash ("<prefix>:m:*") to a
 // separate Redis instance. Defaults to the authoritative rdb. The client
 // stays owned by the caller — Close never touches it.
-func WithSampleCacheRedis(rdb *redis.Client) func(*option) {
+func WithSampleCacheRedis(rdb redis.UniversalClient) func(*option) {
 	return func(o *option) {
 		o.closeOwnedSampleRdb() // a Lake-created client this overrides must not leak
 		o.sampleRdb = rdb
@@ -106,7 +106,7 @@ func (c *Client) List(ctx context.Context, catalog string) *ListResult {
 		return &ListResult{client: c, catalog: catalog, Err: err}
 	}
 
-	snap, rr := c.reader.ListCatalog(ctx, catalog)
+	snap, rr := c.idx.List(ctx, catalog)
 	if len(rr.Deltas) >= backlogWarnThreshold && c.hasHandlers() {
 		c.emitEvent(catalog, "ListLargeBacklog", map[string]any{"entries": len(rr.Deltas)})
 	}
@@ -136,7 +136,7 @@ func (c *Client) BatchList(ctx context.Context, catalogs []string) map[string]*L
 		valid = append(valid, cat)
 	}
 
-	results := c.reader.BatchList(ctx, valid)
+	results := c.idx.BatchList(ctx, valid)
 	for _, cat := range valid {
 		br := results[cat]
 		lr := &ListResult{client: c, catalog: cat}
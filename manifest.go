@@ -0,0 +1,433 @@
+package lake
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+// Write-ahead manifest format: each batch object (objkey.ManifestPath) is
+// newline-delimited JSON — a header naming the catalog, then one record per
+// index change:
+//
+//	{"format":"lake-manifest","version":1,"catalog":"users"}
+//	{"op":"add","tsSeq":"1700000000_1","member":"[1,\"/a\",\"1700000000_1\",\"oss://b/…\"]","at":1700000000123}
+//	{"op":"remove","tsSeq":"1700000000_1","at":…}
+//	{"op":"snap","tsSeq":"1700000000_1","uri":"oss://b/….snap","at":…}
+//	{"op":"drop","tsSeq":"1700000000_1","at":…}
+//
+// An add carries the delta member exactly as the index stored it, so a
+// rebuild restores it byte for byte; Migrate appends a fresh add (and snap)
+// for every entry it repoints. A drop (DeleteCatalog) voids every record at
+// or before its tsSeq — the newest the deleted catalog named. Records are
+// unordered across objects; each one is self-describing, and "at" (unix
+// milliseconds, absent from older records) orders the adds of one tsSeq
+// and the snaps of one stop.
+const (
+	manifestFormat  = "lake-manifest"
+	manifestVersion = 1
+
+	manifestFlushInterval = time.Second
+	manifestBatch         = 256              // pending records that trigger an early flush
+	manifestCloseTimeout  = 10 * time.Second // Close's final flush
+)
+
+type manifestHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Catalog string `json:"catalog"`
+}
+
+type manifestRecord struct {
+	Op     string `json:"op"`               // "add", "remove", "snap" or "drop"
+	TsSeq  string `json:"tsSeq"`            // the delta; for a snap, its stop
+	Member string `json:"member,omitempty"` // add
+	URI    string `json:"uri,omitempty"`    // snap
+	At     int64  `json:"at,omitempty"`     // appended, unix ms
+}
+
+// manifestLog batches records per catalog and writes each batch as one
+// object. A background loop flushes every manifestFlushInterval, or sooner
+// once manifestBatch records are pending; a failed batch is kept and
+// retried on the next flush.
+type manifestLog struct {
+	c                *Client
+	provider, bucket string
+
+	mu      sync.Mutex
+	pending map[string][]manifestRecord
+	n       int
+
+	flushMu sync.Mutex // one flush at a time, so a retried batch keeps its order
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newManifestLog(c *Client, provider, bucket string) *manifestLog {
+	m := &manifestLog{
+		c: c, provider: provider, bucket: bucket,
+		pending: make(map[string][]manifestRecord),
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go m.loop()
+	return m
+}
+
+func (m *manifestLog) loop() {
+	defer close(m.stopped)
+	t := time.NewTicker(manifestFlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-m.kick:
+		case <-m.done:
+			ctx, cancel := context.WithTimeout(context.Background(), manifestCloseTimeout)
+			_ = m.flush(ctx)
+			cancel()
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), manifestCloseTimeout)
+		_ = m.flush(ctx)
+		cancel()
+	}
+}
+
+// append stamps rec and queues it for catalog.
+func (m *manifestLog) append(catalog string, rec manifestRecord) {
+	rec.At = time.Now().UnixMilli()
+	m.mu.Lock()
+	m.pending[catalog] = append(m.pending[catalog], rec)
+	m.n++
+	full := m.n >= manifestBatch
+	m.mu.Unlock()
+	if full {
+		select {
+		case m.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush writes every pending batch, one object per catalog. Batches that
+// fail are re-queued ahead of anything appended meanwhile; their errors
+// are emitted as ManifestError events and returned joined.
+func (m *manifestLog) flush(ctx context.Context) error {
+	m.flushMu.Lock()
+	defer m.flushMu.Unlock()
+	m.mu.Lock()
+	batches := m.pending
+	m.pending, m.n = make(map[string][]manifestRecord), 0
+	m.mu.Unlock()
+
+	var errs []error
+	for _, catalog := range slices.Sorted(maps.Keys(batches)) {
+		recs := batches[catalog]
+		if err := m.put(ctx, catalog, recs); err != nil {
+			err = fmt.Errorf("manifest %s: %w", catalog, err)
+			m.c.emitEvent(catalog, "ManifestError", map[string]any{"records": len(recs), "err": err.Error()})
+			errs = append(errs, err)
+			m.mu.Lock()
+			m.pending[catalog] = append(recs, m.pending[catalog]...)
+			m.n += len(recs)
+			m.mu.Unlock()
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *manifestLog) put(ctx context.Context, catalog string, recs []manifestRecord) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	if err := enc.Encode(manifestHeader{Format: manifestFormat, Version: manifestVersion, Catalog: catalog}); err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	id, err := newUUID()
+	if err != nil {
+		return err
+	}
+	st, err := m.c.storageFor(storage.Delta, m.provider, m.bucket)
+	if err != nil {
+		return err
+	}
+	return st.Put(ctx, catalog, objkey.ManifestPath(catalog, "wal-"+id), buf.Bytes())
+}
+
+// close stops the loop after one last flush. Idempotent via Client.Close.
+func (m *manifestLog) close() {
+	close(m.done)
+	<-m.stopped
+}
+
+// WithWriteManifest turns on the write-ahead manifest: every WriteNotify,
+// RemoveDelta and published snapshot appends a small commit record to
+// object storage at provider/bucket, in the catalog's folder next to its
+// deltas. Records are batched in the background — one object per catalog
+// per second, sooner under load — so the write path gains no storage
+// round-trip; a RemoveDelta record is written before RemoveDelta returns.
+// Client.RebuildIndex replays the manifest to reconstruct a catalog's
+// index if the Redis index is lost. A Close flushes what is pending.
+//
+// The manifest is a recovery aid, not a second source of truth: a record
+// still pending when the process dies is lost, and Lake never deletes
+// manifest objects (they are small; leave them to a lifecycle rule that
+// keeps them at least as long as the deltas they name). The location is
+// resolved as storage.Delta. Panics on an invalid provider/bucket, and on
+// one-empty-one-set, as WithSnapTarget does; both empty disables it.
+func WithWriteManifest(provider, bucket string) func(*option) {
+	if provider == "" && bucket == "" {
+		return func(*option) {}
+	}
+	if err := utils.ValidateStorageProvider(provider); err != nil {
+		panic(fmt.Errorf("lake: WithWriteManifest: %w", err))
+	}
+	if err := utils.ValidateStorageBucket(bucket); err != nil {
+		panic(fmt.Errorf("lake: WithWriteManifest: %w", err))
+	}
+	return func(o *option) { o.manifestProvider, o.manifestBucket = provider, bucket }
+}
+
+// FlushManifest writes every pending manifest record now — for a graceful
+// shutdown that must not wait for Close, or a test. No-op without
+// WithWriteManifest.
+func (c *Client) FlushManifest(ctx context.Context) error {
+	if c.manifest == nil {
+		return nil
+	}
+	return c.manifest.flush(ctx)
+}
+
+// RebuildReport is what one RebuildIndex run restored.
+type RebuildReport struct {
+	Manifests int       // manifest objects read
+	Deltas    int       // delta entries restored
+	Removed   int       // deltas left out because RemoveDelta removed them
+	Snap      *SnapInfo // restored snap pointer; nil if none was recorded
+	RemoveGen string    // restored removal generation
+}
+
+// ErrNoManifest is returned by RebuildIndex on a Client built without
+// WithWriteManifest.
+var ErrNoManifest = errors.New("lake: no write manifest configured (WithWriteManifest)")
+
+// RebuildIndex reconstructs a catalog's index from its write-ahead manifest
+// (WithWriteManifest) after the index Redis was lost: every delta notified
+// and not removed, with its original member and score, the removal
+// generation, the allocator floor and the snap pointer — the newest
+// snapshot the manifest saw published. A delta Migrate repointed comes back
+// with its newest URI, once. The result is then merged exactly as
+// ImportIndex merges a file, so nothing moves backwards: on an empty index
+// the catalog comes back as it was; run against a live one, it only adds
+// what is missing (it never re-removes a delta, nor re-adds a removed one).
+// While a DeleteCatalog tombstone is in place it fails with
+// ErrCatalogDeleted, unless the manifest leaves nothing to restore.
+//
+// Every member is checked with DecodeDeltaMember; a manifest object that
+// fails to parse stops the run. The manifest location must be listable
+// (storage.Lister). Records lost with a crashed process (see
+// WithWriteManifest) are lost to the rebuild too — run FindOrphans
+// afterwards to see uploads no restored entry references.
+func (c *Client) RebuildIndex(ctx context.Context, catalog string) (*RebuildReport, error) {
+	c.emitEvent(catalog, "RebuildIndex", nil)
+	if err := c.requireRedisIndex("rebuild index"); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateCatalog(catalog); err != nil {
+		return nil, err
+	}
+	if c.manifest == nil {
+		return nil, ErrNoManifest
+	}
+	loc := Location{Provider: c.manifest.provider, Bucket: c.manifest.bucket}
+	st, err := c.storageFor(storage.Delta, loc.Provider, loc.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := st.(storage.Lister)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", loc.uriPrefix(), storage.ErrListNotSupported)
+	}
+
+	rep := &RebuildReport{}
+	adds := map[string]manifestRecord{} // tsSeq → its newest add
+	removed := map[string]struct{}{}
+	snaps := map[string]manifestRecord{} // stop → its newest snap
+	var dropped index.TimeSeqID          // newest DeleteCatalog floor: everything at or before it is gone
+	folder := objkey.CatalogFolder(catalog)
+	for cursor := ""; ; {
+		page, next, err := lister.List(ctx, catalog, folder, cursor)
+		if err != nil {
+			return nil, fmt.Errorf("list %s%s: %w", loc.uriPrefix(), folder, err)
+		}
+		for _, obj := range page {
+			name := strings.TrimPrefix(obj.Path, folder)
+			if strings.Contains(name, "/") || !strings.HasSuffix(name, ".wal") {
+				continue // another catalog's nested folder, a delta or a snapshot
+			}
+			body, err := st.Get(ctx, catalog, obj.Path)
+			if err != nil {
+				return nil, fmt.Errorf("read %s%s: %w", loc.uriPrefix(), obj.Path, err)
+			}
+			err = replayManifest(body, catalog, func(rec manifestRecord) error {
+				switch rec.Op {
+				case "add":
+					id, err := index.ParseTimeSeqID(rec.TsSeq)
+					if err != nil {
+						return err
+					}
+					if _, err := index.DecodeDeltaMember(rec.Member, id.Score()); err != nil {
+						return err
+					}
+					if prev, ok := adds[rec.TsSeq]; !ok || newerRecord(rec, prev) {
+						adds[rec.TsSeq] = rec
+					}
+				case "remove":
+					removed[rec.TsSeq] = struct{}{}
+				case "snap":
+					if _, err := index.ParseTimeSeqID(rec.TsSeq); err != nil {
+						return err
+					}
+					if prev, ok := snaps[rec.TsSeq]; !ok || newerRecord(rec, prev) {
+						snaps[rec.TsSeq] = rec
+					}
+				case "drop":
+					id, err := index.ParseTimeSeqID(rec.TsSeq)
+					if err != nil {
+						return err
+					}
+					dropped = maxTsSeq(dropped, id)
+				default:
+					return fmt.Errorf("unknown op %q", rec.Op)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("manifest %s%s: %w", loc.uriPrefix(), obj.Path, err)
+			}
+			rep.Manifests++
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	live := func(tsSeq string) bool {
+		id, err := index.ParseTimeSeqID(tsSeq)
+		return err == nil && id.Score() > dropped.Score()
+	}
+	gen := 0
+	for tsSeq := range removed {
+		if live(tsSeq) {
+			gen++
+		}
+	}
+	d := &index.CatalogDump{RemoveGen: strconv.Itoa(gen)}
+	floor := dropped
+	for tsSeq, add := range adds {
+		if !live(tsSeq) {
+			continue
+		}
+		id, _ := index.ParseTimeSeqID(tsSeq) // validated above
+		floor = maxTsSeq(floor, id)
+		if _, gone := removed[tsSeq]; gone {
+			rep.Removed++
+			continue
+		}
+		d.Deltas = append(d.Deltas, redis.Z{Score: id.Score(), Member: add.Member})
+	}
+	var snap *SnapInfo
+	for tsSeq, rec := range snaps {
+		id, _ := index.ParseTimeSeqID(tsSeq) // validated above
+		if id.Score() > dropped.Score() && (snap == nil || id.Score() > snap.Score()) {
+			snap = &SnapInfo{StopTsSeq: id, URI: rec.URI}
+		}
+	}
+	if snap != nil {
+		if d.Snap, err = index.EncodeSnapValue(snap.StopTsSeq, snap.URI); err != nil {
+			return nil, err
+		}
+		floor = maxTsSeq(floor, snap.StopTsSeq)
+	}
+	if floor != (index.TimeSeqID{}) {
+		d.Alloc = floor.String()
+	}
+	rep.Deltas, rep.Snap, rep.RemoveGen = len(d.Deltas), snap, d.RemoveGen
+	if len(d.Deltas) == 0 && snap == nil && gen == 0 {
+		return rep, nil // nothing left to restore (e.g. a deleted catalog)
+	}
+	if err := c.writer.ImportCatalog(ctx, catalog, d); err != nil {
+		return nil, fmt.Errorf("rebuild %s: %w", catalog, err)
+	}
+	return rep, nil
+}
+
+// replayManifest checks one manifest object's header and feeds fn its
+// records.
+func replayManifest(body []byte, catalog string, fn func(manifestRecord) error) error {
+	sc := bufio.NewScanner(bytes.NewReader(body))
+	sc.Buffer(nil, 1<<20)
+	if !sc.Scan() {
+		return errors.New("empty manifest")
+	}
+	var hdr manifestHeader
+	if err := json.Unmarshal(sc.Bytes(), &hdr); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	if hdr.Format != manifestFormat || hdr.Version != manifestVersion {
+		return fmt.Errorf("unsupported manifest %q version %d", hdr.Format, hdr.Version)
+	}
+	if hdr.Catalog != catalog {
+		return fmt.Errorf("manifest of catalog %q", hdr.Catalog)
+	}
+	for line := 2; sc.Scan(); line++ {
+		var rec manifestRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(rec); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+	return sc.Err()
+}
+
+// newerRecord reports whether a supersedes b, two records for the same
+// tsSeq: the later append wins, ties broken on the member or URI so every
+// rebuild picks the same one.
+func newerRecord(a, b manifestRecord) bool {
+	if a.At != b.At {
+		return a.At > b.At
+	}
+	return a.Member+a.URI > b.Member+b.URI
+}
+
+func maxTsSeq(a, b index.TimeSeqID) index.TimeSeqID {
+	if b.Score() > a.Score() {
+		return b
+	}
+	return a
+}
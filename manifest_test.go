@@ -0,0 +1,157 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestRebuildIndex_Redis loses the whole index and rebuilds it from the
+// manifest: same members and scores, same snap pointer and removal
+// generation, same read — and new writes keep sorting after the old ones.
+func TestRebuildIndex_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		if bucket == "wal" {
+			return store.Bucket(bucket), nil // listable
+		}
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	ctx := context.Background()
+	write := func(c *Client, path, body string) {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+
+	c := New(prefix, rdb, resolve, WithSnapTarget("mem", "snaps"), WithWriteManifest("mem", "wal"))
+	defer c.Close()
+	write(c, "/a", `1`)
+	write(c, "/b", `2`)
+	list := c.List(ctx, "users")
+	stop := list.NextSnap().StopTsSeq
+	if _, err := ReadString(ctx, list); err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	if !waitFor(func() bool { snap, _ := c.idx.LatestSnap(ctx, "users"); return snap != nil && snap.StopTsSeq == stop }) {
+		t.Fatal("snapshot was not indexed within timeout")
+	}
+	write(c, "/c", `3`)
+	write(c, "/d", `4`)
+	tail := c.List(ctx, "users").Entries
+	if ok, err := c.RemoveDelta(ctx, "users", tail[1].TsSeq.String()); err != nil || !ok {
+		t.Fatalf("RemoveDelta = %v (err=%v)", ok, err)
+	}
+	list = c.List(ctx, "users")
+	want, err := ReadString(ctx, list)
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	// That read saves a snapshot in the background; let it land and be
+	// recorded before taking the reference state.
+	last := list.NextSnap().StopTsSeq
+	recorded := func() bool {
+		if err := c.FlushManifest(ctx); err != nil {
+			t.Fatalf("FlushManifest: %v", err)
+		}
+		objs, _, _ := store.Bucket("wal").(storage.Lister).List(ctx, "users", objkey.CatalogFolder("users"), "")
+		for _, o := range objs {
+			body, _ := store.Bucket("wal").Get(ctx, "users", o.Path)
+			if strings.Contains(string(body), `"op":"snap","tsSeq":"`+last.String()+`"`) {
+				return true
+			}
+		}
+		return false
+	}
+	if !waitFor(recorded) {
+		t.Fatal("snapshot was not recorded within timeout")
+	}
+	before, _ := c.reader.ExportCatalog(ctx, "users")
+
+	keys, _ := rdb.Keys(ctx, prefix+":*").Result()
+	if err := rdb.Del(ctx, keys...).Err(); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	rep, err := c.RebuildIndex(ctx, "users")
+	if err != nil {
+		t.Fatalf("RebuildIndex: %v", err)
+	}
+	if rep.Deltas != 3 || rep.Removed != 1 || rep.RemoveGen != "1" || rep.Snap == nil || rep.Snap.StopTsSeq != last {
+		t.Fatalf("report = %+v", rep)
+	}
+	after, _ := c.reader.ExportCatalog(ctx, "users")
+	if after.Snap != before.Snap || after.RemoveGen != before.RemoveGen || len(after.Deltas) != len(before.Deltas) {
+		t.Fatalf("rebuilt index = %+v, want %+v", after, before)
+	}
+	for i := range before.Deltas {
+		if after.Deltas[i] != before.Deltas[i] {
+			t.Fatalf("delta %d = %v, want %v", i, after.Deltas[i], before.Deltas[i])
+		}
+	}
+	if got, err := ReadString(ctx, c.List(ctx, "users")); err != nil || got != want {
+		t.Fatalf("read after rebuild = %q (err=%v), want %q", got, err, want)
+	}
+	write(c, "/e", `5`)
+	if got := c.List(ctx, "users").Entries; got[len(got)-1].TsSeq.Score() <= tail[1].TsSeq.Score() {
+		t.Fatalf("new tsSeq %v not after the removed %v", got[len(got)-1].TsSeq, tail[1].TsSeq)
+	}
+
+	plain := New(prefix, rdb, resolve)
+	if _, err := plain.RebuildIndex(ctx, "users"); !errors.Is(err, ErrNoManifest) {
+		t.Fatalf("RebuildIndex without manifest err = %v, want ErrNoManifest", err)
+	}
+}
+
+// TestWriteManifest_CloseFlushes checks records are batched, not written
+// per notify, and that Close writes what is pending.
+func TestWriteManifest_CloseFlushes(t *testing.T) {
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	c := NewWithIndex("edge", NewMemoryIndex(), resolve, WithWriteManifest("mem", "wal"))
+	ctx := context.Background()
+	for _, path := range []string{"/a", "/b", "/c"} {
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lister := store.Bucket("wal").(storage.Lister)
+	objs, _, err := lister.List(ctx, "users", objkey.CatalogFolder("users"), "")
+	if err != nil || len(objs) != 1 {
+		t.Fatalf("manifest objects = %v (err=%v), want one batch", objs, err)
+	}
+	body, _ := store.Bucket("wal").Get(ctx, "users", objs[0].Path)
+	if n := strings.Count(string(body), `"op":"add"`); n != 3 {
+		t.Fatalf("manifest has %d add records, want 3:\n%s", n, body)
+	}
+}
@@ -0,0 +1,316 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/redis/go-redis/v9"
+)
+
+// Location names a storage backend as the Resolver sees it.
+type Location struct {
+	Provider string
+	Bucket   string
+}
+
+func (l Location) validate() error {
+	if err := utils.ValidateStorageProvider(l.Provider); err != nil {
+		return err
+	}
+	return utils.ValidateStorageBucket(l.Bucket)
+}
+
+// uriPrefix is the "provider://bucket/" every URI stored in l starts with.
+func (l Location) uriPrefix() string { return objkey.BuildURI(l.Provider, l.Bucket, "") }
+
+// MigrateOptions tunes Client.Migrate.
+type MigrateOptions struct {
+	// From and To are the source and destination backends. Only index
+	// entries whose URI lives in From are touched.
+	From, To Location
+	// Copy copies each object from From to To (same path) before its index
+	// entries are repointed. Without it the objects must already be at To
+	// (replicated out of band); Migrate verifies that and stops otherwise.
+	Copy bool
+	// DryRun reports what would move without copying or rewriting anything.
+	DryRun bool
+}
+
+// MigrateReport is what one Migrate run moved (or, with DryRun, would move).
+type MigrateReport struct {
+	Deltas  int64 // delta index entries repointed
+	Snaps   int64 // snap pointer + history entries repointed
+	Objects int   // objects copied (Copy only; already-present ones excluded)
+	Bytes   int64 // combined size of those objects
+}
+
+// migrateBatch bounds one rewrite script call (and the objects copied
+// ahead of it).
+const migrateBatch = 256
+
+// Migrate moves a catalog's objects from one storage location to another:
+// every delta entry, the snap pointer and the snapshot history whose URI
+// lives in opts.From are repointed to the same path in opts.To. With Copy
+// each object is first copied over; either way an entry is repointed only
+// once its object is known to exist at To, so a read never sees a URI it
+// cannot fetch.
+//
+// The rewrite runs in batches through one Lua script each, which replaces
+// only the URI — scores and tsSeqs are preserved, so read order, Compact and
+// GC bounds are unaffected. Migrate is resumable: a copy is skipped when the
+// destination already has the object (storage.Stater), entries already
+// repointed no longer match From, and a failed run leaves every rewritten
+// entry pointing at a copied object. Simply run it again.
+//
+// With WithWriteManifest, every repointed delta and snap pointer is also
+// recorded in the manifest, superseding the records that name From, so
+// RebuildIndex restores the new URIs.
+//
+// Source objects are left in place — in-flight reads may still fetch them;
+// delete them (or the bucket) once your slowest read has passed. Writes
+// keep landing wherever clients upload and snapshots wherever
+// WithSnapTarget points, so switch both to To first, then run Migrate (twice
+// if writes raced the first run) to pick up the stragglers.
+func (c *Client) Migrate(ctx context.Context, catalog string, opts MigrateOptions) (*MigrateReport, error) {
+	c.emitEvent(catalog, "Migrate", map[string]any{
+		"from": opts.From.uriPrefix(), "to": opts.To.uriPrefix(), "copy": opts.Copy, "dryRun": opts.DryRun,
+	})
+	if err := c.requireRedisIndex("migrate"); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateCatalog(catalog); err != nil {
+		return nil, err
+	}
+	if err := opts.From.validate(); err != nil {
+		return nil, fmt.Errorf("migrate from: %w", err)
+	}
+	if err := opts.To.validate(); err != nil {
+		return nil, fmt.Errorf("migrate to: %w", err)
+	}
+	if opts.From == opts.To {
+		return nil, errors.New("lake: migrate: From and To are the same location")
+	}
+	from, to := opts.From.uriPrefix(), opts.To.uriPrefix()
+
+	deltas, err := c.reader.AllDeltas(ctx, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("read deltas: %w", err)
+	}
+	cur, err := c.idx.LatestSnap(ctx, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("read snap: %w", err)
+	}
+	history, err := c.reader.SnapHistory(ctx, catalog)
+	if err != nil {
+		return nil, fmt.Errorf("read snap history: %w", err)
+	}
+
+	m := &migration{c: c, catalog: catalog, opts: opts, from: from, to: to,
+		rep: &MigrateReport{}, moved: map[string]struct{}{}, tsSeqs: map[string]index.TimeSeqID{}}
+	var batch index.URIRewrite
+	flush := func() error {
+		if len(batch.DeltaMembers)+len(batch.HistoryMembers) == 0 && batch.Snap == nil {
+			return nil
+		}
+		err := m.commit(ctx, batch)
+		batch = index.URIRewrite{}
+		return err
+	}
+	for _, d := range deltas {
+		if !strings.HasPrefix(d.URI, from) {
+			continue
+		}
+		if err := m.object(ctx, storage.Delta, d.URI); err != nil {
+			return m.rep, fmt.Errorf("migrate delta %s: %w", d.TsSeq, err)
+		}
+		batch.DeltaMembers = append(batch.DeltaMembers, d.Member)
+		m.tsSeqs[d.Member] = d.TsSeq
+		if len(batch.DeltaMembers) >= migrateBatch {
+			if err := flush(); err != nil {
+				return m.rep, err
+			}
+		}
+	}
+	for _, rec := range history {
+		if !strings.HasPrefix(rec.URI, from) {
+			continue
+		}
+		if err := m.object(ctx, storage.Snap, rec.URI); err != nil {
+			return m.rep, fmt.Errorf("migrate snapshot %s: %w", rec.StopTsSeq, err)
+		}
+		batch.HistoryMembers = append(batch.HistoryMembers, rec.Member)
+		if len(batch.HistoryMembers) >= migrateBatch {
+			if err := flush(); err != nil {
+				return m.rep, err
+			}
+		}
+	}
+	if cur != nil && strings.HasPrefix(cur.URI, from) {
+		if err := m.object(ctx, storage.Snap, cur.URI); err != nil {
+			return m.rep, fmt.Errorf("migrate snapshot %s: %w", cur.StopTsSeq, err)
+		}
+		batch.Snap, batch.SnapURI = cur, to+cur.URI[len(from):]
+	}
+	return m.rep, flush()
+}
+
+// migration is the state of one Migrate run.
+type migration struct {
+	c        *Client
+	catalog  string
+	opts     MigrateOptions
+	from, to string
+	rep      *MigrateReport
+	moved    map[string]struct{}        // source URIs already copied / verified
+	tsSeqs   map[string]index.TimeSeqID // delta member → its tsSeq
+}
+
+// object makes sure the object at uri (under From) exists at To: copying it
+// with Copy, verifying it otherwise. DryRun only sizes what Copy would move.
+func (m *migration) object(ctx context.Context, kind storage.Kind, uri string) error {
+	if _, ok := m.moved[uri]; ok {
+		return nil
+	}
+	_, _, path, err := objkey.ParseURI(uri)
+	if err != nil {
+		return err
+	}
+	dst, err := m.c.storageFor(kind, m.opts.To.Provider, m.opts.To.Bucket)
+	if err != nil {
+		return err
+	}
+	if !m.opts.Copy {
+		if _, err := objectSize(ctx, dst, m.catalog, path); err != nil {
+			return fmt.Errorf("verify %s%s (migrate without Copy needs the object at the destination): %w", m.to, path, err)
+		}
+		m.moved[uri] = struct{}{}
+		return nil
+	}
+	present, err := objectPresent(ctx, dst, m.catalog, path)
+	if err != nil {
+		return fmt.Errorf("probe %s%s: %w", m.to, path, err)
+	}
+	if !present {
+		src, err := m.c.storageFor(kind, m.opts.From.Provider, m.opts.From.Bucket)
+		if err != nil {
+			return err
+		}
+		data, err := src.Get(ctx, m.catalog, path)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", uri, err)
+		}
+		if !m.opts.DryRun {
+			if err := dst.Put(ctx, m.catalog, path, data); err != nil {
+				return fmt.Errorf("copy %s: %w", uri, err)
+			}
+		}
+		m.rep.Objects++
+		m.rep.Bytes += int64(len(data))
+	}
+	m.moved[uri] = struct{}{}
+	return nil
+}
+
+// commit repoints one batch (DryRun: counts it).
+func (m *migration) commit(ctx context.Context, batch index.URIRewrite) error {
+	if m.opts.DryRun {
+		m.rep.Deltas += int64(len(batch.DeltaMembers))
+		m.rep.Snaps += int64(len(batch.HistoryMembers))
+		if batch.Snap != nil {
+			m.rep.Snaps++
+		}
+		return nil
+	}
+	batch.From, batch.To = m.from, m.to
+	res, err := m.c.writer.RewriteURIs(ctx, m.catalog, batch)
+	if err != nil {
+		return err
+	}
+	m.rep.Deltas += int64(len(res.Deltas))
+	m.rep.Snaps += res.History
+	if res.Pointer {
+		m.rep.Snaps++
+	}
+	if m.c.manifest != nil {
+		// Supersede the records naming the source, so a rebuild restores
+		// the repointed entries (see RebuildIndex).
+		for _, d := range res.Deltas {
+			m.c.manifest.append(m.catalog, manifestRecord{Op: "add", TsSeq: m.tsSeqs[d.Old].String(), Member: d.New})
+		}
+		if res.Pointer {
+			m.c.manifest.append(m.catalog, manifestRecord{Op: "snap", TsSeq: batch.Snap.StopTsSeq.String(), URI: batch.SnapURI})
+		}
+	}
+	return nil
+}
+
+// objectPresent reports whether path exists in st — a Stat when the backend
+// has one, otherwise "no": the caller then copies again, and Put is
+// idempotent.
+func objectPresent(ctx context.Context, st storage.Storage, catalog, path string) (bool, error) {
+	s, ok := st.(storage.Stater)
+	if !ok {
+		return false, nil
+	}
+	_, err := s.Stat(ctx, catalog, path)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	return true, nil
+}
+
+// LayoutReport is what one MigrateKeyLayout run copied.
+type LayoutReport = index.LayoutReport
+
+// MigrateKeyLayout copies the prefix's index from key layout from on src to
+// layout to on dst — typically KeyLayoutGlobal on the existing single-node
+// Redis to KeyLayoutCluster on a Redis Cluster (or on the same Redis, ahead
+// of a move). Delta indexes, tsSeq allocators, snapshot histories, pins,
+// snap pointers and removal generations are copied with their TTLs; the
+// sample cache is not (it refills on reads).
+//
+// The copy is offline: stop every writer of the prefix first, run it, then
+// restart the processes with WithKeyLayout(to) against dst. Destination
+// keys are overwritten, so a failed run can simply be repeated. Source keys
+// are left for the operator to delete once the new layout is serving.
+func MigrateKeyLayout(ctx context.Context, prefix string, src, dst redis.UniversalClient, from, to KeyLayout) (*LayoutReport, error) {
+	if prefix == "" {
+		return nil, errors.New("migrate key layout: empty prefix")
+	}
+	if src == nil || dst == nil {
+		return nil, errors.New("migrate key layout: nil redis client")
+	}
+	for _, l := range []KeyLayout{from, to} {
+		if l != KeyLayoutGlobal && l != KeyLayoutCluster {
+			return nil, fmt.Errorf("migrate key layout: unknown layout %v", l)
+		}
+	}
+	rep, err := index.CopyLayout(ctx, prefix, src, dst, from, to)
+	if err != nil {
+		return rep, fmt.Errorf("migrate key layout %s -> %s: %w", from, to, err)
+	}
+	return rep, nil
+}
+
+// MigrateSnapShards moves every catalog's snap fields out of "<prefix>:s"
+// into its shard (WithSnapShards), one catalog per atomic step, and returns
+// the number of catalogs moved. It runs online: readers and writers keep
+// finding a catalog in whichever hash holds it, so roll WithSnapShards out
+// to every process first, then run it. Re-running is safe; once it returns
+// nil "<prefix>:s" is gone. Redis index with KeyLayoutGlobal and shards
+// configured only.
+func (c *Client) MigrateSnapShards(ctx context.Context) (int, error) {
+	if err := c.requireRedisIndex("migrate snap shards"); err != nil {
+		return 0, err
+	}
+	return c.writer.MigrateSnapShards(ctx)
+}
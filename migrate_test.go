@@ -0,0 +1,453 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/storecap"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+func TestMigrate_ValidatesBeforeRedis(t *testing.T) {
+	c := newDeadClient(t)
+	ctx := context.Background()
+	ok := MigrateOptions{From: Location{"mem", "a"}, To: Location{"mem", "b"}}
+	if _, err := c.Migrate(ctx, "bad|name", ok); err == nil || !strings.Contains(err.Error(), "invalid catalog") {
+		t.Fatalf("expected invalid catalog error, got %v", err)
+	}
+	if _, err := c.Migrate(ctx, "users", MigrateOptions{From: Location{"mem", "a/b"}, To: ok.To}); err == nil {
+		t.Fatal("expected invalid From bucket error")
+	}
+	if _, err := c.Migrate(ctx, "users", MigrateOptions{From: ok.From, To: ok.From}); err == nil {
+		t.Fatal("expected same-location error")
+	}
+}
+
+// TestMigrateRoundTrip_Redis: Migrate copies every delta and snapshot
+// object to the new bucket and repoints the index with scores and tsSeqs
+// intact; the read result survives the old bucket going away, DryRun
+// changes nothing, and a second run is a no-op.
+func TestMigrateRoundTrip_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	var oldGone atomic.Bool
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		b := store.Bucket(bucket)
+		if bucket == "old" && oldGone.Load() {
+			b = goneBucket{}
+		}
+		return storecap.Wrap(b, storecap.Set{Presigner: presignBucket{b}, Stater: b.(storage.Stater)}), nil
+	}
+	c := New(prefix, rdb, resolve, WithSnapTarget("mem", "old"))
+	ctx := context.Background()
+
+	write := func(path, body string) {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "old",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+	var doc string
+	var stop TimeSeqID
+	readAndSnap := func() {
+		t.Helper()
+		list := c.List(ctx, "users")
+		var err error
+		if doc, err = ReadString(ctx, list); err != nil {
+			t.Fatalf("ReadString: %v", err)
+		}
+		stop = list.NextSnap().StopTsSeq
+		if !waitFor(func() bool {
+			snap, _ := c.reader.GetLatestSnap(ctx, "users")
+			return snap != nil && snap.StopTsSeq == stop
+		}) {
+			t.Fatal("snapshot was not indexed within timeout")
+		}
+	}
+	write("/a", `1`)
+	write("/b", `2`)
+	readAndSnap()
+	write("/c", `3`)
+	readAndSnap()
+	before, err := c.reader.AllDeltas(ctx, "users")
+	if err != nil || len(before) != 3 {
+		t.Fatalf("AllDeltas = %d entries (err=%v), want 3", len(before), err)
+	}
+
+	opts := MigrateOptions{From: Location{"mem", "old"}, To: Location{"mem", "new"}, Copy: true, DryRun: true}
+	rep, err := c.Migrate(ctx, "users", opts)
+	if err != nil {
+		t.Fatalf("Migrate dry run: %v", err)
+	}
+	if rep.Deltas != 3 || rep.Snaps != 3 || rep.Objects != 5 || rep.Bytes == 0 {
+		t.Fatalf("dry run report = %+v, want 3 deltas, pointer + 2 history, 5 objects", rep)
+	}
+	if after, _ := c.reader.AllDeltas(ctx, "users"); after[0].URI != before[0].URI {
+		t.Fatal("dry run rewrote the index")
+	}
+
+	opts.DryRun = false
+	rep, err = c.Migrate(ctx, "users", opts)
+	if err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if rep.Deltas != 3 || rep.Snaps != 3 || rep.Objects != 5 {
+		t.Fatalf("report = %+v, want 3 deltas, pointer + 2 history, 5 objects", rep)
+	}
+	after, err := c.reader.AllDeltas(ctx, "users")
+	if err != nil || len(after) != len(before) {
+		t.Fatalf("AllDeltas after = %d entries (err=%v), want %d", len(after), err, len(before))
+	}
+	for i := range before {
+		b, a := before[i], after[i]
+		if a.TsSeq != b.TsSeq || a.Score != b.Score || a.Path != b.Path || a.MergeType != b.MergeType {
+			t.Fatalf("delta %d changed beyond its URI: %+v -> %+v", i, b, a)
+		}
+		if a.URI != strings.Replace(b.URI, "mem://old/", "mem://new/", 1) {
+			t.Fatalf("delta %d URI = %q, want it moved from %q", i, a.URI, b.URI)
+		}
+	}
+	snap, err := c.reader.GetLatestSnap(ctx, "users")
+	if err != nil || snap == nil || snap.StopTsSeq != stop || !strings.HasPrefix(snap.URI, "mem://new/") {
+		t.Fatalf("snap pointer = %+v (err=%v), want stop %s in mem://new/", snap, err, stop)
+	}
+	history, _ := c.reader.SnapHistory(ctx, "users")
+	for _, rec := range history {
+		if !strings.HasPrefix(rec.URI, "mem://new/") {
+			t.Fatalf("history entry %s still at %s", rec.StopTsSeq, rec.URI)
+		}
+	}
+
+	oldGone.Store(true)
+	c2 := New(prefix, rdb, resolve)
+	if got, err := ReadString(ctx, c2.List(ctx, "users")); err != nil || got != doc {
+		t.Fatalf("read after migrate = %q (err=%v), want %q", got, err, doc)
+	}
+	if rep, err := c2.Migrate(ctx, "users", opts); err != nil || *rep != (MigrateReport{}) {
+		t.Fatalf("second Migrate: rep=%+v err=%v, want nothing left", rep, err)
+	}
+}
+
+// TestMigrateThenRebuildIndex_Redis: Migrate records what it repoints in
+// the write manifest, so a rebuild — over the live index or after losing
+// it — restores each delta once, at its new URI, and the moved pointer.
+func TestMigrateThenRebuildIndex_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	var oldGone atomic.Bool
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		b := store.Bucket(bucket)
+		switch {
+		case bucket == "wal":
+			return b, nil // listable
+		case bucket == "old" && oldGone.Load():
+			b = goneBucket{}
+		}
+		return storecap.Wrap(b, storecap.Set{Presigner: presignBucket{b}, Stater: b.(storage.Stater)}), nil
+	}
+	c := New(prefix, rdb, resolve, WithSnapTarget("mem", "old"), WithWriteManifest("mem", "wal"))
+	defer c.Close()
+	ctx := context.Background()
+	for _, path := range []string{"/a", "/b"} {
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "old",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(`1`)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+	list := c.List(ctx, "users")
+	doc, err := ReadString(ctx, list)
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	stop := list.NextSnap().StopTsSeq
+	if !waitFor(func() bool {
+		snap, _ := c.reader.GetLatestSnap(ctx, "users")
+		return snap != nil && snap.StopTsSeq == stop
+	}) {
+		t.Fatal("snapshot was not indexed within timeout")
+	}
+	// The publish records its pointer just after indexing it; let that
+	// record land first, as the pointer Migrate then moves supersedes it.
+	if !waitFor(func() bool {
+		if err := c.FlushManifest(ctx); err != nil {
+			t.Fatalf("FlushManifest: %v", err)
+		}
+		objs, _, _ := store.Bucket("wal").(storage.Lister).List(ctx, "users", objkey.CatalogFolder("users"), "")
+		for _, o := range objs {
+			if body, _ := store.Bucket("wal").Get(ctx, "users", o.Path); strings.Contains(string(body), `"op":"snap"`) {
+				return true
+			}
+		}
+		return false
+	}) {
+		t.Fatal("snapshot was not recorded within timeout")
+	}
+	if _, err := c.Migrate(ctx, "users", MigrateOptions{From: Location{"mem", "old"}, To: Location{"mem", "new"}, Copy: true}); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if err := c.FlushManifest(ctx); err != nil {
+		t.Fatalf("FlushManifest: %v", err)
+	}
+	oldGone.Store(true)
+
+	check := func(when string) {
+		t.Helper()
+		deltas, err := c.reader.AllDeltas(ctx, "users")
+		if err != nil || len(deltas) != 2 {
+			t.Fatalf("%s: %d deltas (err=%v), want 2", when, len(deltas), err)
+		}
+		for _, d := range deltas {
+			if !strings.HasPrefix(d.URI, "mem://new/") {
+				t.Fatalf("%s: delta %s at %s", when, d.TsSeq, d.URI)
+			}
+		}
+		if snap, _ := c.reader.GetLatestSnap(ctx, "users"); snap == nil || snap.StopTsSeq != stop || !strings.HasPrefix(snap.URI, "mem://new/") {
+			t.Fatalf("%s: snap pointer = %+v", when, snap)
+		}
+		if got, err := ReadString(ctx, c.List(ctx, "users")); err != nil || got != doc {
+			t.Fatalf("%s: read = %q (err=%v), want %q", when, got, err, doc)
+		}
+	}
+	if _, err := c.RebuildIndex(ctx, "users"); err != nil {
+		t.Fatalf("RebuildIndex over the live index: %v", err)
+	}
+	check("rebuild over the live index")
+
+	keys, _ := rdb.Keys(ctx, prefix+":*").Result()
+	if err := rdb.Del(ctx, keys...).Err(); err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+	if _, err := c.RebuildIndex(ctx, "users"); err != nil {
+		t.Fatalf("RebuildIndex: %v", err)
+	}
+	check("rebuild of a lost index")
+}
+
+// TestMigrate_WithoutCopyVerifiesDestination: without Copy, an object
+// missing at the destination stops the run before its entry is repointed.
+func TestMigrate_WithoutCopyVerifiesDestination(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	c := New(prefix, rdb, resolve)
+	ctx := context.Background()
+	if err := c.writer.AddSnap(ctx, "users", TimeSeqID{Timestamp: 1700000000, SeqID: 1}, "mem://old/a.snap", "0"); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	opts := MigrateOptions{From: Location{"mem", "old"}, To: Location{"mem", "new"}}
+	if _, err := c.Migrate(ctx, "users", opts); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Migrate with object missing at To: err=%v, want ErrNotFound", err)
+	}
+	if snap, _ := c.reader.GetLatestSnap(ctx, "users"); snap.URI != "mem://old/a.snap" {
+		t.Fatalf("pointer moved to %q although the object is missing", snap.URI)
+	}
+
+	if err := store.Bucket("new").Put(ctx, "users", "a.snap", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	rep, err := c.Migrate(ctx, "users", opts)
+	if err != nil || rep.Snaps != 2 || rep.Objects != 0 {
+		t.Fatalf("Migrate: rep=%+v err=%v, want pointer + history, nothing copied", rep, err)
+	}
+	if snap, _ := c.reader.GetLatestSnap(ctx, "users"); snap.URI != "mem://new/a.snap" {
+		t.Fatalf("pointer = %q, want mem://new/a.snap", snap.URI)
+	}
+}
+
+// goneBucket stands in for a decommissioned bucket: every call fails.
+type goneBucket struct{}
+
+func (goneBucket) Get(context.Context, string, string) ([]byte, error) {
+	return nil, fmt.Errorf("bucket decommissioned")
+}
+func (goneBucket) Put(context.Context, string, string, []byte) error {
+	return fmt.Errorf("bucket decommissioned")
+}
+func (goneBucket) Stat(context.Context, string, string) (storage.ObjectInfo, error) {
+	return storage.ObjectInfo{}, fmt.Errorf("bucket decommissioned")
+}
+
+// TestMigrateKeyLayout_Redis: a catalog written under the global layout
+// reads back the same through a KeyLayoutCluster client after
+// MigrateKeyLayout, snapshot included, and keeps accepting writes there.
+func TestMigrateKeyLayout_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	ctx := context.Background()
+	write := func(c *Client, path, body string) {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "tenant/users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+
+	old := New(prefix, rdb, resolve, WithSnapTarget("mem", "snaps"))
+	write(old, "/a", `1`)
+	write(old, "/b", `2`)
+	list := old.List(ctx, "tenant/users")
+	want, err := ReadString(ctx, list)
+	if err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	stop := list.NextSnap().StopTsSeq
+	if !waitFor(func() bool {
+		snap, _ := old.reader.GetLatestSnap(ctx, "tenant/users")
+		return snap != nil && snap.StopTsSeq == stop
+	}) {
+		t.Fatal("snapshot was not indexed within timeout")
+	}
+
+	if _, err := MigrateKeyLayout(ctx, prefix, rdb, rdb, KeyLayoutGlobal, KeyLayout(7)); err == nil {
+		t.Fatal("expected unknown layout error")
+	}
+	rep, err := MigrateKeyLayout(ctx, prefix, rdb, rdb, KeyLayoutGlobal, KeyLayoutCluster)
+	if err != nil {
+		t.Fatalf("MigrateKeyLayout: %v", err)
+	}
+	if rep.Keys != 3 || rep.SnapFields != 1 {
+		t.Fatalf("report = %+v, want delta zset, allocator, history and the pointer", rep)
+	}
+
+	c := New(prefix, rdb, resolve, WithKeyLayout(KeyLayoutCluster))
+	if n, err := rdb.Exists(ctx, prefix+":d:{tenant/users}", prefix+":s:{tenant/users}").Result(); err != nil || n != 2 {
+		t.Fatalf("cluster-layout keys present = %d (err=%v), want 2", n, err)
+	}
+	list = c.List(ctx, "tenant/users")
+	if got, err := ReadString(ctx, list); err != nil || got != want {
+		t.Fatalf("read after migration = %q (err=%v), want %q", got, err, want)
+	}
+	if list.LatestSnap == nil || list.LatestSnap.StopTsSeq != stop || len(list.Entries) != 0 {
+		t.Fatalf("list after migration = %+v, want only the snapshot at %v", list, stop)
+	}
+	write(c, "/c", `3`)
+	if got, err := ReadString(ctx, c.List(ctx, "tenant/users")); err != nil || !strings.Contains(got, `"c":3`) {
+		t.Fatalf("read after write = %q (err=%v)", got, err)
+	}
+}
+
+// TestMigrateSnapShards_Redis: a WithSnapShards client reads and writes a
+// catalog still in "<prefix>:s", and reads it the same after
+// MigrateSnapShards has moved it into its shard.
+func TestMigrateSnapShards_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	ctx := context.Background()
+	write := func(c *Client, path, body string) {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "tenant/users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+
+	old := New(prefix, rdb, resolve, WithSnapTarget("mem", "snaps"))
+	write(old, "/a", `1`)
+	list := old.List(ctx, "tenant/users")
+	if _, err := ReadString(ctx, list); err != nil {
+		t.Fatalf("ReadString: %v", err)
+	}
+	stop := list.NextSnap().StopTsSeq
+	if !waitFor(func() bool {
+		snap, _ := old.reader.GetLatestSnap(ctx, "tenant/users")
+		return snap != nil && snap.StopTsSeq == stop
+	}) {
+		t.Fatal("snapshot was not indexed within timeout")
+	}
+	if _, err := old.MigrateSnapShards(ctx); err == nil {
+		t.Fatal("MigrateSnapShards ran without WithSnapShards")
+	}
+
+	c := New(prefix, rdb, resolve, WithSnapShards(8))
+	write(c, "/b", `2`)
+	want := `{"a":1,"b":2}`
+	if got, err := ReadString(ctx, c.List(ctx, "tenant/users")); err != nil || got != want {
+		t.Fatalf("read before migration = %q (err=%v), want %q", got, err, want)
+	}
+	if n, err := c.MigrateSnapShards(ctx); err != nil || n != 1 {
+		t.Fatalf("MigrateSnapShards = %d, %v", n, err)
+	}
+	if n, err := rdb.Exists(ctx, prefix+":s").Result(); err != nil || n != 0 {
+		t.Fatalf("<prefix>:s left after migration (n=%d err=%v)", n, err)
+	}
+	list = c.List(ctx, "tenant/users")
+	if got, err := ReadString(ctx, list); err != nil || got != want {
+		t.Fatalf("read after migration = %q (err=%v), want %q", got, err, want)
+	}
+	if list.LatestSnap == nil || list.LatestSnap.StopTsSeq != stop {
+		t.Fatalf("snapshot after migration = %+v, want %v", list.LatestSnap, stop)
+	}
+
+	memc := NewWithIndex("edge", NewMemoryIndex(), resolve)
+	if _, err := memc.MigrateSnapShards(ctx); !errors.Is(err, ErrIndexNotSupported) {
+		t.Fatalf("memory MigrateSnapShards err = %v", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithSnapShards(-1) did not panic")
+		}
+	}()
+	WithSnapShards(-1)
+}
@@ -0,0 +1,159 @@
+package lake
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// OrphanOptions tunes Client.FindOrphans.
+type OrphanOptions struct {
+	// Location is the backend to list — the Provider/Bucket clients upload
+	// the catalog's deltas to. It must implement storage.Lister.
+	Location Location
+	// MaxUploadTTL is the longest WithUploadTTL your writers use (default
+	// the 15 min default): an unreferenced object younger than this may
+	// still be about to be notified, so it is never an orphan. Without a
+	// handle secret WriteNotify enforces no expiry at all — choose
+	// generously then.
+	MaxUploadTTL time.Duration
+	// RetainHistory keeps delta objects Compact has dropped from the index:
+	// an unreferenced object last modified at or before the catalog's
+	// snapshot stop may be such retained history and is not reported. Off,
+	// every unreferenced object counts — compacted deltas included.
+	RetainHistory bool
+	// Delete removes the orphans found (the backend must implement
+	// storage.Deleter). Off, they are only reported.
+	Delete bool
+}
+
+// Orphan is one delta object no index entry references.
+type Orphan struct {
+	URI     string
+	Size    int64
+	ModTime time.Time
+}
+
+// OrphanReport is what one FindOrphans run found (and deleted).
+type OrphanReport struct {
+	Scanned int      // delta objects listed in the catalog's folder
+	Orphans []Orphan // unreferenced and old enough, in path order
+	Bytes   int64    // combined size of Orphans
+	Deleted int      // orphans deleted (Delete only)
+}
+
+// FindOrphans finds the delta objects in the catalog's folder of
+// opts.Location that no entry of the catalog's delta index references — the
+// uploads of WriteBegins whose WriteNotify never came (and, unless
+// RetainHistory, the objects of compacted deltas). GC cannot reach them:
+// it only follows the index.
+//
+// Only objects older than MaxUploadTTL, by the backend's ModTime judged on
+// the Redis clock, are considered; a backend that reports no ModTime yields
+// no orphans. Content-addressed objects a pending WriteBegin has pinned are
+// skipped. The folder is listed before the index is read, so a WriteNotify
+// racing the scan can only make an object look referenced, never orphaned.
+//
+// With Delete, orphans are deleted as they are reported; on error the
+// report covers what was done up to that point, and a re-run continues.
+func (c *Client) FindOrphans(ctx context.Context, catalog string, opts OrphanOptions) (*OrphanReport, error) {
+	c.emitEvent(catalog, "FindOrphans", map[string]any{"location": opts.Location.uriPrefix(), "delete": opts.Delete})
+	if err := c.requireRedisIndex("find orphans"); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidateCatalog(catalog); err != nil {
+		return nil, err
+	}
+	if err := opts.Location.validate(); err != nil {
+		return nil, fmt.Errorf("find orphans: %w", err)
+	}
+	ttl := opts.MaxUploadTTL
+	if ttl <= 0 {
+		ttl = defaultUploadTTL
+	}
+	st, err := c.storageFor(storage.Delta, opts.Location.Provider, opts.Location.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := st.(storage.Lister)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", opts.Location.uriPrefix(), storage.ErrListNotSupported)
+	}
+	del, ok := st.(storage.Deleter)
+	if !ok && opts.Delete {
+		return nil, fmt.Errorf("%s: %w", opts.Location.uriPrefix(), storage.ErrDeleteNotSupported)
+	}
+
+	c.ensureClock(ctx)
+	cutoff := c.idx.NowUnix() - int64(ttl/time.Second)
+	folder := objkey.CatalogFolder(catalog)
+	rep := &OrphanReport{}
+	var candidates []storage.ObjectInfo
+	for cursor := ""; ; {
+		page, next, err := lister.List(ctx, catalog, folder, cursor)
+		if err != nil {
+			return rep, fmt.Errorf("list %s%s: %w", opts.Location.uriPrefix(), folder, err)
+		}
+		for _, obj := range page {
+			name := strings.TrimPrefix(obj.Path, folder)
+			if strings.Contains(name, "/") || !strings.HasSuffix(name, ".dat") {
+				continue // another catalog's nested folder, or a snapshot
+			}
+			rep.Scanned++
+			if !obj.ModTime.IsZero() && obj.ModTime.Unix() <= cutoff {
+				candidates = append(candidates, obj)
+			}
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	if len(candidates) == 0 {
+		return rep, nil
+	}
+
+	referenced, err := c.reader.DeltaURIs(ctx, catalog)
+	if err != nil {
+		return rep, fmt.Errorf("read deltas: %w", err)
+	}
+	var retainThrough int64 = -1
+	if opts.RetainHistory {
+		snap, err := c.idx.LatestSnap(ctx, catalog)
+		if err != nil {
+			return rep, fmt.Errorf("read snap: %w", err)
+		}
+		if snap != nil {
+			retainThrough = snap.StopTsSeq.Timestamp
+		}
+	}
+	for _, obj := range candidates {
+		uri := objkey.BuildURI(opts.Location.Provider, opts.Location.Bucket, obj.Path)
+		if _, ok := referenced[uri]; ok || obj.ModTime.Unix() <= retainThrough {
+			continue
+		}
+		claimed, release, err := c.claimDelta(ctx, catalog, uri, !opts.Delete)
+		if err != nil {
+			return rep, fmt.Errorf("orphan %s: %w", uri, err)
+		}
+		if !claimed {
+			continue
+		}
+		if opts.Delete {
+			err := del.Delete(ctx, catalog, obj.Path)
+			release()
+			if err != nil {
+				return rep, fmt.Errorf("delete %s: %w", uri, err)
+			}
+			rep.Deleted++
+		}
+		rep.Orphans = append(rep.Orphans, Orphan{URI: uri, Size: obj.Size, ModTime: obj.ModTime})
+		rep.Bytes += obj.Size
+	}
+	return rep, nil
+}
@@ -0,0 +1,155 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/storecap"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// agedLister reports the objects in old as last modified an hour ago, so
+// tests can age uploads past MaxUploadTTL without sleeping.
+type agedLister struct {
+	storage.Lister
+	mu  sync.Mutex
+	old map[string]bool
+}
+
+func (a *agedLister) age(path string) {
+	a.mu.Lock()
+	a.old[path] = true
+	a.mu.Unlock()
+}
+
+func (a *agedLister) List(ctx context.Context, catalog, prefix, cursor string) ([]storage.ObjectInfo, string, error) {
+	page, next, err := a.Lister.List(ctx, catalog, prefix, cursor)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i := range page {
+		if a.old[page[i].Path] {
+			page[i].ModTime = page[i].ModTime.Add(-time.Hour)
+		}
+	}
+	return page, next, err
+}
+
+func TestFindOrphans_Validates(t *testing.T) {
+	c := newDeadClient(t)
+	ctx := context.Background()
+	if _, err := c.FindOrphans(ctx, "bad|name", OrphanOptions{Location: Location{"mem", "data"}}); err == nil || !strings.Contains(err.Error(), "invalid catalog") {
+		t.Fatalf("expected invalid catalog error, got %v", err)
+	}
+	if _, err := c.FindOrphans(ctx, "users", OrphanOptions{}); err == nil {
+		t.Fatal("expected invalid location error")
+	}
+}
+
+// TestFindOrphans_Redis: an aged upload that was never notified is an
+// orphan; a referenced, a fresh or a snapshot object is not; RetainHistory
+// spares compacted deltas; Delete removes exactly the orphans.
+func TestFindOrphans_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	aged := &agedLister{Lister: store.Bucket("data").(storage.Lister), old: map[string]bool{}}
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		b := store.Bucket(bucket)
+		return storecap.Wrap(b, storecap.Set{Presigner: presignBucket{b}, Lister: aged, Deleter: b.(storage.Deleter)}), nil
+	}
+	c := New(prefix, rdb, resolve)
+	ctx := context.Background()
+
+	upload := func(path string, notify bool) *WriteHandle {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket("data").Put(ctx, h.Catalog, h.Key, []byte(`1`)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if notify {
+			if err := c.WriteNotify(ctx, h); err != nil {
+				t.Fatalf("WriteNotify: %v", err)
+			}
+		}
+		return h
+	}
+	kept := upload("/a", true)
+	orphan := upload("/b", false)
+	fresh := upload("/c", false)
+	snapPath := objkey.SnapPath("users", "1700000000_1")
+	if err := store.Bucket("data").Put(ctx, "users", snapPath, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{kept.Key, orphan.Key, snapPath} {
+		aged.age(p)
+	}
+
+	opts := OrphanOptions{Location: Location{"mem", "data"}}
+	rep, err := c.FindOrphans(ctx, "users", opts)
+	if err != nil {
+		t.Fatalf("FindOrphans: %v", err)
+	}
+	if rep.Scanned != 3 || len(rep.Orphans) != 1 || rep.Orphans[0].URI != orphan.URI || rep.Bytes != 1 || rep.Deleted != 0 {
+		t.Fatalf("report = %+v, want 3 scanned and only %s", rep, orphan.URI)
+	}
+
+	// Compact the referenced delta out of the index: without RetainHistory
+	// its object is unreferenced too; with it, it is history.
+	stop := TimeSeqID{Timestamp: time.Now().Unix() + 1, SeqID: 1}
+	if err := c.writer.AddSnap(ctx, "users", stop, "mem://snaps/s.snap", "0"); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+	if n, err := c.Compact(ctx, "users"); err != nil || n != 1 {
+		t.Fatalf("Compact = %d (err=%v), want 1", n, err)
+	}
+	if rep, err := c.FindOrphans(ctx, "users", opts); err != nil || len(rep.Orphans) != 2 {
+		t.Fatalf("FindOrphans after compact: rep=%+v err=%v, want the compacted delta too", rep, err)
+	}
+	retain := opts
+	retain.RetainHistory = true
+	if rep, err := c.FindOrphans(ctx, "users", retain); err != nil || len(rep.Orphans) != 0 {
+		t.Fatalf("FindOrphans RetainHistory: rep=%+v err=%v, want nothing before the snapshot stop", rep, err)
+	}
+
+	opts.Delete = true
+	if rep, err = c.FindOrphans(ctx, "users", opts); err != nil || rep.Deleted != 2 {
+		t.Fatalf("FindOrphans Delete: rep=%+v err=%v, want 2 deleted", rep, err)
+	}
+	for _, h := range []*WriteHandle{kept, orphan} {
+		if _, err := store.Bucket("data").Get(ctx, "users", h.Key); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("orphan %s still present (err=%v)", h.Key, err)
+		}
+	}
+	if _, err := store.Bucket("data").Get(ctx, "users", fresh.Key); err != nil {
+		t.Fatalf("fresh upload was deleted: %v", err)
+	}
+}
+
+// TestFindOrphans_RequiresLister: a backend that cannot list is refused.
+func TestFindOrphans_RequiresLister(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	c := New(prefix, rdb, resolve)
+	if _, err := c.FindOrphans(context.Background(), "users", OrphanOptions{Location: Location{"mem", "data"}}); !errors.Is(err, storage.ErrListNotSupported) {
+		t.Fatalf("FindOrphans without Lister: err=%v, want ErrListNotSupported", err)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strings"
 
 	"github.com/hkloudou/lake/v3/internal/index"
 	"github.com/hkloudou/lake/v3/internal/utils"
@@ -60,7 +59,7 @@ func (c *Client) RemoveDelta(ctx context.Context, catalog, tsSeq string) (bool,
 	// benign: tsSeq allocation is monotonic, so a delta can only DISAPPEAR
 	// between the two (removed=false with a harmless extra bump), never
 	// appear.
-	if exists, err := c.reader.HasDelta(ctx, catalog, id); err != nil {
+	if exists, err := c.idx.HasDelta(ctx, catalog, id); err != nil {
 		return false, fmt.Errorf("probe delta: %w", err)
 	} else if !exists {
 		return false, nil
@@ -72,13 +71,26 @@ func (c *Client) RemoveDelta(ctx context.Context, catalog, tsSeq string) (bool,
 	// and a retry would return false without ever installing the barrier. A
 	// bump whose removal then fails is harmless — it only discards some
 	// in-flight cache writes.
-	if err := c.sampleRdb.HIncrBy(ctx, c.reader.MakeSampleRemoveGenKey(), catalog, 1).Err(); err != nil {
-		return false, fmt.Errorf("install sample barrier: %w", err)
+	if c.sampleRdb != nil {
+		if err := c.sampleRdb.HIncrBy(ctx, c.keys.MakeSampleRemoveGenKey(), catalog, 1).Err(); err != nil {
+			return false, fmt.Errorf("install sample barrier: %w", err)
+		}
 	}
-	removed, err := c.writer.RemoveDelta(ctx, catalog, id)
+	removed, err := c.idx.RemoveDelta(ctx, catalog, id)
 	if err != nil || !removed {
 		return removed, err
 	}
+	if c.manifest != nil {
+		// Written now, not batched: a rebuild that missed this record would
+		// resurrect the delta the operator just removed.
+		c.manifest.append(catalog, manifestRecord{Op: "remove", TsSeq: id.String()})
+		if err := c.manifest.flush(ctx); err != nil {
+			return true, fmt.Errorf("delta removed, but its manifest record was not written (retried on the next flush): %w", err)
+		}
+	}
+	if c.sampleRdb == nil {
+		return true, nil
+	}
 	if err := c.sweepSamples(ctx, catalog); err != nil {
 		// Correctness no longer depends on the sweep (stale entries carry an
 		// older generation and are rejected at read time); failing here only
@@ -88,8 +100,8 @@ func (c *Client) RemoveDelta(ctx context.Context, catalog, tsSeq string) (bool,
 	return true, nil
 }
 
-// sweepSamples deletes the catalog's entry from every EXISTING memo hash
-// (SCAN "<prefix>:m:*"; never blocks the server on the full keyspace). The
+// sweepSamples deletes the catalogs' entries from every EXISTING memo hash
+// (SCAN "<prefix>:m:*", on every master of a cluster; never blocks the server on the full keyspace). The
 // write barrier ("<prefix>:mrg", bumped by RemoveDelta before the removal)
 // already voids in-flight computes for every indicator — including ones
 // whose memo hash does not exist yet, which no key scan could reach — and
@@ -100,55 +112,30 @@ func (c *Client) RemoveDelta(ctx context.Context, catalog, tsSeq string) (bool,
 // indicators instead of one per indicator), and a failing HDEL does not
 // abandon the rest of the sweep — errors are collected and joined, so as
 // much memory as possible is reclaimed in one pass.
-func (c *Client) sweepSamples(ctx context.Context, catalog string) error {
+func (c *Client) sweepSamples(ctx context.Context, catalogs ...string) error {
 	// The prefix is user-supplied and MATCH treats *?[]\ as glob syntax —
 	// unescaped, a prefix like "app[1]" would silently match the wrong keys
 	// (missing this deployment's memo hashes, or sweeping another's).
-	pattern := globEscape(c.reader.Prefix()) + ":m:*"
-	var (
-		cursor uint64
-		errs   []error
-	)
-	for {
-		keys, next, err := c.sampleRdb.Scan(ctx, cursor, pattern, 256).Result()
-		if err != nil {
-			// The cursor is gone with the failed SCAN; report what happened
-			// so the operator can retry via InvalidateSamples.
-			errs = append(errs, fmt.Errorf("scan %q: %w", pattern, err))
-			break
+	pattern := c.keys.SampleKeyPattern()
+	var errs []error
+	err := index.ScanKeys(ctx, c.sampleRdb, pattern, 256, func(keys []string) (bool, error) {
+		pipe := c.sampleRdb.Pipeline()
+		cmds := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			cmds[i] = pipe.HDel(ctx, key, catalogs...)
 		}
-		if len(keys) > 0 {
-			pipe := c.sampleRdb.Pipeline()
-			cmds := make([]*redis.IntCmd, len(keys))
-			for i, key := range keys {
-				cmds[i] = pipe.HDel(ctx, key, catalog)
-			}
-			_, _ = pipe.Exec(ctx)
-			for i, cmd := range cmds {
-				if err := cmd.Err(); err != nil {
-					errs = append(errs, fmt.Errorf("invalidate %s: %w", keys[i], err))
-				}
+		_, _ = pipe.Exec(ctx)
+		for i, cmd := range cmds {
+			if err := cmd.Err(); err != nil {
+				errs = append(errs, fmt.Errorf("invalidate %s: %w", keys[i], err))
 			}
 		}
-		if next == 0 {
-			break
-		}
-		cursor = next
+		return true, nil
+	})
+	if err != nil {
+		// The cursor is gone with the failed SCAN; report what happened
+		// so the operator can retry via InvalidateSamples.
+		errs = append(errs, fmt.Errorf("scan %q: %w", pattern, err))
 	}
 	return errors.Join(errs...)
 }
-
-// globEscape backslash-escapes Redis MATCH metacharacters so s matches only
-// itself as a literal pattern segment.
-func globEscape(s string) string {
-	var b strings.Builder
-	b.Grow(len(s))
-	for i := 0; i < len(s); i++ {
-		switch s[i] {
-		case '*', '?', '[', ']', '\\':
-			b.WriteByte('\\')
-		}
-		b.WriteByte(s[i])
-	}
-	return b.String()
-}
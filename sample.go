@@ -224,8 +224,8 @@ func (s *Sampler[T]) Batch(ctx context.Context, lists map[string]*ListResult) ma
 		return out
 	}
 
-	now := c.reader.NowUnix()
-	hashKey := c.reader.MakeSampleIndicatorKey(s.indicator)
+	now := c.idx.NowUnix()
+	hashKey := c.keys.MakeSampleIndicatorKey(s.indicator)
 
 	// One pipelined round-trip probes every catalog's cached value plus both
 	// write barriers (indicator epoch + per-catalog removal generation) —
@@ -233,16 +233,28 @@ func (s *Sampler[T]) Batch(ctx context.Context, lists map[string]*ListResult) ma
 	// removal voids the batch's write-backs.
 	fields := append(append(make([]string, 0, len(probe)+1), probe...), sampleEpochField)
 	epoch := "0"
-	pipe := c.sampleRdb.Pipeline()
-	memoCmd := pipe.HMGet(ctx, hashKey, fields...)
-	genCmd := pipe.HMGet(ctx, c.reader.MakeSampleRemoveGenKey(), probe...)
-	_, _ = pipe.Exec(ctx)
-
 	catGens := make(map[string]string, len(probe))
-	genVals, _ := genCmd.Result()
-	for i, raw := range hmgetRow(genVals, len(probe)) {
-		if g, ok := raw.(string); ok {
-			catGens[probe[i]] = g
+	var cached []any
+	if c.sampleRdb != nil {
+		pipe := c.sampleRdb.Pipeline()
+		memoCmd := pipe.HMGet(ctx, hashKey, fields...)
+		genCmd := pipe.HMGet(ctx, c.keys.MakeSampleRemoveGenKey(), probe...)
+		_, _ = pipe.Exec(ctx)
+
+		genVals, _ := genCmd.Result()
+		for i, raw := range hmgetRow(genVals, len(probe)) {
+			if g, ok := raw.(string); ok {
+				catGens[probe[i]] = g
+			}
+		}
+		var err error
+		cached, err = memoCmd.Result()
+		if err != nil && err != redis.Nil {
+			// Cache-read failure: degrade to recompute-all rather than fail
+			// the batch (the cache is an optimization, not the truth).
+			for _, cat := range probe {
+				c.emitEvent(cat, "SampleCacheError", map[string]any{"op": "hmget", "err": err.Error()})
+			}
 		}
 	}
 	catGen := func(cat string) string {
@@ -251,16 +263,7 @@ func (s *Sampler[T]) Batch(ctx context.Context, lists map[string]*ListResult) ma
 		}
 		return "0"
 	}
-
-	cached, err := memoCmd.Result()
-	if err != nil && err != redis.Nil {
-		// Cache-read failure: degrade to recompute-all rather than fail
-		// the batch (the cache is an optimization, not the truth).
-		for _, cat := range probe {
-			c.emitEvent(cat, "SampleCacheError", map[string]any{"op": "hmget", "err": err.Error()})
-		}
-	}
-	cached = hmgetRow(cached, len(fields))
+	cached = hmgetRow(cached, len(fields)) // no sample cache: all misses
 	if e, ok := cached[len(probe)].(string); ok {
 		epoch = e
 	}
@@ -309,7 +312,7 @@ func (s *Sampler[T]) Batch(ctx context.Context, lists map[string]*ListResult) ma
 							e = fmt.Errorf("lake: sampler loader panicked: %v", r)
 						}
 					}()
-					return s.finalize(s.loadAndCache(ctx, c, l, hashKey, l.LastUpdated(), c.reader.NowUnix(), epoch, catGen(cat)))
+					return s.finalize(s.loadAndCache(ctx, c, l, hashKey, l.LastUpdated(), c.idx.NowUnix(), epoch, catGen(cat)))
 				}()
 				mu.Lock()
 				out[cat] = &SampleResult[T]{Value: v, Err: e}
@@ -403,7 +406,7 @@ func (c *Client) InvalidateSamples(ctx context.Context, indicator string, catalo
 			return 0, err
 		}
 	}
-	if len(catalogs) == 0 {
+	if len(catalogs) == 0 || c.sampleRdb == nil {
 		return 0, nil
 	}
 	args := make([]any, len(catalogs))
@@ -411,7 +414,7 @@ func (c *Client) InvalidateSamples(ctx context.Context, indicator string, catalo
 		args[i] = cat
 	}
 	res, err := index.RunScript(ctx, c.sampleRdb, luaSampleInvalidate,
-		[]string{c.reader.MakeSampleIndicatorKey(indicator)}, args...).Result()
+		[]string{c.keys.MakeSampleIndicatorKey(indicator)}, args...).Result()
 	if err != nil {
 		return 0, err
 	}
@@ -462,13 +465,16 @@ func (s *Sampler[T]) isStale(meta SampleMeta, list *ListResult, peers map[string
 // DISCARD the write — never admit a stale one.
 func (s *Sampler[T]) sampleCore(ctx context.Context, c *Client, list *ListResult, peers map[string]*ListResult) (T, error) {
 	lastUpdated := list.LastUpdated()
-	now := c.reader.NowUnix()
-	hashKey := c.reader.MakeSampleIndicatorKey(s.indicator)
+	now := c.idx.NowUnix()
+	hashKey := c.keys.MakeSampleIndicatorKey(s.indicator)
 
 	epoch, catGen := "0", "0"
+	if c.sampleRdb == nil {
+		return s.loadAndCache(ctx, c, list, hashKey, lastUpdated, now, epoch, catGen)
+	}
 	pipe := c.sampleRdb.Pipeline()
 	memoCmd := pipe.HMGet(ctx, hashKey, list.catalog, sampleEpochField)
-	genCmd := pipe.HGet(ctx, c.reader.MakeSampleRemoveGenKey(), list.catalog)
+	genCmd := pipe.HGet(ctx, c.keys.MakeSampleRemoveGenKey(), list.catalog)
 	_, _ = pipe.Exec(ctx)
 	if g, err := genCmd.Result(); err == nil {
 		catGen = g
@@ -522,7 +528,7 @@ func (s *Sampler[T]) loadAndCache(ctx context.Context, c *Client, list *ListResu
 		listGen = "0"
 	}
 	flightKey := list.catalog + ":" + s.indicator + ":" +
-		strconv.FormatFloat(lastUpdated, 'f', 6, 64) + ":" + epoch + ":" + catGen + ":" + listGen
+		strconv.FormatFloat(lastUpdated, 'f', -1, 64) + ":" + epoch + ":" + catGen + ":" + listGen
 	raw, err := c.sampleFlight.Do(flightKey, func() (string, error) {
 		result, lerr := s.loader(list)
 		if lerr != nil {
@@ -532,13 +538,16 @@ func (s *Sampler[T]) loadAndCache(ctx context.Context, c *Client, list *ListResu
 		if merr != nil {
 			return "", fmt.Errorf("marshal sample: %w", merr)
 		}
-		if curGen, gerr := c.reader.RemoveGen(ctx, list.catalog); gerr != nil || curGen != listGen {
+		if c.sampleRdb == nil {
+			return string(data), nil // no sample cache to write back to
+		}
+		if curGen, gerr := c.idx.RemoveGen(ctx, list.catalog); gerr != nil || curGen != listGen {
 			// Unreadable or moved generation: skip the write (never cache a
 			// value the current log may no longer support), keep the result.
 			return string(data), nil
 		}
 		if werr := index.RunScript(ctx, c.sampleRdb, luaSampleWrite,
-			[]string{hashKey, c.reader.MakeSampleRemoveGenKey()},
+			[]string{hashKey, c.keys.MakeSampleRemoveGenKey()},
 			epoch, catGen, list.catalog, data).Err(); werr != nil {
 			c.emitEvent(list.catalog, "SampleCacheError", map[string]any{"op": "hset", "err": werr.Error()})
 		}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/storage"
 	"github.com/hkloudou/lake/v3/storage/cached"
 	"github.com/hkloudou/lake/v3/storage/mem"
 )
@@ -76,3 +77,36 @@ func TestCacheTier_Redis(t *testing.T) {
 		t.Errorf("sample memo TTL = %v, want < 0 (no expiry — resists LRU, grows unbounded)", ttl)
 	}
 }
+
+// TestCacheTier_RedisInvalidateAndStats: cached.Invalidate reaches the shared
+// cache Redis, and RedisCache counts this process's hits and misses.
+func TestCacheTier_RedisInvalidateAndStats(t *testing.T) {
+	cache := redisTestDB(t, 14)
+	prefix := testPrefix(t)
+	cleanupKeys(t, cache, "lake_cache:"+prefix+"|snaps:*")
+	ctx := context.Background()
+
+	rc := cached.NewRedisCache(cache, time.Hour)
+	policy := func(storage.Kind, string, string) cached.Cache { return rc }
+	store := mem.New()
+	resolve := cached.Resolver(func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return store.Bucket(bucket), nil
+	}, policy)
+	s, _ := resolve(storage.Snap, prefix, "snaps")
+	if err := s.Put(ctx, "users", "a/1.snap", []byte("bad")); err != nil {
+		t.Fatal(err)
+	}
+	_ = store.Bucket("snaps").Put(ctx, "users", "a/1.snap", []byte("fixed"))
+	if got, _ := s.Get(ctx, "users", "a/1.snap"); string(got) != "bad" {
+		t.Fatalf("Get = %q, want cached bytes", got)
+	}
+	if err := cached.Invalidate(ctx, policy, storage.Snap, prefix+"://snaps/a/1.snap"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(ctx, "users", "a/1.snap"); string(got) != "fixed" {
+		t.Fatalf("Get = %q after Invalidate, want repaired bytes", got)
+	}
+	if st := rc.Stats(); st.Hits != 1 || st.Misses != 1 {
+		t.Fatalf("stats = %+v, want 1 hit, 1 miss", st)
+	}
+}
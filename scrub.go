@@ -0,0 +1,232 @@
+package lake
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/merge"
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// ScrubOptions tunes Client.Scrub.
+type ScrubOptions struct {
+	// Catalogs to check; empty means every catalog with a snap pointer or a
+	// delta index.
+	Catalogs []string
+	// Concurrency bounds the objects checked in parallel. Default 8.
+	Concurrency int
+	// VerifyJSON fetches every body, checks it is valid JSON, and dry-runs
+	// the catalog's merge, reporting deltas no read could apply. Without
+	// it objects are only probed (Stat when the backend has it).
+	VerifyJSON bool
+}
+
+// ScrubIssue classifies a ScrubFinding.
+type ScrubIssue string
+
+const (
+	ScrubMissing ScrubIssue = "missing" // object not found in storage
+	ScrubEmpty   ScrubIssue = "empty"   // object exists but has 0 bytes
+	ScrubPoison  ScrubIssue = "poison"  // body is not JSON or does not merge (VerifyJSON)
+	ScrubError   ScrubIssue = "error"   // object could not be checked (backend error)
+)
+
+// ScrubFinding is one broken index reference. For a delta, TsSeq is the
+// exact string Client.RemoveDelta takes; for a snapshot it is the snap's
+// stop (the fix is then a restore, not a removal).
+type ScrubFinding struct {
+	Catalog string
+	Kind    storage.Kind // storage.Delta or storage.Snap
+	TsSeq   string
+	URI     string
+	Issue   ScrubIssue
+	Err     error
+}
+
+// ScrubReport is the outcome of one Scrub run.
+type ScrubReport struct {
+	Catalogs int // catalogs checked
+	Objects  int // objects checked
+	Findings []ScrubFinding
+}
+
+// Scrub checks that every object a read of each catalog would fetch — the
+// snapshot the pointer names and every delta past it — exists and is not
+// empty, and with VerifyJSON that it parses and merges. It finds what a
+// user read would otherwise trip over first. Deltas the snapshot already
+// absorbed are never read again and are not checked.
+//
+// Scrub is read-only. Broken references are reported, not repaired: a
+// ScrubFinding for a delta carries the tsSeq to pass to RemoveDelta. Backend
+// errors on individual objects are reported as ScrubError findings; Redis
+// errors stop the run, returning the report so far.
+func (c *Client) Scrub(ctx context.Context, opts ScrubOptions) (*ScrubReport, error) {
+	if err := c.requireRedisIndex("scrub"); err != nil {
+		return nil, err
+	}
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 8
+	}
+	for _, catalog := range opts.Catalogs {
+		if err := utils.ValidateCatalog(catalog); err != nil {
+			return nil, err
+		}
+	}
+	catalogs := opts.Catalogs
+	if len(catalogs) == 0 {
+		var err error
+		if catalogs, err = c.indexedCatalogs(ctx); err != nil {
+			return nil, fmt.Errorf("enumerate catalogs: %w", err)
+		}
+	}
+	rep := &ScrubReport{}
+	for _, catalog := range catalogs {
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+		c.emitEvent(catalog, "Scrub", map[string]any{"verifyJSON": opts.VerifyJSON})
+		snap, rr := c.idx.List(ctx, catalog)
+		if rr.Err != nil {
+			return rep, fmt.Errorf("list %s: %w", catalog, rr.Err)
+		}
+		rep.Catalogs++
+		c.scrubCatalog(ctx, catalog, snap, rr.Deltas, workers, opts.VerifyJSON, rep)
+	}
+	return rep, nil
+}
+
+// indexedCatalogs returns every catalog with a snap pointer or a delta zset.
+func (c *Client) indexedCatalogs(ctx context.Context) ([]string, error) {
+	seen := map[string]struct{}{}
+	var out []string
+	add := func(catalog string) bool {
+		if _, ok := seen[catalog]; !ok {
+			seen[catalog] = struct{}{}
+			out = append(out, catalog)
+		}
+		return true
+	}
+	if err := c.idx.IterateSnaps(ctx, func(catalog string, _ SnapInfo) bool { return add(catalog) }); err != nil {
+		return nil, err
+	}
+	if err := c.reader.IterateDeltaCatalogs(ctx, "", add); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// scrubCatalog checks one catalog's read set and appends its findings.
+func (c *Client) scrubCatalog(ctx context.Context, catalog string, snap *index.SnapInfo, deltas []index.DeltaInfo,
+	workers int, verify bool, rep *ScrubReport) {
+	type check struct {
+		kind  storage.Kind
+		tsSeq string
+		uri   string
+		body  []byte
+		issue ScrubIssue
+		err   error
+	}
+	checks := make([]check, 0, len(deltas)+1)
+	if snap != nil {
+		checks = append(checks, check{kind: storage.Snap, tsSeq: snap.StopTsSeq.String(), uri: snap.URI})
+	}
+	for _, d := range deltas {
+		checks = append(checks, check{kind: storage.Delta, tsSeq: d.TsSeq.String(), uri: d.URI})
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i := range checks {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			ck := &checks[i]
+			ck.body, ck.issue, ck.err = c.scrubObject(ctx, ck.kind, catalog, ck.uri, verify)
+		})
+	}
+	wg.Wait()
+
+	rep.Objects += len(checks)
+	for _, ck := range checks {
+		if ck.issue != "" {
+			rep.Findings = append(rep.Findings, ScrubFinding{
+				Catalog: catalog, Kind: ck.kind, TsSeq: ck.tsSeq, URI: ck.uri, Issue: ck.issue, Err: ck.err,
+			})
+		}
+	}
+	if !verify || (snap != nil && checks[0].issue != "") {
+		return // no base document to dry-run the merge against
+	}
+
+	// Dry-run the merge one delta at a time, exactly as a read orders and
+	// prunes it, so a failure names its delta. A failing delta is skipped
+	// (as RemoveDelta would), letting the rest be checked against the
+	// document the read would build without it.
+	doc := []byte("{}")
+	if snap != nil {
+		doc, checks = checks[0].body, checks[1:]
+	}
+	for i := range deltas {
+		deltas[i].Body = checks[i].body
+	}
+	live, _ := merge.PruneDead(deltas)
+	for _, d := range live {
+		if len(d.Body) == 0 {
+			continue // already reported
+		}
+		next, err := merge.Merge(doc, []index.DeltaInfo{d})
+		if err != nil {
+			rep.Findings = append(rep.Findings, ScrubFinding{
+				Catalog: catalog, Kind: storage.Delta, TsSeq: d.TsSeq.String(), URI: d.URI, Issue: ScrubPoison, Err: err,
+			})
+			continue
+		}
+		doc = next
+	}
+}
+
+// scrubObject probes one object. With verify it is fetched and its body
+// returned; otherwise a Stat suffices when the backend has one.
+func (c *Client) scrubObject(ctx context.Context, kind storage.Kind, catalog, uri string, verify bool) (body []byte, issue ScrubIssue, err error) {
+	defer func() {
+		if err != nil && issue == "" {
+			issue = ScrubError // a contained backend panic
+		}
+	}()
+	defer panicToErr(&err)
+	provider, bucket, path, err := objkey.ParseURI(uri)
+	if err != nil {
+		return nil, ScrubError, err
+	}
+	st, err := c.storageFor(kind, provider, bucket)
+	if err != nil {
+		return nil, ScrubError, err
+	}
+	var size int64
+	if s, ok := st.(storage.Stater); ok && !verify {
+		var info storage.ObjectInfo
+		info, err = s.Stat(ctx, catalog, path)
+		size = info.Size
+	} else {
+		body, err = st.Get(ctx, catalog, path)
+		size = int64(len(body))
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return nil, ScrubMissing, err
+	case err != nil:
+		return nil, ScrubError, err
+	case size == 0:
+		return nil, ScrubEmpty, nil
+	case verify && !json.Valid(body):
+		return nil, ScrubPoison, errors.New("body is not valid JSON")
+	}
+	return body, "", nil
+}
@@ -0,0 +1,113 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+func TestScrub_ValidatesBeforeRedis(t *testing.T) {
+	c := newDeadClient(t)
+	if _, err := c.Scrub(context.Background(), ScrubOptions{Catalogs: []string{"ok", "bad|name"}}); err == nil || !strings.Contains(err.Error(), "invalid catalog") {
+		t.Fatalf("expected invalid catalog error, got %v", err)
+	}
+}
+
+// TestScrub_Redis: Scrub reports missing, empty and poison deltas with the
+// tsSeq RemoveDelta takes, a missing snapshot, and nothing for healthy
+// catalogs; removing what it reports leaves a readable catalog.
+func TestScrub_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return store.Bucket(bucket), nil
+	}
+	c := New(prefix, rdb, resolve)
+	ctx := context.Background()
+
+	// Written straight into the index: Scrub must find broken objects no
+	// matter how they came to be referenced.
+	notify := func(catalog, path, key string, body []byte) string {
+		t.Helper()
+		if body != nil {
+			if err := store.Bucket("data").Put(ctx, catalog, key, body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		id, _, err := c.writer.Notify(ctx, catalog, path, MergeTypeReplace, "mem://data/"+key)
+		if err != nil {
+			t.Fatalf("notify: %v", err)
+		}
+		return id.String()
+	}
+	notify("users", "/ok", "d/ok.json", []byte(`1`))
+	missing := notify("users", "/gone", "d/gone.json", nil)
+	empty := notify("users", "/empty", "d/empty.json", []byte{})
+	poison := notify("users", "/bad", "d/bad.json", []byte(`{invalid`))
+	notify("orders", "/x", "d/x.json", []byte(`{"a":1}`))
+	if err := c.writer.AddSnap(ctx, "archived", TimeSeqID{Timestamp: 1700000000, SeqID: 1}, "mem://snaps/lost.snap", "0"); err != nil {
+		t.Fatalf("AddSnap: %v", err)
+	}
+
+	rep, err := c.Scrub(ctx, ScrubOptions{Catalogs: []string{"users", "orders"}})
+	if err != nil {
+		t.Fatalf("Scrub: %v", err)
+	}
+	if rep.Catalogs != 2 || rep.Objects != 5 {
+		t.Fatalf("report = %+v, want 2 catalogs, 5 objects", rep)
+	}
+	got := findings(rep)
+	if want := []string{"users delta " + missing + " missing", "users delta " + empty + " empty"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("findings without VerifyJSON = %v, want %v", got, want)
+	}
+	if !errors.Is(rep.Findings[0].Err, storage.ErrNotFound) {
+		t.Fatalf("missing finding err = %v, want ErrNotFound", rep.Findings[0].Err)
+	}
+
+	rep, err = c.Scrub(ctx, ScrubOptions{VerifyJSON: true, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("Scrub VerifyJSON: %v", err)
+	}
+	if rep.Catalogs != 3 {
+		t.Fatalf("enumerated %d catalogs, want 3", rep.Catalogs)
+	}
+	got = findings(rep)
+	want := []string{
+		"archived snap 1700000000_1 missing",
+		"users delta " + missing + " missing",
+		"users delta " + empty + " empty",
+		"users delta " + poison + " poison",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("findings with VerifyJSON = %v, want %v", got, want)
+	}
+
+	for _, f := range rep.Findings {
+		if f.Kind == storage.Delta {
+			if ok, err := c.RemoveDelta(ctx, f.Catalog, f.TsSeq); err != nil || !ok {
+				t.Fatalf("RemoveDelta(%s): ok=%v err=%v", f.TsSeq, ok, err)
+			}
+		}
+	}
+	if got, err := ReadString(ctx, c.List(ctx, "users")); err != nil || got != `{"ok":1}` {
+		t.Fatalf("read after removing findings = %q (err=%v)", got, err)
+	}
+}
+
+// findings renders a report's findings as sorted "catalog kind tsSeq issue".
+func findings(rep *ScrubReport) []string {
+	out := make([]string, 0, len(rep.Findings))
+	for _, f := range rep.Findings {
+		out = append(out, f.Catalog+" "+f.Kind.String()+" "+f.TsSeq+" "+string(f.Issue))
+	}
+	sort.Strings(out)
+	return out
+}
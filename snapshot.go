@@ -17,7 +17,7 @@ import (
 // materialising the full set in memory. Callers that want the whole set in a
 // map can accumulate one inside fn.
 func (c *Client) IterateSnaps(ctx context.Context, fn func(catalog string, snap SnapInfo) bool) error {
-	return c.reader.IterateSnaps(ctx, fn)
+	return c.idx.IterateSnaps(ctx, fn)
 }
 
 // saveSnapshotGuarded is the fire-and-forget form of saveSnapshot for the
@@ -92,8 +92,15 @@ func (c *Client) saveSnapshot(ctx context.Context, catalog string, stop index.Ti
 		return "", fmt.Errorf("save snapshot: %w", err)
 	}
 	uri = objkey.BuildURI(c.snapProvider, c.snapBucket, path)
-	if err := c.writer.AddSnap(ctx, catalog, stop, uri, removeGen); err != nil {
+	if err := c.idx.AddSnap(ctx, catalog, stop, uri, removeGen); err != nil {
 		return "", fmt.Errorf("index snapshot: %w", err)
 	}
+	if c.manifest != nil {
+		// AddSnap refuses silently; record the pointer only if it is ours.
+		// A save that lost to a newer one leaves the record to that one.
+		if snap, err := c.idx.LatestSnap(ctx, catalog); err == nil && snap != nil && snap.URI == uri {
+			c.manifest.append(catalog, manifestRecord{Op: "snap", TsSeq: stop.String(), URI: uri})
+		}
+	}
 	return uri, nil
 }
@@ -0,0 +1,188 @@
+package lake
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hkloudou/lake/v3/internal/index"
+	"github.com/hkloudou/lake/v3/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+// CatalogDetail is a catalog's index statistics as Stats reports them; see
+// CatalogStats.
+type CatalogDetail = index.CatalogDetail
+
+// CatalogStats is what one catalog costs: its index statistics — delta
+// count, oldest and newest tsSeq, backlog past the snapshot, snap pointer,
+// removal generation and the approximate Redis bytes of its delta zset
+// (MEMORY USAGE; on the memory index, the members' bytes) — plus its
+// footprint in the sample memo.
+type CatalogStats struct {
+	CatalogDetail
+	MemoEntries int   // memo hashes (indicators) holding an entry for it
+	MemoBytes   int64 // bytes of those entries' values (HSTRLEN)
+}
+
+// TopBy is the measure TopCatalogs ranks by.
+type TopBy int
+
+const (
+	TopByBacklog    TopBy = iota + 1 // deltas a read replays
+	TopByDeltas                      // delta index entries, absorbed ones included
+	TopByDeltaBytes                  // CatalogStats.DeltaBytes
+)
+
+// Stats reports each catalog's CatalogStats, in the order given; a catalog
+// without state reports zeros. The index statistics cost two pipelined
+// round-trips per 500 catalogs; the memo footprint one SCAN of the memo
+// hashes (as InvalidateSamples) with a pipelined HSTRLEN per page. Like
+// IterateCatalogs the numbers are a per-catalog observation, not an atomic
+// one.
+func (c *Client) Stats(ctx context.Context, catalogs ...string) ([]CatalogStats, error) {
+	for _, catalog := range catalogs {
+		c.emitEvent(catalog, "Stats", nil)
+	}
+	for _, catalog := range catalogs {
+		if err := utils.ValidateCatalog(catalog); err != nil {
+			return nil, err
+		}
+	}
+	detailer, ok := c.idx.(index.CatalogDetailer)
+	if !ok {
+		return nil, fmt.Errorf("stats: %w", ErrIndexNotSupported)
+	}
+	details, err := detailer.CatalogDetails(ctx, catalogs)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]CatalogStats, len(details))
+	for i, d := range details {
+		out[i].CatalogDetail = d
+	}
+	if err := c.memoFootprint(ctx, out); err != nil {
+		return out, fmt.Errorf("memo footprint: %w", err)
+	}
+	return out, nil
+}
+
+// TopCatalogs scans every catalog (IterateCatalogs) and returns the Stats
+// of the n largest by the given measure, largest first, ties in name order
+// — the catalogs to snapshot, Compact or look into before reads of them
+// trip ListLargeBacklog. The ranking uses the scan's numbers, so the
+// returned Stats, read afterwards, may differ slightly. TopByBacklog and
+// TopByDeltas rank on the scan's own counts; TopByDeltaBytes also reads
+// the details of every catalog, one more pipelined round-trip pair per
+// page.
+func (c *Client) TopCatalogs(ctx context.Context, by TopBy, n int) ([]CatalogStats, error) {
+	if by < TopByBacklog || by > TopByDeltaBytes {
+		return nil, fmt.Errorf("invalid TopBy: %d", by)
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("top catalogs: n must be positive, got %d", n)
+	}
+	detailer, ok := c.idx.(index.CatalogDetailer)
+	if !ok {
+		return nil, fmt.Errorf("top catalogs: %w", ErrIndexNotSupported)
+	}
+
+	type ranked struct {
+		catalog string
+		value   int64
+	}
+	var top []ranked // descending value, then ascending name
+	keep := func(catalog string, value int64) {
+		i, _ := slices.BinarySearchFunc(top, ranked{catalog, value}, func(a, b ranked) int {
+			return cmp.Or(cmp.Compare(b.value, a.value), strings.Compare(a.catalog, b.catalog))
+		})
+		if i < n {
+			top = slices.Insert(top, i, ranked{catalog, value})
+			top = top[:min(len(top), n)]
+		}
+	}
+	var page []string
+	flush := func() error {
+		details, err := detailer.CatalogDetails(ctx, page)
+		if err != nil {
+			return err
+		}
+		for i := range details {
+			keep(details[i].Catalog, details[i].DeltaBytes)
+		}
+		page = page[:0]
+		return nil
+	}
+	var ferr error
+	err := c.IterateCatalogs(ctx, CatalogFilter{}, func(st CatalogInfo) bool {
+		switch by {
+		case TopByBacklog:
+			keep(st.Catalog, st.Backlog)
+			return true
+		case TopByDeltas:
+			keep(st.Catalog, st.Deltas)
+			return true
+		}
+		if page = append(page, st.Catalog); len(page) == topDetailPage {
+			ferr = flush()
+		}
+		return ferr == nil
+	})
+	if err == nil && ferr == nil && len(page) > 0 {
+		ferr = flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	names := make([]string, len(top))
+	for i, r := range top {
+		names[i] = r.catalog
+	}
+	return c.Stats(ctx, names...)
+}
+
+// topDetailPage is how many catalogs TopByDeltaBytes details per call.
+const topDetailPage = 500
+
+// memoFootprint fills the memo fields of stats: one SCAN of the memo
+// hashes, each page's HSTRLENs in pipelines of at most memoPipeline
+// commands. A no-op without a sample cache.
+func (c *Client) memoFootprint(ctx context.Context, stats []CatalogStats) error {
+	if c.sampleRdb == nil || len(stats) == 0 {
+		return nil
+	}
+	return index.ScanKeys(ctx, c.sampleRdb, c.keys.SampleKeyPattern(), 256, func(keys []string) (bool, error) {
+		step := max(1, memoPipeline/len(keys))
+		for chunk := range slices.Chunk(stats, step) {
+			pipe := c.sampleRdb.Pipeline()
+			cmds := make([][]*redis.IntCmd, len(keys))
+			for i, key := range keys {
+				cmds[i] = make([]*redis.IntCmd, len(chunk))
+				for j := range chunk {
+					cmds[i][j] = pipe.HStrLen(ctx, key, chunk[j].Catalog)
+				}
+			}
+			if _, err := pipe.Exec(ctx); err != nil {
+				return false, err
+			}
+			for i := range keys {
+				for j := range chunk {
+					if n := cmds[i][j].Val(); n > 0 {
+						chunk[j].MemoEntries++
+						chunk[j].MemoBytes += n
+					}
+				}
+			}
+		}
+		return true, nil
+	})
+}
+
+// memoPipeline bounds the HSTRLENs memoFootprint queues per round trip.
+const memoPipeline = 4096
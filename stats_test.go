@@ -0,0 +1,94 @@
+package lake
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestStatsTopCatalogs reads per-catalog stats and ranks catalogs on the
+// memory index and on the Redis index in both key layouts; the memo
+// footprint is only there with a sample cache (Redis).
+func TestStatsTopCatalogs(t *testing.T) {
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	clients := map[string]func(t *testing.T) *Client{
+		"memory": func(*testing.T) *Client { return NewWithIndex("edge", NewMemoryIndex(), resolve) },
+	}
+	for name, layout := range map[string]KeyLayout{"redis-global": KeyLayoutGlobal, "redis-cluster": KeyLayoutCluster} {
+		clients[name] = func(t *testing.T) *Client {
+			rdb := redisTestDB(t, 13)
+			prefix := testPrefix(t)
+			cleanupKeys(t, rdb, prefix+":*")
+			return New(prefix, rdb, resolve, WithKeyLayout(layout))
+		}
+	}
+	ctx := context.Background()
+	for name, newClient := range clients {
+		t.Run(name, func(t *testing.T) {
+			c := newClient(t)
+			defer c.Close()
+			write := func(catalog string, n int) {
+				t.Helper()
+				for range n {
+					h, err := c.WriteBegin(ctx, WriteBeginRequest{
+						Catalog: catalog, Path: "/a", MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+					})
+					if err != nil {
+						t.Fatalf("WriteBegin: %v", err)
+					}
+					if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(`1`)); err != nil {
+						t.Fatalf("upload: %v", err)
+					}
+					if err := c.WriteNotify(ctx, h); err != nil {
+						t.Fatalf("WriteNotify: %v", err)
+					}
+				}
+			}
+			write("small", 1)
+			write("big", 5)
+			write("mid", 3)
+			counter := NewSampler("count", func(l *ListResult) (int, error) { return len(l.Entries), nil })
+			if _, err := counter.Sample(ctx, c.List(ctx, "big")); err != nil {
+				t.Fatalf("Sample: %v", err)
+			}
+
+			stats, err := c.Stats(ctx, "big", "nope")
+			if err != nil || len(stats) != 2 {
+				t.Fatalf("Stats = %+v (err=%v)", stats, err)
+			}
+			big := stats[0]
+			if big.Catalog != "big" || big.Deltas != 5 || big.Backlog != 5 || big.Newest.Score() <= big.Oldest.Score() ||
+				big.RemoveGen != "0" || big.DeltaBytes <= 0 {
+				t.Fatalf("big = %+v", big)
+			}
+			if wantMemo := c.sampleRdb != nil; wantMemo != (big.MemoEntries == 1 && big.MemoBytes > 0) {
+				t.Fatalf("big memo = %d entries, %d bytes", big.MemoEntries, big.MemoBytes)
+			}
+			if nope := stats[1]; nope.Deltas != 0 || nope.Snap != nil || nope.MemoEntries != 0 {
+				t.Fatalf("nope = %+v", nope)
+			}
+			if _, err := c.Stats(ctx, "bad:name"); err == nil {
+				t.Fatal("Stats accepted an invalid catalog")
+			}
+
+			for _, by := range []TopBy{TopByBacklog, TopByDeltas, TopByDeltaBytes} {
+				top, err := c.TopCatalogs(ctx, by, 2)
+				if err != nil || len(top) != 2 || top[0].Catalog != "big" || top[1].Catalog != "mid" {
+					t.Fatalf("TopCatalogs(%d) = %+v (err=%v)", by, top, err)
+				}
+			}
+			if _, err := c.TopCatalogs(ctx, TopByDeltas, 0); err == nil {
+				t.Fatal("TopCatalogs accepted n = 0")
+			}
+			if _, err := c.TopCatalogs(ctx, TopBy(9), 1); err == nil || errors.Is(err, ErrIndexNotSupported) {
+				t.Fatalf("TopCatalogs(9) err = %v", err)
+			}
+		})
+	}
+}
@@ -6,8 +6,9 @@
 //
 // Wrap adds read-through caching on Get and write-through warming on Put — the
 // latter is why a freshly saved snapshot is served from cache on the next read
-// instead of a cold object-store round-trip. Presign capability is passed
-// through unchanged and never cached.
+// instead of a cold object-store round-trip. The backend's optional
+// capabilities (presign, stat, list, delete) are passed through unchanged and
+// never cached; a Delete also evicts the object's cached copy.
 package cached
 
 import "context"
@@ -20,6 +21,26 @@ type Cache interface {
 	Set(ctx context.Context, namespace, key string, data []byte) error
 }
 
+// Deleter is an optional Cache capability: evict one entry. Wrap uses it to
+// invalidate on storage Delete. Evicting a missing entry is not an error.
+type Deleter interface {
+	Delete(ctx context.Context, namespace, key string) error
+}
+
+// CacheStats is a snapshot of a cache's counters since construction. Hits
+// and Misses count Take lookups (a miss is a Take that had to run its
+// loader path). Evictions and Bytes are reported only by caches that manage
+// their own memory (a bounded MemoryCache); others leave them 0.
+type CacheStats struct {
+	Hits, Misses, Evictions, Bytes int64
+}
+
+// StatsReporter is an optional Cache capability: report counters. All
+// built-in caches implement it.
+type StatsReporter interface {
+	Stats() CacheStats
+}
+
 // NoOpCache always invokes the loader and stores nothing. Use it to leave a
 // backend explicitly uncached.
 type NoOpCache struct{}
@@ -31,3 +52,8 @@ func (NoOpCache) Take(_ context.Context, _, _ string, loader func() ([]byte, err
 }
 
 func (NoOpCache) Set(_ context.Context, _, _ string, _ []byte) error { return nil }
+
+func (NoOpCache) Delete(_ context.Context, _, _ string) error { return nil }
+
+// Stats is always zero: NoOpCache keeps no state to count with.
+func (NoOpCache) Stats() CacheStats { return CacheStats{} }
@@ -2,7 +2,10 @@ package cached
 
 import (
 	"context"
+	"fmt"
 
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/internal/storecap"
 	"github.com/hkloudou/lake/v3/storage"
 )
 
@@ -34,28 +37,38 @@ func (s cachedStorage) Put(ctx context.Context, catalog, path string, data []byt
 	return nil
 }
 
-// cachedPresignStorage additionally exposes Presigner when the wrapped backend
-// supports it, so a caching wrapper never hides an object store's presign
-// capability from WriteBegin. Presign mints a URL; it is never cached.
-type cachedPresignStorage struct {
+// deleteStorage is the Deleter a wrapper exposes when the backend has one:
+// delete from the backend, then evict the cached copy so a later Get cannot
+// serve the bytes of a deleted object. Eviction needs a cache implementing
+// Deleter; with one that does not, the stale entry lives until its TTL.
+type deleteStorage struct {
 	cachedStorage
-	presigner storage.Presigner
+	deleter storage.Deleter
 }
 
-func (s cachedPresignStorage) PresignPut(ctx context.Context, catalog, path string, opts storage.PresignOptions) (storage.PresignedUpload, error) {
-	return s.presigner.PresignPut(ctx, catalog, path, opts)
+func (s deleteStorage) Delete(ctx context.Context, catalog, path string) error {
+	if err := s.deleter.Delete(ctx, catalog, path); err != nil {
+		return err
+	}
+	if d, ok := s.cache.(Deleter); ok {
+		return d.Delete(ctx, s.namespace, path)
+	}
+	return nil
 }
 
 // Wrap decorates base with read-through (Get) and write-through (Put) caching
-// under the given namespace. If base implements storage.Presigner the returned
-// Storage does too (delegating, uncached), so `st.(storage.Presigner)` keeps
-// working for object-store backends.
+// under the given namespace. The returned Storage implements exactly the
+// optional capabilities base does, so `st.(storage.Presigner)` and friends
+// keep working through the cache: Presigner, Stater and Lister delegate
+// uncached (they describe the backend, not the bytes); Deleter deletes from
+// base and then evicts the cached copy.
 func Wrap(namespace string, base storage.Storage, cache Cache) storage.Storage {
 	cs := cachedStorage{namespace: namespace, base: base, cache: cache}
-	if p, ok := base.(storage.Presigner); ok {
-		return cachedPresignStorage{cachedStorage: cs, presigner: p}
+	caps := storecap.Of(base)
+	if caps.Deleter != nil {
+		caps.Deleter = deleteStorage{cachedStorage: cs, deleter: caps.Deleter}
 	}
-	return cs
+	return storecap.Wrap(cs, caps)
 }
 
 // Resolver wraps every Storage that inner returns with the cache chosen by
@@ -88,6 +101,34 @@ func Resolver(inner storage.Resolver, policy func(kind storage.Kind, provider, b
 		if c == nil {
 			return base, nil
 		}
-		return Wrap(provider+"|"+bucket, base, c), nil
+		return Wrap(namespace(provider, bucket), base, c), nil
 	}
 }
+
+// Invalidate evicts the object at uri ("provider://bucket/path", e.g. a
+// catalog's LatestSnap.URI) from the cache that policy — the same function
+// given to Resolver — routes (kind, provider, bucket) to. Use it after
+// repairing an object out of band, so readers stop being served the bad
+// bytes before the TTL would drop them. An uncached backend (nil policy
+// result) is a no-op; a cache without Deleter is an error.
+func Invalidate(ctx context.Context, policy func(kind storage.Kind, provider, bucket string) Cache, kind storage.Kind, uri string) error {
+	provider, bucket, path, err := objkey.ParseURI(uri)
+	if err != nil {
+		return err
+	}
+	if policy == nil {
+		return nil
+	}
+	c := policy(kind, provider, bucket)
+	if c == nil {
+		return nil
+	}
+	d, ok := c.(Deleter)
+	if !ok {
+		return fmt.Errorf("cached: %T cannot evict %s", c, uri)
+	}
+	return d.Delete(ctx, namespace(provider, bucket), path)
+}
+
+// namespace is the cache namespace Resolver gives a backend.
+func namespace(provider, bucket string) string { return provider + "|" + bucket }
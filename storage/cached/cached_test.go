@@ -2,6 +2,7 @@ package cached
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
 )
 
 // countingStore is a minimal in-memory storage.Storage that counts Get/Put so a
@@ -117,6 +119,39 @@ func TestWrap_PresignPassthrough(t *testing.T) {
 	}
 }
 
+// TestWrap_DeleteInvalidatesCache: Stat/List/Delete pass through, and a
+// Delete evicts the cached copy — a Get after it must reach the backend and
+// see the object gone, not the cached bytes.
+func TestWrap_DeleteInvalidatesCache(t *testing.T) {
+	w := Wrap("mem|b", mem.New().Bucket("b"), NewMemoryCache(time.Minute))
+	ctx := context.Background()
+	if _, ok := w.(storage.Presigner); ok {
+		t.Fatal("mem has no presign; the wrapper must not fabricate it")
+	}
+	st, ok1 := w.(storage.Stater)
+	ls, ok2 := w.(storage.Lister)
+	del, ok3 := w.(storage.Deleter)
+	if !ok1 || !ok2 || !ok3 {
+		t.Fatalf("wrapper hides capabilities: stat=%v list=%v delete=%v", ok1, ok2, ok3)
+	}
+
+	if err := w.Put(ctx, "users", "a/1.snap", []byte("one")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if info, err := st.Stat(ctx, "users", "a/1.snap"); err != nil || info.Size != 3 {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+	if objs, _, err := ls.List(ctx, "users", "a/", ""); err != nil || len(objs) != 1 {
+		t.Fatalf("List = %+v, %v", objs, err)
+	}
+	if err := del.Delete(ctx, "users", "a/1.snap"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := w.Get(ctx, "users", "a/1.snap"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Get after Delete: err=%v, want ErrNotFound (stale cache served?)", err)
+	}
+}
+
 // TestResolver_PolicyRoutesCache verifies the combinator wraps only when policy
 // returns a non-nil cache, leaving other backends untouched.
 func TestResolver_PolicyRoutesCache(t *testing.T) {
@@ -195,3 +230,145 @@ func TestMemoryCache_CopiesValues(t *testing.T) {
 		t.Fatalf("cache hit returned internal mutable slice: got %q", got)
 	}
 }
+
+// TestMemoryCacheWithLimit_EvictsLRU: past the byte budget the least
+// recently USED entry goes, not the oldest written; oversized entries are
+// never stored; the counters add up.
+func TestMemoryCacheWithLimit_EvictsLRU(t *testing.T) {
+	ctx := context.Background()
+	// Each entry is "ns:k?" (5) + 10 bytes = 15; three fit in 45.
+	c := NewMemoryCacheWithLimit(45, time.Minute)
+	defer c.Close()
+	val := []byte("0123456789")
+	for _, k := range []string{"k1", "k2", "k3"} {
+		_ = c.Set(ctx, "ns", k, val)
+	}
+	if st := c.Stats(); st.Bytes != 45 || st.Evictions != 0 {
+		t.Fatalf("stats = %+v, want 45 bytes, 0 evictions", st)
+	}
+	var loads int
+	load := func() ([]byte, error) { loads++; return val, nil }
+	_, _ = c.Take(ctx, "ns", "k1", load) // k1 becomes most recently used
+	_ = c.Set(ctx, "ns", "k4", val)      // evicts k2, the LRU entry
+
+	// k2 last: reloading it evicts another entry.
+	for _, tc := range []struct {
+		key      string
+		wantLoad bool
+	}{{"k1", false}, {"k3", false}, {"k4", false}, {"k2", true}} {
+		loads = 0
+		_, _ = c.Take(ctx, "ns", tc.key, load)
+		if (loads == 1) != tc.wantLoad {
+			t.Errorf("%s: loaded=%v, want %v", tc.key, loads == 1, tc.wantLoad)
+		}
+	}
+	if st := c.Stats(); st.Evictions < 1 || st.Bytes > 45 {
+		t.Fatalf("stats = %+v: want at least one eviction and bytes within budget", st)
+	}
+
+	// An entry bigger than the budget bypasses the cache and evicts nothing.
+	before := c.Stats()
+	loads = 0
+	big := func() ([]byte, error) { loads++; return make([]byte, 100), nil }
+	_, _ = c.Take(ctx, "ns", "big", big)
+	_, _ = c.Take(ctx, "ns", "big", big)
+	after := c.Stats()
+	if loads != 2 || after.Evictions != before.Evictions || after.Bytes != before.Bytes {
+		t.Fatalf("oversized entry cached or evicted others: loads=%d before=%+v after=%+v", loads, before, after)
+	}
+	if after.Misses != before.Misses+2 {
+		t.Fatalf("misses = %d, want %d", after.Misses, before.Misses+2)
+	}
+}
+
+func TestMemoryCacheWithLimit_AccountsOverwriteAndDelete(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCacheWithLimit(1000, time.Minute)
+	defer c.Close()
+	_ = c.Set(ctx, "ns", "k", make([]byte, 10))
+	_ = c.Set(ctx, "ns", "k", make([]byte, 20)) // overwrite replaces the charge
+	if got := c.Stats().Bytes; got != int64(len("ns:k")+20) {
+		t.Fatalf("bytes after overwrite = %d, want %d", got, len("ns:k")+20)
+	}
+	_ = c.Delete(ctx, "ns", "k")
+	if got := c.Stats(); got.Bytes != 0 || got.Evictions != 0 {
+		t.Fatalf("stats after Delete = %+v, want 0 bytes, 0 evictions", got)
+	}
+}
+
+// TestInvalidate_EvictsThroughPolicy: an object repaired out of band keeps
+// being served from cache until Invalidate evicts it from the cache its
+// Resolver routes to.
+func TestInvalidate_EvictsThroughPolicy(t *testing.T) {
+	ctx := context.Background()
+	store := mem.New()
+	snapCache := NewMemoryCache(time.Minute)
+	defer snapCache.Close()
+	policy := func(kind storage.Kind, _, _ string) Cache {
+		if kind == storage.Snap {
+			return snapCache
+		}
+		return nil
+	}
+	resolve := Resolver(func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return store.Bucket(bucket), nil
+	}, policy)
+	s, _ := resolve(storage.Snap, "mem", "snaps")
+	_ = s.Put(ctx, "users", "a/1.snap", []byte("bad"))
+	_ = store.Bucket("snaps").Put(ctx, "users", "a/1.snap", []byte("fixed")) // the repair
+
+	if got, _ := s.Get(ctx, "users", "a/1.snap"); string(got) != "bad" {
+		t.Fatalf("Get = %q, want the cached bytes before Invalidate", got)
+	}
+	if err := Invalidate(ctx, policy, storage.Snap, "mem://snaps/a/1.snap"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := s.Get(ctx, "users", "a/1.snap"); string(got) != "fixed" {
+		t.Fatalf("Get = %q after Invalidate, want the repaired bytes", got)
+	}
+	if st := snapCache.Stats(); st.Hits != 1 || st.Misses != 1 {
+		t.Fatalf("stats = %+v, want 1 hit, 1 miss", st)
+	}
+
+	// Uncached kinds are a no-op; malformed URIs and non-evicting caches fail.
+	if err := Invalidate(ctx, policy, storage.Delta, "mem://snaps/a/1.snap"); err != nil {
+		t.Fatalf("uncached kind: %v", err)
+	}
+	if err := Invalidate(ctx, policy, storage.Snap, "not-a-uri"); err == nil {
+		t.Fatal("malformed URI accepted")
+	}
+	takeOnly := func(storage.Kind, string, string) Cache { return struct{ Cache }{NewNoOpCache()} }
+	if err := Invalidate(ctx, takeOnly, storage.Snap, "mem://snaps/a/1.snap"); err == nil {
+		t.Fatal("cache without Deleter reported success")
+	}
+}
+
+func TestCaches_ReportStats(t *testing.T) {
+	for name, c := range map[string]Cache{
+		"noop":   NewNoOpCache(),
+		"memory": NewMemoryCache(time.Minute),
+		"tiered": NewTieredCache(NewMemoryCache(time.Minute), NewMemoryCache(time.Minute)),
+		"redis":  NewRedisCache(nil, time.Minute),
+	} {
+		if _, ok := c.(StatsReporter); !ok {
+			t.Errorf("%s cache does not implement StatsReporter", name)
+		}
+		if _, ok := c.(Deleter); !ok {
+			t.Errorf("%s cache does not implement Deleter", name)
+		}
+	}
+
+	ctx := context.Background()
+	l1, l2 := NewMemoryCache(time.Minute), NewMemoryCache(time.Minute)
+	defer l1.Close()
+	defer l2.Close()
+	tc := NewTieredCache(l1, l2)
+	_ = l2.Set(ctx, "ns", "shared", []byte("x"))
+	load := func() ([]byte, error) { return []byte("y"), nil }
+	_, _ = tc.Take(ctx, "ns", "shared", load) // L2 hit
+	_, _ = tc.Take(ctx, "ns", "shared", load) // L1 hit
+	_, _ = tc.Take(ctx, "ns", "cold", load)   // loader
+	if st := tc.Stats(); st.Hits != 2 || st.Misses != 1 {
+		t.Fatalf("tiered stats = %+v, want 2 hits, 1 miss", st)
+	}
+}
@@ -1,40 +1,78 @@
 package cached
 
 import (
+	"container/list"
 	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hkloudou/lake/v3/internal/xsync"
 )
 
-// MemoryCache is a process-local TTL cache. The background cleanup
-// loop runs until Close (or process exit).
+// MemoryCache is a process-local TTL cache, optionally bounded in bytes
+// (NewMemoryCacheWithLimit). The background cleanup loop runs until Close
+// (or process exit).
 type MemoryCache struct {
 	mu        sync.RWMutex
-	data      map[string]cacheEntry
+	data      map[string]*cacheEntry
 	ttl       time.Duration
 	flight    xsync.SingleFlight[[]byte]
 	done      chan struct{}
 	closeOnce sync.Once
+
+	// Byte budget; maxBytes == 0 is unbounded and leaves lru unused.
+	maxBytes int64
+	lru      *list.List // of string keys, most recently used first
+
+	hits, misses, evictions, bytes atomic.Int64
 }
 
 type cacheEntry struct {
 	value      []byte
 	expireTime time.Time
+	elem       *list.Element // position in lru; nil when unbounded
 }
 
+// entrySize is what an entry is charged against the byte budget.
+func entrySize(key string, value []byte) int64 { return int64(len(key) + len(value)) }
+
 func NewMemoryCache(ttl time.Duration) *MemoryCache {
+	return NewMemoryCacheWithLimit(0, ttl)
+}
+
+// NewMemoryCacheWithLimit is NewMemoryCache bounded to about maxBytes of
+// keys plus values: storing past the budget evicts least-recently-used
+// entries first, and a single entry larger than the whole budget is not
+// cached at all (its reads go to the loader every time). maxBytes <= 0 is
+// unbounded.
+func NewMemoryCacheWithLimit(maxBytes int64, ttl time.Duration) *MemoryCache {
 	c := &MemoryCache{
-		data:   make(map[string]cacheEntry),
-		ttl:    ttl,
-		flight: xsync.NewSingleFlight[[]byte](),
-		done:   make(chan struct{}),
+		data:     make(map[string]*cacheEntry),
+		ttl:      ttl,
+		flight:   xsync.NewSingleFlight[[]byte](),
+		done:     make(chan struct{}),
+		maxBytes: max(maxBytes, 0),
+	}
+	if c.maxBytes > 0 {
+		c.lru = list.New()
 	}
 	go c.cleanupLoop()
 	return c
 }
 
+// Stats returns the cache's counters. Evictions counts entries dropped to
+// stay within the byte budget (not TTL expiry, not Delete); Bytes is the
+// current charged size (keys plus values).
+func (c *MemoryCache) Stats() CacheStats {
+	return CacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Evictions: c.evictions.Load(),
+		Bytes:     c.bytes.Load(),
+	}
+}
+
 // Close stops the background cleanup loop. Idempotent. The cache keeps
 // working after Close; expired entries are then reclaimed lazily on access.
 func (c *MemoryCache) Close() { c.closeOnce.Do(func() { close(c.done) }) }
@@ -50,8 +88,10 @@ func (c *MemoryCache) Close() { c.closeOnce.Do(func() { close(c.done) }) }
 func (c *MemoryCache) Take(ctx context.Context, namespace, key string, loader func() ([]byte, error)) ([]byte, error) {
 	cacheKey := namespace + ":" + key
 	if v, ok := c.lookup(cacheKey); ok {
+		c.hits.Add(1)
 		return append([]byte(nil), v...), nil
 	}
+	c.misses.Add(1)
 	return takeWithRetry(ctx, c.flight, cacheKey, func(bool) ([]byte, error) {
 		// Re-check inside the flight (a map lookup — free, unlike a network
 		// probe): a just-finished leader may have filled the entry while
@@ -69,15 +109,26 @@ func (c *MemoryCache) Take(ctx context.Context, namespace, key string, loader fu
 }
 
 // lookup returns the stored (shared) slice — callers must copy before
-// handing it out.
+// handing it out. Unbounded caches look up under the read lock; bounded ones
+// take the write lock to mark the entry most recently used.
 func (c *MemoryCache) lookup(cacheKey string) ([]byte, bool) {
-	c.mu.RLock()
+	if c.lru == nil {
+		c.mu.RLock()
+		e, ok := c.data[cacheKey]
+		c.mu.RUnlock()
+		if ok && time.Now().Before(e.expireTime) {
+			return e.value, true
+		}
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	e, ok := c.data[cacheKey]
-	c.mu.RUnlock()
-	if ok && time.Now().Before(e.expireTime) {
-		return e.value, true
+	if !ok || !time.Now().Before(e.expireTime) {
+		return nil, false
 	}
-	return nil, false
+	c.lru.MoveToFront(e.elem)
+	return e.value, true
 }
 
 // Set writes data through to the cache (write-through warming).
@@ -86,11 +137,46 @@ func (c *MemoryCache) Set(_ context.Context, namespace, key string, data []byte)
 	return nil
 }
 
-func (c *MemoryCache) store(cacheKey string, data []byte) {
-	cp := append([]byte(nil), data...)
+// Delete evicts one entry.
+func (c *MemoryCache) Delete(_ context.Context, namespace, key string) error {
 	c.mu.Lock()
-	c.data[cacheKey] = cacheEntry{value: cp, expireTime: time.Now().Add(c.ttl)}
+	c.remove(namespace + ":" + key)
 	c.mu.Unlock()
+	return nil
+}
+
+func (c *MemoryCache) store(cacheKey string, data []byte) {
+	size := entrySize(cacheKey, data)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(cacheKey)
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return // oversized: would evict everything else and still not fit
+	}
+	e := &cacheEntry{value: append([]byte(nil), data...), expireTime: time.Now().Add(c.ttl)}
+	if c.lru != nil {
+		e.elem = c.lru.PushFront(cacheKey)
+	}
+	c.data[cacheKey] = e
+	c.bytes.Add(size)
+	for c.maxBytes > 0 && c.bytes.Load() > c.maxBytes {
+		oldest := c.lru.Back()
+		c.remove(oldest.Value.(string))
+		c.evictions.Add(1)
+	}
+}
+
+// remove drops one entry and its accounting; c.mu must be held.
+func (c *MemoryCache) remove(cacheKey string) {
+	e, ok := c.data[cacheKey]
+	if !ok {
+		return
+	}
+	delete(c.data, cacheKey)
+	if e.elem != nil {
+		c.lru.Remove(e.elem)
+	}
+	c.bytes.Add(-entrySize(cacheKey, e.value))
 }
 
 // cleanupLoop sweeps expired entries every minute until Close.
@@ -106,7 +192,7 @@ func (c *MemoryCache) cleanupLoop() {
 			c.mu.Lock()
 			for k, e := range c.data {
 				if now.After(e.expireTime) {
-					delete(c.data, k)
+					c.remove(k)
 				}
 			}
 			c.mu.Unlock()
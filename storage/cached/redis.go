@@ -3,6 +3,7 @@ package cached
 import (
 	"context"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/hkloudou/lake/v3/internal/encode"
@@ -13,12 +14,14 @@ import (
 // RedisCache is a Redis-backed Cache. Values are gzip-compressed (a space
 // optimization, not encryption — the cache holds only rebuildable data).
 type RedisCache struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ttl    time.Duration
 	flight xsync.SingleFlight[[]byte]
+
+	hits, misses atomic.Int64
 }
 
-func NewRedisCache(client *redis.Client, ttl time.Duration) *RedisCache {
+func NewRedisCache(client redis.UniversalClient, ttl time.Duration) *RedisCache {
 	return &RedisCache{
 		client: client,
 		ttl:    ttl,
@@ -53,9 +56,11 @@ func (c *RedisCache) Take(ctx context.Context, namespace, key string, loader fun
 		// A value that fails to decompress (foreign / legacy format) is
 		// treated as a miss and recomputed below.
 		if data, derr := gunzip(raw); derr == nil {
+			c.hits.Add(1)
 			return data, nil
 		}
 	}
+	c.misses.Add(1)
 	cacheDown := err != nil && err != redis.Nil
 
 	return takeWithRetry(ctx, c.flight, cacheKey, func(retry bool) ([]byte, error) {
@@ -87,6 +92,19 @@ func (c *RedisCache) Set(ctx context.Context, namespace, key string, data []byte
 	return nil
 }
 
+// Delete evicts one entry. Unlike Set it reports a cache-Redis failure: a
+// caller evicting stale bytes needs to know they may still be served.
+func (c *RedisCache) Delete(ctx context.Context, namespace, key string) error {
+	return c.client.Del(ctx, c.cacheKey(namespace, key)).Err()
+}
+
+// Stats reports this process's Take hits and misses (a cache-Redis error
+// counts as a miss). The shared Redis's own memory and evictions are
+// visible through INFO, not here.
+func (c *RedisCache) Stats() CacheStats {
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
 // write gzips and stores best-effort: a cache-write failure is logged, never
 // surfaced — the cache holds only rebuildable data.
 func (c *RedisCache) write(ctx context.Context, cacheKey string, data []byte) {
@@ -0,0 +1,74 @@
+package cached
+
+import (
+	"context"
+	"errors"
+)
+
+// TieredCache layers a fast cache (typically a process-local MemoryCache)
+// over a shared one (typically a RedisCache): reads try L1, then L2, then
+// the loader, filling L1 from every L2 hit; writes go through both.
+//
+// Single flight spans both tiers because the tiers nest — L2's Take is L1's
+// loader — so concurrent misses on one key in one process make at most one
+// L2 round-trip, and L2's own flight still collapses the loader calls
+// behind it.
+//
+// Each pod's L1 is private: an entry evicted or rewritten elsewhere can be
+// served from another pod's L1 until its TTL passes. Keep the L1 TTL short
+// (seconds to minutes) — it is a bandwidth saver for hot keys, not the
+// cache of record.
+type TieredCache struct {
+	l1, l2 Cache
+}
+
+func NewTieredCache(l1, l2 Cache) *TieredCache { return &TieredCache{l1: l1, l2: l2} }
+
+// Take reads L1, then L2, then loader. An L2 hit or a loaded value is stored
+// in L1 by L1's own miss path; a loaded value is stored in L2 by L2's.
+func (c *TieredCache) Take(ctx context.Context, namespace, key string, loader func() ([]byte, error)) ([]byte, error) {
+	return c.l1.Take(ctx, namespace, key, func() ([]byte, error) {
+		return c.l2.Take(ctx, namespace, key, loader)
+	})
+}
+
+// Set writes data through to both tiers, L2 first so L1 never holds bytes
+// the shared tier was not offered.
+func (c *TieredCache) Set(ctx context.Context, namespace, key string, data []byte) error {
+	return errors.Join(c.l2.Set(ctx, namespace, key, data), c.l1.Set(ctx, namespace, key, data))
+}
+
+// Delete evicts from every tier that implements Deleter, L2 first: evicting
+// L1 first would let a concurrent Take refill it from a still-stale L2.
+func (c *TieredCache) Delete(ctx context.Context, namespace, key string) error {
+	var errs []error
+	for _, t := range []Cache{c.l2, c.l1} {
+		if d, ok := t.(Deleter); ok {
+			errs = append(errs, d.Delete(ctx, namespace, key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stats sums the tiers that implement StatsReporter. An L1 miss is an L2
+// lookup, so Hits counts reads served by either tier and Misses the reads
+// that reached the loader — as L2 counts them. When L2 reports no stats,
+// Misses falls back to L1's: the reads that reached L2, not the loader.
+func (c *TieredCache) Stats() CacheStats {
+	var st CacheStats
+	l1, ok1 := c.l1.(StatsReporter)
+	l2, ok2 := c.l2.(StatsReporter)
+	if ok1 {
+		s := l1.Stats()
+		st.Hits, st.Misses = s.Hits, s.Misses
+		st.Evictions, st.Bytes = s.Evictions, s.Bytes
+	}
+	if ok2 {
+		s := l2.Stats()
+		st.Hits += s.Hits
+		st.Misses = s.Misses
+		st.Evictions += s.Evictions
+		st.Bytes += s.Bytes
+	}
+	return st
+}
@@ -0,0 +1,103 @@
+package cached
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingCache counts Takes that reach it, so a test can tell which tier
+// served a read.
+type countingCache struct {
+	*MemoryCache
+	takes atomic.Int32
+}
+
+func (c *countingCache) Take(ctx context.Context, namespace, key string, loader func() ([]byte, error)) ([]byte, error) {
+	c.takes.Add(1)
+	return c.MemoryCache.Take(ctx, namespace, key, loader)
+}
+
+func TestTieredCache_FillsL1FromL2(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemoryCache(time.Minute), &countingCache{MemoryCache: NewMemoryCache(time.Minute)}
+	defer l1.Close()
+	defer l2.Close()
+	_ = l2.Set(ctx, "ns", "k", []byte("shared")) // written by another pod
+
+	tc := NewTieredCache(l1, l2)
+	for i := range 3 {
+		v, err := tc.Take(ctx, "ns", "k", func() ([]byte, error) {
+			t.Fatal("loader called despite an L2 hit")
+			return nil, nil
+		})
+		if err != nil || string(v) != "shared" {
+			t.Fatalf("Take #%d = %q, %v", i, v, err)
+		}
+	}
+	if n := l2.takes.Load(); n != 1 {
+		t.Fatalf("L2 takes = %d, want 1 (later reads served by L1)", n)
+	}
+}
+
+func TestTieredCache_SingleFlightAcrossTiers(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemoryCache(time.Minute), &countingCache{MemoryCache: NewMemoryCache(time.Minute)}
+	defer l1.Close()
+	defer l2.Close()
+	tc := NewTieredCache(l1, l2)
+
+	var loads atomic.Int32
+	gate := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			<-gate
+			v, err := tc.Take(ctx, "ns", "k", func() ([]byte, error) {
+				loads.Add(1)
+				time.Sleep(30 * time.Millisecond)
+				return []byte("v"), nil
+			})
+			if err != nil || string(v) != "v" {
+				t.Errorf("Take = %q, %v", v, err)
+			}
+		})
+	}
+	close(gate)
+	wg.Wait()
+	if loads.Load() != 1 || l2.takes.Load() != 1 {
+		t.Fatalf("loads=%d L2 takes=%d, want 1 and 1", loads.Load(), l2.takes.Load())
+	}
+	// The loaded value landed in L2 too.
+	if v, _ := l2.MemoryCache.Take(ctx, "ns", "k", func() ([]byte, error) { return nil, nil }); string(v) != "v" {
+		t.Fatalf("L2 = %q, want the loaded value", v)
+	}
+}
+
+func TestTieredCache_SetAndDeleteBothTiers(t *testing.T) {
+	ctx := context.Background()
+	l1, l2 := NewMemoryCache(time.Minute), NewMemoryCache(time.Minute)
+	defer l1.Close()
+	defer l2.Close()
+	tc := NewTieredCache(l1, l2)
+	miss := func() ([]byte, error) { return []byte("miss"), nil }
+
+	if err := tc.Set(ctx, "ns", "k", []byte("warm")); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]Cache{"l1": l1, "l2": l2} {
+		if v, _ := c.Take(ctx, "ns", "k", miss); string(v) != "warm" {
+			t.Fatalf("%s = %q after Set, want warm", name, v)
+		}
+	}
+	if err := tc.Delete(ctx, "ns", "k"); err != nil {
+		t.Fatal(err)
+	}
+	for name, c := range map[string]Cache{"l1": l1, "l2": l2} {
+		if v, _ := c.Take(ctx, "ns", "k", miss); string(v) != "miss" {
+			t.Fatalf("%s = %q after Delete, want evicted", name, v)
+		}
+	}
+}
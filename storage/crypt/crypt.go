@@ -0,0 +1,310 @@
+// Package crypt is a client-side encryption-at-rest decorator for any
+// storage.Storage: bodies are AES-256-GCM encrypted before they reach object
+// storage and decrypted after they come back, with keys the embedder
+// controls.
+//
+// Envelope encryption: each catalog gets a random data key (DEK), reused for
+// Options.DataKeyTTL and then rotated; a KeyProvider (a KMS, an HSM, or the
+// built-in NewStaticKeys) wraps the DEK under a key-encryption key. Every
+// object is self-describing — its header carries the catalog, the KEK's key
+// ID and the wrapped DEK — so KEK rotation never re-encrypts old objects
+// and a reader needs nothing but the KeyProvider. The header and the
+// object's path are authenticated with the body: an object opens only as
+// the catalog and path it was sealed for, so a ciphertext copied to another
+// catalog or another object fails as ErrCorrupt.
+//
+// Lake Puts snapshots itself, so Wrap covers them. Deltas are uploaded by
+// clients straight to a presigned URL, past any server-side hook: a client
+// holding the KeyProvider seals the body with Codec.Seal (for the handle's
+// Catalog and Key) before uploading,
+// and the decorator opens it on read. Presign passes through untouched.
+//
+// Compose the decorator OUTSIDE any cache so caches only ever hold
+// ciphertext:
+//
+//	codec := crypt.New(keys, crypt.Options{})
+//	resolve := crypt.Resolver(cached.Resolver(backends, cachePolicy),
+//	    func(storage.Kind, string, string) *crypt.Codec { return codec })
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/storecap"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// KeyProvider wraps and unwraps data keys. catalog is the owning catalog,
+// usable as KMS encryption context; keyID names the key-encryption key and
+// is stored in every envelope, so UnwrapKey must keep accepting retired IDs
+// for as long as objects sealed under them exist.
+type KeyProvider interface {
+	WrapKey(ctx context.Context, catalog string, dataKey []byte) (keyID string, wrapped []byte, err error)
+	UnwrapKey(ctx context.Context, catalog, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Options tunes a Codec.
+type Options struct {
+	// DataKeyTTL is how long one catalog's data key seals new objects
+	// before a fresh one is generated (and wrapped — one KeyProvider call).
+	// Default 1h.
+	DataKeyTTL time.Duration
+	// AllowPlaintext lets Get return objects that carry no envelope as-is —
+	// for catalogs written before encryption was switched on. Off by
+	// default: an unencrypted body is then an error (ErrNotEncrypted).
+	AllowPlaintext bool
+}
+
+var (
+	// ErrNotEncrypted is returned by Open / Get for a body without an
+	// envelope when Options.AllowPlaintext is off.
+	ErrNotEncrypted = errors.New("crypt: object is not encrypted")
+	// ErrCorrupt is returned for an envelope that fails to parse or
+	// authenticate (tampered, truncated, sealed under another key, or for
+	// another catalog or path).
+	ErrCorrupt = errors.New("crypt: envelope corrupt or not authentic")
+)
+
+// magic starts every envelope.
+var magic = []byte("LAKEENC1")
+
+// Codec seals and opens envelopes; one per KeyProvider, safe for concurrent
+// use. It caches data keys in memory (plaintext DEKs never leave the
+// process).
+type Codec struct {
+	kp   KeyProvider
+	opts Options
+
+	mu      sync.Mutex
+	sealing map[string]*dataKey // catalog -> current DEK
+	opened  map[string][]byte   // keyID + "\x00" + wrapped -> DEK
+}
+
+type dataKey struct {
+	aead    cipher.AEAD
+	keyID   string
+	wrapped []byte
+	expires time.Time
+}
+
+// maxOpened bounds the unwrapped-key cache; past it the cache is reset.
+const maxOpened = 4096
+
+// New returns a Codec over kp.
+func New(kp KeyProvider, opts Options) *Codec {
+	if opts.DataKeyTTL <= 0 {
+		opts.DataKeyTTL = time.Hour
+	}
+	return &Codec{kp: kp, opts: opts, sealing: map[string]*dataKey{}, opened: map[string][]byte{}}
+}
+
+// Seal encrypts plaintext for the object at path in catalog. It is also the
+// client-side helper: an uploader holding the KeyProvider seals a delta body
+// with it for the WriteHandle's Catalog and Key before the presigned PUT,
+// and the decorator opens it on read.
+func (c *Codec) Seal(ctx context.Context, catalog, path string, plaintext []byte) ([]byte, error) {
+	dk, err := c.sealKey(ctx, catalog)
+	if err != nil {
+		return nil, err
+	}
+	var hdr bytes.Buffer
+	hdr.Write(magic)
+	writeField(&hdr, []byte(catalog))
+	writeField(&hdr, []byte(dk.keyID))
+	writeField(&hdr, dk.wrapped)
+	nonce := make([]byte, dk.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, hdr.Len()+len(nonce)+len(plaintext)+dk.aead.Overhead())
+	out = append(append(out, hdr.Bytes()...), nonce...)
+	return dk.aead.Seal(out, nonce, plaintext, additionalData(hdr.Bytes(), path)), nil
+}
+
+// Open decrypts the envelope stored at path in catalog. It fails with
+// ErrCorrupt unless the envelope was sealed for that catalog and path: Lake
+// never shares an object between catalogs (Fork writes a new snapshot) nor
+// moves one to another path (Migrate keeps paths).
+func (c *Codec) Open(ctx context.Context, catalog, path string, envelope []byte) ([]byte, error) {
+	if !bytes.HasPrefix(envelope, magic) {
+		if c.opts.AllowPlaintext {
+			return envelope, nil
+		}
+		return nil, fmt.Errorf("%w (catalog %s)", ErrNotEncrypted, catalog)
+	}
+	rest := envelope[len(magic):]
+	sealedFor, rest, ok1 := readField(rest)
+	keyID, rest, ok2 := readField(rest)
+	wrapped, rest, ok3 := readField(rest)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, ErrCorrupt
+	}
+	if string(sealedFor) != catalog {
+		return nil, fmt.Errorf("%w: sealed for catalog %q, not %q", ErrCorrupt, sealedFor, catalog)
+	}
+	hdr := envelope[:len(envelope)-len(rest)]
+	aead, err := c.openKey(ctx, string(sealedFor), string(keyID), wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	nonce, ct := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	pt, err := aead.Open(nil, nonce, ct, additionalData(hdr, path))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return pt, nil
+}
+
+// sealKey returns catalog's current data key, minting (and wrapping) a new
+// one when there is none or it has expired.
+func (c *Codec) sealKey(ctx context.Context, catalog string) (*dataKey, error) {
+	c.mu.Lock()
+	dk := c.sealing[catalog]
+	c.mu.Unlock()
+	if dk != nil && time.Now().Before(dk.expires) {
+		return dk, nil
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := c.kp.WrapKey(ctx, catalog, raw)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: wrap data key: %w", err)
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+	dk = &dataKey{aead: aead, keyID: keyID, wrapped: wrapped, expires: time.Now().Add(c.opts.DataKeyTTL)}
+	c.mu.Lock()
+	c.sealing[catalog] = dk
+	c.remember(keyID, wrapped, raw)
+	c.mu.Unlock()
+	return dk, nil
+}
+
+// openKey unwraps (once, then from cache) the data key of an envelope.
+func (c *Codec) openKey(ctx context.Context, catalog, keyID string, wrapped []byte) (cipher.AEAD, error) {
+	id := keyID + "\x00" + string(wrapped)
+	c.mu.Lock()
+	raw := c.opened[id]
+	c.mu.Unlock()
+	if raw == nil {
+		var err error
+		raw, err = c.kp.UnwrapKey(ctx, catalog, keyID, wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("crypt: unwrap data key (key %s): %w", keyID, err)
+		}
+		c.mu.Lock()
+		c.remember(keyID, wrapped, raw)
+		c.mu.Unlock()
+	}
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return aead, nil
+}
+
+// remember caches an unwrapped key; c.mu must be held.
+func (c *Codec) remember(keyID string, wrapped, raw []byte) {
+	if len(c.opened) >= maxOpened {
+		c.opened = map[string][]byte{}
+	}
+	c.opened[keyID+"\x00"+string(wrapped)] = raw
+}
+
+// additionalData is what the AEAD authenticates besides the body: the
+// header, then the path. The header's fields are length-prefixed, so the
+// path needs no delimiter.
+func additionalData(hdr []byte, path string) []byte {
+	return append(hdr[:len(hdr):len(hdr)], path...)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func writeField(b *bytes.Buffer, f []byte) {
+	b.Write(binary.AppendUvarint(nil, uint64(len(f))))
+	b.Write(f)
+}
+
+func readField(b []byte) (field, rest []byte, ok bool) {
+	n, k := binary.Uvarint(b)
+	if k <= 0 || n > uint64(len(b)-k) {
+		return nil, nil, false
+	}
+	return b[k : k+int(n)], b[k+int(n):], true
+}
+
+// encrypted is the decorator: Put seals, Get opens.
+type encrypted struct {
+	base  storage.Storage
+	codec *Codec
+}
+
+func (e encrypted) Get(ctx context.Context, catalog, path string) ([]byte, error) {
+	data, err := e.base.Get(ctx, catalog, path)
+	if err != nil {
+		return nil, err
+	}
+	pt, err := e.codec.Open(ctx, catalog, path, data)
+	if err != nil {
+		return nil, fmt.Errorf("crypt: %s: %w", path, err)
+	}
+	return pt, nil
+}
+
+func (e encrypted) Put(ctx context.Context, catalog, path string, data []byte) error {
+	sealed, err := e.codec.Seal(ctx, catalog, path, data)
+	if err != nil {
+		return err
+	}
+	return e.base.Put(ctx, catalog, path, sealed)
+}
+
+// Wrap decorates base with codec: Put encrypts, Get decrypts. The returned
+// Storage implements exactly the optional capabilities base does, passed
+// through (Stat reports the stored, encrypted size).
+func Wrap(base storage.Storage, codec *Codec) storage.Storage {
+	return storecap.Wrap(encrypted{base: base, codec: codec}, storecap.Of(base))
+}
+
+// Resolver wraps every Storage that inner returns with the Codec chosen by
+// policy(kind, provider, bucket); a nil Codec leaves that backend
+// unwrapped. Lake never Puts deltas, so a Delta-kind backend only opens what
+// clients sealed.
+func Resolver(inner storage.Resolver, policy func(kind storage.Kind, provider, bucket string) *Codec) storage.Resolver {
+	if policy == nil {
+		return inner
+	}
+	return func(kind storage.Kind, provider, bucket string) (storage.Storage, error) {
+		base, err := inner(kind, provider, bucket)
+		if err != nil {
+			return nil, err
+		}
+		codec := policy(kind, provider, bucket)
+		if codec == nil {
+			return base, nil
+		}
+		return Wrap(base, codec), nil
+	}
+}
@@ -0,0 +1,228 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+func key(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+
+// countingKeys counts KeyProvider calls around a static key set.
+type countingKeys struct {
+	KeyProvider
+	wraps, unwraps atomic.Int32
+}
+
+func (c *countingKeys) WrapKey(ctx context.Context, catalog string, dk []byte) (string, []byte, error) {
+	c.wraps.Add(1)
+	return c.KeyProvider.WrapKey(ctx, catalog, dk)
+}
+
+func (c *countingKeys) UnwrapKey(ctx context.Context, catalog, id string, w []byte) ([]byte, error) {
+	c.unwraps.Add(1)
+	return c.KeyProvider.UnwrapKey(ctx, catalog, id, w)
+}
+
+func newKeys(t *testing.T, active string, keys map[string][]byte) *countingKeys {
+	t.Helper()
+	kp, err := NewStaticKeys(active, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &countingKeys{KeyProvider: kp}
+}
+
+func TestWrap_RoundTripAndCapabilities(t *testing.T) {
+	ctx := t.Context()
+	kp := newKeys(t, "k1", map[string][]byte{"k1": key(1)})
+	raw := mem.New().Bucket("b")
+	s := Wrap(raw, New(kp, Options{}))
+
+	body := []byte(`{"user":{"name":"alice"}}`)
+	if err := s.Put(ctx, "cat", "p/1.snap", body); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "cat", "p/2.snap", body); err != nil {
+		t.Fatal(err)
+	}
+	stored, _ := raw.Get(ctx, "cat", "p/1.snap")
+	if !bytes.HasPrefix(stored, magic) || bytes.Contains(stored, []byte("alice")) {
+		t.Fatalf("stored body is not an envelope: %q", stored)
+	}
+	got, err := s.Get(ctx, "cat", "p/1.snap")
+	if err != nil || !bytes.Equal(got, body) {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+	// One data key per catalog: two Puts, one wrap; opening hits the cache.
+	if w, u := kp.wraps.Load(), kp.unwraps.Load(); w != 1 || u != 0 {
+		t.Fatalf("wraps=%d unwraps=%d, want 1, 0", w, u)
+	}
+	if err := s.Put(ctx, "other", "p/3.snap", body); err != nil {
+		t.Fatal(err)
+	}
+	if kp.wraps.Load() != 2 {
+		t.Fatalf("second catalog reused the first one's data key")
+	}
+
+	for _, c := range []struct {
+		name string
+		ok   bool
+	}{
+		{"Stater", func() bool { _, ok := s.(storage.Stater); return ok }()},
+		{"Lister", func() bool { _, ok := s.(storage.Lister); return ok }()},
+		{"Deleter", func() bool { _, ok := s.(storage.Deleter); return ok }()},
+	} {
+		if !c.ok {
+			t.Errorf("wrapped mem store lost %s", c.name)
+		}
+	}
+	info, err := s.(storage.Stater).Stat(ctx, "cat", "p/1.snap")
+	if err != nil || info.Size != int64(len(stored)) {
+		t.Fatalf("Stat = %+v, %v; want the stored size %d", info, err, len(stored))
+	}
+}
+
+func TestCodec_ClientSealedDelta(t *testing.T) {
+	ctx := t.Context()
+	keys := map[string][]byte{"k1": key(1)}
+	// The uploader and the server are different processes sharing only keys.
+	client := New(newKeys(t, "k1", keys), Options{})
+	raw := mem.New().Bucket("deltas")
+	sealed, err := client.Seal(ctx, "cat", "d/1.json", []byte(`{"n":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := raw.Put(ctx, "cat", "d/1.json", sealed); err != nil { // the presigned PUT
+		t.Fatal(err)
+	}
+	server := newKeys(t, "k1", keys)
+	s := Wrap(raw, New(server, Options{}))
+	for range 3 {
+		got, err := s.Get(ctx, "cat", "d/1.json")
+		if err != nil || string(got) != `{"n":1}` {
+			t.Fatalf("Get = %q, %v", got, err)
+		}
+	}
+	if server.unwraps.Load() != 1 {
+		t.Fatalf("unwraps = %d, want 1 (cached after the first)", server.unwraps.Load())
+	}
+}
+
+func TestCodec_KeyRotationAndDataKeyTTL(t *testing.T) {
+	ctx := t.Context()
+	old := New(newKeys(t, "k1", map[string][]byte{"k1": key(1)}), Options{})
+	env, err := old.Seal(ctx, "cat", "p/1", []byte("v1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp := newKeys(t, "k2", map[string][]byte{"k1": key(1), "k2": key(2)})
+	c := New(kp, Options{DataKeyTTL: time.Millisecond})
+	if got, err := c.Open(ctx, "cat", "p/1", env); err != nil || string(got) != "v1" {
+		t.Fatalf("old object after rotation: %q, %v", got, err)
+	}
+	if _, err := c.Seal(ctx, "cat", "p/1", []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	env2, err := c.Seal(ctx, "cat", "p/1", []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kp.wraps.Load() != 2 {
+		t.Fatalf("wraps = %d, want 2 (data key rotated after TTL)", kp.wraps.Load())
+	}
+	if !bytes.Contains(env2, []byte("k2")) {
+		t.Fatal("new envelope does not name the active key")
+	}
+	// A reader that dropped k1 can no longer open the old object.
+	gone := New(newKeys(t, "k2", map[string][]byte{"k2": key(2)}), Options{})
+	if _, err := gone.Open(ctx, "cat", "p/1", env); err == nil {
+		t.Fatal("opened an object whose key was removed")
+	}
+}
+
+func TestCodec_TamperAndPlaintext(t *testing.T) {
+	ctx := t.Context()
+	c := New(newKeys(t, "k1", map[string][]byte{"k1": key(1)}), Options{})
+	env, err := c.Seal(ctx, "cat", "p/1", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, mut := range map[string]func([]byte) []byte{
+		"body":      func(b []byte) []byte { b[len(b)-1] ^= 1; return b },
+		"truncated": func(b []byte) []byte { return b[:len(magic)+3] },
+		// Rewriting the catalog in the header breaks the key binding.
+		"catalog": func(b []byte) []byte { return bytes.Replace(b, []byte("cat"), []byte("dog"), 1) },
+	} {
+		_, err := c.Open(ctx, "cat", "p/1", mut(bytes.Clone(env)))
+		if err == nil {
+			t.Errorf("%s: tampered envelope opened", name)
+		}
+	}
+	if _, err := c.Open(ctx, "cat", "p/1", env[:len(env)-1]); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("truncated tag: %v, want ErrCorrupt", err)
+	}
+	// The envelope is bound to where it was sealed for: another catalog or
+	// another object does not open it, whichever catalog the header names.
+	if _, err := c.Open(ctx, "dog", "p/1", env); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("other catalog: %v, want ErrCorrupt", err)
+	}
+	if _, err := c.Open(ctx, "cat", "p/2", env); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("other path: %v, want ErrCorrupt", err)
+	}
+	dog, err := c.Seal(ctx, "dog", "p/1", []byte("other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Open(ctx, "cat", "p/1", dog); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("another catalog's envelope: %v, want ErrCorrupt", err)
+	}
+
+	if _, err := c.Open(ctx, "cat", "p/1", []byte(`{"plain":1}`)); !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("plaintext: %v, want ErrNotEncrypted", err)
+	}
+	lax := New(newKeys(t, "k1", map[string][]byte{"k1": key(1)}), Options{AllowPlaintext: true})
+	if got, err := lax.Open(ctx, "cat", "p/1", []byte(`{"plain":1}`)); err != nil || string(got) != `{"plain":1}` {
+		t.Fatalf("AllowPlaintext: %q, %v", got, err)
+	}
+}
+
+func TestResolver_Policy(t *testing.T) {
+	ctx := t.Context()
+	store := mem.New()
+	inner := func(_ storage.Kind, _, bucket string) (storage.Storage, error) { return store.Bucket(bucket), nil }
+	c := New(newKeys(t, "k1", map[string][]byte{"k1": key(1)}), Options{})
+	resolve := Resolver(inner, func(kind storage.Kind, _, _ string) *Codec {
+		if kind == storage.Snap {
+			return c
+		}
+		return nil
+	})
+	snap, _ := resolve(storage.Snap, "mem", "b")
+	delta, _ := resolve(storage.Delta, "mem", "b")
+	_ = snap.Put(ctx, "cat", "s", []byte("x"))
+	_ = delta.Put(ctx, "cat", "d", []byte("y"))
+	raw := store.Bucket("b")
+	if s, _ := raw.Get(ctx, "cat", "s"); !bytes.HasPrefix(s, magic) {
+		t.Fatal("snapshot not encrypted")
+	}
+	if d, _ := raw.Get(ctx, "cat", "d"); string(d) != "y" {
+		t.Fatal("delta encrypted despite nil policy result")
+	}
+}
+
+func TestNewStaticKeys_Validates(t *testing.T) {
+	if _, err := NewStaticKeys("k", map[string][]byte{"k": key(1)[:16]}); err == nil {
+		t.Fatal("accepted a 16-byte key")
+	}
+	if _, err := NewStaticKeys("missing", map[string][]byte{"k": key(1)}); err == nil {
+		t.Fatal("accepted an active key not in the set")
+	}
+}
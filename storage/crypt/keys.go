@@ -0,0 +1,60 @@
+package crypt
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// staticKeys is a KeyProvider over key-encryption keys held in memory.
+type staticKeys struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// NewStaticKeys returns a KeyProvider that wraps data keys with AES-256-GCM
+// under local key-encryption keys (32 bytes each), bound to the catalog.
+// New data keys are wrapped under active; every ID in keys stays usable
+// for unwrapping, so rotating is: add a key, make it active, keep the old
+// one until no object sealed under it remains. Fine for tests and
+// single-tenant deployments; use a KMS-backed KeyProvider otherwise.
+func NewStaticKeys(active string, keys map[string][]byte) (KeyProvider, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("crypt: active key %q not in key set", active)
+	}
+	s := staticKeys{active: active, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, k := range keys {
+		if len(k) != 32 {
+			return nil, fmt.Errorf("crypt: key %q: want 32 bytes, got %d", id, len(k))
+		}
+		aead, err := newAEAD(k)
+		if err != nil {
+			return nil, err
+		}
+		s.keys[id] = aead
+	}
+	return s, nil
+}
+
+func (s staticKeys) WrapKey(_ context.Context, catalog string, dataKey []byte) (string, []byte, error) {
+	aead := s.keys[s.active]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return s.active, aead.Seal(nonce, nonce, dataKey, []byte(catalog)), nil
+}
+
+func (s staticKeys) UnwrapKey(_ context.Context, catalog, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := s.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, wrapped[:n], wrapped[n:], []byte(catalog))
+}
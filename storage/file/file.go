@@ -1,20 +1,31 @@
 // Package file is a local-filesystem storage backend for dev / single-node
 // use. A bucket maps to a sub-directory under the base path. It writes via a
-// temp file + atomic rename and does not support presign.
+// temp file + atomic rename and supports stat, list and delete. Presign is
+// opt-in (EnablePresign): URLs point at UploadHandler, which the embedding
+// program serves.
 package file
 
 import (
 	"context"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/hkloudou/lake/v3/internal/urlsign"
 	"github.com/hkloudou/lake/v3/storage"
 )
 
 // FS roots all buckets under BasePath.
-type FS struct{ base string }
+type FS struct {
+	base      string
+	signer    *urlsign.Signer // nil until EnablePresign
+	maxUpload int64           // SetMaxUploadSize; 0 = urlsign.DefaultMaxBody
+}
 
 // New roots the backend at basePath (created if missing).
 func New(basePath string) (*FS, error) {
@@ -28,10 +39,61 @@ func New(basePath string) (*FS, error) {
 	return &FS{base: abs}, nil
 }
 
-// Bucket returns a bucket-scoped Storage (bucket = sub-directory).
+// Bucket returns a bucket-scoped Storage (bucket = sub-directory), also a
+// storage.Presigner once EnablePresign was called.
 func (f *FS) Bucket(name string) storage.Storage {
 	root, err := f.bucketRoot(name)
-	return &view{root: root, err: err}
+	v := &view{root: root, err: err}
+	if f.signer != nil {
+		return &presignView{view: v, signer: f.signer, bucket: name}
+	}
+	return v
+}
+
+// EnablePresign makes the buckets vended from now on implement
+// storage.Presigner: PresignPut mints an HMAC-signed PUT URL under baseURL
+// (e.g. "http://localhost:8080/uploads"), valid for the requested TTL. Serve
+// UploadHandler at baseURL's path so those URLs land. Call it before handing
+// buckets to a Resolver — Lake memoises what the Resolver returns.
+func (f *FS) EnablePresign(baseURL string, secret []byte) error {
+	s, err := urlsign.New(baseURL, secret)
+	if err != nil {
+		return fmt.Errorf("file: %w", err)
+	}
+	f.signer = s
+	return nil
+}
+
+// SetMaxUploadSize caps the body UploadHandler accepts, which it buffers in
+// memory; n ≤ 0 restores the default, 64 MiB. Call it before UploadHandler.
+func (f *FS) SetMaxUploadSize(n int64) {
+	f.maxUpload = n
+}
+
+// UploadHandler serves the URLs PresignPut mints: it verifies signature,
+// expiry and the signed headers (Content-Type, metadata), then writes the
+// body through the bucket's Put — the same atomic temp-file + rename. A body
+// over the SetMaxUploadSize cap is refused with 413. It answers 404 until
+// EnablePresign is called.
+func (f *FS) UploadHandler() http.Handler {
+	if f.signer == nil {
+		return http.NotFoundHandler()
+	}
+	return f.signer.Handler(f.Bucket, f.maxUpload)
+}
+
+// presignView is a bucket of a presign-enabled FS.
+type presignView struct {
+	*view
+	signer *urlsign.Signer
+	bucket string
+}
+
+func (v *presignView) PresignPut(_ context.Context, catalog, path string, opts storage.PresignOptions) (storage.PresignedUpload, error) {
+	if _, err := v.full(path); err != nil {
+		return storage.PresignedUpload{}, err
+	}
+	return v.signer.PresignPut(catalog, v.bucket, path, opts), nil
 }
 
 func (f *FS) bucketRoot(name string) (string, error) {
@@ -73,7 +135,7 @@ func (v *view) Get(_ context.Context, _ /*catalog*/, path string) ([]byte, error
 	data, err := os.ReadFile(full)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("file: not found: %s", path)
+			return nil, fmt.Errorf("file: %s: %w", path, storage.ErrNotFound)
 		}
 		return nil, fmt.Errorf("file: read %s: %w", path, err)
 	}
@@ -116,3 +178,95 @@ func (v *view) Put(_ context.Context, _ /*catalog*/, path string, data []byte) e
 	}
 	return nil
 }
+
+// Delete removes the object; a missing object is not an error. Emptied
+// parent directories are left in place (a later Put recreates them anyway).
+func (v *view) Delete(_ context.Context, _ /*catalog*/, path string) error {
+	full, err := v.full(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("file: delete %s: %w", path, err)
+	}
+	return nil
+}
+
+func (v *view) Stat(_ context.Context, _ /*catalog*/, path string) (storage.ObjectInfo, error) {
+	full, err := v.full(path)
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	fi, err := os.Stat(full)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return storage.ObjectInfo{}, fmt.Errorf("file: %s: %w", path, storage.ErrNotFound)
+		}
+		return storage.ObjectInfo{}, fmt.Errorf("file: stat %s: %w", path, err)
+	}
+	if fi.IsDir() {
+		return storage.ObjectInfo{}, fmt.Errorf("file: %s: %w", path, storage.ErrNotFound)
+	}
+	return storage.ObjectInfo{Path: path, Size: fi.Size(), ModTime: fi.ModTime()}, nil
+}
+
+// listPage bounds one List page.
+const listPage = 1000
+
+// stagingName matches Put's in-flight temp files ("<name>.tmp<random>"),
+// which are not objects and never listed.
+var stagingName = regexp.MustCompile(`\.tmp\d+$`)
+
+// List walks the directory holding prefix and pages through the matching
+// files in path order; the cursor is the last path returned.
+func (v *view) List(_ context.Context, _ /*catalog*/, prefix, cursor string) ([]storage.ObjectInfo, string, error) {
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+	start, err := v.full(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	var out []storage.ObjectInfo
+	err = filepath.WalkDir(start, func(full string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || stagingName.MatchString(d.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(v.root, full)
+		if err != nil {
+			return err
+		}
+		p := filepath.ToSlash(rel)
+		if !strings.HasPrefix(p, prefix) || p <= cursor {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // deleted mid-walk
+			}
+			return err
+		}
+		out = append(out, storage.ObjectInfo{Path: p, Size: fi.Size(), ModTime: fi.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("file: list %q: %w", prefix, err)
+	}
+	// WalkDir orders per directory ("a/b" after "a.x"); pages need global
+	// path order.
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	next := ""
+	if len(out) > listPage {
+		out = out[:listPage]
+		next = out[listPage-1].Path
+	}
+	return out, next, nil
+}
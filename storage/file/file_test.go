@@ -2,10 +2,16 @@ package file
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
 )
 
 func TestFile_RoundTrip(t *testing.T) {
@@ -128,3 +134,104 @@ func TestFile_RejectsEscapingBucket(t *testing.T) {
 		t.Fatalf("canary was modified through escaping bucket: %q", data)
 	}
 }
+
+// TestFile_StatListDelete: List returns exactly the prefixed objects in path
+// order — across directories, without staging temp files — and Delete is
+// idempotent.
+func TestFile_StatListDelete(t *testing.T) {
+	fs, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := fs.Bucket("data")
+	ctx := context.Background()
+	for _, p := range []string{"ab/users/2.dat", "ab/users/1.dat", "ab/users.x/3.dat", "cd/other/4.dat"} {
+		if err := b.Put(ctx, "users", p, []byte(p)); err != nil {
+			t.Fatalf("Put %s: %v", p, err)
+		}
+	}
+	// A crashed Put's staging file is not an object.
+	if err := os.WriteFile(filepath.Join(fs.base, "data", "ab", "users", "5.dat.tmp123"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	objs, next, err := b.(storage.Lister).List(ctx, "users", "ab/users", "")
+	if err != nil || next != "" {
+		t.Fatalf("List: next=%q err=%v", next, err)
+	}
+	var got []string
+	for _, o := range objs {
+		got = append(got, o.Path)
+	}
+	if want := "ab/users.x/3.dat ab/users/1.dat ab/users/2.dat"; strings.Join(got, " ") != want {
+		t.Fatalf("List = %v, want %s", got, want)
+	}
+	if objs, _, _ := b.(storage.Lister).List(ctx, "users", "ab/users/", "ab/users/1.dat"); len(objs) != 1 || objs[0].Path != "ab/users/2.dat" {
+		t.Fatalf("List after cursor = %+v", objs)
+	}
+
+	st := b.(storage.Stater)
+	if info, err := st.Stat(ctx, "users", "ab/users/1.dat"); err != nil || info.Size != int64(len("ab/users/1.dat")) {
+		t.Fatalf("Stat = %+v, %v", info, err)
+	}
+	del := b.(storage.Deleter)
+	for range 2 {
+		if err := del.Delete(ctx, "users", "ab/users/1.dat"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+	}
+	if _, err := st.Stat(ctx, "users", "ab/users/1.dat"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Stat after Delete: %v, want ErrNotFound", err)
+	}
+	if _, err := st.Stat(ctx, "users", "ab/users"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Stat of a directory: %v, want ErrNotFound", err)
+	}
+}
+
+// TestFile_PresignUpload: with EnablePresign, a client holding only the
+// presigned URL and headers uploads through UploadHandler; a bucket vended
+// without it is not a Presigner.
+func TestFile_PresignUpload(t *testing.T) {
+	fs, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.Bucket("data").(storage.Presigner); ok {
+		t.Fatal("presign must be opt-in")
+	}
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	if err := fs.EnablePresign(srv.URL+"/uploads", []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	mux.Handle("/uploads/", fs.UploadHandler())
+
+	b := fs.Bucket("data")
+	up, err := b.(storage.Presigner).PresignPut(context.Background(), "users", "ab/(users/u.dat",
+		storage.PresignOptions{ContentType: "application/json", UserMetadata: map[string]string{"Catalog": "users"}})
+	if err != nil {
+		t.Fatalf("PresignPut: %v", err)
+	}
+	put := func(hdr map[string]string) int {
+		req, _ := http.NewRequest(up.Method, up.URL, strings.NewReader(`{"a":1}`))
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := put(map[string]string{"Content-Type": "application/json"}); code != http.StatusForbidden {
+		t.Fatalf("upload without the signed metadata header: %d, want 403", code)
+	}
+	if code := put(up.Headers); code != http.StatusOK {
+		t.Fatalf("presigned upload: %d", code)
+	}
+	if got, err := b.Get(context.Background(), "users", "ab/(users/u.dat"); err != nil || string(got) != `{"a":1}` {
+		t.Fatalf("Get after upload = %q, %v", got, err)
+	}
+}
@@ -1,25 +1,84 @@
 // Package mem is an in-memory storage backend for tests and local dev.
-// One Store vends many buckets; it does not support presign.
+// One Store vends many buckets; it supports stat, list and delete. Presign is
+// opt-in (EnablePresign): URLs point at UploadHandler, which the embedding
+// program serves.
 package mem
 
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/hkloudou/lake/v3/internal/urlsign"
 	"github.com/hkloudou/lake/v3/storage"
 )
 
 // Store is a process-local object store.
 type Store struct {
 	mu sync.RWMutex
-	m  map[string][]byte // "bucket/path" -> data
+	m  map[string][]byte    // "bucket/path" -> data
+	t  map[string]time.Time // "bucket/path" -> last Put
+
+	signer    *urlsign.Signer // nil until EnablePresign
+	maxUpload int64           // SetMaxUploadSize; 0 = urlsign.DefaultMaxBody
 }
 
-func New() *Store { return &Store{m: map[string][]byte{}} }
+func New() *Store { return &Store{m: map[string][]byte{}, t: map[string]time.Time{}} }
+
+// listPage bounds one List page; small enough that tests exercise paging.
+const listPage = 100
 
 // Bucket returns a bucket-scoped Storage; use it inside a storage.Resolver.
-func (s *Store) Bucket(name string) storage.Storage { return &view{s: s, bucket: name} }
+// It is also a storage.Presigner once EnablePresign was called.
+func (s *Store) Bucket(name string) storage.Storage {
+	v := &view{s: s, bucket: name}
+	if s.signer != nil {
+		return &presignView{view: v, signer: s.signer}
+	}
+	return v
+}
+
+// EnablePresign makes the buckets vended from now on implement
+// storage.Presigner, minting HMAC-signed PUT URLs under baseURL; serve
+// UploadHandler there. See file.FS.EnablePresign.
+func (s *Store) EnablePresign(baseURL string, secret []byte) error {
+	sg, err := urlsign.New(baseURL, secret)
+	if err != nil {
+		return fmt.Errorf("mem: %w", err)
+	}
+	s.signer = sg
+	return nil
+}
+
+// SetMaxUploadSize caps the body UploadHandler accepts; see
+// file.FS.SetMaxUploadSize.
+func (s *Store) SetMaxUploadSize(n int64) {
+	s.maxUpload = n
+}
+
+// UploadHandler serves the URLs PresignPut mints, writing verified uploads
+// through the bucket's Put. A body over the SetMaxUploadSize cap is refused
+// with 413. It answers 404 until EnablePresign is called.
+func (s *Store) UploadHandler() http.Handler {
+	if s.signer == nil {
+		return http.NotFoundHandler()
+	}
+	return s.signer.Handler(s.Bucket, s.maxUpload)
+}
+
+// presignView is a bucket of a presign-enabled Store.
+type presignView struct {
+	*view
+	signer *urlsign.Signer
+}
+
+func (v *presignView) PresignPut(_ context.Context, catalog, path string, opts storage.PresignOptions) (storage.PresignedUpload, error) {
+	return v.signer.PresignPut(catalog, v.bucket, path, opts), nil
+}
 
 type view struct {
 	s      *Store
@@ -35,7 +94,7 @@ func (v *view) Get(_ context.Context, _ /*catalog*/, path string) ([]byte, error
 	data, ok := v.s.m[v.key(path)]
 	v.s.mu.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("mem: not found: %s", v.key(path))
+		return nil, fmt.Errorf("mem: %s: %w", v.key(path), storage.ErrNotFound)
 	}
 	return append([]byte(nil), data...), nil
 }
@@ -44,6 +103,53 @@ func (v *view) Put(_ context.Context, _ /*catalog*/, path string, data []byte) e
 	cp := append([]byte(nil), data...)
 	v.s.mu.Lock()
 	v.s.m[v.key(path)] = cp
+	v.s.t[v.key(path)] = time.Now()
 	v.s.mu.Unlock()
 	return nil
 }
+
+// Delete removes the object; a missing object is not an error.
+func (v *view) Delete(_ context.Context, _ /*catalog*/, path string) error {
+	v.s.mu.Lock()
+	delete(v.s.m, v.key(path))
+	delete(v.s.t, v.key(path))
+	v.s.mu.Unlock()
+	return nil
+}
+
+func (v *view) Stat(_ context.Context, _ /*catalog*/, path string) (storage.ObjectInfo, error) {
+	v.s.mu.RLock()
+	defer v.s.mu.RUnlock()
+	data, ok := v.s.m[v.key(path)]
+	if !ok {
+		return storage.ObjectInfo{}, fmt.Errorf("mem: %s: %w", v.key(path), storage.ErrNotFound)
+	}
+	return storage.ObjectInfo{Path: path, Size: int64(len(data)), ModTime: v.s.t[v.key(path)]}, nil
+}
+
+// List pages in path order; the cursor is the last path returned.
+func (v *view) List(_ context.Context, _ /*catalog*/, prefix, cursor string) ([]storage.ObjectInfo, string, error) {
+	v.s.mu.RLock()
+	defer v.s.mu.RUnlock()
+	full := v.key(prefix)
+	var paths []string
+	for k := range v.s.m {
+		if !strings.HasPrefix(k, full) {
+			continue
+		}
+		if p := strings.TrimPrefix(k, v.bucket+"/"); p > cursor {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	next := ""
+	if len(paths) > listPage {
+		paths = paths[:listPage]
+		next = paths[listPage-1]
+	}
+	out := make([]storage.ObjectInfo, len(paths))
+	for i, p := range paths {
+		out[i] = storage.ObjectInfo{Path: p, Size: int64(len(v.s.m[v.key(p)])), ModTime: v.s.t[v.key(p)]}
+	}
+	return out, next, nil
+}
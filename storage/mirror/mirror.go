@@ -0,0 +1,333 @@
+// Package mirror is a replicating storage.Resolver decorator: objects are
+// written to a primary location and one or more secondaries, and reads fall
+// back to a secondary when the primary fails or lacks the object — so a
+// regional object-store incident degrades Lake instead of failing every read.
+//
+// The index is untouched: every URI Lake records still names the primary
+// (provider, bucket). A Mapping derives the secondaries from it, and the
+// object path is the same in every location.
+//
+//	resolve := mirror.Resolver(backends, mirror.Options{
+//	    Mirror: func(kind storage.Kind, provider, bucket string) []mirror.Target {
+//	        if provider == "oss" {
+//	            return []mirror.Target{{Provider: "oss-backup", Bucket: bucket}}
+//	        }
+//	        return nil
+//	    },
+//	})
+//
+// Snapshots are Put by Lake itself and always mirrored. Deltas are uploaded
+// by clients straight to the primary's presigned URL, which no decorator can
+// fan out: with Deltas set, a delta Put through the Resolver is mirrored, and
+// a delta read from the primary is copied to the secondaries in the
+// background (once per path per process, a bounded number at a time, never
+// after the path was deleted). Bucket-level replication is the stronger
+// guarantee for deltas where the store offers it.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/storecap"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// Target is one mirrored location.
+type Target struct {
+	Provider, Bucket string
+}
+
+// Mapping returns the secondaries of a primary (kind, provider, bucket), in
+// read-fallback order; none means "not mirrored".
+type Mapping func(kind storage.Kind, provider, bucket string) []Target
+
+// Options configures Resolver.
+type Options struct {
+	Mirror Mapping
+	// Deltas mirrors delta objects too (see the package doc for what that
+	// can cover). Snapshots are always mirrored.
+	Deltas bool
+	// CopyConcurrency bounds the background delta copies in flight per
+	// mirrored backend; a read that finds them all busy copies nothing,
+	// and a later read of the path tries again. Default 4.
+	CopyConcurrency int
+	// CopyTimeout bounds one background copy to all secondaries.
+	// Default 1m.
+	CopyTimeout time.Duration
+	// OnError observes secondary failures that do not fail the call: a
+	// mirrored Put or copy that did not land, a fallback read that also
+	// failed. Default: log.
+	OnError func(kind storage.Kind, t Target, path string, err error)
+}
+
+// Resolver wraps inner so every mapped (kind, provider, bucket) resolves to
+// a mirrored Storage. Secondaries are resolved through inner as well, once,
+// together with their primary.
+func Resolver(inner storage.Resolver, opts Options) storage.Resolver {
+	if opts.Mirror == nil {
+		return inner
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(kind storage.Kind, t Target, path string, err error) {
+			log.Printf("[lake mirror] %s %s://%s/%s: %v", kind, t.Provider, t.Bucket, path, err)
+		}
+	}
+	if opts.CopyConcurrency <= 0 {
+		opts.CopyConcurrency = 4
+	}
+	if opts.CopyTimeout <= 0 {
+		opts.CopyTimeout = time.Minute
+	}
+	return func(kind storage.Kind, provider, bucket string) (storage.Storage, error) {
+		primary, err := inner(kind, provider, bucket)
+		if err != nil {
+			return nil, err
+		}
+		targets := opts.Mirror(kind, provider, bucket)
+		if len(targets) == 0 {
+			return primary, nil
+		}
+		m := &mirrored{
+			kind: kind, primary: primary, onError: opts.OnError,
+			copySlots: make(chan struct{}, opts.CopyConcurrency), copyTimeout: opts.CopyTimeout,
+		}
+		for _, t := range targets {
+			s, err := inner(kind, t.Provider, t.Bucket)
+			if err != nil {
+				return nil, fmt.Errorf("mirror: resolve %s://%s: %w", t.Provider, t.Bucket, err)
+			}
+			m.secondaries = append(m.secondaries, secondary{Target: t, Storage: s})
+		}
+		if kind == storage.Delta && !opts.Deltas {
+			// Read fallback only: nothing is written to the secondaries.
+			m.readOnly = true
+		}
+		caps := storecap.Of(primary)
+		if caps.Stater != nil {
+			caps.Stater = stater{m, caps.Stater}
+		}
+		if caps.Deleter != nil {
+			caps.Deleter = deleter{m, caps.Deleter}
+		}
+		return storecap.Wrap(m, caps), nil
+	}
+}
+
+type secondary struct {
+	Target
+	storage.Storage
+}
+
+type mirrored struct {
+	kind        storage.Kind
+	primary     storage.Storage
+	secondaries []secondary
+	readOnly    bool // deltas without Options.Deltas
+	onError     func(storage.Kind, Target, string, error)
+	copySlots   chan struct{} // one per background copy in flight
+	copyTimeout time.Duration
+
+	copyMu   sync.Mutex
+	copied   map[string]struct{}      // delta paths copied, or being copied, to the secondaries
+	inflight map[string]chan struct{} // path -> closed when its copy ends
+	deleted  map[string]uint64        // path -> deletes when it was last deleted
+	deletes  uint64                   // Deletes so far
+	since    uint64                   // deletes when deleted was last reset
+}
+
+// maxCopied bounds the copy-once and delete memories; past it a set is
+// reset (a few redundant copies, or skipped ones, never unbounded growth).
+const maxCopied = 100_000
+
+// Get reads the primary, then each secondary in order. A secondary's answer
+// is served only when the primary failed; if every location fails, the
+// primary's error is returned (so a miss everywhere still wraps
+// storage.ErrNotFound).
+func (m *mirrored) Get(ctx context.Context, catalog, path string) ([]byte, error) {
+	copying := m.kind == storage.Delta && !m.readOnly
+	var read uint64
+	if copying {
+		m.copyMu.Lock()
+		read = m.deletes
+		m.copyMu.Unlock()
+	}
+	data, err := m.primary.Get(ctx, catalog, path)
+	if err == nil {
+		if copying {
+			m.copyOnce(catalog, path, data, read)
+		}
+		return data, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	for _, s := range m.secondaries {
+		d, serr := s.Get(ctx, catalog, path)
+		if serr == nil {
+			return d, nil
+		}
+		if !errors.Is(serr, storage.ErrNotFound) {
+			m.onError(m.kind, s.Target, path, serr)
+		}
+	}
+	return nil, err
+}
+
+// Put writes the primary — its failure fails the call — then the
+// secondaries in parallel, best-effort (failures go to OnError).
+func (m *mirrored) Put(ctx context.Context, catalog, path string, data []byte) error {
+	if err := m.primary.Put(ctx, catalog, path, data); err != nil {
+		return err
+	}
+	if m.readOnly {
+		return nil
+	}
+	var wg sync.WaitGroup
+	for _, s := range m.secondaries {
+		wg.Go(func() {
+			if err := s.Put(ctx, catalog, path, data); err != nil {
+				m.onError(m.kind, s.Target, path, err)
+			}
+		})
+	}
+	wg.Wait()
+	return nil
+}
+
+// copyOnce replicates a client-uploaded delta in the background the first
+// time this process reads it from the primary; read is the delete count
+// before that read. The copy stops short of a secondary once the path has
+// been deleted since the read, so it never recreates what GC or
+// DeleteCatalog removed, and Delete waits for a copy in flight.
+func (m *mirrored) copyOnce(catalog, path string, data []byte, read uint64) {
+	m.copyMu.Lock()
+	if _, done := m.copied[path]; done || m.deletedSince(path, read) {
+		m.copyMu.Unlock()
+		return
+	}
+	select {
+	case m.copySlots <- struct{}{}:
+	default:
+		m.copyMu.Unlock()
+		return // saturated: a later read copies it
+	}
+	if m.copied == nil || len(m.copied) >= maxCopied {
+		m.copied = make(map[string]struct{})
+	}
+	if m.inflight == nil {
+		m.inflight = make(map[string]chan struct{})
+	}
+	m.copied[path] = struct{}{}
+	done := make(chan struct{})
+	m.inflight[path] = done
+	m.copyMu.Unlock()
+	go func() {
+		defer func() { <-m.copySlots }()
+		ctx, cancel := context.WithTimeout(context.Background(), m.copyTimeout)
+		defer cancel()
+		failed := false
+		for _, s := range m.secondaries {
+			m.copyMu.Lock()
+			gone := m.deletedSince(path, read)
+			m.copyMu.Unlock()
+			if gone {
+				break
+			}
+			if err := s.Put(ctx, catalog, path, data); err != nil {
+				m.onError(m.kind, s.Target, path, err)
+				failed = true
+			}
+		}
+		m.copyMu.Lock()
+		delete(m.inflight, path)
+		if failed {
+			delete(m.copied, path) // retry on the next read
+		}
+		m.copyMu.Unlock()
+		close(done)
+	}()
+}
+
+// deletedSince reports whether path may have been deleted after the delete
+// count read — certainly, or because the memory of it was reset. Callers
+// hold copyMu.
+func (m *mirrored) deletedSince(path string, read uint64) bool {
+	return read < m.since || m.deleted[path] > read
+}
+
+// noteDelete records a delete of path and returns the copy of it in flight,
+// if any, for the caller to wait out.
+func (m *mirrored) noteDelete(path string) <-chan struct{} {
+	m.copyMu.Lock()
+	defer m.copyMu.Unlock()
+	m.deletes++
+	if m.deleted == nil || len(m.deleted) >= maxCopied {
+		m.deleted = make(map[string]uint64)
+		m.since = m.deletes
+	}
+	m.deleted[path] = m.deletes
+	delete(m.copied, path)
+	return m.inflight[path]
+}
+
+type stater struct {
+	m *mirrored
+	s storage.Stater
+}
+
+// Stat falls back like Get, over the secondaries that implement Stater.
+func (s stater) Stat(ctx context.Context, catalog, path string) (storage.ObjectInfo, error) {
+	info, err := s.s.Stat(ctx, catalog, path)
+	if err == nil || ctx.Err() != nil {
+		return info, err
+	}
+	for _, sec := range s.m.secondaries {
+		st, ok := sec.Storage.(storage.Stater)
+		if !ok {
+			continue
+		}
+		if i, serr := st.Stat(ctx, catalog, path); serr == nil {
+			return i, nil
+		}
+	}
+	return info, err
+}
+
+type deleter struct {
+	m *mirrored
+	d storage.Deleter
+}
+
+// Delete removes the object everywhere it is mirrored, once a background
+// copy of it still in flight has ended. A secondary failure fails the call —
+// Delete is idempotent, so the caller (GC) simply retries — while a
+// secondary without Deleter is reported to OnError and skipped.
+func (d deleter) Delete(ctx context.Context, catalog, path string) error {
+	if err := d.d.Delete(ctx, catalog, path); err != nil {
+		return err
+	}
+	if copying := d.m.noteDelete(path); copying != nil {
+		select {
+		case <-copying:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	var errs []error
+	for _, s := range d.m.secondaries {
+		sd, ok := s.Storage.(storage.Deleter)
+		if !ok {
+			d.m.onError(d.m.kind, s.Target, path, storage.ErrDeleteNotSupported)
+			continue
+		}
+		if err := sd.Delete(ctx, catalog, path); err != nil {
+			errs = append(errs, fmt.Errorf("mirror %s://%s: %w", s.Provider, s.Bucket, err))
+		}
+	}
+	return errors.Join(errs...)
+}
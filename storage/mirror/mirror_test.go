@@ -0,0 +1,234 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// downStore fails every call, like a region in an incident.
+type downStore struct{}
+
+var errDown = errors.New("503 region down")
+
+func (downStore) Get(context.Context, string, string) ([]byte, error) { return nil, errDown }
+func (downStore) Put(context.Context, string, string, []byte) error   { return errDown }
+
+// setup resolves "primary" and "backup" to two mem stores; down makes the
+// primary fail every call instead.
+func setup(t *testing.T, deltas bool, down *atomic.Bool) (storage.Resolver, *mem.Store, *mem.Store, *atomic.Int32) {
+	t.Helper()
+	primary, backup := mem.New(), mem.New()
+	var errs atomic.Int32
+	inner := func(_ storage.Kind, provider, bucket string) (storage.Storage, error) {
+		switch {
+		case provider == "primary" && down != nil && down.Load():
+			return downStore{}, nil
+		case provider == "primary":
+			return primary.Bucket(bucket), nil
+		case provider == "backup":
+			return backup.Bucket(bucket), nil
+		}
+		return nil, fmt.Errorf("unknown provider %q", provider)
+	}
+	resolve := Resolver(inner, Options{
+		Mirror: func(_ storage.Kind, provider, bucket string) []Target {
+			if provider == "primary" {
+				return []Target{{Provider: "backup", Bucket: bucket}}
+			}
+			return nil
+		},
+		Deltas:  deltas,
+		OnError: func(storage.Kind, Target, string, error) { errs.Add(1) },
+	})
+	return resolve, primary, backup, &errs
+}
+
+func TestMirror_SnapshotsWrittenEverywhereReadWithFallback(t *testing.T) {
+	resolve, primary, backup, _ := setup(t, false, nil)
+	ctx := context.Background()
+	s, err := resolve(storage.Snap, "primary", "snaps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "users", "a/1.snap", []byte("snap")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if got, err := backup.Bucket("snaps").Get(ctx, "users", "a/1.snap"); err != nil || string(got) != "snap" {
+		t.Fatalf("secondary copy = %q, %v", got, err)
+	}
+
+	// The primary lost the object: served from the backup.
+	primary.Bucket("snaps").(storage.Deleter).Delete(ctx, "users", "a/1.snap")
+	if got, err := s.Get(ctx, "users", "a/1.snap"); err != nil || string(got) != "snap" {
+		t.Fatalf("fallback Get = %q, %v", got, err)
+	}
+	if _, err := s.Get(ctx, "users", "a/missing.snap"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("missing everywhere: %v, want ErrNotFound", err)
+	}
+
+	// Delete reaches every location.
+	primary.Bucket("snaps").Put(ctx, "users", "a/1.snap", []byte("snap"))
+	if err := s.(storage.Deleter).Delete(ctx, "users", "a/1.snap"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := backup.Bucket("snaps").Get(ctx, "users", "a/1.snap"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("secondary copy survived Delete: %v", err)
+	}
+}
+
+func TestMirror_PrimaryDownFallsBack(t *testing.T) {
+	var down atomic.Bool
+	resolve, _, backup, _ := setup(t, false, &down)
+	ctx := context.Background()
+	backup.Bucket("data").Put(ctx, "users", "a/1.dat", []byte("delta"))
+	down.Store(true)
+	s, _ := resolve(storage.Delta, "primary", "data")
+	if got, err := s.Get(ctx, "users", "a/1.dat"); err != nil || string(got) != "delta" {
+		t.Fatalf("Get with primary down = %q, %v", got, err)
+	}
+	if err := s.Put(ctx, "users", "a/2.dat", nil); !errors.Is(err, errDown) {
+		t.Fatalf("Put with primary down: %v, want the primary's error", err)
+	}
+}
+
+// TestMirror_Deltas: without Deltas, delta writes stay on the primary; with
+// it, a delta read from the primary is copied to the secondary.
+func TestMirror_Deltas(t *testing.T) {
+	ctx := context.Background()
+	for _, deltas := range []bool{false, true} {
+		resolve, primary, backup, _ := setup(t, deltas, nil)
+		primary.Bucket("data").Put(ctx, "users", "a/1.dat", []byte("delta"))
+		s, _ := resolve(storage.Delta, "primary", "data")
+		if _, err := s.Get(ctx, "users", "a/1.dat"); err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		copied := func() bool {
+			_, err := backup.Bucket("data").Get(ctx, "users", "a/1.dat")
+			return err == nil
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for deltas && !copied() && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if copied() != deltas {
+			t.Fatalf("Deltas=%v: copied to secondary = %v", deltas, copied())
+		}
+	}
+}
+
+// stuckStore holds every Put until release is closed or its context ends.
+type stuckStore struct {
+	storage.Storage
+	release chan struct{}
+	puts    atomic.Int32
+}
+
+func (s *stuckStore) Put(ctx context.Context, catalog, path string, data []byte) error {
+	s.puts.Add(1)
+	select {
+	case <-s.release:
+		return s.Storage.Put(ctx, catalog, path, data)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *stuckStore) Delete(ctx context.Context, catalog, path string) error {
+	return s.Storage.(storage.Deleter).Delete(ctx, catalog, path)
+}
+
+// getHook runs *onGet after each Get has read the object.
+type getHook struct {
+	storage.Storage
+	onGet *func()
+}
+
+func (h *getHook) Get(ctx context.Context, catalog, path string) ([]byte, error) {
+	data, err := h.Storage.Get(ctx, catalog, path)
+	(*h.onGet)()
+	return data, err
+}
+
+func (h *getHook) Delete(ctx context.Context, catalog, path string) error {
+	return h.Storage.(storage.Deleter).Delete(ctx, catalog, path)
+}
+
+// TestMirror_DeltaCopiesBounded: background copies are capped in number and
+// time, Delete waits a copy in flight out, and a read from before a Delete
+// never recreates the object on the secondary.
+func TestMirror_DeltaCopiesBounded(t *testing.T) {
+	ctx := context.Background()
+	primary, backup := mem.New(), mem.New()
+	stuck := &stuckStore{Storage: backup.Bucket("data"), release: make(chan struct{})}
+	var errs atomic.Int32
+	onGet := func() {}
+	resolve := Resolver(func(_ storage.Kind, provider, bucket string) (storage.Storage, error) {
+		if provider == "backup" {
+			return stuck, nil
+		}
+		return &getHook{primary.Bucket(bucket), &onGet}, nil
+	}, Options{
+		Mirror: func(_ storage.Kind, provider, bucket string) []Target {
+			if provider == "primary" {
+				return []Target{{Provider: "backup", Bucket: bucket}}
+			}
+			return nil
+		},
+		Deltas:          true,
+		CopyConcurrency: 1,
+		CopyTimeout:     100 * time.Millisecond,
+		OnError:         func(storage.Kind, Target, string, error) { errs.Add(1) },
+	})
+	s, _ := resolve(storage.Delta, "primary", "data")
+	for _, p := range []string{"a/1.dat", "a/2.dat"} {
+		primary.Bucket("data").Put(ctx, "users", p, []byte("delta"))
+		if _, err := s.Get(ctx, "users", p); err != nil {
+			t.Fatalf("Get %s: %v", p, err)
+		}
+	}
+	for deadline := time.Now().Add(2 * time.Second); stuck.puts.Load() == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := stuck.puts.Load(); n != 1 {
+		t.Fatalf("copies started = %d, want 1 (CopyConcurrency)", n)
+	}
+
+	// Delete waits for the stuck copy, which times out.
+	start := time.Now()
+	if err := s.(storage.Deleter).Delete(ctx, "users", "a/1.dat"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond || waited > 2*time.Second {
+		t.Fatalf("Delete returned after %v, want the copy timeout", waited)
+	}
+	if errs.Load() != 1 {
+		t.Fatalf("OnError calls = %d, want the timed-out copy", errs.Load())
+	}
+
+	// A read that began before a Delete copies nothing afterwards.
+	close(stuck.release)
+	onGet = func() {
+		if err := s.(storage.Deleter).Delete(ctx, "users", "a/2.dat"); err != nil {
+			t.Errorf("Delete: %v", err)
+		}
+	}
+	if _, err := s.Get(ctx, "users", "a/2.dat"); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for _, p := range []string{"a/1.dat", "a/2.dat"} {
+		if _, err := backup.Bucket("data").Get(ctx, "users", p); !errors.Is(err, storage.ErrNotFound) {
+			t.Fatalf("%s on the secondary after Delete: %v", p, err)
+		}
+	}
+	if n := stuck.puts.Load(); n != 1 {
+		t.Fatalf("copies started = %d, want none after the deletes", n)
+	}
+}
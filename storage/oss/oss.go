@@ -1,5 +1,6 @@
 // Package oss is an Aliyun OSS storage backend. One Client (one endpoint +
-// credential set) vends many buckets and implements storage.Presigner.
+// credential set) vends many buckets; each implements storage.Presigner,
+// Stater, Lister and Deleter.
 //
 //	client := oss.New(oss.Config{Endpoint: "oss-cn-hangzhou", AccessKey: ak, SecretKey: sk})
 //	resolve := func(_ storage.Kind, provider, bucket string) (storage.Storage, error) {
@@ -11,9 +12,12 @@ package oss
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -78,7 +82,8 @@ func New(cfg Config) (*Client, error) {
 	return &Client{cli: cli, buckets: map[string]*alioss.Bucket{}}, nil
 }
 
-// Bucket returns a bucket-scoped storage.Storage (also a Presigner). The
+// Bucket returns a bucket-scoped storage.Storage (also a Presigner, Stater,
+// Lister and Deleter). The
 // *oss.Bucket handle is created lazily and cached per name.
 func (c *Client) Bucket(name string) storage.Storage { return &bucket{c: c, name: name} }
 
@@ -108,7 +113,7 @@ func (b *bucket) Get(ctx context.Context, _ /*catalog*/, path string) ([]byte, e
 	}
 	r, err := h.GetObject(path, alioss.WithContext(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("oss: get %s: %w", path, err)
+		return nil, fmt.Errorf("oss: get %s: %w", path, notFound(err))
 	}
 	defer r.Close()
 	return io.ReadAll(r)
@@ -124,8 +129,12 @@ func (b *bucket) Put(ctx context.Context, _ /*catalog*/, path string, data []byt
 
 // PresignPut signs a PUT URL. UserMetadata is baked into the signature, so the
 // client MUST send the listed headers verbatim — this keeps the OSS object
-// self-describing.
+// self-describing. OSS offers no SHA-256 check on a PUT, so a
+// ContentSHA256 is refused with storage.ErrContentSHA256NotSupported.
 func (b *bucket) PresignPut(_ context.Context, _ /*catalog*/, path string, opts storage.PresignOptions) (storage.PresignedUpload, error) {
+	if opts.ContentSHA256 != "" {
+		return storage.PresignedUpload{}, fmt.Errorf("oss: %w", storage.ErrContentSHA256NotSupported)
+	}
 	h, err := b.c.handle(b.name)
 	if err != nil {
 		return storage.PresignedUpload{}, err
@@ -156,3 +165,68 @@ func (b *bucket) PresignPut(_ context.Context, _ /*catalog*/, path string, opts
 	}
 	return storage.PresignedUpload{URL: url, Method: "PUT", Headers: headers}, nil
 }
+
+func (b *bucket) Stat(ctx context.Context, _ /*catalog*/, path string) (storage.ObjectInfo, error) {
+	h, err := b.c.handle(b.name)
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	hdr, err := h.GetObjectDetailedMeta(path, alioss.WithContext(ctx))
+	if err != nil {
+		return storage.ObjectInfo{}, fmt.Errorf("oss: stat %s: %w", path, notFound(err))
+	}
+	size, err := strconv.ParseInt(hdr.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return storage.ObjectInfo{}, fmt.Errorf("oss: stat %s: content-length: %w", path, err)
+	}
+	mod, _ := http.ParseTime(hdr.Get("Last-Modified"))
+	return storage.ObjectInfo{Path: path, Size: size, ModTime: mod}, nil
+}
+
+// List pages with ListObjectsV2; the cursor is OSS's continuation token.
+func (b *bucket) List(ctx context.Context, _ /*catalog*/, prefix, cursor string) ([]storage.ObjectInfo, string, error) {
+	h, err := b.c.handle(b.name)
+	if err != nil {
+		return nil, "", err
+	}
+	opts := []alioss.Option{alioss.WithContext(ctx), alioss.Prefix(prefix), alioss.MaxKeys(1000)}
+	if cursor != "" {
+		opts = append(opts, alioss.ContinuationToken(cursor))
+	}
+	res, err := h.ListObjectsV2(opts...)
+	if err != nil {
+		return nil, "", fmt.Errorf("oss: list %q: %w", prefix, err)
+	}
+	out := make([]storage.ObjectInfo, len(res.Objects))
+	for i, o := range res.Objects {
+		out[i] = storage.ObjectInfo{Path: o.Key, Size: o.Size, ModTime: o.LastModified}
+	}
+	next := ""
+	if res.IsTruncated {
+		next = res.NextContinuationToken
+	}
+	return out, next, nil
+}
+
+// Delete removes the object. OSS answers 204 for a missing key too, so a
+// repeated Delete is a no-op as the contract requires.
+func (b *bucket) Delete(ctx context.Context, _ /*catalog*/, path string) error {
+	h, err := b.c.handle(b.name)
+	if err != nil {
+		return err
+	}
+	if err := h.DeleteObject(path, alioss.WithContext(ctx)); err != nil {
+		return fmt.Errorf("oss: delete %s: %w", path, err)
+	}
+	return nil
+}
+
+// notFound maps an OSS 404 to storage.ErrNotFound, keeping the SDK error's
+// text.
+func notFound(err error) error {
+	var se alioss.ServiceError
+	if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", storage.ErrNotFound, se.Message)
+	}
+	return err
+}
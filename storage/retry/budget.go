@@ -0,0 +1,81 @@
+package retry
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// budget is a token bucket shared by all calls on one wrapped backend: calls
+// deposit ratio tokens, retries and hedges withdraw one.
+type budget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+	burst  float64
+}
+
+func newBudget(ratio, burst float64) *budget {
+	return &budget{tokens: burst, ratio: ratio, burst: burst}
+}
+
+func (b *budget) deposit() {
+	b.mu.Lock()
+	b.tokens = min(b.tokens+b.ratio, b.burst)
+	b.mu.Unlock()
+}
+
+func (b *budget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// latencyWindow is how many recent successful Gets the hedge threshold is
+// computed over.
+const latencyWindow = 256
+
+// latencies keeps a ring of recent Get latencies and the percentile derived
+// from them. The percentile is recomputed every 16 samples, not per Get —
+// it only needs to track drift.
+type latencies struct {
+	mu         sync.Mutex
+	ring       [latencyWindow]time.Duration
+	n          int // samples recorded, saturating at latencyWindow
+	next       int
+	percentile float64
+	minSamples int
+	cached     atomic.Int64 // current threshold; 0 = not enough samples
+}
+
+func newLatencies(percentile float64, minSamples int) *latencies {
+	return &latencies{percentile: min(percentile, 1), minSamples: min(minSamples, latencyWindow)}
+}
+
+func (l *latencies) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ring[l.next] = d
+	l.next = (l.next + 1) % latencyWindow
+	if l.n < latencyWindow {
+		l.n++
+	}
+	if l.n < l.minSamples || (l.n != l.minSamples && l.next%16 != 0) {
+		return
+	}
+	s := slices.Clone(l.ring[:l.n])
+	slices.Sort(s)
+	i := min(int(float64(len(s))*l.percentile), len(s)-1)
+	l.cached.Store(int64(max(s[i], time.Millisecond)))
+}
+
+// threshold is how long a Get may run before it is hedged.
+func (l *latencies) threshold() (time.Duration, bool) {
+	d := l.cached.Load()
+	return time.Duration(d), d > 0
+}
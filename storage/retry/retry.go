@@ -0,0 +1,296 @@
+// Package retry is a ready-made retrying decorator for any storage.Storage,
+// composed in a storage.Resolver like storage/cached. One transient 5xx from
+// an object store otherwise fails a whole read: Lake fetches a catalog's
+// deltas in parallel and gives up on the first error.
+//
+// Wrap retries failed calls with exponential backoff and full jitter, bounded
+// per call (MaxAttempts) and per backend (a retry budget, so an outage does
+// not multiply the load on a struggling store). Gets can additionally be
+// hedged: when one runs longer than a latency percentile observed on this
+// backend, a second identical Get races it and the first success wins.
+// Optional capabilities pass through: Presigner uncached and unretried (it
+// only signs), Stater / Lister / Deleter retried like Get.
+//
+// Compose it INSIDE a cache — a cache hit should not pay for retry
+// bookkeeping, and a retried miss should still fill the cache:
+//
+//	resolve := cached.Resolver(retry.Resolver(backends, func(storage.Kind, string, string) *retry.Policy {
+//	    return &retry.Policy{HedgePercentile: 0.95}
+//	}), cachePolicy)
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/storecap"
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// Policy tunes one wrapped backend. Zero fields take the defaults noted.
+type Policy struct {
+	// MaxAttempts bounds the tries of one call, the first included.
+	// Default 3; 1 disables retrying (hedging still applies).
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry; each further retry
+	// doubles it, capped at MaxDelay. The actual sleep is drawn uniformly
+	// from [0, delay) ("full jitter"), so synchronized failures spread out.
+	// Defaults 50ms and 2s.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// BudgetRatio is the retry budget: each call earns the backend
+	// BudgetRatio retry tokens, every retry and every hedge spends one, and
+	// at most BudgetBurst tokens are banked (the bank starts full). Under a
+	// sustained outage retries thus settle at BudgetRatio × calls instead of
+	// (MaxAttempts-1) × calls. Defaults 0.1 and 10.
+	BudgetRatio float64
+	BudgetBurst float64
+	// Retryable classifies an error. Default: DefaultRetryable.
+	Retryable func(error) bool
+	// HedgePercentile enables hedged Gets: once a Get has run longer than
+	// this percentile (e.g. 0.95) of recent successful Get latencies on the
+	// backend, a second Get is started and the first success wins. 0
+	// disables hedging. No hedge is sent before HedgeMinSamples (default
+	// 20) latencies have been observed.
+	HedgePercentile float64
+	HedgeMinSamples int
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = 50 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 2 * time.Second
+	}
+	if p.BudgetRatio <= 0 {
+		p.BudgetRatio = 0.1
+	}
+	if p.BudgetBurst <= 0 {
+		p.BudgetBurst = 10
+	}
+	if p.Retryable == nil {
+		p.Retryable = DefaultRetryable
+	}
+	if p.HedgeMinSamples <= 0 {
+		p.HedgeMinSamples = 20
+	}
+	return p
+}
+
+// DefaultRetryable retries everything except what cannot succeed on a
+// retry: a missing object (storage.ErrNotFound), an unsupported operation,
+// the caller's own cancellation or deadline, and errors that report
+// Temporary() == false (s3.Error does, for 4xx answers other than 408/429).
+func DefaultRetryable(err error) bool {
+	switch {
+	case errors.Is(err, storage.ErrNotFound),
+		errors.Is(err, storage.ErrPresignNotSupported),
+		errors.Is(err, storage.ErrDeleteNotSupported),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	}
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		return t.Temporary()
+	}
+	return true
+}
+
+// retrying is the wrapper's Get/Put; the optional capabilities are layered
+// on by Wrap.
+type retrying struct {
+	base    storage.Storage
+	policy  Policy
+	budget  *budget
+	latency *latencies // nil without hedging
+}
+
+// Wrap decorates base with the retry policy. The returned Storage implements
+// exactly the optional capabilities base does. Each Wrap has its own budget
+// and latency history.
+func Wrap(base storage.Storage, p Policy) storage.Storage {
+	p = p.withDefaults()
+	r := &retrying{base: base, policy: p, budget: newBudget(p.BudgetRatio, p.BudgetBurst)}
+	if p.HedgePercentile > 0 {
+		r.latency = newLatencies(p.HedgePercentile, p.HedgeMinSamples)
+	}
+	caps := storecap.Of(base)
+	if caps.Stater != nil {
+		caps.Stater = stater{r, caps.Stater}
+	}
+	if caps.Lister != nil {
+		caps.Lister = lister{r, caps.Lister}
+	}
+	if caps.Deleter != nil {
+		caps.Deleter = deleter{r, caps.Deleter}
+	}
+	return storecap.Wrap(r, caps)
+}
+
+// Resolver wraps every Storage that inner returns with the policy chosen by
+// policy(kind, provider, bucket); a nil policy result leaves that backend
+// unwrapped. Lake memoises resolved backends, so each (kind, provider,
+// bucket) keeps one budget and one latency history.
+func Resolver(inner storage.Resolver, policy func(kind storage.Kind, provider, bucket string) *Policy) storage.Resolver {
+	if policy == nil {
+		return inner
+	}
+	return func(kind storage.Kind, provider, bucket string) (storage.Storage, error) {
+		base, err := inner(kind, provider, bucket)
+		if err != nil {
+			return nil, err
+		}
+		p := policy(kind, provider, bucket)
+		if p == nil {
+			return base, nil
+		}
+		return Wrap(base, *p), nil
+	}
+}
+
+func (r *retrying) Get(ctx context.Context, catalog, path string) ([]byte, error) {
+	var data []byte
+	err := r.do(ctx, func() (err error) {
+		data, err = r.getOnce(ctx, catalog, path)
+		return err
+	})
+	return data, err
+}
+
+// Put is retried as a whole: rewriting the same bytes to the same path is
+// idempotent, which is what Lake's object layout guarantees.
+func (r *retrying) Put(ctx context.Context, catalog, path string, data []byte) error {
+	return r.do(ctx, func() error { return r.base.Put(ctx, catalog, path, data) })
+}
+
+// do runs op until it succeeds, fails non-retryably, exhausts MaxAttempts or
+// the budget, or ctx ends. The last error is returned wrapped (errors.Is /
+// As still see it).
+func (r *retrying) do(ctx context.Context, op func() error) error {
+	r.budget.deposit()
+	delay := r.policy.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			return nil
+		}
+		if attempt >= r.policy.MaxAttempts || !r.policy.Retryable(err) || ctx.Err() != nil {
+			if attempt == 1 {
+				return err
+			}
+			return fmt.Errorf("retry: %d attempts: %w", attempt, err)
+		}
+		if !r.budget.withdraw() {
+			return fmt.Errorf("retry: budget exhausted after %d attempts: %w", attempt, err)
+		}
+		t := time.NewTimer(rand.N(delay) + 1)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return fmt.Errorf("retry: %d attempts: %w", attempt, err)
+		case <-t.C:
+		}
+		delay = min(2*delay, r.policy.MaxDelay)
+	}
+}
+
+// getOnce is one (possibly hedged) Get attempt.
+func (r *retrying) getOnce(ctx context.Context, catalog, path string) ([]byte, error) {
+	if r.latency == nil {
+		return r.base.Get(ctx, catalog, path)
+	}
+	threshold, ok := r.latency.threshold()
+	if !ok {
+		return r.timedGet(ctx, catalog, path)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stops the losing Get
+	type result struct {
+		data []byte
+		err  error
+	}
+	ch := make(chan result, 2)
+	launch := func() {
+		go func() {
+			data, err := r.timedGet(ctx, catalog, path)
+			ch <- result{data, err}
+		}()
+	}
+	launch()
+	inflight := 1
+	hedge := time.NewTimer(threshold)
+	defer hedge.Stop()
+	var firstErr error
+	for {
+		select {
+		case <-hedge.C:
+			if r.budget.withdraw() {
+				launch()
+				inflight++
+			}
+		case res := <-ch:
+			if res.err == nil {
+				return res.data, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if inflight--; inflight == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
+
+// timedGet records the latency of successful Gets for the hedge threshold.
+func (r *retrying) timedGet(ctx context.Context, catalog, path string) ([]byte, error) {
+	start := time.Now()
+	data, err := r.base.Get(ctx, catalog, path)
+	if err == nil {
+		r.latency.record(time.Since(start))
+	}
+	return data, err
+}
+
+type stater struct {
+	r *retrying
+	s storage.Stater
+}
+
+func (s stater) Stat(ctx context.Context, catalog, path string) (info storage.ObjectInfo, err error) {
+	err = s.r.do(ctx, func() (err error) {
+		info, err = s.s.Stat(ctx, catalog, path)
+		return err
+	})
+	return info, err
+}
+
+type lister struct {
+	r *retrying
+	l storage.Lister
+}
+
+func (l lister) List(ctx context.Context, catalog, prefix, cursor string) (objs []storage.ObjectInfo, next string, err error) {
+	err = l.r.do(ctx, func() (err error) {
+		objs, next, err = l.l.List(ctx, catalog, prefix, cursor)
+		return err
+	})
+	return objs, next, err
+}
+
+type deleter struct {
+	r *retrying
+	d storage.Deleter
+}
+
+func (d deleter) Delete(ctx context.Context, catalog, path string) error {
+	return d.r.do(ctx, func() error { return d.d.Delete(ctx, catalog, path) })
+}
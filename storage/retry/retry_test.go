@@ -0,0 +1,208 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+var errTransient = errors.New("503 slow down")
+
+// flakyStore fails the first `fails` calls of every operation, then defers
+// to a mem bucket. get, when set, replaces Get entirely.
+type flakyStore struct {
+	storage.Storage
+	fails atomic.Int32
+	calls atomic.Int32
+	get   func(ctx context.Context, n int32) ([]byte, error)
+}
+
+func newFlaky(fails int32) *flakyStore {
+	f := &flakyStore{Storage: mem.New().Bucket("b")}
+	f.fails.Store(fails)
+	return f
+}
+
+func (f *flakyStore) Get(ctx context.Context, catalog, path string) ([]byte, error) {
+	n := f.calls.Add(1)
+	if f.get != nil {
+		return f.get(ctx, n)
+	}
+	if f.fails.Add(-1) >= 0 {
+		return nil, errTransient
+	}
+	return f.Storage.Get(ctx, catalog, path)
+}
+
+func (f *flakyStore) Put(ctx context.Context, catalog, path string, data []byte) error {
+	f.calls.Add(1)
+	if f.fails.Add(-1) >= 0 {
+		return errTransient
+	}
+	return f.Storage.Put(ctx, catalog, path, data)
+}
+
+func (f *flakyStore) Delete(ctx context.Context, catalog, path string) error {
+	f.calls.Add(1)
+	if f.fails.Add(-1) >= 0 {
+		return errTransient
+	}
+	return f.Storage.(storage.Deleter).Delete(ctx, catalog, path)
+}
+
+var fast = Policy{BaseDelay: time.Microsecond, MaxDelay: time.Millisecond}
+
+func TestWrap_RetriesTransientErrors(t *testing.T) {
+	ctx := context.Background()
+	base := newFlaky(2)
+	w := Wrap(base, fast)
+	if err := w.Put(ctx, "users", "x.dat", []byte("v")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if n := base.calls.Load(); n != 3 {
+		t.Fatalf("backend calls = %d, want 3 (two failures, one success)", n)
+	}
+	base.fails.Store(1)
+	if got, err := w.Get(ctx, "users", "x.dat"); err != nil || string(got) != "v" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	// Past MaxAttempts the last error surfaces, still matchable.
+	base.fails.Store(5)
+	if _, err := w.Get(ctx, "users", "x.dat"); !errors.Is(err, errTransient) {
+		t.Fatalf("Get after MaxAttempts: %v, want errTransient", err)
+	}
+}
+
+func TestWrap_NotFoundIsNotRetried(t *testing.T) {
+	base := newFlaky(0)
+	w := Wrap(base, fast)
+	if _, err := w.Get(context.Background(), "users", "missing"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Get missing: %v", err)
+	}
+	if n := base.calls.Load(); n != 1 {
+		t.Fatalf("backend calls = %d, want 1", n)
+	}
+}
+
+// TestWrap_BudgetCapsRetries: once the bank is empty, failures surface after
+// one attempt instead of MaxAttempts.
+func TestWrap_BudgetCapsRetries(t *testing.T) {
+	base := newFlaky(1 << 20)
+	p := fast
+	p.BudgetBurst, p.BudgetRatio = 2, 0.001
+	w := Wrap(base, p)
+	ctx := context.Background()
+	w.Get(ctx, "users", "x") // 3 attempts: spends both tokens
+	base.calls.Store(0)
+	if _, err := w.Get(ctx, "users", "x"); !errors.Is(err, errTransient) {
+		t.Fatalf("Get: %v", err)
+	}
+	if n := base.calls.Load(); n != 1 {
+		t.Fatalf("backend calls with an empty budget = %d, want 1", n)
+	}
+}
+
+// TestWrap_HedgesSlowGet: after enough fast Gets set the threshold, a Get
+// that hangs is raced by a hedge, which wins; the hung one is cancelled.
+func TestWrap_HedgesSlowGet(t *testing.T) {
+	base := newFlaky(0)
+	var cancelled atomic.Bool
+	base.get = func(ctx context.Context, n int32) ([]byte, error) {
+		if n == 21 { // first Get after warm-up hangs until cancelled
+			<-ctx.Done()
+			cancelled.Store(true)
+			return nil, ctx.Err()
+		}
+		return []byte("v"), nil
+	}
+	p := fast
+	p.HedgePercentile = 0.9
+	w := Wrap(base, p)
+	ctx := context.Background()
+	for range 20 {
+		if _, err := w.Get(ctx, "users", "x"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := w.Get(ctx, "users", "x")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("hedged Get: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow Get was not hedged")
+	}
+	deadline := time.Now().Add(time.Second)
+	for !cancelled.Load() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !cancelled.Load() {
+		t.Fatal("losing Get was not cancelled")
+	}
+}
+
+func TestWrap_CapabilityPassthrough(t *testing.T) {
+	w := Wrap(newFlaky(1), fast)
+	if _, ok := w.(storage.Presigner); ok {
+		t.Fatal("wrapper must not fabricate Presigner")
+	}
+	del, ok := w.(storage.Deleter)
+	if !ok {
+		t.Fatal("wrapper hides Deleter")
+	}
+	if err := del.Delete(context.Background(), "users", "x"); err != nil {
+		t.Fatalf("Delete (one transient failure): %v", err)
+	}
+
+	store := mem.New()
+	if err := store.EnablePresign("http://localhost/up", []byte("k")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Wrap(store.Bucket("b"), fast).(storage.Presigner); !ok {
+		t.Fatal("wrapper hides Presigner")
+	}
+}
+
+func TestWrap_StopsOnContextCancel(t *testing.T) {
+	base := newFlaky(1 << 20)
+	w := Wrap(base, Policy{BaseDelay: time.Hour, MaxDelay: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := w.Get(ctx, "users", "x"); !errors.Is(err, errTransient) {
+		t.Fatalf("Get: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("backoff ignored context cancellation")
+	}
+}
+
+func TestResolver_PolicyRoutes(t *testing.T) {
+	inner := func(storage.Kind, string, string) (storage.Storage, error) { return newFlaky(1), nil }
+	resolve := Resolver(inner, func(kind storage.Kind, _, _ string) *Policy {
+		if kind == storage.Delta {
+			return &fast
+		}
+		return nil
+	})
+	ctx := context.Background()
+	d, _ := resolve(storage.Delta, "p", "b")
+	if err := d.Put(ctx, "users", "x", nil); err != nil {
+		t.Fatalf("wrapped Put: %v", err)
+	}
+	s, _ := resolve(storage.Snap, "p", "b")
+	if err := s.Put(ctx, "users", "x", nil); !errors.Is(err, errTransient) {
+		t.Fatalf("unwrapped Put: %v, want the raw failure", err)
+	}
+}
@@ -0,0 +1,306 @@
+// Package s3 is an S3-compatible storage backend (AWS S3, MinIO, Ceph RGW,
+// and other stores speaking the S3 REST API). It talks HTTP directly and
+// signs with AWS Signature Version 4 — no SDK dependency. One Client (one
+// endpoint + credential set) vends many buckets; each implements
+// storage.Presigner, Stater, Lister and Deleter.
+//
+//	client, err := s3.New(s3.Config{Region: "us-east-1", AccessKey: ak, SecretKey: sk})
+//	resolve := func(_ storage.Kind, provider, bucket string) (storage.Storage, error) {
+//	    if provider != "s3" { return nil, fmt.Errorf("unknown provider %q", provider) }
+//	    return client.Bucket(bucket), nil
+//	}
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hkloudou/lake/v3/storage"
+)
+
+// Config holds S3 connection settings.
+type Config struct {
+	// Endpoint is the service address: a full URL ("http://minio:9000") or a
+	// bare host (https assumed). Empty means AWS: "s3.<Region>.amazonaws.com".
+	Endpoint  string
+	Region    string // signing region, e.g. "us-east-1"; required
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses buckets as "<endpoint>/<bucket>/<key>" instead of
+	// the virtual-hosted "<bucket>.<endpoint>/<key>". Most self-hosted stores
+	// need it; so do bucket names containing dots under https.
+	PathStyle bool
+	// HTTPClient overrides http.DefaultClient (timeouts, transport, proxies).
+	HTTPClient *http.Client
+}
+
+// Client is an endpoint+credential-scoped S3 handle that vends buckets.
+type Client struct {
+	base      *url.URL
+	pathStyle bool
+	hc        *http.Client
+	sign      signer
+	now       func() time.Time
+}
+
+// New builds an S3 client. It returns an error only on malformed config; no
+// request is made.
+func New(cfg Config) (*Client, error) {
+	if cfg.Region == "" {
+		return nil, errors.New("s3: Region is required (it is part of every signature)")
+	}
+	endpoint := cfg.Endpoint
+	switch {
+	case endpoint == "":
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	case !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://"):
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("s3: endpoint: %w", err)
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+		return nil, fmt.Errorf("s3: endpoint %q must be a bare scheme://host[:port]", cfg.Endpoint)
+	}
+	u.Path = ""
+	hc := cfg.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return &Client{
+		base:      u,
+		pathStyle: cfg.PathStyle,
+		hc:        hc,
+		sign:      signer{region: cfg.Region, accessKey: cfg.AccessKey, secretKey: cfg.SecretKey},
+		now:       time.Now,
+	}, nil
+}
+
+// Bucket returns a bucket-scoped storage.Storage (also a Presigner, Stater,
+// Lister and Deleter).
+func (c *Client) Bucket(name string) storage.Storage { return &bucket{c: c, name: name} }
+
+type bucket struct {
+	c    *Client
+	name string
+}
+
+// url addresses path (an object key; "" for the bucket itself) in the
+// configured style. Path and RawPath are both set so the wire form — and
+// therefore the signed canonical URI — is exactly SigV4's encoding, which
+// escapes more than net/url does (e.g. the "(" of Lake's catalog folders).
+func (b *bucket) url(path string) *url.URL {
+	u := *b.c.base
+	key := "/" + path
+	switch {
+	case !b.c.pathStyle:
+		u.Host = b.name + "." + u.Host
+	case path == "":
+		key = "/" + b.name
+	default:
+		key = "/" + b.name + key
+	}
+	u.Path = key
+	u.RawPath = uriEncode(key, false)
+	return &u
+}
+
+// do sends one header-signed request. A non-2xx answer is returned as *Error
+// after the body is drained.
+func (b *bucket) do(ctx context.Context, method, path string, query url.Values, body []byte, hdr map[string]string) (*http.Response, error) {
+	u := b.url(path)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body, req.ContentLength = http.NoBody, 0
+	}
+	for k, v := range hdr {
+		req.Header.Set(k, v)
+	}
+	payloadHash := emptyHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+	b.c.sign.signHeader(req, payloadHash, b.c.now().UTC())
+	resp, err := b.c.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, readError(resp)
+	}
+	return resp, nil
+}
+
+func (b *bucket) Get(ctx context.Context, _ /*catalog*/, path string) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, path, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("s3: get %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("s3: get %s: %w", path, err)
+	}
+	return data, nil
+}
+
+func (b *bucket) Put(ctx context.Context, _ /*catalog*/, path string, data []byte) error {
+	resp, err := b.do(ctx, http.MethodPut, path, nil, data, nil)
+	if err != nil {
+		return fmt.Errorf("s3: put %s: %w", path, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (b *bucket) Stat(ctx context.Context, _ /*catalog*/, path string) (storage.ObjectInfo, error) {
+	resp, err := b.do(ctx, http.MethodHead, path, nil, nil, nil)
+	if err != nil {
+		return storage.ObjectInfo{}, fmt.Errorf("s3: stat %s: %w", path, err)
+	}
+	resp.Body.Close()
+	mod, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return storage.ObjectInfo{Path: path, Size: resp.ContentLength, ModTime: mod}, nil
+}
+
+// listResult is the subset of ListObjectsV2's answer List reads.
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+}
+
+// List pages with ListObjectsV2; the cursor is S3's continuation token.
+func (b *bucket) List(ctx context.Context, _ /*catalog*/, prefix, cursor string) ([]storage.ObjectInfo, string, error) {
+	q := url.Values{"list-type": {"2"}, "prefix": {prefix}, "max-keys": {"1000"}}
+	if cursor != "" {
+		q.Set("continuation-token", cursor)
+	}
+	resp, err := b.do(ctx, http.MethodGet, "", q, nil, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("s3: list %q: %w", prefix, err)
+	}
+	defer resp.Body.Close()
+	var res listResult
+	if err := xml.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, "", fmt.Errorf("s3: list %q: decode: %w", prefix, err)
+	}
+	out := make([]storage.ObjectInfo, len(res.Contents))
+	for i, o := range res.Contents {
+		out[i] = storage.ObjectInfo{Path: o.Key, Size: o.Size, ModTime: o.LastModified}
+	}
+	next := ""
+	if res.IsTruncated {
+		next = res.NextContinuationToken
+	}
+	return out, next, nil
+}
+
+// Delete removes the object. S3 answers 204 for a missing key too, so a
+// repeated Delete is a no-op as the contract requires.
+func (b *bucket) Delete(ctx context.Context, _ /*catalog*/, path string) error {
+	resp, err := b.do(ctx, http.MethodDelete, path, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("s3: delete %s: %w", path, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PresignPut signs a PUT URL (SigV4 query signing). Content-Type,
+// UserMetadata and ContentSHA256 are signed headers, so the client MUST send
+// the listed headers verbatim — this keeps the S3 object self-describing
+// and lets S3 reject a body that does not match its declared hash.
+func (b *bucket) PresignPut(_ context.Context, _ /*catalog*/, path string, opts storage.PresignOptions) (storage.PresignedUpload, error) {
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = 15 * time.Minute
+	}
+	// X-Amz-Expires is whole seconds in [1, 7 days]; a sub-second TTL would
+	// truncate to 0 and sign a URL that is already expired when returned.
+	ttl = min(max(ttl, time.Second), maxPresignTTL)
+	signed := map[string]string{}
+	headers := map[string]string{}
+	if opts.ContentType != "" {
+		signed["content-type"] = opts.ContentType
+		headers["Content-Type"] = opts.ContentType
+	}
+	for k, v := range opts.UserMetadata {
+		name := "x-amz-meta-" + strings.ToLower(k)
+		signed[name] = v
+		headers[name] = v
+	}
+	if opts.ContentSHA256 != "" {
+		sum, err := hex.DecodeString(opts.ContentSHA256)
+		if err != nil || len(sum) != sha256.Size {
+			return storage.PresignedUpload{}, fmt.Errorf("s3: invalid content SHA-256 %q", opts.ContentSHA256)
+		}
+		// S3 rejects a body whose checksum does not match (BadDigest).
+		signed["x-amz-checksum-sha256"] = base64.StdEncoding.EncodeToString(sum)
+		headers["x-amz-checksum-sha256"] = signed["x-amz-checksum-sha256"]
+	}
+	u := b.c.sign.presign(http.MethodPut, b.url(path), signed, ttl, b.c.now().UTC())
+	return storage.PresignedUpload{URL: u, Method: "PUT", Headers: headers}, nil
+}
+
+// Error is a non-2xx S3 answer. A 404 unwraps to storage.ErrNotFound.
+type Error struct {
+	StatusCode int
+	Code       string // S3 error code, e.g. "NoSuchKey", "SignatureDoesNotMatch"
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return "status " + strconv.Itoa(e.StatusCode)
+	}
+	return fmt.Sprintf("status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Temporary reports whether retrying may help: server errors, throttling
+// and request timeouts. storage/retry consults it.
+func (e *Error) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests || e.StatusCode == http.StatusRequestTimeout
+}
+
+func (e *Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// readError decodes S3's XML error body when there is one (HEAD has none).
+func readError(resp *http.Response) error {
+	e := &Error{StatusCode: resp.StatusCode}
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10)); err == nil && xml.Unmarshal(raw, &body) == nil {
+		e.Code, e.Message = body.Code, body.Message
+	}
+	return e
+}
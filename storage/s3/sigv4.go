@@ -0,0 +1,159 @@
+package s3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AWS Signature Version 4, the subset S3 needs: header-signed requests for
+// Lake's own calls and query-signed (presigned) URLs for client uploads.
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-authenticating-requests.html
+
+const (
+	algorithm       = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	// emptyHash is hex(sha256("")), the payload hash of a body-less request.
+	emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// maxPresignTTL is SigV4's ceiling on X-Amz-Expires (7 days).
+	maxPresignTTL = 7 * 24 * time.Hour
+)
+
+type signer struct {
+	region, accessKey, secretKey string
+}
+
+func (s signer) scope(t time.Time) string {
+	return t.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature signs canonicalRequest at time t.
+func (s signer) signature(t time.Time, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	toSign := algorithm + "\n" + t.Format(amzDateFormat) + "\n" + s.scope(t) + "\n" + hex.EncodeToString(sum[:])
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+// signHeader authorizes req with the Authorization header. Every header
+// already set on req is signed, plus host; the caller sets nothing it does
+// not want pinned. payloadHash is hex(sha256(body)).
+func (s signer) signHeader(req *http.Request, payloadHash string, t time.Time) {
+	req.Header.Set("X-Amz-Date", t.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	hdr := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		hdr[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	signed, canonHdr := canonicalHeaders(hdr)
+	creq := canonicalRequest(req.Method, req.URL.EscapedPath(), req.URL.Query(), canonHdr, signed, payloadHash)
+	req.Header.Set("Authorization", algorithm+" Credential="+s.accessKey+"/"+s.scope(t)+
+		", SignedHeaders="+signed+", Signature="+s.signature(t, creq))
+}
+
+// presign returns u with query-string authorization for method, valid for
+// ttl from t. hdr (lower-case names) are signed alongside host: the uploader
+// must send exactly those headers.
+func (s signer) presign(method string, u *url.URL, hdr map[string]string, ttl time.Duration, t time.Time) string {
+	all := map[string]string{"host": u.Host}
+	for k, v := range hdr {
+		all[k] = v
+	}
+	signed, canonHdr := canonicalHeaders(all)
+	q := u.Query()
+	q.Set("X-Amz-Algorithm", algorithm)
+	q.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(t))
+	q.Set("X-Amz-Date", t.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", strconv.FormatInt(int64(ttl/time.Second), 10))
+	q.Set("X-Amz-SignedHeaders", signed)
+	creq := canonicalRequest(method, u.EscapedPath(), q, canonHdr, signed, unsignedPayload)
+	out := *u
+	out.RawQuery = canonicalQuery(q) + "&X-Amz-Signature=" + s.signature(t, creq)
+	return out.String()
+}
+
+// canonicalHeaders renders the (lower-case) headers in SigV4 form and returns
+// the matching SignedHeaders list.
+func canonicalHeaders(hdr map[string]string) (signed, canonical string) {
+	names := make([]string, 0, len(hdr))
+	for k := range hdr {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(k + ":" + strings.Join(strings.Fields(hdr[k]), " ") + "\n")
+	}
+	return strings.Join(names, ";"), b.String()
+}
+
+func canonicalRequest(method, escapedPath string, q url.Values, canonicalHeaders, signedHeaders, payloadHash string) string {
+	if escapedPath == "" {
+		escapedPath = "/"
+	}
+	return method + "\n" + escapedPath + "\n" + canonicalQuery(q) + "\n" +
+		canonicalHeaders + "\n" + signedHeaders + "\n" + payloadHash
+}
+
+// canonicalQuery sorts by key then value and encodes both the SigV4 way —
+// which differs from url.Values.Encode (space is %20, not +). The signature
+// parameter itself is never part of what it signs.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		if k != "X-Amz-Signature" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes every byte but the unreserved set
+// (A-Z a-z 0-9 - _ . ~); "/" is kept too unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
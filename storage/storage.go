@@ -2,7 +2,7 @@
 // storage-agnostic — it never imports a cloud SDK. The embedding program
 // supplies a Resolver that maps a (kind, provider, bucket) to a bucket-scoped
 // Storage; ready-made backends live in optional subpackages (storage/oss,
-// storage/file, storage/mem).
+// storage/s3, storage/file, storage/mem).
 package storage
 
 import (
@@ -28,12 +28,46 @@ type Storage interface {
 
 // Presigner is an optional capability: a Storage that can mint an HTTP-signed
 // URL for a direct client upload. Object stores (OSS / S3 / COS) implement it;
-// file / memory backends do not, and WriteBegin returns ErrPresignNotSupported
-// for them.
+// file / memory backends only once presign is enabled on them, and WriteBegin
+// returns ErrPresignNotSupported for a backend without it.
 type Presigner interface {
 	PresignPut(ctx context.Context, catalog, path string, opts PresignOptions) (PresignedUpload, error)
 }
 
+// ObjectInfo describes one stored object, as reported by Stater and Lister.
+type ObjectInfo struct {
+	Path    string    // object key within the bucket
+	Size    int64     // bytes
+	ModTime time.Time // last modification; zero when the backend does not report it
+}
+
+// Stater is an optional capability: a Storage that can report an object's
+// existence and size without fetching it. A missing object is an error
+// wrapping ErrNotFound.
+type Stater interface {
+	Stat(ctx context.Context, catalog, path string) (ObjectInfo, error)
+}
+
+// Lister is an optional capability: a Storage that can enumerate its objects.
+// List returns one page of the objects whose path starts with prefix, in
+// ascending path order, plus the cursor of the next page — "" once
+// exhausted. Pass "" to start; cursors are opaque and backend-specific, and
+// page size is the backend's choice. catalog is context, as everywhere:
+// prefix alone selects the objects (objkey's per-catalog folder is the usual
+// prefix).
+type Lister interface {
+	List(ctx context.Context, catalog, prefix, cursor string) ([]ObjectInfo, string, error)
+}
+
+// Deleter is an optional capability: a Storage that can remove an object.
+// Deleting an object that does not exist is NOT an error — GC retries a
+// partially completed run, and must be able to re-delete what is already
+// gone. Lake itself never deletes on the read or write path; only explicit
+// maintenance calls (Client.GC) use it.
+type Deleter interface {
+	Delete(ctx context.Context, catalog, path string) error
+}
+
 // Kind tells a Resolver which class of object Lake is about to access, so it can
 // route by class — cache snapshots, pick a storage tier, tag metrics — without
 // inspecting the path or relying on bucket naming. Object storage only ever
@@ -72,6 +106,13 @@ type PresignOptions struct {
 	TTL          time.Duration     // signature validity
 	UserMetadata map[string]string // mapped to x-oss-meta-* / x-amz-meta-*
 	ContentType  string            // optional; if set, signed and required
+	// ContentSHA256 (lowercase hex), when set, pins the body: the backend
+	// must have the store reject an upload that does not match it (s3:
+	// x-amz-checksum-sha256; file / mem: checked by the upload handler). A
+	// backend that cannot (oss) returns ErrContentSHA256NotSupported rather
+	// than sign a URL that accepts any body: content-addressed writers
+	// trust the object at a hash's path without reading it.
+	ContentSHA256 string
 }
 
 // PresignedUpload is the JSON-serialisable result handed back to a client.
@@ -83,3 +124,19 @@ type PresignedUpload struct {
 
 // ErrPresignNotSupported is returned by backends without presign capability.
 var ErrPresignNotSupported = errors.New("storage: presigned uploads not supported by this backend")
+
+// ErrContentSHA256NotSupported is returned by PresignPut for a
+// PresignOptions.ContentSHA256 the backend cannot have verified.
+var ErrContentSHA256NotSupported = errors.New("storage: presigned uploads cannot be pinned to a SHA-256 on this backend")
+
+// ErrNotFound is wrapped by backends when the requested object does not exist,
+// so callers can tell a missing object from a failed fetch via errors.Is.
+var ErrNotFound = errors.New("storage: object not found")
+
+// ErrDeleteNotSupported is returned when an operation needs to remove objects
+// from a backend that does not implement Deleter.
+var ErrDeleteNotSupported = errors.New("storage: delete not supported by this backend")
+
+// ErrListNotSupported is returned when an operation needs to enumerate
+// objects in a backend that does not implement Lister.
+var ErrListNotSupported = errors.New("storage: list not supported by this backend")
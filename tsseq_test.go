@@ -0,0 +1,88 @@
+package lake
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+// TestTsSeqV2_Redis: a TsSeqV2 writer joins a catalog written under
+// TsSeqV1 — reads merge both in order, the snapshot stop and RemoveDelta
+// take TsSeqV2 IDs, and a TsSeqV1 writer then keeps the catalog on TsSeqV2.
+// NewWithIndex hands the version to the memory index.
+func TestTsSeqV2_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	}
+	ctx := context.Background()
+	write := func(c *Client, path, body string) {
+		t.Helper()
+		h, err := c.WriteBegin(ctx, WriteBeginRequest{
+			Catalog: "users", Path: path, MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+		})
+		if err != nil {
+			t.Fatalf("WriteBegin: %v", err)
+		}
+		if err := store.Bucket(h.Bucket).Put(ctx, h.Catalog, h.Key, []byte(body)); err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		if err := c.WriteNotify(ctx, h); err != nil {
+			t.Fatalf("WriteNotify: %v", err)
+		}
+	}
+
+	v1 := New(prefix, rdb, resolve)
+	defer v1.Close()
+	v2 := New(prefix, rdb, resolve, WithTsSeqVersion(TsSeqV2), WithSnapTarget("mem", "snaps"))
+	defer v2.Close()
+	write(v1, "/a", `1`)
+	write(v2, "/a", `2`)
+	write(v2, "/b", `3`)
+	list := v2.List(ctx, "users")
+	if len(list.Entries) != 3 || list.Entries[0].TsSeq.Version() != TsSeqV1 ||
+		list.Entries[1].TsSeq.Version() != TsSeqV2 || list.Entries[2].TsSeq.Version() != TsSeqV2 {
+		t.Fatalf("entries = %+v", list.Entries)
+	}
+	if got, err := ReadString(ctx, list); err != nil || got != `{"a":2,"b":3}` {
+		t.Fatalf("read = %q (err=%v)", got, err)
+	}
+	stop := list.NextSnap().StopTsSeq
+	if stop != list.Entries[2].TsSeq || !waitFor(func() bool {
+		snap, _ := v2.reader.GetLatestSnap(ctx, "users")
+		return snap != nil && snap.StopTsSeq == stop
+	}) {
+		t.Fatalf("snapshot at %v was not indexed within timeout", stop)
+	}
+
+	write(v1, "/c", `4`)
+	list = v1.List(ctx, "users")
+	if len(list.Entries) != 1 || list.Entries[0].TsSeq.Version() != TsSeqV2 {
+		t.Fatalf("TsSeqV1 writer on a TsSeqV2 catalog: entries = %+v", list.Entries)
+	}
+	if ok, err := v1.RemoveDelta(ctx, "users", list.Entries[0].TsSeq.String()); err != nil || !ok {
+		t.Fatalf("RemoveDelta(%s) = %v (err=%v)", list.Entries[0].TsSeq, ok, err)
+	}
+	if got, err := ReadString(ctx, v1.List(ctx, "users")); err != nil || got != `{"a":2,"b":3}` {
+		t.Fatalf("read after removal = %q (err=%v)", got, err)
+	}
+
+	memc := NewWithIndex("edge", NewMemoryIndex(), resolve, WithTsSeqVersion(TsSeqV2))
+	defer memc.Close()
+	write(memc, "/a", `1`)
+	if e := memc.List(ctx, "users").Entries; len(e) != 1 || e[0].TsSeq.Version() != TsSeqV2 {
+		t.Fatalf("memory index entries = %+v", e)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("WithTsSeqVersion(3) did not panic")
+		}
+	}()
+	WithTsSeqVersion(3)
+}
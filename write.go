@@ -10,8 +10,10 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hkloudou/lake/v3/internal/index"
 	"github.com/hkloudou/lake/v3/internal/objkey"
 	"github.com/hkloudou/lake/v3/internal/utils"
 	"github.com/hkloudou/lake/v3/storage"
@@ -24,6 +26,10 @@ var ErrPresignNotSupported = storage.ErrPresignNotSupported
 // defaultUploadTTL is the signed-URL validity; override via WithUploadTTL.
 const defaultUploadTTL = 15 * time.Minute
 
+// contentPinGrace pads a content-addressed handle's GC pin past its upload
+// TTL, covering the WriteNotify that arrives just before the handle expires.
+const contentPinGrace = time.Minute
+
 // WriteBeginRequest describes a write that is about to happen. The caller picks
 // where the body lands per-write via Provider + Bucket; that location is
 // recorded in the delta (as provider://bucket/path), so a catalog's deltas may
@@ -34,6 +40,19 @@ type WriteBeginRequest struct {
 	MergeType MergeType `json:"mergeType"` // Replace or RFC7396
 	Provider  string    `json:"provider"`  // storage provider, e.g. "oss", "cos"
 	Bucket    string    `json:"bucket"`    // target bucket
+	// ContentSHA256 selects content-addressed mode: the hex SHA-256 of the
+	// body about to be uploaded. The object path is derived from it
+	// (objkey.ContentDeltaPath) instead of a fresh UUID, so identical bodies
+	// written to one catalog share one object — one upload, one cached copy.
+	// When the object already exists the handle comes back with Exists set
+	// and no upload URL. Empty keeps the default one-object-per-write mode.
+	ContentSHA256 string `json:"contentSHA256,omitempty"`
+	// TTL gives the catalog a sliding time-to-live (see Client.SetExpiry)
+	// once the upload is signed (and a content object pinned), so a failed
+	// WriteBegin leaves the policy as is; each WriteNotify then moves the
+	// deadline. It must not be shorter than the upload TTL, or the catalog
+	// could expire before the write lands. 0 leaves the policy as is.
+	TTL time.Duration `json:"ttl,omitempty"`
 }
 
 // WriteHandle is what WriteBegin returns and WriteNotify consumes. It carries
@@ -44,7 +63,7 @@ type WriteHandle struct {
 	Catalog       string            `json:"catalog"`
 	Path          string            `json:"path"`
 	MergeType     MergeType         `json:"mergeType"`
-	UUID          string            `json:"uuid"`
+	UUID          string            `json:"uuid"` // empty on a content-addressed handle
 	Provider      string            `json:"provider"`
 	Bucket        string            `json:"bucket"`
 	Key           string            `json:"key"` // object path within the bucket
@@ -53,6 +72,13 @@ type WriteHandle struct {
 	UploadMethod  string            `json:"uploadMethod"`
 	UploadHeaders map[string]string `json:"uploadHeaders"`
 	ExpiresAt     int64             `json:"expiresAt"` // unix seconds
+	// ContentSHA256 is the body hash of a content-addressed handle (see
+	// WriteBeginRequest.ContentSHA256); the backend, where it can, rejects
+	// an upload that does not match it.
+	ContentSHA256 string `json:"contentSHA256,omitempty"`
+	// Exists reports that the content-addressed object is already stored:
+	// UploadURL is empty — skip the upload and go straight to WriteNotify.
+	Exists bool `json:"exists,omitempty"`
 	// Signature authenticates the handle's identity fields when the Client
 	// was built WithHandleSecret; empty otherwise. Clients must echo it back
 	// unchanged.
@@ -81,6 +107,14 @@ func WithUploadContentType(ct string) WriteBeginOption {
 // against the requested (Provider, Bucket) for direct client upload. The
 // resulting URI (provider://bucket/path) is returned in the handle and
 // recorded by WriteNotify.
+//
+// With req.ContentSHA256 set, the path is derived from the body hash
+// instead, and the object is pinned against GC for the handle's lifetime
+// (one Redis call). The backend must be able to bind the hash into the
+// signed upload; otherwise WriteBegin fails with
+// storage.ErrContentSHA256NotSupported. If the backend implements
+// storage.Stater and the object is already there, the handle carries no URL
+// and reports Exists.
 func (c *Client) WriteBegin(ctx context.Context, req WriteBeginRequest, opts ...WriteBeginOption) (*WriteHandle, error) {
 	if c.hasHandlers() {
 		c.emitEvent(req.Catalog, "WriteBegin", map[string]any{
@@ -99,6 +133,12 @@ func (c *Client) WriteBegin(ctx context.Context, req WriteBeginRequest, opts ...
 	if req.MergeType < MergeTypeReplace || req.MergeType > MergeTypeRFC7396 {
 		return nil, fmt.Errorf("invalid mergeType: %d", req.MergeType)
 	}
+	if req.ContentSHA256 != "" {
+		req.ContentSHA256 = strings.ToLower(req.ContentSHA256)
+		if !isLowerHex(req.ContentSHA256, sha256.Size*2) {
+			return nil, fmt.Errorf("invalid contentSHA256 %q (want %d hex chars)", req.ContentSHA256, sha256.Size*2)
+		}
+	}
 	if req.Provider == "" || req.Bucket == "" {
 		return nil, errors.New("WriteBegin requires Provider and Bucket")
 	}
@@ -133,14 +173,30 @@ func (c *Client) WriteBegin(ctx context.Context, req WriteBeginRequest, opts ...
 		// otherwise round to an already-expired handle.
 		o.ttl = time.Second
 	}
+	var expirer index.CatalogExpirer
+	if req.TTL != 0 {
+		if req.TTL < o.ttl {
+			return nil, fmt.Errorf("catalog ttl %v shorter than the upload ttl %v", req.TTL, o.ttl)
+		}
+		if expirer, ok = c.idx.(index.CatalogExpirer); !ok {
+			return nil, fmt.Errorf("set expiry: %w", ErrIndexNotSupported)
+		}
+	}
 
-	uuid, err := newUUID()
-	if err != nil {
-		return nil, fmt.Errorf("generate uuid: %w", err)
+	var uuid, key string
+	if req.ContentSHA256 != "" {
+		key = objkey.ContentDeltaPath(req.Catalog, req.ContentSHA256)
+	} else {
+		if uuid, err = newUUID(); err != nil {
+			return nil, fmt.Errorf("generate uuid: %w", err)
+		}
+		key = objkey.DeltaPath(req.Catalog, uuid)
 	}
-	key := objkey.DeltaPath(req.Catalog, uuid)
 	uri := objkey.BuildURI(req.Provider, req.Bucket, key)
 
+	// Sign first, in content mode too: a backend that cannot have the store
+	// verify the hash refuses here, before anything trusts an object at the
+	// hash's path.
 	upload, err := presigner.PresignPut(ctx, req.Catalog, key, storage.PresignOptions{
 		TTL:         o.ttl,
 		ContentType: o.contentType,
@@ -149,16 +205,43 @@ func (c *Client) WriteBegin(ctx context.Context, req WriteBeginRequest, opts ...
 			"path":       req.Path,
 			"merge-type": strconv.Itoa(int(req.MergeType)),
 		},
+		ContentSHA256: req.ContentSHA256,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("presign put: %w", err)
 	}
+	exists := false
+	if req.ContentSHA256 != "" {
+		// Pin BEFORE probing: once the probe says "exists", a GC run that
+		// absorbed the object's previous writers must not delete it before
+		// this write's Notify records a new reference. (GC runs on the Redis
+		// index only; on any other there is nothing to pin against.)
+		if c.writer != nil {
+			if err := c.pinContent(ctx, req.Catalog, key, int64((o.ttl+contentPinGrace)/time.Second)); err != nil {
+				return nil, fmt.Errorf("pin content object: %w", err)
+			}
+		}
+		if stater, ok := st.(storage.Stater); ok {
+			// Best-effort: any probe failure just means "upload it".
+			_, serr := stater.Stat(ctx, req.Catalog, key)
+			exists = serr == nil
+		}
+		if exists {
+			upload = storage.PresignedUpload{}
+		}
+	}
+	// The policy goes on last, so a WriteBegin that fails leaves it as is.
+	if expirer != nil {
+		if err := expirer.SetExpiry(ctx, req.Catalog, req.TTL); err != nil {
+			return nil, err
+		}
+	}
 	// Close the startup window before stamping ExpiresAt: until the first
 	// clock sync lands, NowUnix is the LOCAL clock, while the WriteNotify
 	// end (possibly another, long-running host) checks against the Redis
 	// clock — host skew would then shift the effective TTL. One synchronous
 	// sync on the first pre-sync WriteBegin; best-effort, no new failure mode.
-	c.reader.EnsureClock(ctx)
+	c.ensureClock(ctx)
 	h := &WriteHandle{
 		Catalog:       req.Catalog,
 		Path:          req.Path,
@@ -175,7 +258,9 @@ func (c *Client) WriteBegin(ctx context.Context, req WriteBeginRequest, opts ...
 		// round-trip across machines, and WriteNotify may run on a different
 		// host — both ends must measure expiry against the same clock (the
 		// ~5s sync resolution is noise next to the minutes-scale TTL).
-		ExpiresAt: c.reader.NowUnix() + int64(o.ttl/time.Second),
+		ExpiresAt:     c.idx.NowUnix() + int64(o.ttl/time.Second),
+		ContentSHA256: req.ContentSHA256,
+		Exists:        exists,
 	}
 	if len(c.handleSecret) > 0 {
 		h.Signature = c.signHandle(h)
@@ -185,12 +270,18 @@ func (c *Client) WriteBegin(ctx context.Context, req WriteBeginRequest, opts ...
 
 // signHandle computes the HMAC-SHA256 over the handle's identity fields —
 // exactly the ones WriteNotify acts on plus ExpiresAt. The payload is a JSON
-// string array, so no field value can forge a boundary into a neighbour.
+// string array, so no field value can forge a boundary into a neighbour. A
+// content-addressed handle appends its hash; UUID handles keep the original
+// six-field payload, so handles signed before the field existed still verify.
 func (c *Client) signHandle(h *WriteHandle) string {
-	payload, _ := json.Marshal([6]string{
+	fields := []string{
 		h.Catalog, h.Path, strconv.Itoa(int(h.MergeType)),
 		h.UUID, h.URI, strconv.FormatInt(h.ExpiresAt, 10),
-	})
+	}
+	if h.ContentSHA256 != "" {
+		fields = append(fields, h.ContentSHA256)
+	}
+	payload, _ := json.Marshal(fields)
 	mac := hmac.New(sha256.New, c.handleSecret)
 	mac.Write(payload)
 	return hex.EncodeToString(mac.Sum(nil))
@@ -208,6 +299,11 @@ func (c *Client) signHandle(h *WriteHandle) string {
 // HMAC signature over the identity fields, pinning Path / MergeType /
 // ExpiresAt to what WriteBegin issued.
 //
+// A content-addressed handle is bound the same way, to the path its hash
+// derives; and since its client may have skipped the upload (Exists), Notify
+// first confirms the object is stored when the backend implements
+// storage.Stater, failing with storage.ErrNotFound otherwise — begin again.
+//
 // Notify is NOT idempotent — duplicate calls produce duplicate deltas (each
 // with its own tsSeq, all referencing the same URI). For Replace / RFC7396,
 // applying the same body twice is benign; nevertheless, callers should retry
@@ -231,8 +327,17 @@ func (c *Client) WriteNotify(ctx context.Context, h *WriteHandle) error {
 	if h.MergeType < MergeTypeReplace || h.MergeType > MergeTypeRFC7396 {
 		return fmt.Errorf("invalid mergeType: %d", h.MergeType)
 	}
-	if !isUUIDHex(h.UUID) {
-		return fmt.Errorf("invalid uuid in handle: %q", h.UUID)
+	var want string // the only object path this handle may name
+	if h.ContentSHA256 != "" {
+		if h.UUID != "" || !isLowerHex(h.ContentSHA256, sha256.Size*2) {
+			return fmt.Errorf("invalid content-addressed handle (uuid %q, sha256 %q)", h.UUID, h.ContentSHA256)
+		}
+		want = objkey.ContentDeltaPath(h.Catalog, h.ContentSHA256)
+	} else {
+		if !isLowerHex(h.UUID, 32) {
+			return fmt.Errorf("invalid uuid in handle: %q", h.UUID)
+		}
+		want = objkey.DeltaPath(h.Catalog, h.UUID)
 	}
 	if h.URI == "" {
 		return errors.New("empty URI in handle")
@@ -251,7 +356,7 @@ func (c *Client) WriteNotify(ctx context.Context, h *WriteHandle) error {
 	if err := utils.ValidateStorageBucket(bucket); err != nil {
 		return err
 	}
-	if want := objkey.DeltaPath(h.Catalog, h.UUID); path != want {
+	if path != want {
 		return fmt.Errorf("handle URI path %q does not match catalog/uuid (want %q)", path, want)
 	}
 	if len(c.handleSecret) > 0 {
@@ -269,13 +374,61 @@ func (c *Client) WriteNotify(ctx context.Context, h *WriteHandle) error {
 		// shift the effective TTL. EnsureClock mirrors WriteBegin's: a
 		// notify-only host must not judge expiry on its local clock during
 		// its own pre-first-sync window.
-		c.reader.EnsureClock(ctx)
-		if now := c.reader.NowUnix(); now > h.ExpiresAt {
+		c.ensureClock(ctx)
+		if now := c.idx.NowUnix(); now > h.ExpiresAt {
 			return fmt.Errorf("handle expired at %d (now %d)", h.ExpiresAt, now)
 		}
 	}
-	_, _, err = c.writer.Notify(ctx, h.Catalog, h.Path, h.MergeType, h.URI)
-	return err
+	if h.ContentSHA256 != "" {
+		st, err := c.storageFor(storage.Delta, provider, bucket)
+		if err != nil {
+			return err
+		}
+		// The client may have skipped the upload on WriteBegin's say-so;
+		// without a Stater, read the object and check its hash instead.
+		if stater, ok := st.(storage.Stater); ok {
+			if _, err := stater.Stat(ctx, h.Catalog, path); err != nil {
+				return fmt.Errorf("content object %s: %w", h.URI, err)
+			}
+		} else {
+			data, err := st.Get(ctx, h.Catalog, path)
+			if err != nil {
+				return fmt.Errorf("content object %s: %w", h.URI, err)
+			}
+			if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != h.ContentSHA256 {
+				return fmt.Errorf("content object %s does not match its SHA-256", h.URI)
+			}
+		}
+	}
+	id, member, err := c.idx.Notify(ctx, h.Catalog, h.Path, h.MergeType, h.URI)
+	if err != nil {
+		return err
+	}
+	if c.manifest != nil {
+		c.manifest.append(h.Catalog, manifestRecord{Op: "add", TsSeq: id.String(), Member: member})
+	}
+	return nil
+}
+
+// contentPinWait is how long pinContent waits out a GC delete mark.
+const contentPinWait = 2 * time.Second
+
+// pinContent pins a content-addressed object, waiting while GC is deleting
+// it: once GC has deleted and released it, the pin holds, and WriteBegin's
+// probe then finds it gone and hands out an upload.
+func (c *Client) pinContent(ctx context.Context, catalog, key string, ttlSeconds int64) error {
+	deadline := time.Now().Add(contentPinWait)
+	for {
+		err := c.writer.PinObject(ctx, catalog, key, ttlSeconds)
+		if !errors.Is(err, index.ErrObjectDeleting) || time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
 }
 
 // newUUID returns a UUID v4 string (32 hex chars, no hyphens).
@@ -289,11 +442,12 @@ func newUUID() (string, error) {
 	return hex.EncodeToString(b[:]), nil
 }
 
-// isUUIDHex reports whether s is exactly the form newUUID emits: 32 lowercase
-// hex chars. WriteNotify uses it to keep a client-supplied UUID from smuggling
-// path segments into the recomputed delta path.
-func isUUIDHex(s string) bool {
-	if len(s) != 32 {
+// isLowerHex reports whether s is exactly n lowercase hex chars — the form
+// newUUID emits (n = 32) and a content hash takes (n = 64). WriteNotify uses
+// it to keep a client-supplied UUID or hash from smuggling path segments
+// into the recomputed delta path.
+func isLowerHex(s string, n int) bool {
+	if len(s) != n {
 		return false
 	}
 	for i := 0; i < len(s); i++ {
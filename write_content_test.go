@@ -0,0 +1,301 @@
+package lake
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hkloudou/lake/v3/internal/objkey"
+	"github.com/hkloudou/lake/v3/storage"
+	"github.com/hkloudou/lake/v3/storage/mem"
+)
+
+func sha256Hex(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentTestClient serves mem's signed-upload handler (which enforces the
+// signed body hash) and resolves every bucket to the presign-enabled store,
+// which has Stat and Delete as well.
+func contentTestClient(t *testing.T, prefix string) (*Client, *mem.Store, func(h *WriteHandle, body string) int) {
+	t.Helper()
+	rdb := redisTestDB(t, 13)
+	cleanupKeys(t, rdb, prefix+":*")
+	store := mem.New()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	if err := store.EnablePresign(srv.URL+"/uploads", []byte("upload-secret")); err != nil {
+		t.Fatal(err)
+	}
+	mux.Handle("/uploads/", store.UploadHandler())
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return store.Bucket(bucket), nil
+	}
+	upload := func(h *WriteHandle, body string) int {
+		t.Helper()
+		req, _ := http.NewRequest(h.UploadMethod, h.UploadURL, strings.NewReader(body))
+		for k, v := range h.UploadHeaders {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("upload: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	return New(prefix, rdb, resolve, WithSnapTarget("mem", "snaps")), store, upload
+}
+
+// TestWriteContentAddressed_Redis: identical bodies share one object — the
+// second WriteBegin finds it via Stat and hands back Exists with no URL —
+// and both writes read back as separate deltas.
+func TestWriteContentAddressed_Redis(t *testing.T) {
+	c, store, upload := contentTestClient(t, testPrefix(t))
+	ctx := context.Background()
+	body := `{"theme":"dark"}`
+	req := WriteBeginRequest{
+		Catalog: "users", Path: "/settings", MergeType: MergeTypeReplace,
+		Provider: "mem", Bucket: "data", ContentSHA256: strings.ToUpper(sha256Hex(body)),
+	}
+
+	h1, err := c.WriteBegin(ctx, req)
+	if err != nil {
+		t.Fatalf("WriteBegin: %v", err)
+	}
+	if h1.Exists || h1.UploadURL == "" || h1.UUID != "" || h1.ContentSHA256 != sha256Hex(body) {
+		t.Fatalf("first handle = %+v, want a fresh upload with the normalised hash", h1)
+	}
+	if h1.Key != objkey.ContentDeltaPath("users", sha256Hex(body)) {
+		t.Fatalf("key = %q, want the content-addressed path", h1.Key)
+	}
+	// The signed hash is enforced by the upload handler.
+	if code := upload(h1, `{"theme":"light"}`); code != http.StatusBadRequest {
+		t.Fatalf("mismatching body: status %d, want 400", code)
+	}
+	if code := upload(h1, body); code != http.StatusOK {
+		t.Fatalf("upload: status %d", code)
+	}
+	if err := c.WriteNotify(ctx, h1); err != nil {
+		t.Fatalf("WriteNotify: %v", err)
+	}
+
+	h2, err := c.WriteBegin(ctx, req)
+	if err != nil {
+		t.Fatalf("second WriteBegin: %v", err)
+	}
+	if !h2.Exists || h2.UploadURL != "" || h2.URI != h1.URI {
+		t.Fatalf("second handle = %+v, want Exists on the same URI", h2)
+	}
+	if err := c.WriteNotify(ctx, h2); err != nil {
+		t.Fatalf("second WriteNotify: %v", err)
+	}
+
+	list := c.List(ctx, "users")
+	if list.Err != nil || len(list.Entries) != 2 || list.Entries[0].URI != list.Entries[1].URI {
+		t.Fatalf("list = %+v (err %v), want two deltas on one URI", list.Entries, list.Err)
+	}
+	got, err := ReadString(ctx, list)
+	if err != nil || got != `{"settings":{"theme":"dark"}}` {
+		t.Fatalf("ReadString = %s, %v", got, err)
+	}
+	objs, _, _ := store.Bucket("data").(storage.Lister).List(ctx, "users", "", "")
+	if len(objs) != 1 {
+		t.Fatalf("data bucket holds %d objects, want 1", len(objs))
+	}
+	waitFor(func() bool { s, _ := c.reader.GetLatestSnap(ctx, "users"); return s != nil })
+}
+
+// TestWriteContentAddressed_NotifyRequiresObject: a client that claims
+// Exists without the object being there is refused before anything is
+// recorded; tampering with the hash breaks the path binding.
+func TestWriteContentAddressed_NotifyRequiresObject(t *testing.T) {
+	c, _, _ := contentTestClient(t, testPrefix(t))
+	ctx := context.Background()
+	h, err := c.WriteBegin(ctx, WriteBeginRequest{
+		Catalog: "users", Path: "/", MergeType: MergeTypeReplace,
+		Provider: "mem", Bucket: "data", ContentSHA256: sha256Hex("never uploaded"),
+	})
+	if err != nil {
+		t.Fatalf("WriteBegin: %v", err)
+	}
+	if err := c.WriteNotify(ctx, h); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Notify without upload: %v, want ErrNotFound", err)
+	}
+	if list := c.List(ctx, "users"); list.Exist() {
+		t.Fatal("refused Notify recorded a delta")
+	}
+
+	tampered := *h
+	tampered.ContentSHA256 = sha256Hex("other")
+	if err := c.WriteNotify(ctx, &tampered); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("tampered hash: %v, want a path mismatch", err)
+	}
+	mixed := *h
+	mixed.UUID = "0123456789abcdef0123456789abcdef"
+	if err := c.WriteNotify(ctx, &mixed); err == nil || !strings.Contains(err.Error(), "content-addressed") {
+		t.Fatalf("uuid + hash: %v, want rejection", err)
+	}
+}
+
+func TestWriteBegin_RejectsMalformedContentSHA256(t *testing.T) {
+	c := newDeadClient(t)
+	for _, sum := range []string{"abc", strings.Repeat("g", 64), strings.Repeat("a", 63) + "/"} {
+		_, err := c.WriteBegin(context.Background(), WriteBeginRequest{
+			Catalog: "users", Path: "/", MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data", ContentSHA256: sum,
+		})
+		if err == nil || !strings.Contains(err.Error(), "contentSHA256") {
+			t.Errorf("ContentSHA256 %q: err = %v, want rejection", sum, err)
+		}
+	}
+}
+
+// TestGC_SparesPinnedContentObject: a content-addressed object whose only
+// recorded reference was absorbed is still spared while a WriteBegin that
+// found it (Exists) has not notified yet.
+func TestGC_SparesPinnedContentObject(t *testing.T) {
+	c, store, upload := contentTestClient(t, testPrefix(t))
+	ctx := context.Background()
+	body := `1`
+	req := WriteBeginRequest{
+		Catalog: "users", Path: "/a", MergeType: MergeTypeReplace,
+		Provider: "mem", Bucket: "data", ContentSHA256: sha256Hex(body),
+	}
+	h, err := c.WriteBegin(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := upload(h, body); code != http.StatusOK {
+		t.Fatalf("upload: status %d", code)
+	}
+	if err := c.WriteNotify(ctx, h); err != nil {
+		t.Fatal(err)
+	}
+	list := c.List(ctx, "users")
+	if _, err := ReadString(ctx, list); err != nil {
+		t.Fatal(err)
+	}
+	stop := list.NextSnap().StopTsSeq
+	if !waitFor(func() bool { s, _ := c.reader.GetLatestSnap(ctx, "users"); return s != nil && s.StopTsSeq == stop }) {
+		t.Fatal("snapshot was not indexed within timeout")
+	}
+
+	pending, err := c.WriteBegin(ctx, req) // pins the object; Notify comes later
+	if err != nil || !pending.Exists {
+		t.Fatalf("pending WriteBegin = %+v, %v", pending, err)
+	}
+	rep, err := c.GC(ctx, "users", GCOptions{})
+	if err != nil {
+		t.Fatalf("GC: %v", err)
+	}
+	if rep.DeltaObjects != 0 || rep.IndexEntries != 1 {
+		t.Fatalf("report = %+v, want the index entry trimmed and the object spared", rep)
+	}
+	if _, err := store.Bucket("data").Get(ctx, "users", h.Key); err != nil {
+		t.Fatalf("pinned object was deleted: %v", err)
+	}
+	if err := c.WriteNotify(ctx, pending); err != nil {
+		t.Fatalf("late WriteNotify: %v", err)
+	}
+	got, err := ReadString(ctx, c.List(ctx, "users"))
+	if err != nil || got != `{"a":1}` {
+		t.Fatalf("ReadString = %s, %v", got, err)
+	}
+	waitFor(func() bool { s, _ := c.reader.GetLatestSnap(ctx, "users"); return s != nil && s.StopTsSeq != stop })
+}
+
+// hashBlindBucket signs uploads like OSS: it cannot bind a body hash, so it
+// refuses one. It has no Stater either.
+type hashBlindBucket struct{ storage.Storage }
+
+func (hashBlindBucket) PresignPut(_ context.Context, _, _ string, opts storage.PresignOptions) (storage.PresignedUpload, error) {
+	if opts.ContentSHA256 != "" {
+		return storage.PresignedUpload{}, storage.ErrContentSHA256NotSupported
+	}
+	return storage.PresignedUpload{URL: "mem://upload", Method: "PUT"}, nil
+}
+
+// TestWriteContentAddressed_UnverifiableBackends: WriteBegin refuses a hash
+// the backend cannot have checked; without a Stater, WriteNotify reads the
+// object and checks it against the hash.
+func TestWriteContentAddressed_UnverifiableBackends(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+	store := mem.New()
+	ctx := context.Background()
+	req := WriteBeginRequest{
+		Catalog: "users", Path: "/a", MergeType: MergeTypeReplace,
+		Provider: "mem", Bucket: "data", ContentSHA256: sha256Hex(`1`),
+	}
+
+	blind := New(prefix, rdb, func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return hashBlindBucket{store.Bucket(bucket)}, nil
+	})
+	if _, err := blind.WriteBegin(ctx, req); !errors.Is(err, storage.ErrContentSHA256NotSupported) {
+		t.Fatalf("WriteBegin on a hash-blind backend: %v, want ErrContentSHA256NotSupported", err)
+	}
+
+	c := New(prefix, rdb, func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return presignBucket{store.Bucket(bucket)}, nil
+	})
+	h, err := c.WriteBegin(ctx, req)
+	if err != nil {
+		t.Fatalf("WriteBegin: %v", err)
+	}
+	if err := c.WriteNotify(ctx, h); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("Notify without upload: %v, want ErrNotFound", err)
+	}
+	if err := store.Bucket("data").Put(ctx, "users", h.Key, []byte(`2`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteNotify(ctx, h); err == nil || !strings.Contains(err.Error(), "SHA-256") {
+		t.Fatalf("Notify over the wrong bytes: %v, want a hash mismatch", err)
+	}
+	if err := store.Bucket("data").Put(ctx, "users", h.Key, []byte(`1`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteNotify(ctx, h); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+}
+
+// TestWriteBegin_WaitsOutGCDeleteMark: a WriteBegin for an object GC is
+// deleting waits for the delete mark to go, then pins.
+func TestWriteBegin_WaitsOutGCDeleteMark(t *testing.T) {
+	c, _, _ := contentTestClient(t, testPrefix(t))
+	ctx := context.Background()
+	key := objkey.ContentDeltaPath("users", sha256Hex(`1`))
+	if ok, err := c.writer.MarkObjectDeleting(ctx, "users", key, 60); err != nil || !ok {
+		t.Fatalf("MarkObjectDeleting = %v, %v", ok, err)
+	}
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		close(released)
+		c.writer.UnmarkObjectDeleting(ctx, "users", key)
+	}()
+	h, err := c.WriteBegin(ctx, WriteBeginRequest{
+		Catalog: "users", Path: "/a", MergeType: MergeTypeReplace,
+		Provider: "mem", Bucket: "data", ContentSHA256: sha256Hex(`1`),
+	})
+	select {
+	case <-released:
+	default:
+		t.Fatal("WriteBegin returned while the delete mark was held")
+	}
+	if err != nil || h.Exists || h.UploadURL == "" {
+		t.Fatalf("WriteBegin = %+v, %v; want a fresh upload", h, err)
+	}
+	if ok, err := c.reader.ObjectPinned(ctx, "users", key); err != nil || !ok {
+		t.Fatalf("object not pinned after the wait (pinned=%v err=%v)", ok, err)
+	}
+}
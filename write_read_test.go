@@ -2,6 +2,8 @@ package lake
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
@@ -84,6 +86,55 @@ func TestWriteReadRoundTrip_Redis(t *testing.T) {
 	}
 }
 
+// TestWriteReadHTTPUpload_Redis runs the write flow exactly as a production
+// client does — the body goes over HTTP to the presigned URL with the
+// handle's headers — against mem's built-in upload handler.
+func TestWriteReadHTTPUpload_Redis(t *testing.T) {
+	rdb := redisTestDB(t, 13)
+	prefix := testPrefix(t)
+	cleanupKeys(t, rdb, prefix+":*")
+
+	store := mem.New()
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	if err := store.EnablePresign(srv.URL+"/uploads", []byte("upload-secret")); err != nil {
+		t.Fatal(err)
+	}
+	mux.Handle("/uploads/", store.UploadHandler())
+	resolve := func(_ storage.Kind, _, bucket string) (storage.Storage, error) {
+		return store.Bucket(bucket), nil
+	}
+	c := New(prefix, rdb, resolve)
+	ctx := context.Background()
+
+	h, err := c.WriteBegin(ctx, WriteBeginRequest{
+		Catalog: "users", Path: "/", MergeType: MergeTypeReplace, Provider: "mem", Bucket: "data",
+	})
+	if err != nil {
+		t.Fatalf("WriteBegin: %v", err)
+	}
+	req, _ := http.NewRequest(h.UploadMethod, h.UploadURL, strings.NewReader(`{"name":"Alice"}`))
+	for k, v := range h.UploadHeaders {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload: status %d", resp.StatusCode)
+	}
+	if err := c.WriteNotify(ctx, h); err != nil {
+		t.Fatalf("WriteNotify: %v", err)
+	}
+	got, err := ReadString(ctx, c.List(ctx, "users"))
+	if err != nil || got != `{"name":"Alice"}` {
+		t.Fatalf("ReadString = %s, %v", got, err)
+	}
+}
+
 // TestReadBytesMutationDoesNotCorruptSnapshot pins the isolation between the
 // bytes ReadBytes hands the caller and the bytes the async snapshot save
 // persists: the caller owns its slice and may mutate it immediately, and the